@@ -0,0 +1,88 @@
+package hydrate
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Access describes whether the current AWS principal can read a parameter.
+type Access struct {
+	Parameter string
+	Readable  bool
+	Reason    string // Why the parameter can't be read.
+}
+
+// CheckAccess reports which of the parameters the current AWS principal can
+// and cannot read, including KMS decryption. The fetched values are discarded.
+func (p *ssmProvider) CheckAccess(ctx context.Context, paths []string) ([]Access, error) {
+	var access []Access
+
+	// GetParameters accepts up to 10 names per call.
+	for len(paths) > 0 {
+		names := paths
+		if len(names) > 10 {
+			names = names[:10]
+		}
+		paths = paths[len(names):]
+
+		out, err := p.ssm.GetParameters(ctx, &ssm.GetParametersInput{
+			Names:          names,
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			if apiErrorCode(err) != "AccessDeniedException" {
+				return nil, p.explainError(ctx, err, "")
+			}
+			// The whole batch is denied if any of the parameters is,
+			// so find out which one(s).
+			for _, name := range names {
+				access = append(access, p.checkAccess(ctx, name))
+			}
+			continue
+		}
+
+		invalid := map[string]bool{}
+		for _, name := range out.InvalidParameters {
+			invalid[name] = true
+		}
+		for _, name := range names {
+			if invalid[name] {
+				access = append(access, Access{Parameter: name, Reason: "parameter doesn't exist"})
+			} else {
+				access = append(access, Access{Parameter: name, Readable: true})
+			}
+		}
+	}
+
+	return access, nil
+}
+
+func (p *ssmProvider) checkAccess(ctx context.Context, name string) Access {
+	_, err := p.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return Access{Parameter: name, Reason: p.explainError(ctx, err, name).Error()}
+	}
+	return Access{Parameter: name, Readable: true}
+}
+
+// Exists reports which of the parameters exist, without reading their values.
+// Versions and labels of pinned references aren't checked, see Versions.
+func (p *ssmProvider) Exists(ctx context.Context, paths []string) (map[string]bool, error) {
+	exists := map[string]bool{}
+	names, refs := referencesByName(paths)
+	err := p.describeParameters(ctx, names, func(param types.ParameterMetadata) {
+		for _, path := range refs[aws.ToString(param.Name)] {
+			exists[path] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exists, nil
+}
@@ -0,0 +1,96 @@
+package hydrate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckAccess(t *testing.T) {
+	params := map[string]string{}
+	var paths []string
+	for i := 0; i < 24; i++ {
+		name := fmt.Sprintf("/app/param_%02d", i)
+		params[name] = "value"
+		paths = append(paths, name)
+	}
+	paths = append(paths, "/app/missing")
+
+	f, svc := newFakeSSM(t, params)
+	f.fails = map[string]apiFailure{
+		"/app/param_12": {"AccessDeniedException", "denied"},
+	}
+
+	access, err := SSMProvider(svc).CheckAccess(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []Access
+	for _, path := range paths {
+		switch path {
+		case "/app/param_12":
+			expected = append(expected, Access{Parameter: path, Reason: `AccessDeniedException: access to "/app/param_12" denied, allow "ssm:GetParameter" on it`})
+		case "/app/missing":
+			expected = append(expected, Access{Parameter: path, Reason: "parameter doesn't exist"})
+		default:
+			expected = append(expected, Access{Parameter: path, Readable: true})
+		}
+	}
+	if !reflect.DeepEqual(access, expected) {
+		t.Errorf("expected %+v, got %+v", expected, access)
+	}
+
+	// 3 batches of up to 10 names; the denied batch is checked one by one.
+	if n := f.called("GetParameters"); n != 3 {
+		t.Errorf("expected 3 GetParameters calls, got %v", n)
+	}
+	if n := f.called("GetParameter"); n != 10 {
+		t.Errorf("expected 10 GetParameter calls, got %v", n)
+	}
+}
+
+func TestCheckAccessError(t *testing.T) {
+	f, svc := newFakeSSM(t, map[string]string{"/app/a": "value"})
+	f.fails = map[string]apiFailure{"/app/a": {"ExpiredTokenException", "expired"}}
+
+	_, err := SSMProvider(svc).CheckAccess(context.Background(), []string{"/app/a"})
+	if err == nil || !strings.Contains(err.Error(), "AWS credentials have expired") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	params := map[string]string{}
+	var paths []string
+	for i := 0; i < 120; i++ {
+		name := fmt.Sprintf("/app/param_%03d", i)
+		if i%3 != 0 {
+			params[name] = "value"
+		}
+		paths = append(paths, name)
+	}
+	// Pinned references exist if their parameter does.
+	paths = append(paths, "/app/param_001:1", "/app/param_002#prod", "/app/param_003:1")
+
+	f, svc := newFakeSSM(t, params)
+	exists, err := SSMProvider(svc).Exists(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		name, _ := parameterSelector(path)
+		if _, ok := params[name]; exists[path] != ok {
+			t.Errorf("%v: expected exists %v, got %v", path, ok, exists[path])
+		}
+	}
+	// Chunks of up to 50 names.
+	if n := f.called("DescribeParameters"); n < 3 {
+		t.Errorf("expected at least 3 DescribeParameters calls, got %v", n)
+	}
+	if n := f.called("GetParameter") + f.called("GetParameters"); n != 0 {
+		t.Errorf("expected no values to be read, got %v calls", n)
+	}
+}
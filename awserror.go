@@ -0,0 +1,197 @@
+package hydrate
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+// hintError is an AWS error translated into a human-actionable message.
+type hintError struct {
+	err  smithy.APIError
+	hint string
+	key  string // Of ParameterNotFound errors, see suggest.
+}
+
+func (e *hintError) Error() string {
+	return fmt.Sprintf("%v: %v", e.err.ErrorCode(), e.hint)
+}
+
+// Cause returns the original AWS error, see github.com/pkg/errors.
+func (e *hintError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the original AWS error, ie. for IsThrottled.
+func (e *hintError) Unwrap() error {
+	return e.err
+}
+
+// Is reports ParameterNotFound errors as ErrNotFound.
+func (e *hintError) Is(target error) bool {
+	return target == ErrNotFound && e.err.ErrorCode() == "ParameterNotFound"
+}
+
+// apiErrorCode returns the error code of AWS API errors, ie. "ParameterNotFound",
+// or "" for other errors.
+func apiErrorCode(err error) string {
+	var aerr smithy.APIError
+	if errors.As(err, &aerr) {
+		return aerr.ErrorCode()
+	}
+	return ""
+}
+
+var accessDeniedRe = regexp.MustCompile(`(\S+) is not authorized to perform: (\S+) on resource: (\S+)`)
+
+// explainError translates common AWS errors that occurred while fetching
+// the key parameter into messages with suggested fixes. Unknown errors are
+// returned as they are.
+func (p *ssmProvider) explainError(ctx context.Context, err error, key string) error {
+	var aerr smithy.APIError
+	if !errors.As(err, &aerr) {
+		return err
+	}
+
+	switch aerr.ErrorCode() {
+	case "ExpiredToken", "ExpiredTokenException", "RequestExpired":
+		return &hintError{err: aerr, hint: "AWS credentials have expired, refresh them (ie. `aws sso login` or re-assume the IAM role) and try again"}
+
+	case "UnrecognizedClientException", "InvalidClientTokenId":
+		return &hintError{err: aerr, hint: "AWS credentials are invalid, check $AWS_PROFILE / $AWS_ACCESS_KEY_ID and that the region is enabled for your account"}
+
+	case "ThrottlingException", "TooManyUpdates":
+		return &hintError{err: aerr, hint: "AWS SSM API rate limit exceeded even after retries, wait a minute and try again or enable higher throughput for Parameter Store"}
+
+	case "AccessDeniedException":
+		if m := accessDeniedRe.FindStringSubmatch(aerr.ErrorMessage()); m != nil {
+			principal, action, resource := m[1], m[2], m[3]
+			if strings.HasPrefix(action, "kms:") {
+				return &hintError{err: aerr, hint: fmt.Sprintf("%v can't use KMS key %v to decrypt %q, allow %q in the key policy or IAM policy", principal, resource, key, action)}
+			}
+			return &hintError{err: aerr, hint: fmt.Sprintf("%v is missing IAM permission, allow %q on %q", principal, action, resource)}
+		}
+		if strings.Contains(aerr.ErrorMessage(), "KMS") || strings.Contains(aerr.ErrorMessage(), "kms") {
+			return &hintError{err: aerr, hint: fmt.Sprintf("can't decrypt %q, allow \"kms:Decrypt\" on the parameter's KMS key", key)}
+		}
+		return &hintError{err: aerr, hint: fmt.Sprintf("access to %q denied, allow \"ssm:GetParameter\" on it", key)}
+
+	case "ParameterNotFound":
+		return &hintError{err: aerr, hint: fmt.Sprintf("parameter %q doesn't exist", key), key: key}
+
+	case "ParameterVersionNotFound":
+		return &hintError{err: aerr, hint: fmt.Sprintf("version of %q doesn't exist, check the version/label of the reference or lock file", key)}
+	}
+
+	return err
+}
+
+// maxSuggestionPages bounds the GetParametersByPath calls listing the
+// parameters that similarParams suggests, of directories with many.
+const maxSuggestionPages = 3
+
+// suggest adds the closest parameter names to the error of a parameter that
+// doesn't exist in SSM, ie. of a typo. It's only called for misses failing
+// the hydration, not for references with defaults or tolerated by
+// SetMissing, as listing the parameters takes API calls.
+func (ps *paramStore) suggest(ctx context.Context, err error) error {
+	var herr *hintError
+	if !errors.As(err, &herr) || herr.key == "" {
+		return err
+	}
+	if p, ok := ps.provider.(*ssmProvider); ok {
+		if similar := p.similarParams(ctx, herr.key); len(similar) > 0 {
+			herr.hint += fmt.Sprintf(", did you mean %v?", strings.Join(similar, " or "))
+		}
+	}
+	return err
+}
+
+// similarParams returns up to three parameter names from the same
+// directory as key that are the closest to it, of up to maxSuggestionPages
+// pages of parameters listed within the rate limit.
+func (p *ssmProvider) similarParams(ctx context.Context, key string) []string {
+	var names []string
+	pages := ssm.NewGetParametersByPathPaginator(p.ssm, &ssm.GetParametersByPathInput{
+		Path:      aws.String(path.Dir(key)),
+		Recursive: aws.Bool(false),
+	})
+	for i := 0; i < maxSuggestionPages && pages.HasMorePages(); i++ {
+		if p.limiter != nil {
+			if err := p.limiter.wait(ctx); err != nil {
+				return nil
+			}
+		}
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil // Best effort only.
+		}
+		for _, param := range out.Parameters {
+			names = append(names, aws.ToString(param.Name))
+		}
+	}
+
+	maxDistance := len(path.Base(key))/3 + 1
+	distances := map[string]int{}
+	for _, name := range names {
+		if d := levenshtein(key, name); d <= maxDistance {
+			distances[name] = d
+		}
+	}
+
+	similar := make([]string, 0, len(distances))
+	for name := range distances {
+		similar = append(similar, name)
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		if distances[similar[i]] != distances[similar[j]] {
+			return distances[similar[i]] < distances[similar[j]]
+		}
+		return similar[i] < similar[j]
+	})
+	if len(similar) > 3 {
+		similar = similar[:3]
+	}
+	for i, name := range similar {
+		similar[i] = fmt.Sprintf("%q", name)
+	}
+	return similar
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
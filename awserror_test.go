@@ -0,0 +1,121 @@
+package hydrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExplainError(t *testing.T) {
+	tt := []struct {
+		key      string
+		fail     *apiFailure
+		expected string
+	}{
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"ExpiredTokenException", "The security token included in the request is expired"},
+			expected: "ExpiredTokenException: AWS credentials have expired",
+		},
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"UnrecognizedClientException", "The security token included in the request is invalid"},
+			expected: "AWS credentials are invalid",
+		},
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"AccessDeniedException", "User: arn:aws:iam::1:user/ci is not authorized to perform: ssm:GetParameter on resource: arn:aws:ssm:us-east-1:1:parameter/app/db_pass"},
+			expected: `arn:aws:iam::1:user/ci is missing IAM permission, allow "ssm:GetParameter" on "arn:aws:ssm:us-east-1:1:parameter/app/db_pass"`,
+		},
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"AccessDeniedException", "User: arn:aws:iam::1:user/ci is not authorized to perform: kms:Decrypt on resource: arn:aws:kms:us-east-1:1:key/k"},
+			expected: `can't use KMS key arn:aws:kms:us-east-1:1:key/k to decrypt "/app/db_pass", allow "kms:Decrypt"`,
+		},
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"AccessDeniedException", "The ciphertext refers to a KMS key you don't have access to"},
+			expected: `can't decrypt "/app/db_pass", allow "kms:Decrypt"`,
+		},
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"AccessDeniedException", "denied"},
+			expected: `access to "/app/db_pass" denied, allow "ssm:GetParameter" on it`,
+		},
+		{
+			key:      "/app/db_pass",
+			fail:     &apiFailure{"InternalServerError", "boom"},
+			expected: "InternalServerError: boom",
+		},
+		{
+			key:      "/app/db_pas",
+			expected: `ParameterNotFound: parameter "/app/db_pas" doesn't exist, did you mean "/app/db_pass"?`,
+		},
+		{
+			key:      "/app/unrelated",
+			expected: `ParameterNotFound: parameter "/app/unrelated" doesn't exist`,
+		},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/db_pass": "hunter2", "/app/api_key": "k3y"})
+		if tc.fail != nil {
+			f.fails = map[string]apiFailure{tc.key: *tc.fail}
+		}
+
+		_, err := ParamStore(svc, "/app").GetSecret(tc.key)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%v: expected error %q, got %v", tc.key, tc.expected, err)
+		}
+		if strings.Contains(tc.expected, "doesn't exist") && !strings.Contains(tc.expected, "did you mean") && strings.Contains(err.Error(), "did you mean") {
+			t.Errorf("%v: unexpected suggestion in %v", tc.key, err)
+		}
+	}
+}
+
+func TestSuggestionPages(t *testing.T) {
+	params := map[string]string{}
+	for i := 0; i < 100; i++ {
+		params[fmt.Sprintf("/app/param_%03d", i)] = "value"
+	}
+	f, svc := newFakeSSM(t, params)
+
+	_, err := ParamStore(svc, "/app").GetSecret("/app/param_1000")
+	if err == nil || !strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("expected a suggestion, got %v", err)
+	}
+	if n := f.called("GetParametersByPath"); n != maxSuggestionPages {
+		t.Errorf("expected %v GetParametersByPath calls, got %v", maxSuggestionPages, n)
+	}
+}
+
+func TestSuggestSimilarParams(t *testing.T) {
+	tt := []struct {
+		value   string
+		missing Missing
+		suggest string // Expected in the error, if any.
+		listed  bool
+	}{
+		{value: "$SECRET:/app/db_pas", suggest: `did you mean "/app/db_pass"?`, listed: true},
+		{value: "$SECRET:/app/unrelated", listed: true},
+		{value: "$SECRET:/app/db_pas|default"},
+		{value: "$SECRET?:/app/db_pas"},
+		{value: "$SECRET:/app/db_pas", missing: MissingEmpty},
+		{value: "$SECRET:/app/db_pas", missing: MissingKeep},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/db_pass": "hunter2"})
+		ps := ParamStore(svc, "/app")
+		ps.SetMissing(tc.missing)
+
+		_, err := ps.hydrateKeyValue(context.Background(), "db_pass", tc.value)
+		if tc.suggest != "" && (err == nil || !strings.Contains(err.Error(), tc.suggest)) {
+			t.Errorf("%q: expected error suggesting %q, got %v", tc.value, tc.suggest, err)
+		}
+		if n := f.called("GetParametersByPath"); tc.listed != (n > 0) {
+			t.Errorf("%q: expected parameters to be listed: %v, got %v calls", tc.value, tc.listed, n)
+		}
+	}
+}
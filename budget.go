@@ -0,0 +1,64 @@
+package hydrate
+
+import "github.com/pkg/errors"
+
+// budget guards against templates that unexpectedly reference more
+// parameters or pull more data than expected, ie. due to template
+// injection or runaway subtree expansion.
+type budget struct {
+	maxSecrets int
+	maxBytes   int
+
+	secrets int
+	bytes   int
+}
+
+// SetBudget aborts hydration once more than maxSecrets parameters or more
+// than maxBytes of secret data were fetched. Zero means no limit.
+func (ps *paramStore) SetBudget(maxSecrets, maxBytes int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.budget = &budget{maxSecrets: maxSecrets, maxBytes: maxBytes}
+}
+
+// reserve accounts for a parameter about to be fetched.
+func (ps *paramStore) reserve(key string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.budget == nil {
+		return nil
+	}
+	if ps.budget.maxSecrets > 0 && ps.budget.secrets >= ps.budget.maxSecrets {
+		return errors.Errorf("fetching %q would exceed the budget of %v secrets (--max-secrets)", key, ps.budget.maxSecrets)
+	}
+	ps.budget.secrets++
+	return nil
+}
+
+// release returns the reservation of a parameter that wasn't fetched,
+// ie. of one that doesn't exist.
+func (ps *paramStore) release(key string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.budget != nil && ps.budget.secrets > 0 {
+		ps.budget.secrets--
+	}
+}
+
+// spend accounts for the size of a fetched parameter.
+func (ps *paramStore) spend(key string, secret string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.budget == nil {
+		return nil
+	}
+	ps.budget.bytes += len(secret)
+	if ps.budget.maxBytes > 0 && ps.budget.bytes > ps.budget.maxBytes {
+		return errors.Errorf("fetching %q exceeded the budget of %v bytes of secret data (--max-bytes)", key, ps.budget.maxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package hydrate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	secrets := map[string]string{"/app/a": "1234", "/app/b": "5678", "/app/c": "90"}
+	tt := []struct {
+		name       string
+		maxSecrets int
+		maxBytes   int
+		keys       []string
+		err        string // Of the last key, if any.
+	}{
+		{name: "within budget", maxSecrets: 3, maxBytes: 10, keys: []string{"a", "b", "c"}},
+		{name: "no limits", keys: []string{"a", "b", "c"}},
+		{name: "too many secrets", maxSecrets: 2, keys: []string{"a", "b", "c"}, err: "fetching \"/app/c\" would exceed the budget of 2 secrets (--max-secrets)"},
+		{name: "too many bytes", maxBytes: 7, keys: []string{"a", "b"}, err: "fetching \"/app/b\" exceeded the budget of 7 bytes of secret data (--max-bytes)"},
+		{name: "cached secrets are free", maxSecrets: 1, maxBytes: 4, keys: []string{"a", "/app/a", "a"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := testStore(t, secrets)
+			ps.SetBudget(tc.maxSecrets, tc.maxBytes)
+
+			var err error
+			for i, key := range tc.keys {
+				if _, err = ps.GetSecret(key); err != nil && i < len(tc.keys)-1 {
+					t.Fatalf("%q: %v", key, err)
+				}
+			}
+			if tc.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Bundle is an artifact assembled from multiple secrets, ie. a PEM chain of
+// a certificate, its intermediates and the private key.
+type Bundle struct {
+	// Parts are secret references ("$SECRET:/app/tls/cert",
+	// "$SECRETSMANAGER:tls#key", ...) or literal text, in order.
+	Parts []string `yaml:"parts" json:"parts"`
+
+	// Separator is written between the parts. If empty, each part is
+	// terminated by a newline, as expected by PEM bundles.
+	Separator string `yaml:"separator,omitempty" json:"separator,omitempty"`
+}
+
+// Assemble hydrates the bundle's parts and concatenates them.
+func (ps *paramStore) Assemble(bundle Bundle) ([]byte, error) {
+	if len(bundle.Parts) == 0 {
+		return nil, errors.New("bundle has no parts")
+	}
+
+	var b bytes.Buffer
+	for i, part := range bundle.Parts {
+		value, err := ps.Lookup(part)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to hydrate part %v", i)
+		}
+
+		if bundle.Separator != "" {
+			if i > 0 {
+				b.WriteString(bundle.Separator)
+			}
+			b.WriteString(value)
+			continue
+		}
+		b.WriteString(value)
+		if value != "" && !strings.HasSuffix(value, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.Bytes(), nil
+}
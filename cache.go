@@ -0,0 +1,150 @@
+package hydrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// diskCache persists fetched secrets across runs, so that hydration can be
+// served from it, ie. after warming it up ahead of a deployment window.
+// Entries are files readable by the owner only, named by their key's hash.
+type diskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	Key     string    `json:"key"`
+	Value   string    `json:"value"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// SetCache persists the fetched secrets into dir, and serves them from there
+// for up to ttl, also to other processes. Secrets that expire, see
+// ExpiringSecretProvider, aren't persisted.
+func (ps *paramStore) SetCache(dir string, ttl time.Duration) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "failed to create cache dir")
+	}
+	ps.cache = &diskCache{dir: dir, ttl: ttl}
+	return nil
+}
+
+func (c *diskCache) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *diskCache) load(key string) (string, bool) {
+	data, err := ioutil.ReadFile(c.filename(key))
+	if err != nil {
+		return "", false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		return "", false
+	}
+	if c.ttl > 0 && time.Since(entry.Fetched) > c.ttl {
+		os.Remove(c.filename(key))
+		return "", false
+	}
+	return entry.Value, true
+}
+
+func (c *diskCache) store(key, value string) error {
+	data, err := json.Marshal(cacheEntry{Key: key, Value: value, Fetched: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	// Write a temp file first, so that readers never see partial entries.
+	f, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.filename(key))
+}
+
+func (c *diskCache) forget(key string) {
+	os.Remove(c.filename(key))
+}
+
+// cached returns the secret from the memory or disk cache.
+func (ps *paramStore) cached(cacheKey string) (string, bool) {
+	if secret, ok := ps.secrets.Load(cacheKey); ok {
+		return secret, true
+	}
+	if ps.cache == nil {
+		return "", false
+	}
+	secret, ok := ps.cache.load(cacheKey)
+	if ok {
+		ps.log(LevelDebug, "serving secret from cache", "key", cacheKey)
+		ps.secrets.Store(cacheKey, secret)
+		ps.count(cacheKey, func(s *ProviderStats) { s.Cached++ })
+	}
+	return secret, ok
+}
+
+// persist stores the fetched secret in the disk cache, if any.
+func (ps *paramStore) persist(cacheKey, secret string) {
+	if ps.cache == nil {
+		return
+	}
+	if err := ps.cache.store(cacheKey, secret); err != nil {
+		ps.log(LevelWarn, "failed to cache secret", "key", cacheKey, "error", err)
+	}
+}
+
+// Warm fetches all parameters of the path's subtree into the cache, see
+// SetCache, so that later hydrations are served from it. It returns the
+// number of cached parameters.
+func (ps *paramStore) Warm(ctx context.Context, path string) (int, error) {
+	if ps.cache == nil {
+		return 0, errors.New("failed to warm cache: no cache dir set, see SetCache")
+	}
+	provider, ok := ps.provider.(PathSecretProvider)
+	if !ok {
+		return 0, errors.Errorf("failed to warm cache: %T can't fetch subtrees", ps.provider)
+	}
+
+	path, err := ps.paramPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var secrets map[string]string
+	err = ps.call(ctx, func() (err error) {
+		secrets, err = provider.GetSecretsByPath(ctx, path)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for key, secret := range secrets {
+		ps.secrets.Store(ps.secretKey(key), secret)
+		ps.count(ps.secretKey(key), func(s *ProviderStats) { s.Fetched++ })
+		if err := ps.cache.store(ps.secretKey(key), secret); err != nil {
+			return 0, errors.Wrapf(err, "failed to cache %q", key)
+		}
+	}
+	return len(secrets), nil
+}
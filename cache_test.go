@@ -0,0 +1,145 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	params := map[string]string{"/app/db_pass": "hunter2", "/app/user": "app"}
+
+	tt := []struct {
+		name   string
+		ttl    time.Duration
+		age    time.Duration // Of the cached entries.
+		forget []string
+		calls  int // Of the second run.
+	}{
+		{name: "served from disk", calls: 0},
+		{name: "fresh", ttl: time.Hour, calls: 0},
+		{name: "expired", ttl: time.Minute, age: time.Hour, calls: 1},
+		{name: "forgotten", forget: []string{"/app/user"}, calls: 1},
+	}
+
+	for _, tc := range tt {
+		dir := t.TempDir()
+		input := "db_pass: $$\nuser: $$\n"
+
+		// The first run persists the secrets for the second one.
+		hydrate := func() (*fakeSSM, *paramStore) {
+			f, svc := newFakeSSM(t, params)
+			ps := ParamStore(svc, "/app")
+			if err := ps.SetCache(dir, tc.ttl); err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			if err := ps.Hydrate(&b, strings.NewReader(input), "yaml", false); err != nil {
+				t.Fatal(err)
+			}
+			if expected := "db_pass: hunter2\nuser: app\n"; b.String() != expected {
+				t.Errorf("%v: expected %q, got %q", tc.name, expected, b.String())
+			}
+			return f, ps
+		}
+		_, ps := hydrate()
+		ps.Forget(tc.forget...)
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := len(params) - len(tc.forget); len(files) != expected {
+			t.Errorf("%v: expected %v cache files, got %v", tc.name, expected, len(files))
+		}
+		for _, file := range files {
+			if file.Mode().Perm() != 0600 {
+				t.Errorf("%v: expected %v to be 0600, got %v", tc.name, file.Name(), file.Mode().Perm())
+			}
+			if tc.age > 0 {
+				entry := filepath.Join(dir, file.Name())
+				data, err := ioutil.ReadFile(entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var e cacheEntry
+				if err := json.Unmarshal(data, &e); err != nil {
+					t.Fatal(err)
+				}
+				e.Fetched = e.Fetched.Add(-tc.age)
+				if data, err = json.Marshal(e); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(entry, data, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		f, _ := hydrate()
+		if n := f.called("GetParameters") + f.called("GetParameter"); n != tc.calls {
+			t.Errorf("%v: expected %v calls, got %v", tc.name, tc.calls, n)
+		}
+	}
+}
+
+func TestWarm(t *testing.T) {
+	params := map[string]string{"/app/db_pass": "hunter2", "/app/api/key": "k3y", "/other/user": "app"}
+
+	tt := []struct {
+		path     string
+		cache    bool
+		expected int
+		err      string
+	}{
+		{path: "/app", cache: true, expected: 2},
+		{path: "/none", cache: true, expected: 0},
+		{path: "/app", err: "no cache dir set"},
+	}
+
+	for _, tc := range tt {
+		dir := t.TempDir()
+		_, svc := newFakeSSM(t, params)
+		ps := ParamStore(svc, "/app")
+		if tc.cache {
+			if err := ps.SetCache(dir, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n, err := ps.Warm(context.Background(), tc.path)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.path, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tc.expected {
+			t.Errorf("%v: expected %v parameters, got %v", tc.path, tc.expected, n)
+		}
+
+		// Served from the cache, without any calls.
+		if n > 0 {
+			f, svc := newFakeSSM(t, nil)
+			ps := ParamStore(svc, "/app")
+			ps.SetCache(dir, 0)
+			var b strings.Builder
+			if err := ps.Hydrate(&b, strings.NewReader("db_pass: $$\nkey: $SECRET:/app/api/key\n"), "yaml", false); err != nil {
+				t.Fatal(err)
+			}
+			if expected := "db_pass: hunter2\nkey: k3y\n"; b.String() != expected {
+				t.Errorf("%v: expected %q, got %q", tc.path, expected, b.String())
+			}
+			if len(f.calls) != 0 {
+				t.Errorf("%v: expected no calls, got %v", tc.path, f.calls)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package hydrate
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// chaosProvider injects latency and errors into the calls of a provider.
+type chaosProvider struct {
+	provider    SecretProvider
+	probability float64
+	latency     time.Duration
+}
+
+// chaosBatchProvider is a chaosProvider of a BatchSecretProvider.
+type chaosBatchProvider struct {
+	*chaosProvider
+	batch BatchSecretProvider
+}
+
+// ChaosProvider wraps the provider for resilience testing: every call is
+// delayed by up to latency, and fails with the given probability (0-1).
+// Injected errors are AWS ThrottlingException errors, so that they're
+// retried like real ones until the retries are exhausted. Not for
+// production use.
+func ChaosProvider(provider SecretProvider, probability float64, latency time.Duration) SecretProvider {
+	p := &chaosProvider{provider: provider, probability: probability, latency: latency}
+	if batch, ok := provider.(BatchSecretProvider); ok {
+		return &chaosBatchProvider{p, batch}
+	}
+	return p
+}
+
+// SetLogger sets the Logger of the wrapped provider.
+func (p *chaosProvider) SetLogger(logger Logger) {
+	if p, ok := p.provider.(interface{ SetLogger(Logger) }); ok {
+		p.SetLogger(logger)
+	}
+}
+
+// Name returns the name of the wrapped provider, see NamedSecretProvider.
+func (p *chaosProvider) Name() string {
+	return namespace("", p.provider)
+}
+
+// inject delays the call and returns the injected error, if any.
+func (p *chaosProvider) inject(ctx context.Context) error {
+	if p.latency > 0 {
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(p.latency))))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if rand.Float64() < p.probability {
+		return &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded (injected by chaos testing)"}
+	}
+	return nil
+}
+
+func (p *chaosProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	if err := p.inject(ctx); err != nil {
+		return "", err
+	}
+	return p.provider.GetSecret(ctx, key)
+}
+
+func (p *chaosBatchProvider) GetSecrets(ctx context.Context, keys []string) (map[string]string, error) {
+	if err := p.inject(ctx); err != nil {
+		return nil, err
+	}
+	return p.batch.GetSecrets(ctx, keys)
+}
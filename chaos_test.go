@@ -0,0 +1,57 @@
+package hydrate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChaosProvider(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := []struct {
+		name        string
+		ctx         context.Context
+		probability float64
+		latency     time.Duration
+		throttled   bool
+		err         error
+	}{
+		{name: "passthrough", ctx: context.Background()},
+		{name: "delayed", ctx: context.Background(), latency: 10 * time.Millisecond},
+		{name: "failing", ctx: context.Background(), probability: 1, throttled: true},
+		{name: "canceled", ctx: canceled, latency: time.Hour, err: context.Canceled},
+	}
+
+	for _, tc := range tt {
+		_, svc := newFakeSSM(t, map[string]string{"/app/db_pass": "hunter2"})
+		provider := ChaosProvider(SSMProvider(svc), tc.probability, tc.latency)
+		batch, ok := provider.(BatchSecretProvider)
+		if !ok {
+			t.Fatalf("%v: expected a BatchSecretProvider, got %T", tc.name, provider)
+		}
+
+		secret, err := provider.GetSecret(tc.ctx, "/app/db_pass")
+		_, berr := batch.GetSecrets(tc.ctx, []string{"/app/db_pass"})
+		switch {
+		case tc.throttled:
+			if !IsThrottled(err) || !IsThrottled(berr) {
+				t.Errorf("%v: expected throttling errors, got %v and %v", tc.name, err, berr)
+			}
+		case tc.err != nil:
+			if err != tc.err || berr != tc.err {
+				t.Errorf("%v: expected %v, got %v and %v", tc.name, tc.err, err, berr)
+			}
+		case err != nil || berr != nil:
+			t.Errorf("%v: %v, %v", tc.name, err, berr)
+		case secret != "hunter2":
+			t.Errorf("%v: expected %q, got %q", tc.name, "hunter2", secret)
+		}
+	}
+
+	// Providers without batch support aren't made batch providers.
+	if _, ok := ChaosProvider(mapProvider(nil), 0, 0).(BatchSecretProvider); ok {
+		t.Error("expected no BatchSecretProvider")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+func simulateAccess(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate simulate-access", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		format   = flags.String("format", "", "input file format: json, yaml, toml (defaults to file extension)")
+		k8s      = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate simulate-access: exactly one file must be provided"))
+	}
+
+	r := openInput(flags.Arg(0), format)
+	defer r.Close()
+
+	provider := hydrate.SSMProvider(newSSM(*region))
+	provider.SetLogger(logger)
+	params, err := hydrate.New(provider, *basePath).References(r, *format, *k8s)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate simulate-access"))
+	}
+
+	access, err := provider.CheckAccess(context.Background(), params)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate simulate-access"))
+	}
+
+	denied := 0
+	for _, a := range access {
+		if a.Readable {
+			fmt.Printf("ok      %v\n", a.Parameter)
+			continue
+		}
+		denied++
+		fmt.Printf("denied  %v: %v\n", a.Parameter, a.Reason)
+	}
+	if denied > 0 {
+		logger.Log(hydrate.LevelError, "parameters can't be read", "denied", denied, "total", len(access))
+		os.Exit(1)
+	}
+}
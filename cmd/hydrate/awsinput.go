@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// awsProviders are the names of the providers calling AWS APIs.
+var awsProviders = map[string]bool{"ssm": true, "secretsmanager": true}
+
+type providerReferencer interface {
+	ProviderReferences(ctx context.Context, r io.Reader, format string, k8s bool) (map[string]string, error)
+}
+
+// awsInput returns the first input referencing secrets of an AWS-backed
+// provider, the field referencing them and the provider's name, if any.
+// Inputs that can't be scanned, ie. STDIN, SOPS-encrypted or invalid files,
+// are taken to reference the --backend's secrets; their hydration reports
+// any errors. Files are scanned in the format, if given, or else in the
+// format of their extension.
+func awsInput(ctx context.Context, h providerReferencer, args []string, format string, k8s bool) (input, field, provider string) {
+	for _, arg := range args {
+		if arg == "-" || *sops != "" {
+			if awsProviders[*backend] {
+				return arg, "", *backend
+			}
+			continue
+		}
+
+		fileFormat := format
+		if fileFormat == "" {
+			fileFormat = strings.TrimLeft(filepath.Ext(arg), ".")
+		}
+		refs, err := scanProviders(hydrate.WithIncludeDir(ctx, filepath.Dir(arg)), h, arg, fileFormat, k8s)
+		if err != nil {
+			if awsProviders[*backend] {
+				return arg, "", *backend
+			}
+			continue
+		}
+		for _, name := range []string{"ssm", "secretsmanager"} {
+			if field, ok := refs[name]; ok {
+				return arg, field, name
+			}
+		}
+	}
+	return "", "", ""
+}
+
+func scanProviders(ctx context.Context, h providerReferencer, filename, format string, k8s bool) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return h.ProviderReferences(ctx, f, format, k8s)
+}
+
+// requireAWS fails unless the AWS region and credentials resolve, naming the
+// input and field whose references require them.
+func requireAWS(ctx context.Context, cfg aws.Config, input, field, provider string) {
+	if input == "-" {
+		input = "STDIN"
+	}
+	if field != "" {
+		input = fmt.Sprintf("%v field %q", input, field)
+	}
+	if cfg.Region == "" {
+		fatal(errors.Errorf("hydrate: %v references %v secrets: --region=[us-west-2], $AWS_REGION or a --profile with a region must be provided", input, provider))
+	}
+	if cfg.Credentials == nil {
+		fatal(errors.Errorf("hydrate: %v references %v secrets, but no AWS credentials resolve", input, provider))
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		fatal(errors.Wrapf(err, "hydrate: %v references %v secrets, but no AWS credentials resolve", input, provider))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/pressly/hydrate"
+)
+
+func TestAWSInput(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"vault.yml":  "db:\n  pass: $VAULT:kv/app#db_pass\n",
+		"ssm.yml":    "name: app\ndb:\n  pass: $SECRET:/app/db_pass\n",
+		"sm.env":     "API_KEY=$SECRETSMANAGER:app/api_key\n",
+		"plain.json": `{"name": "app"}`,
+		"broken.yml": "db: [\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tt := []struct {
+		name     string
+		backend  string
+		args     []string
+		input    string
+		field    string
+		provider string
+	}{
+		{name: "vault only", backend: "ssm", args: []string{path("vault.yml"), path("plain.json")}},
+		{name: "ssm", backend: "ssm", args: []string{path("vault.yml"), path("ssm.yml")}, input: path("ssm.yml"), field: "db.pass", provider: "ssm"},
+		{name: "secretsmanager", backend: "vault", args: []string{path("sm.env")}, input: path("sm.env"), field: "API_KEY", provider: "secretsmanager"},
+		{name: "stdin", backend: "ssm", args: []string{"-"}, input: "-", provider: "ssm"},
+		{name: "stdin vault", backend: "vault", args: []string{"-"}},
+		{name: "invalid", backend: "secretsmanager", args: []string{path("broken.yml")}, input: path("broken.yml"), provider: "secretsmanager"},
+		{name: "invalid vault", backend: "vault", args: []string{path("broken.yml")}},
+	}
+
+	defer func(b string) { *backend = b }(*backend)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			*backend = tc.backend
+			ps := hydrate.ParamStore(nil, "/app")
+			ps.SetBackend("VAULT", hydrate.VaultProvider(hydrate.VaultConfig{}))
+			ps.SetBackend("SECRETSMANAGER", hydrate.SecretsManagerProvider(nil))
+
+			input, field, provider := awsInput(context.Background(), ps, tc.args, "", false)
+			if input != tc.input || field != tc.field || provider != tc.provider {
+				t.Errorf("expected %q %q %q, got %q %q %q", tc.input, tc.field, tc.provider, input, field, provider)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+type backendSetter interface {
+	SetBackend(name string, provider hydrate.SecretProvider)
+}
+
+// setBackends registers the providers of $SECRETSMANAGER: and $VAULT: references.
+func setBackends(ps backendSetter, cfg aws.Config) {
+	for name, provider := range backends(cfg) {
+		ps.SetBackend(name, provider)
+	}
+}
+
+// backends returns the providers of $SECRETSMANAGER: and $VAULT: references.
+func backends(cfg aws.Config) map[string]hydrate.SecretProvider {
+	return map[string]hydrate.SecretProvider{
+		"SECRETSMANAGER": hydrate.SecretsManagerProvider(secretsmanager.NewFromConfig(cfg)),
+		"VAULT":          hydrate.VaultProvider(hydrate.VaultConfigFromEnv()),
+	}
+}
+
+// backendConfig returns the AWS config of the --backend. Vault and dry
+// runs don't require a region, as AWS is only used by $SECRETSMANAGER:
+// references, and not at all by dry runs.
+func backendConfig(region string) aws.Config {
+	return loadConfig(region, !(*backend == "vault" || *dryRunMode && !*checkExist && !*pinVersion))
+}
+
+// backendProvider returns the --backend provider of $SECRET and $$ values.
+func backendProvider(name string, ssmProvider, smProvider, vaultProvider hydrate.SecretProvider) (hydrate.SecretProvider, error) {
+	switch name {
+	case "ssm":
+		return ssmProvider, nil
+	case "secretsmanager":
+		return smProvider, nil
+	case "vault":
+		return vaultProvider, nil
+	default:
+		return nil, errors.Errorf("unknown --backend=%v, expected ssm, secretsmanager or vault", name)
+	}
+}
+
+// newStore returns a secret store with fresh providers of the config,
+// configured like the main command's by the flags of hydratorFlags.
+func newStore(cfg aws.Config, basePath string) (envHydrator, error) {
+	smProvider := hydrate.SecretsManagerProvider(secretsmanager.NewFromConfig(cfg))
+	vaultProvider := hydrate.VaultProvider(hydrate.VaultConfigFromEnv())
+	provider, err := backendProvider(*backend, hydrate.SSMProvider(ssm.NewFromConfig(cfg)), smProvider, vaultProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	paramStore, err := hydrate.NewHydrator(provider, hydrate.Options{
+		BasePath: basePath,
+		Backends: map[string]hydrate.SecretProvider{
+			"SECRETSMANAGER": smProvider,
+			"VAULT":          vaultProvider,
+		},
+		Logger:      logger,
+		RateLimit:   *rate,
+		Concurrency: *workers,
+		MaxSecrets:  *maxSecrets,
+		MaxBytes:    *maxBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paramStore, nil
+}
+
+// hydratorFlags registers the main command's flags configuring the secret
+// stores, see newStore, with the subcommand's flags.
+func hydratorFlags(fs *flag.FlagSet) {
+	for _, name := range []string{"backend", "rate-limit", "concurrency", "max-secrets", "max-bytes"} {
+		f := flags.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+}
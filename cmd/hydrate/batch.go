@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+type hydrator interface {
+	HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error
+}
+
+type batchOptions struct {
+	format       string // Inferred from file extensions, if empty.
+	outputFormat string // Same as input format, if empty.
+	k8s          bool
+	outDir       string
+	write        bool   // Hydrate files in place instead of into outDir.
+	backup       string // Suffix of the originals kept by write, if set.
+	concurrency  int
+	state        *runState // Progress of the run, see --state.
+}
+
+type fileError struct {
+	filename string
+	err      error
+}
+
+// hydrateFiles hydrates files concurrently, sharing the hydrator's AWS
+// client, cache and rate limiter, and writes the results into the output
+// directory, preserving the input files' relative paths. It returns the
+// names of the written files, in the order of the input files.
+func hydrateFiles(ctx context.Context, h hydrator, filenames []string, opts batchOptions) ([]string, error) {
+	concurrency := opts.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []fileError
+		queue  = make(chan int)
+		outs   = make([]string, len(filenames))
+		report = func(filename string, err error) {
+			mu.Lock()
+			errs = append(errs, fileError{filename, err})
+			mu.Unlock()
+		}
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if opts.state != nil && opts.state.done(filenames[i], outputPath(filenames[i], opts), opts.write) {
+					logger.Log(hydrate.LevelInfo, "skipping file, hydrated by a previous run", "file", filenames[i])
+					outs[i] = outputPath(filenames[i], opts)
+					continue
+				}
+				out, err := hydrateFile(ctx, h, filenames[i], opts)
+				if err != nil {
+					report(filenames[i], err)
+					continue
+				}
+				outs[i] = out
+			}
+		}()
+	}
+	for i := range filenames {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	written := make([]string, 0, len(outs))
+	for _, out := range outs {
+		if out != "" {
+			written = append(written, out)
+		}
+	}
+	if len(errs) == 0 {
+		if opts.state != nil {
+			return written, opts.state.remove()
+		}
+		return written, nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "hydrate: %v of %v files failed:", len(errs), len(filenames))
+	for _, e := range errs {
+		fmt.Fprintf(&b, "\n    %v: %v", e.filename, e.err)
+	}
+	return written, fmt.Errorf("%v", b.String())
+}
+
+func hydrateFile(ctx context.Context, h hydrator, filename string, opts batchOptions) (string, error) {
+	format := opts.format
+	if format == "" {
+		format = strings.TrimLeft(filepath.Ext(filename), ".")
+	}
+
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := h.HydrateFormatContext(hydrate.WithIncludeDir(ctx, filepath.Dir(filename)), &b, bytes.NewReader(input), format, opts.outputFormat, opts.k8s); err != nil {
+		return "", err
+	}
+
+	out := outputPath(filename, opts)
+	if opts.write {
+		err = writeInPlace(filename, b.Bytes(), opts.backup)
+	} else if err = os.MkdirAll(filepath.Dir(out), 0755); err == nil {
+		err = ioutil.WriteFile(out, b.Bytes(), 0600)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opts.state != nil {
+		if err := opts.state.record(filename, hashBytes(input), out); err != nil {
+			return "", errors.Wrap(err, "failed to write --state")
+		}
+	}
+	return out, nil
+}
+
+// outputPath returns the name of the file that the input is hydrated into.
+func outputPath(filename string, opts batchOptions) string {
+	if opts.write {
+		return filename
+	}
+	out := filepath.Join(opts.outDir, strings.TrimPrefix(filepath.Clean(filename), string(filepath.Separator)))
+	if opts.outputFormat != "" {
+		out = strings.TrimSuffix(out, filepath.Ext(out)) + "." + opts.outputFormat
+	}
+	return out
+}
+
+// writeInPlace replaces the file atomically, keeping its permissions and
+// ownership. If backup is set, the original is kept as filename+backup.
+func writeInPlace(filename string, data []byte, backup string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		// Only privileged users can give files away, like sed -i the
+		// file is owned by the current user otherwise.
+		os.Chown(tmp.Name(), int(st.Uid), int(st.Gid))
+	}
+	if backup != "" {
+		if err := backupFile(filename, filename+backup); err != nil {
+			return errors.Wrap(err, "failed to back up")
+		}
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// backupFile hard links the file as backup, keeping it exactly as it is,
+// or copies it where hard links aren't supported.
+func backupFile(filename, backup string) error {
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(filename, backup) == nil {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(backup, data, info.Mode().Perm())
+}
+
+// inputFormats are the file extensions picked up when walking directories.
+var inputFormats = map[string]bool{
+	"json": true, "yml": true, "yaml": true, "toml": true, "env": true, "properties": true, "tmpl": true,
+}
+
+// expandInputs expands directories into the files of known formats within
+// them, and glob patterns (with "**" matching any number of directories,
+// ie. "./manifests/**/*.yml") into the matching files. It reports whether
+// any argument expanded into multiple files.
+func expandInputs(args []string) (files []string, multi bool, err error) {
+	for _, arg := range args {
+		switch {
+		case arg == "-":
+			files = append(files, arg)
+
+		case strings.ContainsAny(arg, "*?["):
+			matches, err := globFiles(arg)
+			if err != nil {
+				return nil, false, err
+			}
+			if len(matches) == 0 {
+				return nil, false, fmt.Errorf("hydrate: no files match %q", arg)
+			}
+			files = append(files, matches...)
+			multi = true
+
+		default:
+			info, err := os.Stat(arg)
+			if err != nil {
+				return nil, false, err
+			}
+			if !info.IsDir() {
+				files = append(files, arg)
+				continue
+			}
+			err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() && inputFormats[strings.TrimLeft(filepath.Ext(path), ".")] {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, false, err
+			}
+			multi = true
+		}
+	}
+	return dedupe(files), multi, nil
+}
+
+// dedupe removes repeated filenames, ie. of overlapping globs.
+func dedupe(files []string) []string {
+	seen := make(map[string]bool, len(files))
+	unique := files[:0]
+	for _, file := range files {
+		if !seen[filepath.Clean(file)] {
+			seen[filepath.Clean(file)] = true
+			unique = append(unique, file)
+		}
+	}
+	return unique
+}
+
+// globFiles returns the files matching the pattern, sorted.
+func globFiles(pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+
+	// Walk from the longest directory prefix without wildcards.
+	base := 0
+	for base < len(segments)-1 && !strings.ContainsAny(segments[base], "*?[") {
+		base++
+	}
+	root := strings.Join(segments[:base], "/")
+	if root == "" && base > 0 {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+	segments = segments[base:]
+
+	for _, segment := range segments {
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("hydrate: invalid glob pattern %q", pattern)
+		}
+	}
+
+	var matches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
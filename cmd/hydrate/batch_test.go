@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeHydrator upper-cases its inputs, failing those containing "fail",
+// and records the max number of concurrent hydrations.
+type fakeHydrator struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (h *fakeHydrator) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	h.mu.Lock()
+	h.inFlight++
+	if h.inFlight > h.max {
+		h.max = h.inFlight
+	}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.inFlight--
+		h.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(data), "fail") {
+		return errors.Errorf("failed to hydrate %v", format)
+	}
+	_, err = io.WriteString(w, strings.ToUpper(string(data)))
+	return err
+}
+
+func TestHydrateFiles(t *testing.T) {
+	tt := []struct {
+		files    map[string]string
+		opts     batchOptions
+		expected map[string]string
+		err      string
+	}{
+		{
+			files:    map[string]string{"a.yml": "a: b\n", "conf/b.json": "{}", "conf/c.toml": "c = 1\n"},
+			opts:     batchOptions{concurrency: 2},
+			expected: map[string]string{"a.yml": "A: B\n", "conf/b.json": "{}", "conf/c.toml": "C = 1\n"},
+		},
+		{
+			files:    map[string]string{"a.yml": "a: b\n", "conf/b.toml": "b = 1\n"},
+			opts:     batchOptions{outputFormat: "json", concurrency: 4},
+			expected: map[string]string{"a.json": "A: B\n", "conf/b.json": "B = 1\n"},
+		},
+		{
+			files:    map[string]string{"a.yml": "a: b\n", "b.yml": "fail: yes\n", "c.json": `{"fail": 1}`},
+			expected: map[string]string{"a.yml": "A: B\n"},
+			err:      "2 of 3 files failed:",
+		},
+	}
+
+	for _, tc := range tt {
+		in, out := t.TempDir(), t.TempDir()
+		var filenames []string
+		for name, data := range tc.files {
+			filename := filepath.Join(in, name)
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+
+		h := &fakeHydrator{}
+		tc.opts.outDir = out
+		written, err := hydrateFiles(context.Background(), h, filenames, tc.opts)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+			for name := range tc.files {
+				if _, ok := tc.expected[name]; !ok && !strings.Contains(err.Error(), filepath.Join(in, name)+": failed to hydrate "+strings.TrimPrefix(filepath.Ext(name), ".")) {
+					t.Errorf("expected error of %v, got %v", name, err)
+				}
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		var expectedWritten []string
+		for name := range tc.expected {
+			expectedWritten = append(expectedWritten, filepath.Join(out, in, name))
+		}
+		sort.Strings(expectedWritten)
+		if !reflect.DeepEqual(written, expectedWritten) {
+			t.Errorf("expected written files %q, got %q", expectedWritten, written)
+		}
+
+		for name, expected := range tc.expected {
+			data, err := ioutil.ReadFile(filepath.Join(out, in, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != expected {
+				t.Errorf("%v: expected %q, got %q", name, expected, data)
+			}
+		}
+		if max := tc.opts.concurrency; max > 0 && h.max > max {
+			t.Errorf("expected up to %v concurrent hydrations, got %v", max, h.max)
+		}
+	}
+}
+
+func TestHydrateFilesInPlace(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]os.FileMode{"a.yml": 0640, "b/c.json": 0600}
+	var filenames []string
+	for name, mode := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("key: "+name+"\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	written, err := hydrateFiles(context.Background(), &fakeHydrator{}, filenames, batchOptions{write: true, concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(written, filenames) {
+		t.Errorf("expected written files %q, got %q", filenames, written)
+	}
+	for name, mode := range files {
+		filename := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "KEY: " + strings.ToUpper(name) + "\n"; string(data) != expected {
+			t.Errorf("%v: expected %q, got %q", name, expected, data)
+		}
+		if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != mode {
+			t.Errorf("%v: expected mode %v to be kept, got %v", name, mode, fi.Mode().Perm())
+		}
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(dir, "b")); len(entries) != 1 {
+		t.Errorf("expected no temporary files left in place, got %v files", len(entries))
+	}
+}
+
+func TestWriteInPlaceBackup(t *testing.T) {
+	tt := []struct {
+		name     string
+		backup   string
+		existing string // Of a previous backup.
+	}{
+		{name: "no backup"},
+		{name: "backup", backup: ".bak"},
+		{name: "previous backup", backup: ".orig", existing: "previous\n"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config.yml")
+			if err := ioutil.WriteFile(filename, []byte("key: $$\n"), 0640); err != nil {
+				t.Fatal(err)
+			}
+			if tc.existing != "" {
+				if err := ioutil.WriteFile(filename+tc.backup, []byte(tc.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := writeInPlace(filename, []byte("key: secret\n"), tc.backup); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := ioutil.ReadFile(filename); string(data) != "key: secret\n" {
+				t.Errorf("expected the file to be hydrated, got %q", data)
+			}
+			if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0640 {
+				t.Errorf("expected mode 0640 to be kept, got %v", fi.Mode().Perm())
+			}
+
+			entries, _ := ioutil.ReadDir(filepath.Dir(filename))
+			if tc.backup == "" {
+				if len(entries) != 1 {
+					t.Errorf("expected no backup, got %v files", len(entries))
+				}
+				return
+			}
+			if data, err := ioutil.ReadFile(filename + tc.backup); err != nil || string(data) != "key: $$\n" {
+				t.Errorf("expected the original in %v, got %q: %v", filename+tc.backup, data, err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("expected the file and its backup only, got %v files", len(entries))
+			}
+		})
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.yml", "b.json", "notes.txt", "m/x.yml", "m/y/z.yml", "m/y/z.toml"} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		args     []string
+		expected []string
+		multi    bool
+		err      string
+	}{
+		{args: []string{"a.yml"}, expected: []string{"a.yml"}},
+		{args: []string{"-"}, expected: []string{"-"}},
+		{args: []string{"a.yml", "b.json"}, expected: []string{"a.yml", "b.json"}},
+		{args: []string{"m"}, expected: []string{"m/x.yml", "m/y/z.toml", "m/y/z.yml"}, multi: true},
+		{args: []string{"."}, expected: []string{"a.yml", "b.json", "m/x.yml", "m/y/z.toml", "m/y/z.yml"}, multi: true},
+		{args: []string{"m/**/*.yml"}, expected: []string{"m/x.yml", "m/y/z.yml"}, multi: true},
+		{args: []string{"**/z.*"}, expected: []string{"m/y/z.toml", "m/y/z.yml"}, multi: true},
+		{args: []string{"m/*.yml", "m/**/*.yml"}, expected: []string{"m/x.yml", "m/y/z.yml"}, multi: true},
+		{args: []string{"*.xml"}, err: `hydrate: no files match "*.xml"`},
+		{args: []string{"m/[.yml"}, err: `hydrate: invalid glob pattern "m/[.yml"`},
+		{args: []string{"missing.yml"}, err: "no such file or directory"},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, tc := range tt {
+		files, multi, err := expandInputs(tc.args)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.args, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range files {
+			files[i] = filepath.ToSlash(files[i])
+		}
+		if !reflect.DeepEqual(files, tc.expected) || multi != tc.multi {
+			t.Errorf("%q: expected %q (multi %v), got %q (multi %v)", tc.args, tc.expected, tc.multi, files, multi)
+		}
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tt := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.yml", "app.yml", true},
+		{"*.yml", "dir/app.yml", false},
+		{"**/*.yml", "app.yml", true},
+		{"**/*.yml", "a/b/app.yml", true},
+		{"**/*.yml", "a/b/app.json", false},
+		{"a/**", "a/b/c.yml", true},
+		{"a/**", "b/c.yml", false},
+		{"a/**/c/*.yml", "a/c/app.yml", true},
+		{"a/**/c/*.yml", "a/b/b/c/app.yml", true},
+		{"a/**/c/*.yml", "a/b/app.yml", false},
+		{"a/*/c.yml", "a/b/c.yml", true},
+		{"a/*/c.yml", "a/b/b/c.yml", false},
+		{"[ab].yml", "b.yml", true},
+	}
+	for _, tc := range tt {
+		if match := matchSegments(strings.Split(tc.pattern, "/"), strings.Split(tc.path, "/")); match != tc.match {
+			t.Errorf("%q of %q: expected match %v, got %v", tc.pattern, tc.path, tc.match, match)
+		}
+	}
+}
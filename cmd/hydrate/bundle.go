@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// bundleFile is a bundle manifest entry, keyed by the output filename.
+type bundleFile struct {
+	hydrate.Bundle `yaml:",inline"`
+	Mode           string `yaml:"mode"` // Octal file mode, defaults to 0600.
+}
+
+func bundle(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate bundle", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		outDir   = flags.String("out-dir", ".", "write assembled bundles into directory")
+		name     = flags.String("name", "", "print only the named bundle to STDOUT instead of writing files")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate bundle: exactly one manifest file must be provided"))
+	}
+
+	b, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate bundle: failed to read manifest"))
+	}
+	var manifest map[string]bundleFile
+	if err := yaml.Unmarshal(b, &manifest); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate bundle: failed to decode manifest"))
+	}
+
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	setBackends(paramStore, cfg)
+	paramStore.SetLogger(logger)
+
+	if *name != "" {
+		file, ok := manifest[*name]
+		if !ok {
+			log.Fatal(errors.Errorf("hydrate bundle: %q not found in manifest", *name))
+		}
+		data, err := paramStore.Assemble(file.Bundle)
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate bundle: %v", *name))
+		}
+		if err := writeStdout(data); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	names := make([]string, 0, len(manifest))
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := manifest[name]
+		mode := uint64(0600)
+		if file.Mode != "" {
+			if mode, err = strconv.ParseUint(file.Mode, 8, 32); err != nil {
+				log.Fatal(errors.Errorf("hydrate bundle: %v: invalid mode %q", name, file.Mode))
+			}
+		}
+
+		data, err := paramStore.Assemble(file.Bundle)
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate bundle: %v", name))
+		}
+
+		out := filepath.Join(*outDir, name)
+		if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate bundle"))
+		}
+		if err := ioutil.WriteFile(out, data, os.FileMode(mode)); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate bundle"))
+		}
+		if err := os.Chmod(out, os.FileMode(mode)); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate bundle"))
+		}
+		logger.Log(hydrate.LevelInfo, "wrote bundle", "bundle", name, "file", out)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// capabilities describes what the binary supports, see hydrate capabilities.
+type capabilities struct {
+	Providers     []capabilityProvider `json:"providers"`
+	Plugins       []string             `json:"plugins"` // Installed in $PATH.
+	InputFormats  []string             `json:"inputFormats"`
+	OutputFormats []string             `json:"outputFormats"`
+	Transforms    []string             `json:"transforms"` // Of pipeline specs.
+	Missing       []string             `json:"missing"`
+	Empty         []string             `json:"empty"`
+	Directives    []string             `json:"directives"`
+	Modifiers     []string             `json:"modifiers"`
+	Commands      []string             `json:"commands"`
+	Syntax        capabilitySyntax     `json:"syntax"`
+}
+
+type capabilityProvider struct {
+	Name      string `json:"name"`
+	Reference string `json:"reference"`
+	Backend   bool   `json:"backend"` // Of --backend, resolving $$ and $SECRET.
+}
+
+// capabilitySyntax are the versions of the syntaxes the binary reads.
+type capabilitySyntax struct {
+	References         []string `json:"references"`
+	PipelineAPIVersion []string `json:"pipelineAPIVersions"`
+	PluginProtocol     []int    `json:"pluginProtocolVersions"`
+}
+
+// commands are the names of the subcommands, sorted. Listing subcommands
+// itself would be an initialization cycle.
+var commands = []string{
+	"bundle", "capabilities", "cluster-diff", "compare", "diff", "doctor", "emit", "exec", "graph",
+	"helm", "k8s-configmap", "push", "run", "scan", "serve", "simulate-access", "stamp", "validate",
+	"verify", "warm", "watch", "webhook",
+}
+
+func showCapabilities(args []string) {
+	var (
+		flags  = flag.NewFlagSet("hydrate capabilities", flag.ExitOnError)
+		asJSON = flags.Bool("json", false, "print the capabilities as JSON, ie. for wrapper tooling to validate specs against")
+	)
+	parseFlags(flags, args)
+
+	c := binaryCapabilities()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(c); err != nil {
+			fatal(errors.Wrap(err, "hydrate capabilities"))
+		}
+		return
+	}
+	if err := writeStdout([]byte(c.String())); err != nil {
+		fatal(err)
+	}
+}
+
+// binaryCapabilities returns the capabilities of this binary and the
+// plugins installed in $PATH.
+func binaryCapabilities() capabilities {
+	return capabilities{
+		Providers: []capabilityProvider{
+			{Name: "ssm", Reference: "$SECRET:<path>", Backend: true},
+			{Name: "secretsmanager", Reference: "$SECRETSMANAGER:<name>[#<key>]", Backend: true},
+			{Name: "vault", Reference: "$VAULT:<path>#<key>", Backend: true},
+			{Name: "plugin", Reference: "$PLUGIN:<name>:<key>"},
+		},
+		Plugins:       installedPlugins(),
+		InputFormats:  hydrate.InputFormats(),
+		OutputFormats: hydrate.OutputFormats(),
+		Transforms:    yamlFields(reflect.TypeOf(pipeline{}.Transforms)),
+		Missing:       []string{"error", "empty", "keep"},
+		Empty:         []string{"skip", "hydrate", "error"},
+		Directives:    []string{"gzip", "base64"},
+		Modifiers:     []string{"list", "json", "yaml"},
+		Commands:      commands,
+		Syntax: capabilitySyntax{
+			References: []string{
+				"$SECRET:<path>[:<version>|#<label>]", "$$", "$SECRET", "$SECRET?:<path>", "$SECRET:<path>|<default>",
+				"${SECRET:<path>}", "$GENERATE:<generator>", "$INCLUDE:<file>", "{{.<var>}}",
+			},
+			PipelineAPIVersion: []string{pipelineAPIVersion},
+			PluginProtocol:     []int{1},
+		},
+	}
+}
+
+// String returns the capabilities as aligned text, one line per list.
+func (c capabilities) String() string {
+	var b strings.Builder
+	for _, p := range c.Providers {
+		fmt.Fprintf(&b, "provider     %-15v %v\n", p.Name, p.Reference)
+	}
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"plugins", c.Plugins},
+		{"input", c.InputFormats},
+		{"output", c.OutputFormats},
+		{"transforms", c.Transforms},
+		{"missing", c.Missing},
+		{"empty", c.Empty},
+		{"directives", c.Directives},
+		{"modifiers", c.Modifiers},
+		{"commands", c.Commands},
+		{"pipeline", c.Syntax.PipelineAPIVersion},
+	} {
+		fmt.Fprintf(&b, "%-12v %v\n", list.name, strings.Join(list.values, ", "))
+	}
+	return b.String()
+}
+
+// installedPlugins returns the names of the provider plugins in $PATH, see
+// hydrate.ProviderPluginPrefix.
+func installedPlugins() []string {
+	seen := map[string]bool{}
+	plugins := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			name := strings.TrimPrefix(f.Name(), hydrate.ProviderPluginPrefix)
+			if name == f.Name() || name == "" || f.IsDir() || f.Mode()&0111 == 0 || seen[name] {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, name)
+		}
+	}
+	sort.Strings(plugins)
+	return plugins
+}
+
+// yamlFields returns the YAML names of the struct's fields.
+func yamlFields(t reflect.Type) []string {
+	fields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]; name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pressly/hydrate"
+)
+
+func TestCapabilitiesCommands(t *testing.T) {
+	var names []string
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(commands, names) {
+		t.Errorf("expected the subcommands %q, got %q", names, commands)
+	}
+}
+
+func TestCapabilitiesTransforms(t *testing.T) {
+	transforms := binaryCapabilities().Transforms
+	for _, name := range []string{"k8s", "missing", "pins", "vars", "varFiles"} {
+		found := false
+		for _, transform := range transforms {
+			found = found || transform == name
+		}
+		if !found {
+			t.Errorf("expected transform %q in %q", name, transforms)
+		}
+	}
+}
+
+func TestInstalledPlugins(t *testing.T) {
+	tt := []struct {
+		name       string
+		files      map[string]os.FileMode
+		executable bool
+	}{
+		{name: "1password", files: map[string]os.FileMode{hydrate.ProviderPluginPrefix + "1password": 0755}, executable: true},
+		{name: "not executable", files: map[string]os.FileMode{hydrate.ProviderPluginPrefix + "gcp": 0644}},
+		{name: "no prefix", files: map[string]os.FileMode{"hydrate": 0755}},
+		{name: "prefix only", files: map[string]os.FileMode{hydrate.ProviderPluginPrefix: 0755}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, other := t.TempDir(), t.TempDir()
+			for name, mode := range tc.files {
+				for _, d := range []string{dir, other} { // Listed once.
+					if err := ioutil.WriteFile(filepath.Join(d, name), nil, mode); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			t.Setenv("PATH", strings.Join([]string{dir, filepath.Join(dir, "missing"), other}, string(filepath.ListSeparator)))
+
+			plugins := installedPlugins()
+			expected := []string{}
+			if tc.executable {
+				expected = []string{tc.name}
+			}
+			if !reflect.DeepEqual(plugins, expected) {
+				t.Errorf("expected %q, got %q", expected, plugins)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesString(t *testing.T) {
+	c := capabilities{
+		Providers:    []capabilityProvider{{Name: "ssm", Reference: "$SECRET:<path>", Backend: true}},
+		InputFormats: []string{"json", "yaml"},
+		Syntax:       capabilitySyntax{PipelineAPIVersion: []string{pipelineAPIVersion}},
+	}
+	text := c.String()
+	for _, line := range []string{
+		"provider     ssm             $SECRET:<path>\n",
+		"input        json, yaml\n",
+		"plugins      \n",
+		"pipeline     hydrate.pressly.com/v1alpha1\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("expected line %q, got:\n%s", line, text)
+		}
+	}
+}
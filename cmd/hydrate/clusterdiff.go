@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// k8sSecret is the part of a Secret object compared by cluster-diff.
+type k8sSecret struct {
+	Kind     string `json:"kind" yaml:"kind"`
+	Metadata struct {
+		Name      string `json:"name" yaml:"name"`
+		Namespace string `json:"namespace" yaml:"namespace"`
+	} `json:"metadata" yaml:"metadata"`
+	Data       map[string]string `json:"data" yaml:"data"` // Base64-encoded.
+	StringData map[string]string `json:"stringData" yaml:"stringData"`
+}
+
+// values returns the decoded values of the Secret's keys.
+func (s *k8sSecret) values() (map[string]string, error) {
+	values := map[string]string{}
+	for key, value := range s.Data {
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %q data", key)
+		}
+		values[key] = string(b)
+	}
+	for key, value := range s.StringData {
+		values[key] = value // Takes precedence over data.
+	}
+	return values, nil
+}
+
+func clusterDiff(args []string) {
+	var (
+		flags       = flag.NewFlagSet("hydrate cluster-diff", flag.ExitOnError)
+		region      = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath    = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		filename    = flags.String("f", "", "Secret manifest to hydrate and compare, ie. secret.yaml")
+		namespace   = flags.String("namespace", "", "namespace of Secrets without one (defaults to kubectl's)")
+		kubeContext = flags.String("context", "", "kubectl context to compare against (defaults to the current one)")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *filename == "" {
+		log.Fatal(errors.New("hydrate cluster-diff: usage: hydrate cluster-diff -f secret.yaml"))
+	}
+
+	format := "yaml" // Also reads JSON manifests.
+	r := openInput(*filename, &format)
+	defer r.Close()
+
+	var b bytes.Buffer
+	paramStore := hydrate.ParamStore(newSSM(*region), *basePath)
+	paramStore.SetLogger(logger)
+	if err := paramStore.Hydrate(&b, r, format, true); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate cluster-diff"))
+	}
+
+	diffs := 0
+	dec := yaml.NewDecoder(&b)
+	for {
+		var secret k8sSecret
+		if err := dec.Decode(&secret); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate cluster-diff: failed to decode manifest"))
+		}
+		if secret.Kind != "Secret" {
+			continue
+		}
+		if secret.Metadata.Namespace == "" {
+			secret.Metadata.Namespace = *namespace
+		}
+
+		n, err := diffSecret(&secret, *kubeContext)
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate cluster-diff: secret/%v", secret.Metadata.Name))
+		}
+		diffs += n
+	}
+	if diffs > 0 {
+		os.Exit(1)
+	}
+}
+
+// diffSecret prints the keys added, changed and removed by the Secret
+// compared to the live Secret, without revealing any values. It returns
+// the number of differences.
+func diffSecret(secret *k8sSecret, kubeContext string) (int, error) {
+	desired, err := secret.values()
+	if err != nil {
+		return 0, err
+	}
+
+	name := "secret/" + secret.Metadata.Name
+	if secret.Metadata.Namespace != "" {
+		name = "secret/" + secret.Metadata.Namespace + "/" + secret.Metadata.Name
+	}
+
+	live, err := liveSecret(secret.Metadata.Name, secret.Metadata.Namespace, kubeContext)
+	if err != nil {
+		return 0, err
+	}
+	if live == nil {
+		fmt.Printf("%v: doesn't exist in the cluster\n", name)
+		live = &k8sSecret{}
+	}
+	current, err := live.values()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(desired)+len(current))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := 0
+	for _, key := range keys {
+		value, ok := desired[key]
+		liveValue, liveOk := current[key]
+		switch {
+		case ok && !liveOk:
+			fmt.Printf("added    %v: %v\n", name, key)
+		case !ok && liveOk:
+			fmt.Printf("removed  %v: %v\n", name, key)
+		case value != liveValue:
+			fmt.Printf("changed  %v: %v\n", name, key)
+		default:
+			continue
+		}
+		diffs++
+	}
+	if diffs == 0 {
+		fmt.Printf("%v: up to date\n", name)
+	}
+	return diffs, nil
+}
+
+// liveSecret fetches the Secret from the cluster via kubectl. It returns
+// nil if the Secret doesn't exist.
+func liveSecret(name, namespace, kubeContext string) (*k8sSecret, error) {
+	kubectl, err := exec.LookPath("kubectl")
+	if err != nil {
+		return nil, errors.Wrap(err, "cluster-diff requires kubectl in $PATH")
+	}
+
+	args := []string{"get", "secret", name, "-o", "json", "--ignore-not-found"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(kubectl, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "kubectl get: %v", strings.TrimSpace(stderr.String()))
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil // Not found.
+	}
+
+	var secret k8sSecret
+	if err := json.Unmarshal(stdout.Bytes(), &secret); err != nil {
+		return nil, errors.Wrap(err, "failed to decode kubectl get output")
+	}
+	return &secret, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeKubectl puts a kubectl in $PATH that prints the Secret, if any,
+// recording its arguments.
+func fakeKubectl(t *testing.T, secret string) string {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\ncat <<'EOF'\n" + secret + "\nEOF\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return args
+}
+
+func TestDiffSecret(t *testing.T) {
+	tt := []struct {
+		name     string
+		live     string
+		secret   k8sSecret
+		diffs    int
+		expected string
+	}{
+		{
+			name:     "up to date",
+			live:     `{"kind":"Secret","data":{"user":"YXBw"}}`,
+			secret:   k8sSecret{StringData: map[string]string{"user": "app"}},
+			expected: "secret/sit1/app: up to date\n",
+		},
+		{
+			name:   "added, changed and removed",
+			live:   `{"kind":"Secret","data":{"user":"YXBw","old":"eA=="},"stringData":{"pass":"old"}}`,
+			secret: k8sSecret{Data: map[string]string{"pass": "aHVudGVyMg=="}, StringData: map[string]string{"user": "app", "new": "x"}},
+			diffs:  3,
+			expected: "added    secret/sit1/app: new\n" +
+				"removed  secret/sit1/app: old\n" +
+				"changed  secret/sit1/app: pass\n",
+		},
+		{
+			name:   "not found",
+			secret: k8sSecret{StringData: map[string]string{"user": "app"}},
+			diffs:  1,
+			expected: "secret/sit1/app: doesn't exist in the cluster\n" +
+				"added    secret/sit1/app: user\n",
+		},
+	}
+
+	for _, tc := range tt {
+		args := fakeKubectl(t, tc.live)
+		tc.secret.Metadata.Name = "app"
+		tc.secret.Metadata.Namespace = "sit1"
+
+		var diffs int
+		var err error
+		out := captureStdout(t, func() {
+			diffs, err = diffSecret(&tc.secret, "prod")
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+		if diffs != tc.diffs {
+			t.Errorf("%v: expected %v diffs, got %v", tc.name, tc.diffs, diffs)
+		}
+		if out != tc.expected {
+			t.Errorf("%v: expected:\n%v\ngot:\n%v", tc.name, tc.expected, out)
+		}
+
+		data, err := ioutil.ReadFile(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "get secret app -o json --ignore-not-found --namespace sit1 --context prod\n"; string(data) != expected {
+			t.Errorf("%v: expected kubectl %q, got %q", tc.name, expected, data)
+		}
+	}
+}
+
+func TestLiveSecretNoKubectl(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := liveSecret("app", "", ""); err == nil || !strings.Contains(err.Error(), "requires kubectl in $PATH") {
+		t.Errorf("expected missing kubectl error, got %v", err)
+	}
+}
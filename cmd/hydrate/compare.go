@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+func compare(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate compare", flag.ExitOnError)
+		region    = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		leftPath  = flags.String("left-path", "", "base path of the left environment, ie. /app/stage")
+		rightPath = flags.String("right-path", "", "base path of the right environment, ie. /app/prod")
+		format    = flags.String("format", "", "input file format: json, yaml, toml (defaults to file extension)")
+		k8s       = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *leftPath == "" || *rightPath == "" {
+		log.Fatal(errors.New("hydrate compare: both --left-path and --right-path must be provided"))
+	}
+	if flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate compare: exactly one template file must be provided"))
+	}
+	r := openInput(flags.Arg(0), format)
+	defer r.Close()
+
+	svc := newSSM(*region)
+	left, right := hydrate.ParamStore(svc, *leftPath), hydrate.ParamStore(svc, *rightPath)
+	left.SetLogger(logger)
+	right.SetLogger(logger)
+	diffs, err := hydrate.Compare(left, right, r, *format, *k8s)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate compare"))
+	}
+
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
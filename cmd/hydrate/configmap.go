@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// configMapKeyRe matches valid ConfigMap keys.
+var configMapKeyRe = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+type configMap struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace,omitempty"`
+	} `yaml:"metadata"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	BinaryData map[string]string `yaml:"binaryData,omitempty"` // Base64-encoded.
+}
+
+func k8sConfigMap(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate k8s-configmap", flag.ExitOnError)
+		region    = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath  = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		fromDir   = flags.String("from-dir", "", "directory whose files become the ConfigMap keys")
+		name      = flags.String("name", "", "name of the ConfigMap")
+		namespace = flags.String("namespace", "", "namespace of the ConfigMap, optional")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *fromDir == "" || *name == "" || flags.NArg() != 0 {
+		log.Fatal(errors.New("hydrate k8s-configmap: usage: hydrate k8s-configmap --from-dir=conf/ --name=app-conf"))
+	}
+
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	setBackends(paramStore, cfg)
+	paramStore.SetLogger(logger)
+
+	cm, err := packConfigMap(paramStore, *fromDir, *name, *namespace)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate k8s-configmap"))
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(cm); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate k8s-configmap: failed to encode ConfigMap"))
+	}
+	if err := writeStdout(b.Bytes()); err != nil {
+		fatal(err)
+	}
+}
+
+// packConfigMap hydrates the files of the directory into a ConfigMap,
+// keyed by their filenames. Files that aren't valid UTF-8 are packed
+// into binaryData.
+func packConfigMap(h hydrator, dir, name, namespace string) (*configMap, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := &configMap{APIVersion: "v1", Kind: "ConfigMap"}
+	cm.Metadata.Name = name
+	cm.Metadata.Namespace = namespace
+
+	for _, file := range files {
+		// Like kubectl create configmap --from-file, skip subdirectories.
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		key := file.Name()
+		if !configMapKeyRe.MatchString(key) {
+			return nil, errors.Errorf("%q is not a valid ConfigMap key", key)
+		}
+
+		data, err := hydrateConfigMapFile(h, filepath.Join(dir, key))
+		if err != nil {
+			return nil, errors.Wrap(err, key)
+		}
+
+		if utf8.Valid(data) {
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[key] = string(data)
+		} else {
+			if cm.BinaryData == nil {
+				cm.BinaryData = map[string]string{}
+			}
+			cm.BinaryData[key] = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return cm, nil
+}
+
+// hydrateConfigMapFile hydrates files of known formats. Other files are
+// packed as they are.
+func hydrateConfigMapFile(h hydrator, filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.TrimLeft(filepath.Ext(filename), ".")
+	if !inputFormats[format] {
+		logger.Log(hydrate.LevelWarn, "k8s-configmap: unknown file format, packed as is", "file", filename)
+		return data, nil
+	}
+
+	var b bytes.Buffer
+	if err := h.HydrateFormatContext(hydrate.WithIncludeDir(context.Background(), filepath.Dir(filename)), &b, bytes.NewReader(data), format, "", false); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackConfigMap(t *testing.T) {
+	tt := []struct {
+		name       string
+		files      map[string]string
+		data       map[string]string
+		binaryData map[string]string
+		err        string
+	}{
+		{
+			name:  "hydrated",
+			files: map[string]string{"app.yml": "db: $SSM:db\n"},
+			data:  map[string]string{"app.yml": "DB: $SSM:DB\n"},
+		},
+		{
+			name:  "unknown format packed as is",
+			files: map[string]string{"notes.txt": "hello\n", "app.json": `{"a":"b"}`},
+			data:  map[string]string{"notes.txt": "hello\n", "app.json": `{"A":"B"}`},
+		},
+		{
+			name:       "binary",
+			files:      map[string]string{"logo.bin": "\xff\xfe"},
+			binaryData: map[string]string{"logo.bin": "//4="},
+		},
+		{
+			name:  "subdirectories skipped",
+			files: map[string]string{"sub/app.yml": "a: b\n", "app.env": "A=b\n"},
+			data:  map[string]string{"app.env": "A=B\n"},
+		},
+		{
+			name:  "invalid key",
+			files: map[string]string{"app conf.yml": "a: b\n"},
+			err:   `"app conf.yml" is not a valid ConfigMap key`,
+		},
+	}
+
+	for _, tc := range tt {
+		dir, err := ioutil.TempDir("", "hydrate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for name, content := range tc.files {
+			filename := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cm, err := packConfigMap(upperHydrator{}, dir, "app-conf", "sit1")
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+		if cm.Kind != "ConfigMap" || cm.Metadata.Name != "app-conf" || cm.Metadata.Namespace != "sit1" {
+			t.Errorf("%v: unexpected header %+v", tc.name, cm)
+		}
+		if !reflect.DeepEqual(cm.Data, tc.data) {
+			t.Errorf("%v: expected data %q, got %q", tc.name, tc.data, cm.Data)
+		}
+		if !reflect.DeepEqual(cm.BinaryData, tc.binaryData) {
+			t.Errorf("%v: expected binaryData %q, got %q", tc.name, tc.binaryData, cm.BinaryData)
+		}
+	}
+}
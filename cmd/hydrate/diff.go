@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// diffContext is the number of unchanged lines around changes of a diff.
+const diffContext = 3
+
+func diff(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate diff", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		format   = flags.String("format", "", "input file format: json, yaml, toml, env (defaults to file extension)")
+		k8s      = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+		hash     = flags.Bool("hash", false, "fetch the secrets and show their SHA-256 hashes instead of their paths, ie. to spot rotated values")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate diff: exactly one input file must be provided"))
+	}
+	filename := flags.Arg(0)
+	r := openInput(filename, format)
+	defer r.Close()
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate diff: failed to read input"))
+	}
+
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	setBackends(paramStore, cfg)
+	paramStore.SetLogger(logger)
+	paramStore.SetRedaction(hydrate.RedactRef)
+	if *hash {
+		paramStore.SetRedaction(hydrate.RedactHash)
+	}
+
+	ctx := context.Background()
+	if filename != "-" {
+		ctx = hydrate.WithIncludeDir(ctx, filepath.Dir(filename))
+	}
+	var hydrated bytes.Buffer
+	if err := paramStore.HydrateContext(ctx, &hydrated, bytes.NewReader(input), *format, *k8s); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate diff"))
+	}
+	original, err := normalize(input, *format)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate diff"))
+	}
+
+	if changed := writeDiff(os.Stdout, filename, filename+" (hydrated)", lines(original), lines(hydrated.Bytes())); changed {
+		os.Exit(1)
+	}
+}
+
+// normalize re-encodes YAML input like the hydration does, so that only
+// the hydrated values differ, not the indentation. JSON, TOML and env
+// inputs are hydrated keeping their formatting.
+func normalize(input []byte, format string) ([]byte, error) {
+	if format != "yml" && format != "yaml" {
+		return input, nil
+	}
+
+	var b bytes.Buffer
+	dec := yaml.NewDecoder(bytes.NewReader(input))
+	enc := yaml.NewEncoder(&b)
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to decode YAML")
+		}
+		resetMergeTags(&node)
+		if err := enc.Encode(&node); err != nil {
+			return nil, errors.Wrap(err, "failed to encode YAML")
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// resetMergeTags writes merge keys as `<<:`, like the hydration does.
+func resetMergeTags(node *yaml.Node) {
+	if node.Tag == "!!merge" {
+		node.Tag = ""
+	}
+	for _, n := range node.Content {
+		resetMergeTags(n)
+	}
+}
+
+func lines(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// writeDiff writes the unified diff of the lines of a and b. It reports
+// whether they differ.
+func writeDiff(w io.Writer, aName, bName string, a, b []string) bool {
+	ops := diffLines(a, b)
+
+	// Group the changes into hunks, joining those within twice the context.
+	var hunks [][2]int // Ranges of ops.
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		start, end := i-diffContext, i+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+			continue
+		}
+		hunks = append(hunks, [2]int{start, end})
+	}
+	if len(hunks) == 0 {
+		return false
+	}
+
+	fmt.Fprintf(w, "--- %v\n+++ %v\n", aName, bName)
+	for _, hunk := range hunks {
+		hunkOps := ops[hunk[0]:hunk[1]]
+		aStart, bStart := hunkOps[0].a+1, hunkOps[0].b+1
+		var aLen, bLen int
+		for _, op := range hunkOps {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+		fmt.Fprintf(w, "@@ -%v,%v +%v,%v @@\n", aStart, aLen, bStart, bLen)
+		for _, op := range hunkOps {
+			fmt.Fprintf(w, "%c%v\n", op.kind, op.line)
+		}
+	}
+	return true
+}
+
+// diffOp is a line kept (' '), removed ('-') or added ('+') by a diff,
+// at the line indexes a and b of the inputs.
+type diffOp struct {
+	kind byte
+	line string
+	a, b int
+}
+
+// diffLines returns the operations turning a into b, along their longest
+// common subsequence of lines. Common leading and trailing lines are
+// skipped, as hydration changes few lines of large files.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', line: a[i], a: i, b: i})
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, diffOp{kind: ' ', line: x[i], a: prefix + i, b: prefix + j})
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{kind: '-', line: x[i], a: prefix + i, b: prefix + j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: y[j], a: prefix + i, b: prefix + j})
+			j++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		ops = append(ops, diffOp{kind: ' ', line: a[len(a)-suffix+k], a: len(a) - suffix + k, b: len(b) - suffix + k})
+	}
+	return ops
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDiff(t *testing.T) {
+	tt := []struct {
+		name     string
+		a, b     []string
+		expected string
+	}{
+		{name: "equal", a: []string{"a", "b"}, b: []string{"a", "b"}},
+		{
+			name:     "changed",
+			a:        []string{"db:", "  pass: $$", "  port: 5432"},
+			b:        []string{"db:", "  pass: <redacted:/app/db/pass>", "  port: 5432"},
+			expected: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n db:\n-  pass: $$\n+  pass: <redacted:/app/db/pass>\n   port: 5432\n",
+		},
+		{
+			name:     "hunks",
+			a:        []string{"1", "x", "3", "4", "5", "6", "7", "8", "9", "y"},
+			b:        []string{"1", "X", "3", "4", "5", "6", "7", "8", "9", "Y"},
+			expected: "--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-x\n+X\n 3\n 4\n 5\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-y\n+Y\n",
+		},
+		{name: "added", b: []string{"a"}, expected: "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+a\n"},
+		{name: "removed", a: []string{"a"}, expected: "--- a\n+++ b\n@@ -1,1 +0,0 @@\n-a\n"},
+	}
+
+	for _, tc := range tt {
+		var b bytes.Buffer
+		changed := writeDiff(&b, "a", "b", tc.a, tc.b)
+		if changed != (tc.expected != "") {
+			t.Errorf("%v: expected changed %v, got %v", tc.name, tc.expected != "", changed)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected:\n%s\ngot:\n%s", tc.name, tc.expected, b.String())
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tt := []struct {
+		format   string
+		input    string
+		expected string
+	}{
+		{format: "yaml", input: "db:\n  pass: $$\n", expected: "db:\n    pass: $$\n"},
+		{format: "yml", input: "base: &base {a: 1}\nx:\n  <<: *base\n", expected: "base: &base {a: 1}\nx:\n    <<: *base\n"},
+		{format: "json", input: `{"pass":  "$$"}`, expected: `{"pass":  "$$"}`},
+	}
+
+	for _, tc := range tt {
+		out, err := normalize([]byte(tc.input), tc.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.format, tc.expected, out)
+		}
+	}
+}
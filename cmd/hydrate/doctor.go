@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/pressly/hydrate"
+)
+
+// maxClockSkew is the max clock skew tolerated by AWS SigV4 signatures.
+const maxClockSkew = 5 * time.Minute
+
+type doctorReport struct {
+	failed bool
+}
+
+func (r *doctorReport) ok(check, format string, args ...interface{}) {
+	fmt.Printf("[ OK ] %v: %v\n", check, fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(check, format string, args ...interface{}) {
+	fmt.Printf("[WARN] %v: %v\n", check, fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) fail(check, format string, args ...interface{}) {
+	r.failed = true
+	fmt.Printf("[FAIL] %v: %v\n", check, fmt.Sprintf(format, args...))
+}
+
+func doctor(args []string) {
+	var (
+		flags   = flag.NewFlagSet("hydrate doctor", flag.ExitOnError)
+		region  = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		probe   = flags.String("probe", "", "SecureString parameter to check fetching and KMS decryption with, ie. /app/sit1/db_password")
+		timeout = flags.Duration("timeout", 10*time.Second, "timeout of each check")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	report := &doctorReport{}
+	defer func() {
+		if report.failed {
+			os.Exit(1)
+		}
+	}()
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), configOptions(*region)...)
+	if err != nil {
+		report.fail("config", "failed to load AWS config: %v", err)
+		return
+	}
+
+	// Region resolution.
+	source := "--region"
+	if *region == "" {
+		source = "the shared config profile"
+		for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+			if os.Getenv(env) != "" {
+				source = "$" + env
+				break
+			}
+		}
+	}
+	if cfg.Region == "" {
+		report.fail("region", "not configured, set --region, $AWS_REGION or a --profile with a region")
+		return
+	}
+	report.ok("region", "%v (from %v)", cfg.Region, source)
+
+	// Proxy settings.
+	endpoint := fmt.Sprintf("https://ssm.%v.amazonaws.com/", cfg.Region)
+	if cfg.BaseEndpoint != nil {
+		endpoint = aws.ToString(cfg.BaseEndpoint)
+	}
+	req, _ := http.NewRequest("HEAD", endpoint, nil)
+	if proxy, err := http.ProxyFromEnvironment(req); err != nil {
+		report.fail("proxy", "invalid proxy settings: %v", err)
+	} else if proxy != nil {
+		report.ok("proxy", "%v via %v", endpoint, redactURL(proxy))
+	} else {
+		report.ok("proxy", "none, %v is reached directly", endpoint)
+	}
+
+	checkEndpoint(report, &http.Client{Timeout: *timeout}, req)
+
+	// Credential chain.
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	cancel()
+	if err != nil {
+		report.fail("credentials", "no valid credentials found: %v", err)
+		return
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	cancel()
+	if err != nil {
+		report.fail("credentials", "%v credentials rejected: %v", creds.Source, err)
+		return
+	}
+	report.ok("credentials", "%v (from %v)", aws.ToString(identity.Arn), creds.Source)
+
+	// SSM access.
+	svc := ssm.NewFromConfig(cfg)
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	_, err = svc.DescribeParameters(ctx, &ssm.DescribeParametersInput{MaxResults: aws.Int32(1)})
+	cancel()
+	if err != nil {
+		report.fail("ssm", "DescribeParameters failed: %v", err)
+	} else {
+		report.ok("ssm", "Parameter Store API accessible")
+	}
+
+	// Fetching and KMS decryption of the probe parameter.
+	if *probe == "" {
+		report.warn("kms", "skipped, pass --probe=[/path/to/secure/parameter] to check decryption")
+		return
+	}
+	provider := hydrate.SSMProvider(svc)
+	provider.SetLogger(logger)
+	ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	secret, err := provider.GetSecret(ctx, *probe)
+	cancel()
+	if err != nil {
+		report.fail("kms", "%v", err)
+		return
+	}
+	report.ok("kms", "%q fetched and decrypted (%v bytes)", *probe, len(secret))
+}
+
+// checkEndpoint checks connectivity and clock skew, based on the endpoint's
+// Date header.
+func checkEndpoint(report *doctorReport, client *http.Client, req *http.Request) {
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		report.fail("connectivity", "can't reach %v: %v", req.URL, err)
+		return
+	}
+	resp.Body.Close()
+	report.ok("connectivity", "%v reachable in %v", req.URL, time.Since(start).Round(time.Millisecond))
+
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err != nil {
+		report.warn("clock", "can't check clock skew, no Date header in response")
+	} else if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		report.fail("clock", "local clock is off by %v, AWS rejects requests skewed by more than %v", skew.Round(time.Second), maxClockSkew)
+	} else {
+		report.ok("clock", "skew %v", skew.Round(time.Second))
+	}
+}
+
+// redactURL hides the password of proxy URLs.
+func redactURL(u *url.URL) string {
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+type referencer interface {
+	FieldReferencesContext(ctx context.Context, r io.Reader, format string, k8s bool) ([]hydrate.Reference, error)
+}
+
+type existenceChecker interface {
+	Exists(ctx context.Context, paths []string) (map[string]bool, error)
+}
+
+type versionResolver interface {
+	Versions(ctx context.Context, paths []string) (map[string]int64, error)
+}
+
+// fileRef is a parameter reference of a file's field.
+type fileRef struct {
+	file string
+	hydrate.Reference
+}
+
+// dryRun prints the parameters referenced by each field of the files,
+// without fetching any secrets. If checker is set, it also checks that
+// the parameters exist. If resolver is set, it prints the references pinned
+// to the current versions, ie. "/app/db_pass:3", to commit them. It returns
+// the references of missing parameters.
+func dryRun(ctx context.Context, ps referencer, checker existenceChecker, resolver versionResolver, filenames []string, format string, k8s bool) ([]fileRef, error) {
+	var refs []fileRef
+	for _, filename := range filenames {
+		fileRefs, err := fieldReferences(ctx, ps, filename, format, k8s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v", filename)
+		}
+		for _, ref := range fileRefs {
+			refs = append(refs, fileRef{filename, ref})
+		}
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if !seen[ref.Parameter] {
+			seen[ref.Parameter] = true
+			paths = append(paths, ref.Parameter)
+		}
+	}
+
+	var exists map[string]bool
+	if checker != nil {
+		var err error
+		if exists, err = checker.Exists(ctx, paths); err != nil {
+			return nil, err
+		}
+	}
+
+	var versions map[string]int64
+	if resolver != nil {
+		var err error
+		if versions, err = resolver.Versions(ctx, paths); err != nil {
+			return nil, err
+		}
+	}
+
+	var missingRefs []fileRef
+	missing := map[string]bool{}
+	for _, ref := range refs {
+		field := ref.Field
+		if field == "" {
+			field = "(template)"
+		}
+		if len(filenames) > 1 {
+			field = ref.file + ": " + field
+		}
+
+		param := ref.Parameter
+		if version, ok := versions[param]; ok {
+			param = fmt.Sprintf("%v:%v", pinnedName(param), version)
+		}
+
+		switch {
+		case checker == nil:
+			fmt.Printf("%v -> %v\n", field, param)
+		case exists[ref.Parameter]:
+			fmt.Printf("ok       %v -> %v\n", field, param)
+		default:
+			missing[ref.Parameter] = true
+			missingRefs = append(missingRefs, ref)
+			fmt.Printf("missing  %v -> %v\n", field, param)
+		}
+	}
+	if len(missing) > 0 {
+		logger.Log(hydrate.LevelError, "referenced parameters don't exist", "missing", len(missing), "total", len(paths))
+	}
+	return missingRefs, nil
+}
+
+// pinnedName strips the version or label of a pinned parameter reference.
+func pinnedName(param string) string {
+	slash := strings.LastIndex(param, "/")
+	if i := strings.LastIndexAny(param, ":#"); i > slash {
+		return param[:i]
+	}
+	return param
+}
+
+func fieldReferences(ctx context.Context, ps referencer, filename, format string, k8s bool) ([]hydrate.Reference, error) {
+	if filename == "-" {
+		return ps.FieldReferencesContext(ctx, os.Stdin, format, k8s)
+	}
+	if format == "" {
+		format = strings.TrimLeft(filepath.Ext(filename), ".")
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ps.FieldReferencesContext(hydrate.WithIncludeDir(ctx, filepath.Dir(filename)), f, format, k8s)
+}
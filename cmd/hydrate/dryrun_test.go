@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// fakeReferencer references "/app/<word>" parameters of the "<field>: <word>"
+// lines of its inputs, or of "(template)" lines without a field.
+type fakeReferencer struct{}
+
+func (fakeReferencer) FieldReferencesContext(ctx context.Context, r io.Reader, format string, k8s bool) ([]hydrate.Reference, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var refs []hydrate.Reference
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "invalid" {
+			return nil, errors.Errorf("failed to decode %v", format)
+		}
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) == 1 {
+			refs = append(refs, hydrate.Reference{Parameter: "/app/" + kv[0]})
+			continue
+		}
+		refs = append(refs, hydrate.Reference{Field: kv[0], Parameter: "/app/" + kv[1]})
+	}
+	return refs, nil
+}
+
+type fakeChecker map[string]bool
+
+func (c fakeChecker) Exists(ctx context.Context, paths []string) (map[string]bool, error) {
+	if c == nil {
+		return nil, errors.New("AccessDeniedException")
+	}
+	return c, nil
+}
+
+type fakeResolver map[string]int64
+
+func (r fakeResolver) Versions(ctx context.Context, paths []string) (map[string]int64, error) {
+	return r, nil
+}
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yml":     "db.password: db_pass\ndb.user: user\n",
+		"b.yml":     "api.key: api_key\n",
+		"c.tmpl":    "db_pass\n",
+		"bad.yml":   "invalid\n",
+		"other.yml": "x: missing\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := fakeChecker{"/app/db_pass": true, "/app/user": true, "/app/api_key": true}
+
+	tt := []struct {
+		files    []string
+		checker  existenceChecker
+		resolver versionResolver
+		expected string
+		missing  []fileRef
+		err      string
+	}{
+		{
+			files:    []string{"a.yml"},
+			expected: "db.password -> /app/db_pass\ndb.user -> /app/user\n",
+		},
+		{
+			files:    []string{"c.tmpl"},
+			expected: "(template) -> /app/db_pass\n",
+		},
+		{
+			files:    []string{"a.yml", "b.yml"},
+			checker:  exists,
+			expected: "ok       a.yml: db.password -> /app/db_pass\nok       a.yml: db.user -> /app/user\nok       b.yml: api.key -> /app/api_key\n",
+		},
+		{
+			files:    []string{"a.yml", "other.yml"},
+			checker:  exists,
+			expected: "ok       a.yml: db.password -> /app/db_pass\nok       a.yml: db.user -> /app/user\nmissing  other.yml: x -> /app/missing\n",
+			missing:  []fileRef{{"other.yml", hydrate.Reference{Field: "x", Parameter: "/app/missing"}}},
+		},
+		{
+			files:    []string{"a.yml"},
+			resolver: fakeResolver{"/app/db_pass": 3},
+			expected: "db.password -> /app/db_pass:3\ndb.user -> /app/user\n",
+		},
+		{files: []string{"a.yml", "bad.yml"}, err: "bad.yml: failed to decode yml"},
+		{files: []string{"missing.yml"}, err: "no such file or directory"},
+		{files: []string{"a.yml"}, checker: fakeChecker(nil), err: "AccessDeniedException"},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, tc := range tt {
+		var (
+			missing []fileRef
+			err     error
+		)
+		output := captureStdout(t, func() {
+			missing, err = dryRun(context.Background(), fakeReferencer{}, tc.checker, tc.resolver, tc.files, "", false)
+		})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.files, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != tc.expected {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", tc.files, tc.expected, output)
+		}
+		if !reflect.DeepEqual(missing, tc.missing) {
+			t.Errorf("%q: expected %v missing, got %v", tc.files, tc.missing, missing)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// emitSpec maps secrets to files, similar to the Secrets Store CSI
+// driver's SecretProviderClass.
+type emitSpec struct {
+	Files []emitFile `yaml:"files"`
+}
+
+type emitFile struct {
+	Path   string `yaml:"path"`   // Relative to --dir.
+	Secret string `yaml:"secret"` // ie. $SECRET:/app/db/password
+	Mode   string `yaml:"mode"`   // Octal file mode, defaults to 0400.
+	UID    *int   `yaml:"uid"`
+	GID    *int   `yaml:"gid"`
+}
+
+func emit(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate emit", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		specFile = flags.String("spec", "", "YAML spec mapping secrets to files, permissions and ownership")
+		dir      = flags.String("dir", "", "directory to write the secret files into, ie. /mnt/secrets")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *specFile == "" || *dir == "" {
+		log.Fatal(errors.New("hydrate emit: --spec=[spec.yaml] and --dir=[/mnt/secrets] must be provided"))
+	}
+
+	b, err := ioutil.ReadFile(*specFile)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate emit: failed to read spec"))
+	}
+	var spec emitSpec
+	if err := yaml.Unmarshal(b, &spec); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate emit: failed to decode spec"))
+	}
+
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	setBackends(paramStore, cfg)
+	paramStore.SetLogger(logger)
+
+	written, err := emitFiles(paramStore, *dir, spec.Files)
+	for _, filename := range written {
+		logger.Log(hydrate.LevelInfo, "wrote file", "file", filename)
+	}
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate emit"))
+	}
+}
+
+type lookuper interface {
+	Lookup(value string) (string, error)
+}
+
+// emitFiles resolves the secrets of all files first, so that a failure
+// leaves no files behind, and then writes them into dir.
+func emitFiles(l lookuper, dir string, files []emitFile) ([]string, error) {
+	values := make([]string, len(files))
+	for i, file := range files {
+		if file.Path == "" || filepath.IsAbs(file.Path) || strings.HasPrefix(filepath.Clean(file.Path), "..") {
+			return nil, errors.Errorf("files[%v]: path %q must be relative to --dir", i, file.Path)
+		}
+		var err error
+		if values[i], err = l.Lookup(file.Secret); err != nil {
+			return nil, errors.Wrap(err, file.Path)
+		}
+	}
+
+	var written []string
+	for i, file := range files {
+		if err := emitFileAtomic(dir, file, values[i]); err != nil {
+			return written, errors.Wrap(err, file.Path)
+		}
+		written = append(written, filepath.Join(dir, file.Path))
+	}
+	return written, nil
+}
+
+// emitFileAtomic writes the file via a temporary file renamed into place,
+// so that readers never see partially written secrets.
+func emitFileAtomic(dir string, file emitFile, value string) error {
+	mode := uint64(0400)
+	if file.Mode != "" {
+		var err error
+		if mode, err = strconv.ParseUint(file.Mode, 8, 32); err != nil {
+			return errors.Errorf("invalid mode %q", file.Mode)
+		}
+	}
+
+	out := filepath.Join(dir, file.Path)
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(out), "."+filepath.Base(out)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), os.FileMode(mode)); err != nil {
+		return err
+	}
+	if file.UID != nil || file.GID != nil {
+		uid, gid := -1, -1
+		if file.UID != nil {
+			uid = *file.UID
+		}
+		if file.GID != nil {
+			gid = *file.GID
+		}
+		if err := os.Chown(tmp.Name(), uid, gid); err != nil {
+			return errors.Wrap(err, "failed to set ownership")
+		}
+	}
+	return os.Rename(tmp.Name(), out)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// mapLookuper resolves "$SECRET:<key>" references from a map.
+type mapLookuper map[string]string
+
+func (l mapLookuper) Lookup(value string) (string, error) {
+	if !strings.HasPrefix(value, "$SECRET:") {
+		return value, nil
+	}
+	secret, ok := l[strings.TrimPrefix(value, "$SECRET:")]
+	if !ok {
+		return "", errors.Errorf("%q not found", value)
+	}
+	return secret, nil
+}
+
+func TestEmitFiles(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	secrets := mapLookuper{"/app/db/password": "p4ss", "/app/api_key": "k3y"}
+
+	tt := []struct {
+		files    []emitFile
+		expected map[string]string
+		modes    map[string]os.FileMode
+		err      string
+	}{
+		{
+			files: []emitFile{
+				{Path: "db/password", Secret: "$SECRET:/app/db/password", Mode: "0440", UID: &uid, GID: &gid},
+				{Path: "api-key", Secret: "$SECRET:/app/api_key"},
+				{Path: "literal", Secret: "plain", Mode: "644"},
+			},
+			expected: map[string]string{"db/password": "p4ss", "api-key": "k3y", "literal": "plain"},
+			modes:    map[string]os.FileMode{"db/password": 0440, "api-key": 0400, "literal": 0644},
+		},
+		{
+			files: []emitFile{{Path: "a", Secret: "$SECRET:/app/api_key"}, {Path: "b", Secret: "$SECRET:/app/missing"}},
+			err:   `b: "$SECRET:/app/missing" not found`,
+		},
+		{files: []emitFile{{Path: "/etc/passwd", Secret: "x"}}, err: `files[0]: path "/etc/passwd" must be relative to --dir`},
+		{files: []emitFile{{Path: "a/../../b", Secret: "x"}}, err: `files[0]: path "a/../../b" must be relative to --dir`},
+		{files: []emitFile{{Secret: "x"}}, err: `files[0]: path "" must be relative to --dir`},
+		{files: []emitFile{{Path: "a", Secret: "x", Mode: "rw"}}, err: `a: invalid mode "rw"`},
+	}
+
+	for _, tc := range tt {
+		dir := t.TempDir()
+		written, err := emitFiles(secrets, dir, tc.files)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			// Failed lookups leave no files behind.
+			if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("%v: expected no files, got %v", tc.err, len(entries))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var expectedWritten []string
+		for _, file := range tc.files {
+			expectedWritten = append(expectedWritten, filepath.Join(dir, file.Path))
+		}
+		if !reflect.DeepEqual(written, expectedWritten) {
+			t.Errorf("expected written files %q, got %q", expectedWritten, written)
+		}
+		for name, expected := range tc.expected {
+			filename := filepath.Join(dir, name)
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != expected {
+				t.Errorf("%v: expected %q, got %q", name, expected, data)
+			}
+			if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != tc.modes[name] {
+				t.Errorf("%v: expected mode %v, got %v", name, tc.modes[name], fi.Mode().Perm())
+			}
+		}
+		// No temporary files are left in place.
+		if entries, _ := ioutil.ReadDir(filepath.Join(dir, "db")); len(entries) != 1 {
+			t.Errorf("expected only db/password, got %v files", len(entries))
+		}
+	}
+}
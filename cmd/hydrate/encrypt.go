@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+type fieldEncrypter interface {
+	EncryptFields(patterns []string, cipher hydrate.FieldCipher) error
+}
+
+func encryptFields(h fieldEncrypter, patterns []string, kmsKey, ageRecipients, region string) error {
+	var (
+		cipher hydrate.FieldCipher
+		err    error
+	)
+	switch {
+	case kmsKey != "" && ageRecipients != "":
+		return errors.New("hydrate: only one of --encrypt-kms-key and --encrypt-age can be provided")
+	case kmsKey != "":
+		cipher, err = hydrate.KMSCipher(kms.NewFromConfig(newConfig(region)), kmsKey)
+	case ageRecipients != "":
+		cipher, err = hydrate.AgeCipher(strings.Split(ageRecipients, ",")...)
+	default:
+		return errors.New("hydrate: --encrypt-fields requires --encrypt-kms-key or --encrypt-age")
+	}
+	if err != nil {
+		return errors.Wrap(err, "hydrate")
+	}
+
+	return errors.Wrap(h.EncryptFields(patterns, cipher), "hydrate")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/pressly/hydrate"
+)
+
+type fakeEncrypter struct {
+	patterns []string
+	cipher   hydrate.FieldCipher
+}
+
+func (e *fakeEncrypter) EncryptFields(patterns []string, cipher hydrate.FieldCipher) error {
+	e.patterns, e.cipher = patterns, cipher
+	return nil
+}
+
+func TestEncryptFieldsFlags(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := identity.Recipient().String()
+
+	tt := []struct {
+		kmsKey, ageRecipients string
+		cipher                string
+		err                   string
+	}{
+		{ageRecipients: recipient, cipher: "age"},
+		{ageRecipients: recipient + "," + recipient, cipher: "age"},
+		{ageRecipients: "age1invalid", err: `invalid age recipient "age1invalid"`},
+		{kmsKey: "alias/app", ageRecipients: recipient, err: "only one of --encrypt-kms-key and --encrypt-age can be provided"},
+		{err: "--encrypt-fields requires --encrypt-kms-key or --encrypt-age"},
+	}
+
+	for _, tc := range tt {
+		e := &fakeEncrypter{}
+		err := encryptFields(e, []string{"db.*"}, tc.kmsKey, tc.ageRecipients, "us-east-1")
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.cipher.Manifest()["type"]; got != tc.cipher || e.patterns[0] != "db.*" {
+			t.Errorf("expected %v cipher of db.*, got %v of %v", tc.cipher, got, e.patterns)
+		}
+	}
+}
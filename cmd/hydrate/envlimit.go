@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+const (
+	// maxExecSize is the size of the arguments and environment accepted by
+	// execve on all supported platforms, ie. ARG_MAX of macOS. Each string
+	// counts with its NUL terminator and pointer.
+	maxExecSize = 1 << 20
+
+	// maxEnvVarSize is the max size of a single "KEY=VALUE" string on Linux,
+	// MAX_ARG_STRLEN.
+	maxEnvVarSize = 128 << 10
+
+	// secretsDirEnv is exported with the directory of the variables that
+	// didn't fit into the environment.
+	secretsDirEnv = "HYDRATE_SECRETS_DIR"
+)
+
+// envSpiller writes hydrated variables that would exceed the OS limits of
+// the command's environment into files of a directory, one per variable,
+// instead of failing to start the command with "argument list too long".
+type envSpiller struct {
+	dir     string // Created on first spill, removed by cleanup.
+	spilled map[string]bool
+}
+
+// fit returns the env vars of the command that fit into its environment.
+// The largest variables are written into files named by the variables, in
+// the directory exported as $HYDRATE_SECRETS_DIR.
+func (s *envSpiller) fit(command, env []string) ([]string, error) {
+	size := execSize(command) + execSize(os.Environ())
+	for _, kv := range env {
+		size += execSize([]string{kv})
+	}
+
+	// Spill the largest variables first, so that as few as possible move.
+	bySize := append([]string(nil), env...)
+	sort.SliceStable(bySize, func(i, j int) bool {
+		return len(bySize[i]) > len(bySize[j])
+	})
+	spill := map[string]bool{}
+	reserve := execSize([]string{secretsDirEnv + "=" + filepath.Join(os.TempDir(), "hydrate-exec-000000000")})
+	for _, kv := range bySize {
+		if len(kv)+1 <= maxEnvVarSize && size+reserve <= maxExecSize {
+			break
+		}
+		spill[kv] = true
+		size -= execSize([]string{kv})
+	}
+	if len(spill) == 0 && s.dir == "" {
+		return env, nil
+	}
+	if size+reserve > maxExecSize {
+		return nil, errors.Errorf("command line and inherited environment exceed the %v bytes limit", maxExecSize)
+	}
+
+	if s.dir == "" {
+		dir, err := ioutil.TempDir("", "hydrate-exec-")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create secrets directory")
+		}
+		s.dir = dir
+	}
+	spilled := map[string]bool{}
+	fitted := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !spill[kv] {
+			fitted = append(fitted, kv)
+			continue
+		}
+		i := strings.Index(kv, "=")
+		key, value := kv[:i], kv[i+1:]
+		if strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+			return nil, errors.Errorf("%q env var is too large for the environment and can't be written into a file", key)
+		}
+		if err := emitFileAtomic(s.dir, emitFile{Path: key}, value); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %q env var into secrets directory", key)
+		}
+		if !s.spilled[key] {
+			logger.Log(hydrate.LevelWarn, "env var exceeds the OS environment limits, written into the secrets directory instead", "key", key, "file", "$"+secretsDirEnv+"/"+key)
+		}
+		spilled[key] = true
+	}
+	// Remove the files of variables that fit again after a renewal.
+	for key := range s.spilled {
+		if !spilled[key] {
+			os.Remove(filepath.Join(s.dir, key))
+		}
+	}
+	s.spilled = spilled
+
+	return append(fitted, secretsDirEnv+"="+s.dir), nil
+}
+
+// cleanup removes the secrets directory.
+func (s *envSpiller) cleanup() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// execSize returns the size of the strings passed to execve, including
+// their NUL terminators and pointers.
+func execSize(strs []string) int {
+	size := 0
+	for _, s := range strs {
+		size += len(s) + 1 + 8
+	}
+	return size
+}
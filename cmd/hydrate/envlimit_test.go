@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvSpillerFit(t *testing.T) {
+	large := strings.Repeat("x", maxEnvVarSize)
+	half := large[:maxEnvVarSize/2]
+	var halves []string
+	for i := 0; i < 2*maxExecSize/maxEnvVarSize; i++ {
+		halves = append(halves, fmt.Sprintf("V%02d=%v", i, half))
+	}
+	// The largest variables are spilled until the rest fits.
+	spilled := len(halves) - (maxExecSize-execSize(os.Environ())-execSize([]string{"app", "SMALL=1", secretsDirEnv + "=" + filepath.Join(os.TempDir(), "hydrate-exec-000000000")}))/execSize(halves[:1])
+	tt := []struct {
+		name    string
+		env     []string
+		fitted  []string // Besides $HYDRATE_SECRETS_DIR.
+		spilled map[string]string
+		err     string
+	}{
+		{
+			name:   "fits",
+			env:    []string{"A=1", "B=2"},
+			fitted: []string{"A=1", "B=2"},
+		},
+		{
+			name:    "large var",
+			env:     []string{"A=1", "CERT=" + large, "B=2"},
+			fitted:  []string{"A=1", "B=2"},
+			spilled: map[string]string{"CERT": large},
+		},
+		{
+			name:    "large environment",
+			env:     append(halves, "SMALL=1"),
+			fitted:  append(halves[spilled:], "SMALL=1"),
+			spilled: map[string]string{"V00": half},
+		},
+		{
+			name: "invalid file name",
+			env:  []string{"A/B=" + large},
+			err:  `"A/B" env var is too large for the environment and can't be written into a file`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &envSpiller{}
+			defer s.cleanup()
+			fitted, err := s.fit([]string{"app"}, tc.env)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tc.spilled) == 0 {
+				if !reflect.DeepEqual(fitted, tc.fitted) || s.dir != "" {
+					t.Errorf("expected %q without a secrets directory, got %q", tc.fitted, fitted)
+				}
+				return
+			}
+			if last := fitted[len(fitted)-1]; last != secretsDirEnv+"="+s.dir {
+				t.Errorf("expected $%v last, got %q", secretsDirEnv, last)
+			}
+			if size := execSize([]string{"app"}) + execSize(os.Environ()) + execSize(fitted); size > maxExecSize {
+				t.Errorf("expected the environment to fit, got %v bytes", size)
+			}
+			if tc.fitted != nil && !reflect.DeepEqual(fitted[:len(fitted)-1], tc.fitted) {
+				t.Errorf("expected %q, got %q", tc.fitted, fitted[:len(fitted)-1])
+			}
+			for key, value := range tc.spilled {
+				data, err := ioutil.ReadFile(filepath.Join(s.dir, key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != value {
+					t.Errorf("expected %v file of %v bytes, got %v", key, len(value), len(data))
+				}
+			}
+		})
+	}
+}
+
+func TestEnvSpillerRenewal(t *testing.T) {
+	s := &envSpiller{}
+	defer s.cleanup()
+
+	if _, err := s.fit([]string{"app"}, []string{"CERT=" + strings.Repeat("x", maxEnvVarSize)}); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(s.dir, "CERT")
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// The renewed value fits, the directory is still exported but empty.
+	fitted, err := s.fit([]string{"app"}, []string{"CERT=small"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"CERT=small", secretsDirEnv + "=" + s.dir}; !reflect.DeepEqual(fitted, expected) {
+		t.Errorf("expected %q, got %q", expected, fitted)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected the spilled file to be removed, got %v", err)
+	}
+
+	s.cleanup()
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Errorf("expected the secrets directory to be removed, got %v", err)
+	}
+}
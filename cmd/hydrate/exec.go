@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// renewRetryInterval is the delay between failed renewals.
+const renewRetryInterval = 30 * time.Second
+
+func execCommand(args []string) {
+	var (
+		flags       = flag.NewFlagSet("hydrate exec", flag.ExitOnError)
+		region      = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath    = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		format      = flags.String("format", "", "env file format: env, json, yaml, toml (defaults to file extension)")
+		renewBefore = flags.Duration("renew-before-expiry", 0, "re-hydrate expiring secrets (ie. Vault leases) this long before they expire, ie. 5m (0 = never)")
+		renewSignal = flags.String("renew-signal", "", "send the signal (ie. HUP) instead of restarting the command on renewal, requires --env-out")
+		envOut      = flags.String("env-out", "", "write the hydrated environment into file for the --renew-signal'd command to re-read")
+		envOutFmt   = flags.String("env-out-format", "env", "format of --env-out: env (quoted KEY=VALUE lines), env-export (export lines for eval), env-null (NUL-delimited)")
+		envFile     = flags.String("env-file", "", "env file to hydrate, instead of the $SECRET: references of the current environment")
+	)
+	hydratorFlags(flags)
+	notify := notifyFlags(flags)
+	awsFlags(flags)
+	parseFlags(flags, args)
+	notify.check()
+
+	rest := flags.Args()
+	switch {
+	case *envFile != "":
+	case len(rest) > 1 && rest[1] == "--": // env.yml -- command
+		*envFile, rest = rest[0], rest[2:]
+	case len(args) > len(rest) && args[len(args)-len(rest)-1] == "--":
+		// No env file before "--", hydrate the current environment.
+	case len(rest) > 1:
+		*envFile, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		log.Fatal(errors.New("hydrate exec: usage: hydrate exec [flags] [env.yml] -- command [args...]"))
+	}
+	command := rest
+	switch *envOutFmt {
+	case "env", "env-export", "env-null":
+	default:
+		log.Fatal(errors.Errorf("hydrate exec: unknown --env-out-format=%v, expected env, env-export or env-null", *envOutFmt))
+	}
+	if *format == "" {
+		*format = strings.TrimLeft(filepath.Ext(*envFile), ".")
+	}
+
+	var sig syscall.Signal
+	if *renewSignal != "" {
+		if *envOut == "" {
+			log.Fatal(errors.New("hydrate exec: --renew-signal requires --env-out"))
+		}
+		var ok bool
+		if sig, ok = signalNames[strings.TrimPrefix(strings.ToUpper(*renewSignal), "SIG")]; !ok {
+			log.Fatal(errors.Errorf("hydrate exec: unknown --renew-signal=%v", *renewSignal))
+		}
+	}
+
+	cfg := backendConfig(*region)
+	hydrateEnvFile := func() ([]string, time.Time, error) {
+		// Fresh secret stores, so that renewals fetch everything again.
+		paramStore, err := newStore(cfg, *basePath)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		return hydrateEnv(paramStore, *envFile, *format)
+	}
+
+	env, expires, err := hydrateEnvFile()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate exec"))
+	}
+	if *envOut != "" {
+		if err := writeEnv(*envOut, env, *envOutFmt); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate exec"))
+		}
+	}
+
+	spiller := &envSpiller{}
+	cmdEnv, err := spiller.fit(command, env)
+	if err != nil {
+		spiller.cleanup()
+		log.Fatal(errors.Wrap(err, "hydrate exec"))
+	}
+	cmd, done, err := startCommand(command, cmdEnv)
+	if err != nil {
+		spiller.cleanup()
+		log.Fatal(errors.Wrap(err, "hydrate exec"))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for {
+		var renew <-chan time.Time
+		if *renewBefore > 0 && !expires.IsZero() {
+			renew = time.After(time.Until(expires.Add(-*renewBefore)))
+		}
+
+		select {
+		case err := <-done:
+			spiller.cleanup()
+			os.Exit(exitCode(err))
+
+		case s := <-signals:
+			cmd.Process.Signal(s)
+
+		case <-renew:
+			newEnv, newExpires, err := hydrateEnvFile()
+			if err != nil {
+				notify.failed(failureRenewal, errors.Wrap(err, "failed to renew secrets"), command[0])
+				logger.Log(hydrate.LevelWarn, "failed to renew secrets", "retry", renewRetryInterval.String(), "error", err)
+				expires = time.Now().Add(*renewBefore + renewRetryInterval)
+				continue
+			}
+			env, expires = newEnv, newExpires
+
+			if *envOut != "" {
+				if err := writeEnv(*envOut, env, *envOutFmt); err != nil {
+					logger.Log(hydrate.LevelError, "failed to write env file", "error", err)
+				}
+			}
+			if cmdEnv, err = spiller.fit(command, env); err != nil {
+				notify.failed(failureRenewal, errors.Wrap(err, "failed to renew secrets"), command[0])
+				logger.Log(hydrate.LevelWarn, "failed to renew secrets", "retry", renewRetryInterval.String(), "error", err)
+				expires = time.Now().Add(*renewBefore + renewRetryInterval)
+				continue
+			}
+
+			if sig != 0 {
+				logger.Log(hydrate.LevelInfo, "secrets renewed, signaling command", "signal", sig.String(), "command", command[0])
+				cmd.Process.Signal(sig)
+				continue
+			}
+
+			logger.Log(hydrate.LevelInfo, "secrets renewed, restarting command", "command", command[0])
+			stopCommand(cmd, done)
+			if cmd, done, err = startCommand(command, cmdEnv); err != nil {
+				spiller.cleanup()
+				log.Fatal(errors.Wrap(err, "hydrate exec"))
+			}
+		}
+	}
+}
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// envHydrator hydrates env files or the current environment, see hydrateEnv.
+type envHydrator interface {
+	hydrator
+	fieldResolver
+
+	// Expires returns the earliest expiry of the fetched secrets.
+	Expires() time.Time
+}
+
+// hydrateEnv hydrates the env file, or the current environment if filename
+// is empty, and returns the environment variables, sorted by name, and the
+// earliest expiry of their secrets.
+func hydrateEnv(paramStore envHydrator, filename, format string) ([]string, time.Time, error) {
+	if filename == "" {
+		env, err := hydrateEnviron(paramStore)
+		return env, paramStore.Expires(), err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	if err := paramStore.HydrateFormatContext(context.Background(), &b, f, format, "json", false); err != nil {
+		return nil, time.Time{}, err
+	}
+	var vars map[string]interface{}
+	dec := json.NewDecoder(&b)
+	dec.UseNumber()
+	if err := dec.Decode(&vars); err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "failed to decode env file")
+	}
+
+	env := make([]string, 0, len(vars))
+	for key, value := range vars {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, time.Time{}, errors.Errorf("%q env var must be a scalar value", key)
+		}
+		env = append(env, fmt.Sprintf("%v=%v", key, value))
+	}
+	sort.Strings(env)
+
+	return env, paramStore.Expires(), nil
+}
+
+type fieldResolver interface {
+	Resolve(ctx context.Context, doc interface{}, selectors []string) ([]hydrate.Change, error)
+}
+
+// hydrateEnviron returns the environment variables of the current
+// environment whose values are references, hydrated.
+func hydrateEnviron(ps fieldResolver) ([]string, error) {
+	vars := map[string]interface{}{}
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			vars[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	changes, err := ps.Resolve(context.Background(), vars, []string{"*"})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hydrate environment")
+	}
+	env := make([]string, 0, len(changes))
+	for _, c := range changes {
+		env = append(env, fmt.Sprintf("%v=%v", c.Path, c.New))
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+func writeEnv(filename string, env []string, format string) error {
+	var b bytes.Buffer
+	if err := hydrate.EncodeEnv(&b, env, format); err != nil {
+		return errors.Wrap(err, "failed to write env file")
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0600); err != nil {
+		return errors.Wrap(err, "failed to write env file")
+	}
+	return errors.Wrap(os.Rename(tmp, filename), "failed to write env file")
+}
+
+func startCommand(command, env []string) (*exec.Cmd, <-chan error, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to start %v", command[0])
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	return cmd, done, nil
+}
+
+// stopCommand terminates the command, killing it if it doesn't exit in 10s.
+func stopCommand(cmd *exec.Cmd, done <-chan error) {
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+	logger.Log(hydrate.LevelError, "command failed", "error", err)
+	return 1
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeEnvHydrator hydrates "$$" values of YAML env files as "<key>-s3cr3t"
+// into JSON, with a fixed expiry.
+type fakeEnvHydrator struct {
+	expires time.Time
+}
+
+func (h fakeEnvHydrator) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	var vars map[string]interface{}
+	if err := yaml.NewDecoder(r).Decode(&vars); err != nil {
+		return err
+	}
+	for key, value := range vars {
+		if value == "$$" {
+			vars[key] = key + "-s3cr3t"
+		}
+	}
+	return json.NewEncoder(w).Encode(vars)
+}
+
+// Resolve hydrates "$$" values of the vars as "<key>-s3cr3t".
+func (h fakeEnvHydrator) Resolve(ctx context.Context, doc interface{}, selectors []string) ([]hydrate.Change, error) {
+	var changes []hydrate.Change
+	for key, value := range doc.(map[string]interface{}) {
+		if value == "$$" {
+			changes = append(changes, hydrate.Change{Path: key, Old: "$$", New: key + "-s3cr3t"})
+		}
+	}
+	return changes, nil
+}
+
+func (h fakeEnvHydrator) Expires() time.Time {
+	return h.expires
+}
+
+func TestHydrateEnv(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+
+	tt := []struct {
+		input    string
+		expected []string
+		err      string
+	}{
+		{
+			input:    "DB_PASSWORD: $$\nPORT: 8080\nRATIO: 0.5\nDEBUG: false\nAPI_KEY: $$\n",
+			expected: []string{"API_KEY=API_KEY-s3cr3t", "DB_PASSWORD=DB_PASSWORD-s3cr3t", "DEBUG=false", "PORT=8080", "RATIO=0.5"},
+		},
+		{input: "{}\n", expected: []string{}},
+		{input: "DB:\n  PASSWORD: $$\n", err: `"DB" env var must be a scalar value`},
+		{input: "HOSTS: [a, b]\n", err: `"HOSTS" env var must be a scalar value`},
+	}
+
+	for _, tc := range tt {
+		filename := filepath.Join(t.TempDir(), "env.yml")
+		if err := ioutil.WriteFile(filename, []byte(tc.input), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		env, exp, err := hydrateEnv(fakeEnvHydrator{expires: expires}, filename, "yml")
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(env, tc.expected) {
+			t.Errorf("expected %q, got %q", tc.expected, env)
+		}
+		if !exp.Equal(expires) {
+			t.Errorf("expected expiry %v, got %v", expires, exp)
+		}
+	}
+
+	if _, _, err := hydrateEnv(fakeEnvHydrator{}, filepath.Join(t.TempDir(), "missing.yml"), "yml"); err == nil {
+		t.Error("expected error of a missing env file")
+	}
+}
+
+func TestHydrateEnviron(t *testing.T) {
+	tt := []struct {
+		env      map[string]string
+		expected []string
+	}{
+		{env: map[string]string{"HYDRATE_TEST_PASSWORD": "$$", "HYDRATE_TEST_USER": "app"}, expected: []string{"HYDRATE_TEST_PASSWORD=HYDRATE_TEST_PASSWORD-s3cr3t"}},
+		{env: map[string]string{"HYDRATE_TEST_USER": "app"}, expected: []string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run("", func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			env, _, err := hydrateEnv(fakeEnvHydrator{}, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(env, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, env)
+			}
+		})
+	}
+}
+
+func TestWriteEnv(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.env")
+	tt := []struct {
+		env      []string
+		format   string
+		expected string
+	}{
+		{env: []string{"B=2", "A=1"}, format: "env", expected: "A=1\nB=2\n"},
+		{env: []string{"A=it's"}, format: "env", expected: "A=\"it's\"\n"},
+		{env: []string{"A=two words"}, format: "env-export", expected: "export A='two words'\n"},
+	}
+	for _, tc := range tt {
+		if err := writeEnv(filename, tc.env, tc.format); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, data)
+		}
+	}
+	if _, err := ioutil.ReadFile(filename + ".tmp"); err == nil {
+		t.Error("expected no temporary file left in place")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tt := []struct {
+		script   string
+		stop     bool
+		expected int
+	}{
+		{script: "exit 0", expected: 0},
+		{script: "exit 3", expected: 3},
+		{script: `[ "$HYDRATED" = yes ] || exit 4`, expected: 0},
+		{script: "exec sleep 10", stop: true, expected: 128 + 15}, // SIGTERM
+	}
+
+	for _, tc := range tt {
+		cmd, done, err := startCommand([]string{"sh", "-c", tc.script}, []string{"HYDRATED=yes"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tc.stop {
+			if code := exitCode(<-done); code != tc.expected {
+				t.Errorf("%v: expected exit code %v, got %v", tc.script, tc.expected, code)
+			}
+			continue
+		}
+
+		stopCommand(cmd, done)
+		if code := exitCode(&exec.ExitError{ProcessState: cmd.ProcessState}); code != tc.expected {
+			t.Errorf("%v: expected exit code %v, got %v", tc.script, tc.expected, code)
+		}
+	}
+
+	if _, _, err := startCommand([]string{"hydrate-test-missing-command"}, nil); err == nil || !strings.Contains(err.Error(), "failed to start hydrate-test-missing-command") {
+		t.Errorf("expected start error, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+func graph(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate graph", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		format   = flags.String("format", "dot", "output format: dot, json")
+		k8s      = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+		kms      = flags.Bool("kms", true, "look up KMS keys of the referenced parameters (requires AWS access)")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 {
+		log.Fatal(errors.New("hydrate graph: at least one file or directory must be provided"))
+	}
+
+	g := &hydrate.Graph{Files: map[string][]string{}}
+	refs := hydrate.ParamStore(nil, *basePath)
+	seen := map[string]bool{}
+
+	for _, root := range flags.Args() {
+		err := filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			format := strings.TrimLeft(filepath.Ext(filename), ".")
+			switch format {
+			case "json", "yml", "yaml", "toml":
+			default:
+				return nil
+			}
+
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			params, err := refs.References(f, format, *k8s)
+			if err != nil {
+				return errors.Wrapf(err, "%v", filename)
+			}
+			if len(params) > 0 {
+				g.Files[filename] = params
+			}
+			for _, param := range params {
+				seen[param] = true
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate graph"))
+		}
+	}
+
+	if *kms && len(seen) > 0 {
+		params := make([]string, 0, len(seen))
+		for param := range seen {
+			params = append(params, param)
+		}
+
+		provider := hydrate.SSMProvider(newSSM(*region))
+		provider.SetLogger(logger)
+		keys, err := provider.KMSKeyIDs(context.Background(), params)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate graph"))
+		}
+		g.KMSKeys = keys
+	}
+
+	var err error
+	switch *format {
+	case "dot":
+		err = g.WriteDOT(os.Stdout)
+	case "json":
+		err = g.WriteJSON(os.Stdout)
+	default:
+		err = errors.Errorf("unknown output format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate graph"))
+	}
+}
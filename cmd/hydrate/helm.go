@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// stringsFlag collects repeated flags, ie. --values=a.yml --values=b.yml.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func helm(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate helm", flag.ExitOnError)
+		region    = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath  = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		release   = flags.String("release", "", "release name to render the chart as (defaults to the chart's name)")
+		namespace = flags.String("namespace", "", "namespace to render the chart into")
+		k8sAll    = flags.Bool("k8s-all", false, "hydrate all fields of Kubernetes objects of any kind, not just Secret/ConfigMap data")
+		values    stringsFlag
+		sets      stringsFlag
+	)
+	flags.Var(&values, "values", "values file to render the chart with, ie. --values=prod.yml (repeatable)")
+	flags.Var(&sets, "set", "value to render the chart with, ie. --set=image.tag=1.2.3 (repeatable)")
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	chart, helmArgs, err := chartArgs(flags.Args())
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate helm"))
+	}
+	if err := checkChart(chart); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate helm"))
+	}
+	if *release == "" {
+		*release = chartName(chart)
+	}
+
+	templateArgs := helmTemplateArgs(*release, chart, *namespace, values, sets)
+	rendered, err := runHelm(append(templateArgs, helmArgs...))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate helm"))
+	}
+
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	paramStore.SetLogger(logger)
+	setBackends(paramStore, cfg)
+	if *k8sAll {
+		paramStore.EnableK8sDeepScan()
+	}
+	if err := paramStore.HydrateContext(context.Background(), os.Stdout, bytes.NewReader(rendered), "yaml", true); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate helm"))
+	}
+}
+
+// chartArgs splits the arguments into the chart and the flags after "--",
+// which are passed to helm template, ie. -- --version=1.2.3.
+func chartArgs(args []string) (string, []string, error) {
+	if len(args) == 0 || args[0] == "--" {
+		return "", nil, errors.New("usage: hydrate helm [flags] chart.tgz|chart-dir [-- helm template flags]")
+	}
+	chart, rest := args[0], args[1:]
+	if len(rest) > 0 && rest[0] != "--" {
+		return "", nil, errors.New("exactly one chart must be provided, pass helm template flags after --")
+	}
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+	return chart, rest, nil
+}
+
+// helmTemplateArgs returns the arguments of helm template rendering the
+// chart as the release.
+func helmTemplateArgs(release, chart, namespace string, values, sets []string) []string {
+	args := []string{"template", release, chart}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	for _, v := range values {
+		args = append(args, "--values", v)
+	}
+	for _, s := range sets {
+		args = append(args, "--set", s)
+	}
+	return args
+}
+
+// checkChart checks that the chart is a packaged chart or a chart directory.
+func checkChart(chart string) error {
+	info, err := os.Stat(chart)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(chart, "Chart.yaml")); err != nil {
+			return errors.Errorf("%q is not a chart directory, it has no Chart.yaml", chart)
+		}
+		return nil
+	}
+	if !strings.HasSuffix(chart, ".tgz") && !strings.HasSuffix(chart, ".tar.gz") {
+		return errors.Errorf("%q is not a packaged chart (.tgz) or a chart directory", chart)
+	}
+	return nil
+}
+
+// chartName returns the name of the chart directory, or of the packaged
+// chart without its version, ie. "app" of "app-1.2.3.tgz".
+func chartName(chart string) string {
+	name := filepath.Base(filepath.Clean(chart))
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".tgz"), ".tar.gz")
+	return chartVersionRe.ReplaceAllString(name, "")
+}
+
+// chartVersionRe matches the version suffix of packaged charts.
+var chartVersionRe = regexp.MustCompile(`-v?[0-9]+\.[0-9]+\.[0-9]+.*$`)
+
+// runHelm runs the helm binary, which must be installed in $PATH, and
+// returns its output.
+func runHelm(args []string) ([]byte, error) {
+	helm, err := exec.LookPath("helm")
+	if err != nil {
+		return nil, errors.Wrap(err, "helm must be installed in $PATH")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(helm, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "helm %v: %v", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChartArgs(t *testing.T) {
+	tt := []struct {
+		name     string
+		args     []string
+		chart    string
+		helmArgs []string
+		err      string
+	}{
+		{name: "chart", args: []string{"./charts/api"}, chart: "./charts/api"},
+		{name: "helm flags", args: []string{"api.tgz", "--", "--version=1.2.3"}, chart: "api.tgz", helmArgs: []string{"--version=1.2.3"}},
+		{name: "no chart", err: "usage"},
+		{name: "only helm flags", args: []string{"--", "--version=1.2.3"}, err: "usage"},
+		{name: "two charts", args: []string{"api.tgz", "worker.tgz"}, err: "exactly one chart"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			chart, helmArgs, err := chartArgs(tc.args)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chart != tc.chart || strings.Join(helmArgs, " ") != strings.Join(tc.helmArgs, " ") {
+				t.Errorf("expected %q %q, got %q %q", tc.chart, tc.helmArgs, chart, helmArgs)
+			}
+		})
+	}
+}
+
+func TestHelmTemplateArgs(t *testing.T) {
+	args := helmTemplateArgs("api", "./charts/api", "web", []string{"base.yml", "prod.yml"}, []string{"image.tag=1.2.3"})
+	expected := []string{"template", "api", "./charts/api", "--namespace", "web", "--values", "base.yml", "--values", "prod.yml", "--set", "image.tag=1.2.3"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+	if args := helmTemplateArgs("api", "api.tgz", "", nil, nil); !reflect.DeepEqual(args, []string{"template", "api", "api.tgz"}) {
+		t.Errorf("expected no optional flags, got %q", args)
+	}
+}
+
+func TestCheckChart(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"api/Chart.yaml", "api-1.2.3.tgz", "values.yml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		chart string
+		err   string
+	}{
+		{chart: "api"},
+		{chart: "api-1.2.3.tgz"},
+		{chart: "templates", err: "has no Chart.yaml"},
+		{chart: "values.yml", err: "is not a packaged chart"},
+		{chart: "missing.tgz", err: "no such file"},
+	}
+
+	for _, tc := range tt {
+		err := checkChart(filepath.Join(dir, tc.chart))
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%v: expected error %q, got %v", tc.chart, tc.err, err)
+		}
+	}
+}
+
+func TestChartName(t *testing.T) {
+	tt := []struct {
+		chart    string
+		expected string
+	}{
+		{"./charts/api/", "api"},
+		{"./charts/api-1.2.3.tgz", "api"},
+		{"api-v2.0.0-rc.1.tar.gz", "api"},
+		{"my-app.tgz", "my-app"},
+	}
+
+	for _, tc := range tt {
+		if name := chartName(tc.chart); name != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.chart, tc.expected, name)
+		}
+	}
+}
+
+func TestRunHelm(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$2\" = fail ]; then echo 'Error: chart not found' >&2; exit 1; fi\necho \"$@\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir)
+	out, err := runHelm([]string{"template", "api", "./charts/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "template api ./charts/api\n" {
+		t.Errorf("unexpected helm output %q", out)
+	}
+	if _, err := runHelm([]string{"template", "fail"}); err == nil || !strings.Contains(err.Error(), "helm template: Error: chart not found") {
+		t.Errorf("expected the helm error, got %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := runHelm([]string{"template", "api"}); err == nil || !strings.Contains(err.Error(), "helm must be installed in $PATH") {
+		t.Errorf("expected a missing helm error, got %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+var (
+	flags      = flag.NewFlagSet("hydrate", flag.ExitOnError)
+	region     = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+	profile    = flags.String("profile", "", "AWS shared config profile, ie. an SSO profile (defaults to $AWS_PROFILE)")
+	endpoint   = flags.String("endpoint-url", "", "AWS API endpoint URL, ie. http://localhost:4566 for LocalStack")
+	userAgent  = flags.String("user-agent", "", "suffix of the AWS API calls' user agent recorded by CloudTrail, ie. pipeline/1234 or git/$GIT_SHA")
+	sessName   = flags.String("session-name", "", "session name of assumed IAM roles recorded by CloudTrail, ie. deploy-1234 (defaults to hydrate-<timestamp>)")
+	sessTags   = keyValueFlag("session-tag", "tag the sessions of assumed IAM roles, ie. --session-tag=pipeline=1234 (repeatable)")
+	basePath   = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+	vars       = keyValueFlag("var", "set a variable of {{.Name}} parameter paths and --format=tmpl templates, ie. --var=Env=prod (repeatable)")
+	varFiles   = flags.String("var-file", "", "comma-separated YAML or JSON files of variables, overridden by later files and --var, ie. --var-file=vars/prod.yml")
+	backend    = flags.String("backend", "ssm", "backend of $SECRET and $$ values: ssm, secretsmanager, vault")
+	format     = flags.String("format", "yaml", "input file format: json, yaml, toml, env, properties, tmpl, npmrc, pypirc, netrc, pipconf (default yaml)")
+	output     = flags.String("output-format", "", "output format: "+strings.Join(hydrate.OutputFormats(), ", ")+" (defaults to input format)")
+	toSecret   = flags.String("to-k8s-secret", "", "write the hydrated flat config as a Kubernetes Secret manifest, ie. --to-k8s-secret=name[,namespace]")
+	labels     = keyValueFlag("secret-label", "label the --to-k8s-secret Secret, ie. --secret-label=app=api (repeatable)")
+	annotate   = keyValueFlag("secret-annotation", "annotate the --to-k8s-secret Secret, ie. --secret-annotation=owner=payments (repeatable)")
+	debug      = flags.Bool("debug", false, "print debug info to stderr, same as --verbose")
+	verbose    = flags.Bool("verbose", false, "print debug info to stderr")
+	quiet      = flags.Bool("quiet", false, "print only warnings and errors to stderr, not the fetched parameters")
+	logFormat  = flags.String("log-format", "text", "format of stderr messages: text, json")
+	k8s        = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+	k8sAll     = flags.Bool("k8s-all", false, "with --k8s, hydrate all fields of Kubernetes objects of any kind, not just Secret/ConfigMap data")
+	onMissing  = flags.String("missing", "error", "hydrate references to parameters that don't exist: error, empty, keep (the reference)")
+	pins       = keyValueFlag("pin", "fetch the fields matching the pattern from the reference, whatever their values, ie. --pin=database.password=vault:kv/app#db_pw (repeatable)")
+	onEmpty    = flags.String("empty", "skip", "hydrate null and empty values: skip (keep them), hydrate (like $$), error")
+	lockFile   = flags.String("lock", "", "record versions of the fetched parameters into a lock file, ie. --lock=hydrate.lock")
+	frozen     = flags.Bool("frozen", false, "fetch exactly the parameter versions recorded in the --lock file")
+	refresh    = flags.String("refresh", "", "with --lock, re-hydrate only the fields of the hydrated file whose parameters have new versions, ie. --refresh=secrets.yml")
+	emitRefs   = flags.String("emit-refs", "", "write the ARNs, versions and types of the fetched parameters as JSON into the file, ie. for Terraform")
+	outDir     = flags.String("out-dir", "", "write hydrated files into directory, required for multiple input files (or --write)")
+	write      = flags.Bool("write", false, "hydrate files in place, atomically keeping their permissions and ownership")
+	backup     = flags.String("backup", "", "with --write, keep the original files with the suffix, ie. --backup=.bak")
+	dryRunMode = flags.Bool("dry-run", false, "list the fields' parameter references without fetching any secrets")
+	checkExist = flags.Bool("check-exists", false, "with --dry-run, check that the referenced parameters exist, exit 1 if any doesn't")
+	pinVersion = flags.Bool("pin-versions", false, "with --dry-run, print the references pinned to the current parameter versions, ie. /app/db_pass:3")
+	roRole     = flags.String("read-only-role", "", "with --check-exists or --pin-versions, assume the IAM role for their calls, ie. a CI role without ssm:GetParameter")
+	stateFile  = flags.String("state", "", "with --out-dir or --write, record progress into the file to resume an interrupted run, ie. --state=run.json")
+	null       = flags.Bool("output-null-delimited", false, "print written --out-dir filenames NUL-delimited, ie. for xargs -0")
+	workers    = flags.Int("concurrency", 8, "number of files hydrated, and parameter requests of each file in flight, concurrently")
+	rate       = flags.Int("rate-limit", 0, "max AWS SSM API calls per second shared by all files (0 = no limit, defaults to 40 with standard --throughput)")
+	cacheDir   = flags.String("cache-dir", "", "serve parameters from and persist them into the directory, see hydrate warm")
+	cacheTTL   = flags.Duration("cache-ttl", time.Hour, "max age of --cache-dir parameters, ie. 30m (0 = no limit)")
+	chaos      = flags.String("chaos", "", "test-only: fail secret fetches with a probability, delayed by up to a latency, ie. 0.1,200ms")
+	timeout    = flags.Duration("timeout", 0, "cancel the run, including in-flight AWS calls, after the duration, ie. 30s (0 = no timeout)")
+	throughput = flags.String("throughput", "auto", "Parameter Store throughput to tune --rate-limit and --concurrency for: auto (detect), standard, high")
+	maxSecrets = flags.Int("max-secrets", 0, "abort if more than N parameters are referenced (0 = no limit)")
+	maxBytes   = flags.Int("max-bytes", 0, "abort if more than N bytes of secret data are fetched (0 = no limit)")
+	sops       = flags.String("sops", "", "decrypt SOPS/helm-secrets encrypted input and emit: plaintext, encrypted")
+	generate   = flags.Bool("generate", false, "allow $GENERATE:password(32) values to store generated secrets into AWS SSM Parameter Store")
+	genKMSKey  = flags.String("generate-kms-key", "", "KMS key to encrypt --generate'd parameters with (defaults to aws/ssm)")
+	encFields  = flags.String("encrypt-fields", "", "comma-separated fields to emit encrypted, ie. 'database.password,api.*'")
+	encKMSKey  = flags.String("encrypt-kms-key", "", "KMS key to encrypt --encrypt-fields with, ie. alias/app")
+	encAge     = flags.String("encrypt-age", "", "comma-separated age recipients to encrypt --encrypt-fields with")
+	encOut     = flags.String("encrypt-manifest", "hydrate.manifest.json", "file to write the --encrypt-fields decryption manifest into")
+	pushMetric = flags.String("push-metrics", "", "push the run's duration, fetched secrets and errors on exit to a Prometheus Pushgateway or OTLP/HTTP /v1/metrics URL")
+)
+
+// hydrateMain hydrates the input files of the args, see usage.
+func hydrateMain(args []string) {
+	start := time.Now()
+	flags.Parse(args)
+	if err := setLogger(); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(flags.Args()) == 0 {
+		log.Fatal(usage)
+	}
+	args, multi, err := expandInputs(flags.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *write && *outDir != "" {
+		log.Fatal(errors.New("hydrate: --write and --out-dir are mutually exclusive"))
+	}
+	if *write && *output != "" {
+		log.Fatal(errors.New("hydrate: --write doesn't support --output-format"))
+	}
+	if *toSecret != "" {
+		if *output != "" || *write || *outDir != "" {
+			log.Fatal(errors.New("hydrate: --to-k8s-secret doesn't support --output-format, --out-dir and --write"))
+		}
+		parts := strings.SplitN(*toSecret, ",", 2)
+		name, namespace := parts[0], ""
+		if len(parts) == 2 {
+			namespace = parts[1]
+		}
+		if name == "" {
+			log.Fatal(errors.New("hydrate: --to-k8s-secret=name[,namespace] requires a name"))
+		}
+		hydrate.RegisterEncoder("k8s-secret", hydrate.K8sSecretEncoder(name, namespace, *labels, *annotate))
+		*output = "k8s-secret"
+	}
+	batch := *outDir != "" || *write
+	if (multi || len(args) > 1) && !batch && !*dryRunMode {
+		log.Fatal(errors.New("hydrate: multiple input files require --out-dir=[dir] or --write"))
+	}
+
+	if *backup != "" && !*write {
+		log.Fatal(errors.New("hydrate: --backup requires --write"))
+	}
+	if !batch && !*dryRunMode && *refresh == "" {
+		if err := checkStdout(args); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *stateFile != "" && !batch {
+		log.Fatal(errors.New("hydrate: --state requires --out-dir=[dir] or --write"))
+	}
+	if *frozen && *lockFile == "" {
+		log.Fatal(errors.New("hydrate: --frozen requires --lock=[hydrate.lock]"))
+	}
+	if *refresh != "" {
+		if *lockFile == "" || *frozen {
+			log.Fatal(errors.New("hydrate: --refresh requires --lock=[hydrate.lock] and no --frozen"))
+		}
+		if batch || *dryRunMode || len(args) != 1 || args[0] == "-" {
+			log.Fatal(errors.New("hydrate: --refresh requires a single template file, and no --out-dir, --write or --dry-run"))
+		}
+		if *k8s || *output != "" || *sops != "" {
+			log.Fatal(errors.New("hydrate: --refresh doesn't support --k8s, --output-format, --to-k8s-secret and --sops"))
+		}
+	}
+	if *checkExist && (!*dryRunMode || *backend != "ssm") {
+		log.Fatal(errors.New("hydrate: --check-exists requires --dry-run and --backend=ssm"))
+	}
+	if *pinVersion && (!*dryRunMode || *backend != "ssm") {
+		log.Fatal(errors.New("hydrate: --pin-versions requires --dry-run and --backend=ssm"))
+	}
+	if *roRole != "" && !*checkExist && !*pinVersion {
+		log.Fatal(errors.New("hydrate: --read-only-role requires --dry-run --check-exists or --pin-versions"))
+	}
+	requireRole("hydrate", "--read-only-role", *roRole)
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// The region and credentials are only required by inputs referencing
+	// AWS-backed secrets, see requireAWS.
+	cfg := loadConfig(*region, false)
+	ssmProvider := hydrate.SSMProvider(ssm.NewFromConfig(cfg))
+	smProvider := hydrate.SecretsManagerProvider(secretsmanager.NewFromConfig(cfg))
+	vaultProvider := hydrate.VaultProvider(hydrate.VaultConfigFromEnv())
+
+	provider, err := backendProvider(*backend, ssmProvider, smProvider, vaultProvider)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate"))
+	}
+	if *cacheDir != "" && *lockFile != "" {
+		log.Fatal(errors.New("hydrate: --cache-dir doesn't support --lock, cached parameters have no versions"))
+	}
+	if *lockFile != "" && *backend != "ssm" {
+		log.Fatal(errors.New("hydrate: --lock is only supported by --backend=ssm"))
+	}
+	if *emitRefs != "" && (*backend != "ssm" || *dryRunMode) {
+		log.Fatal(errors.New("hydrate: --emit-refs requires --backend=ssm and no --dry-run"))
+	}
+	if *cacheDir != "" && *emitRefs != "" {
+		log.Fatal(errors.New("hydrate: --cache-dir doesn't support --emit-refs, cached parameters have no ARNs"))
+	}
+
+	if *chaos != "" {
+		probability, latency, err := parseChaos(*chaos)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Log(hydrate.LevelWarn, "chaos testing, failing secret fetches", "probability", probability, "latency", latency.String())
+		provider = hydrate.ChaosProvider(provider, probability, latency)
+	}
+
+	templateVars, err := readVars(*varFiles, *vars)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate"))
+	}
+	missingMode, err := hydrate.ParseMissing(*onMissing)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate"))
+	}
+	emptyMode, err := hydrate.ParseEmpty(*onEmpty)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate"))
+	}
+	if *generate {
+		ssmProvider.SetKMSKeyID(*genKMSKey)
+	}
+	paramStore, err := hydrate.NewHydrator(provider, hydrate.Options{
+		BasePath: *basePath,
+		Backends: map[string]hydrate.SecretProvider{
+			"SECRETSMANAGER": smProvider,
+			"VAULT":          vaultProvider,
+		},
+		Logger:      logger,
+		Missing:     missingMode,
+		Empty:       emptyMode,
+		Pins:        *pins,
+		Vars:        templateVars,
+		RateLimit:   *rate,
+		Concurrency: *workers,
+		CacheDir:    *cacheDir,
+		CacheTTL:    *cacheTTL,
+		MaxSecrets:  *maxSecrets,
+		MaxBytes:    *maxBytes,
+		K8sDeepScan: *k8sAll,
+		Generate:    *generate,
+	})
+	if err != nil {
+		fatal(errors.Wrap(err, "hydrate"))
+	}
+	if *pushMetric != "" {
+		// Pushed on exit, including by fatal errors.
+		pushedMetrics = &runMetrics{url: *pushMetric, start: start, stats: paramStore.Stats}
+		defer pushMetrics(nil)
+	}
+	if *encFields != "" {
+		if err := encryptFields(paramStore, strings.Split(*encFields, ","), *encKMSKey, *encAge, *region); err != nil {
+			fatal(err)
+		}
+	}
+	if *frozen {
+		lock, err := readLock(*lockFile)
+		if err != nil {
+			fatal(err)
+		}
+		ssmProvider.Freeze(lock)
+	}
+
+	if *sops != "" && batch {
+		fatal(errors.New("hydrate: --sops doesn't support multiple files"))
+	}
+
+	// Inputs of mixed pipelines only referencing Vault or plugin secrets, or
+	// none at all, hydrate without AWS, and dry runs only call AWS to check
+	// the parameters.
+	scanFormat := explicitFormat() // Inferred per file, unless provided.
+	if !batch && !*dryRunMode {
+		scanFormat = *format
+	}
+	input, field, name := awsInput(ctx, paramStore, args, scanFormat, *k8s)
+	if input != "" && (!*dryRunMode || *checkExist || *pinVersion) {
+		requireAWS(ctx, cfg, input, field, name)
+	}
+
+	if input != "" && *backend == "ssm" && !*dryRunMode {
+		high, err := highThroughput(ctx, ssmProvider, *throughput)
+		if err != nil {
+			fatal(err)
+		}
+		if !high && !isFlagSet("rate-limit") {
+			*rate = standardRateLimit
+			paramStore.SetRateLimit(*rate)
+		}
+		if high && !isFlagSet("concurrency") {
+			*workers = highThroughputWorkers
+			paramStore.SetConcurrency(*workers)
+		}
+	}
+
+	if *dryRunMode {
+		// Validation calls only read metadata, so that CI can run them
+		// with weaker credentials than deploys hydrating the values.
+		readOnly := ssmProvider
+		if *roRole != "" {
+			readOnly = hydrate.SSMProvider(ssm.NewFromConfig(assumeRole(cfg, *roRole)))
+			readOnly.SetLogger(logger)
+		}
+		var checker existenceChecker
+		if *checkExist {
+			checker = readOnly
+		}
+		fileFormat := explicitFormat()
+		if len(args) == 1 && args[0] == "-" {
+			fileFormat = *format
+		}
+		var resolver versionResolver
+		if *pinVersion {
+			resolver = readOnly
+		}
+		missing, err := dryRun(ctx, paramStore, checker, resolver, args, fileFormat, *k8s)
+		if err != nil {
+			fatal(timedOut(ctx, errors.Wrap(err, "hydrate")))
+		}
+		if len(missing) > 0 {
+			pushMetrics(errors.Errorf("%v referenced parameters don't exist", len(missing)))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if batch {
+		opts := batchOptions{
+			format:       explicitFormat(), // Inferred per file, unless provided.
+			outputFormat: *output,
+			k8s:          *k8s,
+			outDir:       *outDir,
+			write:        *write,
+			backup:       *backup,
+			concurrency:  *workers,
+		}
+		if *stateFile != "" {
+			if opts.state, err = readRunState(*stateFile); err != nil {
+				fatal(errors.Wrap(err, "hydrate"))
+			}
+		}
+		written, err := hydrateFiles(ctx, paramStore, args, opts)
+		if perr := printFilenames(written, *null); perr != nil {
+			fatal(perr)
+		}
+		if err != nil {
+			fatal(timedOut(ctx, err))
+		}
+	} else if *refresh != "" {
+		if err := refreshFile(ctx, paramStore, ssmProvider, args[0], *refresh, explicitFormat(), *lockFile, logger); err != nil {
+			fatal(timedOut(ctx, err))
+		}
+	} else if *sops != "" {
+		if err := hydrateSOPS(ctx, paramStore, args[0], *format, *output, *sops, *k8s); err != nil {
+			fatal(timedOut(ctx, err))
+		}
+	} else {
+		r := openInput(args[0], format)
+		defer r.Close()
+		if args[0] != "-" {
+			ctx = hydrate.WithIncludeDir(ctx, filepath.Dir(args[0]))
+		}
+
+		// Buffer the output to never write partially hydrated data.
+		var b bytes.Buffer
+		if err := paramStore.HydrateFormatContext(ctx, &b, r, *format, *output, *k8s); err != nil {
+			fatal(timedOut(ctx, err))
+		}
+		if err := writeStdout(b.Bytes()); err != nil {
+			fatal(err)
+		}
+	}
+
+	stats := paramStore.Stats()
+	providers := make([]string, 0, len(stats))
+	for name := range stats {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	for _, name := range providers {
+		s := stats[name]
+		logger.Log(hydrate.LevelDebug, "served secrets", "provider", name, "fetched", s.Fetched, "cached", s.Cached, "failed", s.Failed)
+	}
+
+	if manifest := paramStore.EncryptionManifest(); manifest != nil {
+		if err := writeFile(*encOut, manifest.Write); err != nil {
+			fatal(errors.Wrap(err, "hydrate: failed to write encryption manifest"))
+		}
+	}
+
+	if *lockFile != "" && !*frozen && *refresh == "" {
+		if err := writeLock(*lockFile, ssmProvider.Lock()); err != nil {
+			fatal(err)
+		}
+	}
+	if *emitRefs != "" {
+		if err := writeFile(*emitRefs, ssmProvider.Refs().Write); err != nil {
+			fatal(errors.Wrap(err, "hydrate: failed to write refs"))
+		}
+	}
+}
+
+// keyValueFlags collects repeated --flag=key=value flags.
+type keyValueFlags map[string]string
+
+func (f *keyValueFlags) String() string {
+	return ""
+}
+
+func (f *keyValueFlags) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return errors.Errorf("expected key=value, got %q", value)
+	}
+	if *f == nil {
+		*f = keyValueFlags{}
+	}
+	(*f)[value[:i]] = value[i+1:]
+	return nil
+}
+
+func keyValueFlag(name, usage string) *keyValueFlags {
+	var f keyValueFlags
+	flags.Var(&f, name, usage)
+	return &f
+}
+
+// parseChaos parses --chaos=probability[,latency].
+func parseChaos(value string) (float64, time.Duration, error) {
+	parts := strings.SplitN(value, ",", 2)
+	probability, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || probability < 0 || probability > 1 {
+		return 0, 0, errors.Errorf("hydrate: invalid --chaos=%v, expected probability between 0 and 1, ie. 0.1,200ms", value)
+	}
+	var latency time.Duration
+	if len(parts) == 2 {
+		if latency, err = time.ParseDuration(parts[1]); err != nil {
+			return 0, 0, errors.Errorf("hydrate: invalid --chaos=%v latency, ie. 0.1,200ms", value)
+		}
+	}
+	return probability, latency, nil
+}
+
+// timedOut explains errors of runs canceled by --timeout.
+func timedOut(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("hydrate: canceled after --timeout=%v: %v", *timeout, err)
+	}
+	return err
+}
+
+// explicitFormat returns the --format, if explicitly provided.
+func explicitFormat() string {
+	if isFlagSet("format") {
+		return *format
+	}
+	return ""
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// checkStdout fails if STDOUT is redirected into one of the input files,
+// ie. `hydrate config.yml > config.yml`, which the shell truncated before
+// it was read.
+func checkStdout(filenames []string) error {
+	out, err := os.Stdout.Stat()
+	if err != nil || !out.Mode().IsRegular() {
+		return nil
+	}
+	for _, filename := range filenames {
+		if in, err := os.Stat(filename); err == nil && os.SameFile(in, out) {
+			return errors.Errorf("hydrate: output is redirected into the input file %v, which is truncated before it's read, use --write to hydrate it in place", filename)
+		}
+	}
+	return nil
+}
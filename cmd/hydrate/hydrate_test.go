@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckStdout(t *testing.T) {
+	dir := t.TempDir()
+	input, other := filepath.Join(dir, "config.yml"), filepath.Join(dir, "other.yml")
+	for _, filename := range []string{input, other} {
+		if err := ioutil.WriteFile(filename, []byte("key: $$\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		stdout string
+		err    bool
+	}{
+		{stdout: input, err: true},
+		{stdout: other},
+		{stdout: os.DevNull},
+	}
+
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	for _, tc := range tt {
+		f, err := os.OpenFile(tc.stdout, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdout = f
+		err = checkStdout([]string{input})
+		os.Stdout = stdout
+		f.Close()
+
+		if (err != nil) != tc.err {
+			t.Errorf("%v: expected error %v, got %v", tc.stdout, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// logger receives the messages of the command and its secret stores,
+// configured by setLogger.
+var logger = hydrate.TextLogger(os.Stderr, hydrate.LevelInfo)
+
+// logFlags registers the main command's --quiet, --verbose and --log-format
+// flags with the subcommand's flags.
+func logFlags(fs *flag.FlagSet) {
+	for _, name := range []string{"quiet", "verbose", "log-format"} {
+		f := flags.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+}
+
+// parseFlags parses the subcommand's flags, including logFlags, and sets
+// the logger.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	logFlags(fs)
+	fs.Parse(args)
+	if err := setLogger(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// setLogger sets the logger of the --quiet, --verbose and --log-format flags.
+func setLogger() error {
+	l, err := newLogger(os.Stderr)
+	if err != nil {
+		return err
+	}
+	logger = l
+	return nil
+}
+
+// newLogger returns a logger of the --quiet, --verbose and --log-format
+// flags writing into w.
+func newLogger(w io.Writer) (hydrate.Logger, error) {
+	level := hydrate.LevelInfo
+	switch {
+	case *quiet:
+		level = hydrate.LevelWarn
+	case *verbose || *debug:
+		level = hydrate.LevelDebug
+	}
+
+	switch *logFormat {
+	case "text":
+		return hydrate.TextLogger(w, level), nil
+	case "json":
+		return hydrate.JSONLogger(w, level), nil
+	default:
+		return nil, errors.Errorf("hydrate: unknown --log-format=%v, expected text or json", *logFormat)
+	}
+}
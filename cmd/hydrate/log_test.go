@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pressly/hydrate"
+)
+
+func TestNewLogger(t *testing.T) {
+	tt := []struct {
+		quiet    bool
+		verbose  bool
+		format   string
+		expected string
+		err      string
+	}{
+		{format: "text", expected: "hydrate: info\nhydrate: warn: warn\n"},
+		{quiet: true, format: "text", expected: "hydrate: warn: warn\n"},
+		{verbose: true, format: "text", expected: "hydrate: debug\nhydrate: info\nhydrate: warn: warn\n"},
+		{quiet: true, format: "json", expected: `{"level":"warn","msg":"warn"}` + "\n"},
+		{format: "xml", err: "unknown --log-format=xml"},
+	}
+
+	defer func(q, v bool, f string) { *quiet, *verbose, *logFormat = q, v, f }(*quiet, *verbose, *logFormat)
+	for _, tc := range tt {
+		*quiet, *verbose, *logFormat = tc.quiet, tc.verbose, tc.format
+
+		var b strings.Builder
+		l, err := newLogger(&b)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%+v: expected error %q, got %v", tc, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l.Log(hydrate.LevelDebug, "debug")
+		l.Log(hydrate.LevelInfo, "info")
+		l.Log(hydrate.LevelWarn, "warn")
+		if b.String() != tc.expected {
+			t.Errorf("%+v: expected %q, got %q", tc, tc.expected, b.String())
+		}
+	}
+}
@@ -1,36 +1,50 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/pkg/errors"
 	"github.com/pressly/hydrate"
 )
 
-var (
-	flags    = flag.NewFlagSet("hydrate", flag.ExitOnError)
-	region   = flags.String("region", "", "AWS region (defaults to $AWS_DEFAULT_REGION)")
-	basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
-	format   = flags.String("format", "yaml", "input file format: json, yaml, toml (default yaml)")
-	debug    = flags.Bool("debug", false, "print debug info to stderr")
-	k8s      = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
-
-	usage = errors.New(`hydrate:
+// usage is printed when no input file is provided.
+var usage = errors.New(`hydrate:
 
 Hydrate	JSON, YAML, TOML config files.
 
 Replace all matching values with strings/secrets from AWS SSM Param Store.
-    1. "$SECRET:/custom/parameter/path"
+    1. "$SECRET:/custom/parameter/path" (or pinned to a "path:3" version or "path#prod" label)
     2. "$$"
     3. "$SECRET"
+    4. "$GENERATE:password(32)" (with --generate, stores a random value if the parameter doesn't exist)
+    5. "$PLUGIN:<name>:<key>" (resolved by hydrate-provider-<name> plugin executable in $PATH)
+    6. "$SECRETSMANAGER:<name>[#<key>]" (AWS Secrets Manager secret, or a key of its JSON value)
+    7. "$VAULT:<path>#<key>" (HashiCorp Vault KV secret key, ie. "$VAULT:secret/data/app#db_password")
+    8. "postgres://user:${SECRET:/app/db_pass}@host/db" (inline references within larger strings)
+    9. "$INCLUDE:common/db.yml" (replaced by the included file's document before hydration)
+    10. "$SECRET:/app/feature_flag|off" (default value, if the parameter doesn't exist)
+    11. "$SECRET?:/app/optional_key" (empty, if the parameter doesn't exist)
+    12. "$SECRET:/app/allowed_hosts!list", "$SECRET:/app/db!json" (parsed into an array or object, or !yaml)
+    13. "$SECRET:/app/userdata|gzip|base64" (compressed and/or base64-encoded, after any default)
 
 Usage:
     # Hydrate JSON file:
@@ -43,6 +57,165 @@ Usage:
 	# (both "data" and "stringData" fields, handles base64 encoding automatically):
         hydrate -k8s k8s-secret.yml | kubectl apply -
 
+	# Hydrate Deployments, CRDs and other objects of any kind too
+	# (or only those annotated with hydrate.pressly.com/enabled: "true", without --k8s-all):
+        hydrate -k8s --k8s-all manifests.yml | kubectl apply -
+
+    # Convert TOML config into hydrated YAML:
+        hydrate --format=toml --output-format=yaml app.toml > app.yml
+
+    # Hydrate null and empty values like $$, ie. "db_pass: ~" (or fail on them with --empty=error):
+        hydrate --empty=hydrate --path=/app/sit1 config.yml > secrets.yml
+
+    # Pin the most sensitive fields to their references, whatever the config's values:
+        hydrate --pin=database.password=vault:kv/app#db_pw --pin='api.*=ssm:/app/prod/api_key' config.yml > secrets.yml
+
+    # Convert multi-document YAML manifests into a JSON array, or one JSON document per line:
+        hydrate -k8s --output-format=json manifests.yml
+        hydrate -k8s --output-format=ndjson manifests.yml
+
+    # Generate a Kubernetes Secret manifest of a flat config (env, JSON, YAML), values base64-encoded:
+        hydrate --format=env --to-k8s-secret=app,prod --secret-label=app=api .env.tpl | kubectl apply -f -
+
+    # Hydrate $SECRET and $$ values from AWS Secrets Manager instead of SSM Parameter Store:
+        hydrate --backend=secretsmanager --path=/app/sit1 config.yml > secrets.yml
+
+    # Hydrate $SECRET and $$ values from HashiCorp Vault ($VAULT_ADDR, $VAULT_TOKEN or $VAULT_ROLE_ID + $VAULT_SECRET_ID):
+        hydrate --backend=vault --path=secret/data/app config.yml > secrets.yml
+
+    # Use an AWS shared config profile (ie. SSO), or LocalStack:
+        hydrate --profile=dev-sso config.yml > secrets.yml
+        hydrate --endpoint-url=http://localhost:4566 --region=us-east-1 config.yml > secrets.yml
+
+    # Attribute the AWS calls to a deployment in CloudTrail:
+        hydrate --user-agent=pipeline/1234 --dry-run --check-exists --read-only-role=arn:aws:iam::123456789012:role/ci-validate --session-tag=pipeline=1234 ./manifests
+
+    # Hydrate multiple files concurrently into a directory:
+        hydrate --out-dir=./hydrated --concurrency=8 configs/*.yml
+        hydrate --out-dir=./hydrated --throughput=high configs/*.yml
+        hydrate --out-dir=./hydrated --timeout=2m configs/*.yml
+        hydrate --out-dir=./hydrated --output-null-delimited configs/*.yml | xargs -0 -n1 kubectl apply -f
+        hydrate --out-dir=./hydrated --state=run.json configs/*.yml  # Re-run to resume if interrupted.
+
+    # Render a Helm chart (.tgz or directory) and hydrate its Secrets/ConfigMaps, requires helm in $PATH:
+        hydrate helm --path=/app/prod --release=api --namespace=web --values=prod.yml ./charts/api-1.2.3.tgz | kubectl apply -f -
+
+    # Hydrate all files of a directory or "**" glob, into a directory or in place:
+        hydrate --out-dir=./hydrated './manifests/**/*.yml'
+        hydrate --write ./manifests
+        hydrate --write --backup=.bak config.yml
+
+    # Hydrate SOPS/helm-secrets encrypted values file and re-encrypt it:
+        hydrate --sops=encrypted secrets.values.yaml > hydrated.values.yaml
+
+    # Emit selected fields encrypted by a KMS data key or age recipient:
+        hydrate --encrypt-fields='database.password,api.*' --encrypt-kms-key=alias/app config.yml > config.enc.yml
+
+    # Hydrate .env files, keeping comments and order:
+        hydrate --format=env .env.tpl > .env
+        eval "$(hydrate --output-format=env-export config.yml)"  # Or env-null for xargs -0.
+
+    # Hydrate Java .properties files, keeping comments and order:
+        hydrate --format=properties application.properties.tpl > application.properties
+
+    # Render a Go template with secrets and their metadata, ie. {{ secret "db_password" }} {{ version "db_password" }}:
+        hydrate --format=tmpl --path=/app/sit1 app.env.tmpl > app.env
+
+    # Expand variables in parameter paths and templates, ie. "$SECRET:/app/{{.Env}}/db_password":
+        hydrate --var-file=vars/prod.yml --var=Env=prod --path=/app/{{.Env}} config.yml > secrets.yml
+
+    # Hydrate registry tokens of credential files (.npmrc, .pypirc, .netrc, pip.conf):
+        hydrate --format=npmrc .npmrc.tpl > ~/.npmrc
+
+    # List the parameters referenced by each field without fetching secrets, ie. in CI:
+        hydrate --dry-run --check-exists --path=/app/sit1 ./manifests
+        hydrate --dry-run --check-exists --read-only-role=arn:aws:iam::123456789012:role/ci-validate ./manifests
+
+    # Report missing parameters and plaintext secrets as SARIF, ie. for GitHub code scanning:
+        hydrate validate --path=/app/sit1 --sarif=validate.sarif ./manifests
+        hydrate scan --sarif=scan.sarif ./manifests
+
+    # Warm a cache of the subtree ahead of a deployment window, then hydrate from it:
+        hydrate warm --path=/app/prod --cache-dir=/var/cache/hydrate
+        hydrate --path=/app/prod --cache-dir=/var/cache/hydrate config.yml > secrets.yml
+
+    # Store the values of a config file into AWS SSM Parameter Store, printing a template of it:
+        hydrate push --path=/app/prod --kms-key-id=alias/app --tag=team=payments secrets.yml > template.yml
+
+    # Run a declarative pipeline of providers, transforms and outputs, or print its commands:
+        hydrate run pipeline.yaml
+        hydrate run --dry-run pipeline.yaml
+
+    # Record parameter versions and reproduce them on later runs:
+        hydrate --lock=hydrate.lock config.yml > secrets.yml
+        hydrate --lock=hydrate.lock --frozen config.yml > secrets.yml
+
+    # Re-fetch only the parameters with new versions since the lock file, rewriting their fields in place:
+        hydrate --refresh=secrets.yml --lock=hydrate.lock config.yml
+
+    # List the ARNs of the fetched parameters, ie. for Terraform to scope IAM policies to them:
+        hydrate --emit-refs=refs.json config.yml > secrets.yml
+
+    # Print the references pinned to the current parameter versions, ie. "$SECRET:/app/db_pass:3":
+        hydrate --dry-run --pin-versions --path=/app/sit1 config.yml
+
+    # Print the diff of a hydration with the secrets redacted, ie. for PR reviews (or --hash):
+        hydrate diff --path=/app/sit1 config.yml
+
+    # Compare a template against two environments (values are masked):
+        hydrate compare --left-path=/app/stage --right-path=/app/prod template.yml
+
+    # Compare a hydrated Secret manifest against the live Secret (values are masked):
+        hydrate cluster-diff --path=/app/prod -f secret.yaml
+
+    # Verify hydrated Secrets still match the template and current parameter values, ie. to detect rotation lag:
+        hydrate verify --path=/app/prod -f secret.yaml --against=live
+        hydrate verify --path=/app/prod -f secret.yaml --against=hydrated/secret.yaml
+
+    # Check which referenced parameters the current AWS principal can read:
+        hydrate simulate-access --path=/app/prod config.yml
+
+    # Hydrate a template once per tenant, ie. "$SECRET:/app/{{.Tenant}}/db":
+        hydrate stamp --tenants=tenants.yml --out-dir=./out template.yml
+
+    # Generate a ConfigMap manifest of hydrated files, one key per file of the directory:
+        hydrate k8s-configmap --from-dir=conf/ --name=app-conf | kubectl apply -f -
+
+    # Assemble PEM chains and other multi-part files from several parameters:
+        hydrate bundle --out-dir=/etc/tls bundles.yml
+
+    # Write secrets into files with given permissions/ownership, ie. in an initContainer:
+        hydrate emit --spec=spec.yml --dir=/mnt/secrets
+
+    # Run a command with hydrated env vars, restarting it before Vault leases expire:
+        hydrate exec --renew-before-expiry=5m env.yml -- ./server
+        DB_PASSWORD='$SECRET:/app/db_password' hydrate exec -- ./server
+
+    # Re-hydrate templates whenever their parameters change (EventBridge -> SQS):
+        hydrate watch --queue-url=https://sqs.us-west-2.amazonaws.com/123/ssm-changes --k8s --kubectl-apply secrets.yml
+        hydrate watch --notify-url=https://hooks.slack.com/services/T000/B000/XXXX --queue-url=... --out-dir=/etc/app configs/*.yml
+
+    # Serve hydration over HTTP, ie. as a sidecar, holding the AWS credentials and cached secrets:
+        hydrate serve --path=/app/prod --cache-ttl=5m
+        hydrate serve --listen=:8443 --tls-cert=tls.crt --tls-key=tls.key --token-file=token --path=/app/prod
+        curl --data-binary @config.yml 'localhost:8080/hydrate?format=yaml&output-format=json'
+
+    # Hydrate ConfigMaps and Secrets on creation, as a mutating admission webhook:
+        hydrate webhook --listen=:8443 --tls-cert=/etc/webhook/tls.crt --tls-key=/etc/webhook/tls.key --path=/app/prod
+        hydrate webhook --tls-cert=tls.crt --tls-key=tls.key --failure-policy=ignore --max-in-flight=32
+
+    # Push the run's metrics to a Pushgateway, grouped by pipeline, for fleet-wide monitoring from CI:
+        hydrate --push-metrics=http://pushgateway:9091/metrics/job/hydrate/pipeline/deploy --write ./configs
+
+    # List the providers, formats, transforms and syntax versions of this binary, ie. to validate specs against:
+        hydrate capabilities --json
+
+    # Diagnose region, credentials, connectivity, clock skew, proxy and KMS setup:
+        hydrate doctor --probe=/app/sit1/db_password
+
+    # Graph files -> parameters -> KMS keys of a directory tree:
+        hydrate graph --path=/app/sit1 --format=dot ./configs | dot -Tsvg > secrets.svg
+
 Example:
 
     Parameter Store:
@@ -68,52 +241,177 @@ Example:
 			"db_pwd": "ccc",
 		}
 `)
-)
+
+// subcommands are run by "hydrate <name>", with the arguments following it.
+var subcommands = map[string]func(args []string){
+	"graph":           graph,
+	"compare":         compare,
+	"diff":            diff,
+	"simulate-access": simulateAccess,
+	"watch":           watch,
+	"serve":           serve,
+	"webhook":         webhook,
+	"stamp":           stamp,
+	"bundle":          bundle,
+	"emit":            emit,
+	"exec":            execCommand,
+	"doctor":          doctor,
+	"k8s-configmap":   k8sConfigMap,
+	"cluster-diff":    clusterDiff,
+	"warm":            warm,
+	"verify":          verify,
+	"helm":            helm,
+	"push":            push,
+	"validate":        validate,
+	"scan":            scan,
+	"run":             runPipeline,
+	"capabilities":    showCapabilities,
+}
 
 func main() {
-	flags.Parse(os.Args[1:])
+	// Report broken pipes as write errors instead of getting killed by SIGPIPE.
+	// Unlike an ignored signal, a handled one is reset on exec, so commands
+	// run by hydrate (kubectl, sops, plugins) still get killed by it.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE)
 
-	if *region == "" {
-		*region = os.Getenv("AWS_DEFAULT_REGION")
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			subcommand(os.Args[2:])
+			return
+		}
 	}
-	if *region == "" {
-		log.Fatal(errors.New("hydrate: --region=[us-west-2] or $AWS_DEFAULT_REGION must be provided"))
+	hydrateMain(os.Args[1:])
+}
+
+func readLock(filename string) (*hydrate.Lock, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "hydrate: failed to open lock file")
 	}
+	defer f.Close()
+
+	return hydrate.ReadLock(f)
+}
 
-	args := flags.Args()
-	if len(args) != 1 {
-		log.Fatal(usage)
+func writeLock(filename string, lock *hydrate.Lock) error {
+	return errors.Wrap(writeFile(filename, lock.Write), "hydrate: failed to write lock file")
+}
+
+func writeFile(filename string, write func(w io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
 	}
-	filename := args[0]
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	var r io.Reader
+// openInput opens the input file, or STDIN if filename is "-".
+// The format is inferred from the file extension, unless provided.
+func openInput(filename string, format *string) io.ReadCloser {
 	if filename == "-" {
 		if *format == "" {
 			log.Fatal(errors.New("hydrate: --format=[json|yaml|toml] must be provided when using STDIN"))
 		}
-		r = os.Stdin
-	} else {
-		if *format == "" {
-			*format = strings.TrimLeft(filepath.Ext(filename), ".")
-		}
-		f, err := os.Open(filename)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer f.Close()
-		r = io.Reader(f)
+		return os.Stdin
+	}
+
+	if *format == "" {
+		*format = strings.TrimLeft(filepath.Ext(filename), ".")
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f
+}
+
+func newSSM(region string) *ssm.Client {
+	return ssm.NewFromConfig(newConfig(region))
+}
+
+// awsFlags registers the flags of the AWS config with the subcommand's flags.
+func awsFlags(fs *flag.FlagSet) {
+	for _, name := range []string{"profile", "endpoint-url", "user-agent", "session-name", "session-tag"} {
+		f := flags.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+}
+
+// requireRole fails if the session flags are given without a role to assume.
+func requireRole(cmd, roleFlag, roleARN string) {
+	if roleARN == "" && (*sessName != "" || len(*sessTags) > 0) {
+		log.Fatal(errors.Errorf("%v: --session-name and --session-tag require %v", cmd, roleFlag))
 	}
+}
 
-	sess, err := session.NewSession(&aws.Config{
-		CredentialsChainVerboseErrors: aws.Bool(true),
-		Region:                        region,
+// assumeRole returns a copy of the config with the credentials of the IAM
+// role, assumed by the config's own credentials and refreshed as needed.
+// The sessions are named and tagged by the --session-name and --session-tag
+// flags, so that CloudTrail attributes their calls to the deployment.
+func assumeRole(cfg aws.Config, roleARN string) aws.Config {
+	cfg = cfg.Copy()
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = *sessName
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = fmt.Sprintf("hydrate-%d", time.Now().Unix())
+		}
+		keys := make([]string, 0, len(*sessTags))
+		for key := range *sessTags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			o.Tags = append(o.Tags, ststypes.Tag{Key: aws.String(key), Value: aws.String((*sessTags)[key])})
+		}
 	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	return cfg
+}
+
+func newConfig(region string) aws.Config {
+	return loadConfig(region, true)
+}
+
+// loadConfig resolves the AWS config like the AWS CLI, from the flags, the
+// environment, the shared config files and the EC2 instance metadata. API
+// calls are retried adaptively, backing off when throttled.
+func loadConfig(region string, requireRegion bool) aws.Config {
+	cfg, err := config.LoadDefaultConfig(context.Background(), configOptions(region)...)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "failed to create aws session"))
+		log.Fatal(errors.Wrap(err, "failed to load aws config"))
+	}
+	if requireRegion && cfg.Region == "" {
+		log.Fatal(errors.New("hydrate: --region=[us-west-2], $AWS_REGION or a --profile with a region must be provided"))
 	}
 
-	paramStore := hydrate.ParamStore(ssm.New(sess, aws.NewConfig()), *basePath)
-	if err := paramStore.Hydrate(os.Stdout, r, *format, *k8s); err != nil {
-		log.Fatal(err)
+	return cfg
+}
+
+// configOptions returns the AWS config options of the region and the
+// --profile and --endpoint-url flags.
+func configOptions(region string) []func(*config.LoadOptions) error {
+	userAgentKeys := []func(*middleware.Stack) error{awsmiddleware.AddUserAgentKey("hydrate")}
+	if i := strings.Index(*userAgent, "/"); i > 0 {
+		userAgentKeys = append(userAgentKeys, awsmiddleware.AddUserAgentKeyValue((*userAgent)[:i], (*userAgent)[i+1:]))
+	} else if *userAgent != "" {
+		userAgentKeys = append(userAgentKeys, awsmiddleware.AddUserAgentKey(*userAgent))
+	}
+	opts := []func(*config.LoadOptions) error{
+		config.WithRetryMode(aws.RetryModeAdaptive),
+		config.WithAPIOptions(userAgentKeys),
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if *profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(*profile))
+	}
+	if *endpoint != "" {
+		opts = append(opts, config.WithBaseEndpoint(*endpoint))
 	}
+	return opts
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestAssumeRole(t *testing.T) {
+	tt := []struct {
+		role     string
+		status   int
+		expected string
+		err      bool
+	}{
+		{role: "arn:aws:iam::123456789012:role/ci-validate", status: http.StatusOK, expected: "ASIAVALIDATE"},
+		{role: "arn:aws:iam::123456789012:role/deploy", status: http.StatusForbidden, err: true},
+	}
+
+	for _, tc := range tt {
+		var assumed string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			assumed = r.Form.Get("RoleArn")
+			w.WriteHeader(tc.status)
+			if tc.status != http.StatusOK {
+				w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`))
+				return
+			}
+			w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+				<AccessKeyId>ASIAVALIDATE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>
+				<SessionToken>token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration>
+			</Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+		}))
+		cfg := aws.Config{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(srv.URL),
+			Credentials:  credentials.NewStaticCredentialsProvider("AKIADEPLOY", "secret", ""),
+			Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+		}
+
+		creds, err := assumeRole(cfg, tc.role).Credentials.Retrieve(context.Background())
+		srv.Close()
+		if tc.err != (err != nil) {
+			t.Errorf("%v: expected error %v, got %v", tc.role, tc.err, err)
+			continue
+		}
+		if assumed != tc.role {
+			t.Errorf("expected %v to be assumed, got %q", tc.role, assumed)
+		}
+		if !tc.err && creds.AccessKeyID != tc.expected {
+			t.Errorf("%v: expected %v credentials, got %v", tc.role, tc.expected, creds.AccessKeyID)
+		}
+	}
+}
+
+func TestAssumeRoleSession(t *testing.T) {
+	tt := []struct {
+		name     string
+		sessName string
+		sessTags keyValueFlags
+		expected string // Session name prefix.
+		tags     map[string]string
+	}{
+		{name: "defaults", expected: "hydrate-"},
+		{name: "session name", sessName: "deploy-1234", expected: "deploy-1234"},
+		{
+			name:     "tags",
+			sessTags: keyValueFlags{"pipeline": "1234", "env": "prod"},
+			expected: "hydrate-",
+			tags:     map[string]string{"Tags.member.1.Key": "env", "Tags.member.1.Value": "prod", "Tags.member.2.Key": "pipeline", "Tags.member.2.Value": "1234"},
+		},
+	}
+
+	defer func(n string, tags keyValueFlags) { *sessName, *sessTags = n, tags }(*sessName, *sessTags)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			*sessName, *sessTags = tc.sessName, tc.sessTags
+			var form url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				form = r.Form
+				w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+					<AccessKeyId>ASIADEPLOY</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>
+					<SessionToken>token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration>
+				</Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+			}))
+			defer srv.Close()
+			cfg := aws.Config{
+				Region:       "us-east-1",
+				BaseEndpoint: aws.String(srv.URL),
+				Credentials:  credentials.NewStaticCredentialsProvider("AKIADEPLOY", "secret", ""),
+				Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+			}
+
+			if _, err := assumeRole(cfg, "arn:aws:iam::123456789012:role/deploy").Credentials.Retrieve(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if name := form.Get("RoleSessionName"); !strings.HasPrefix(name, tc.expected) {
+				t.Errorf("expected session name %q, got %q", tc.expected, name)
+			}
+			for key, value := range tc.tags {
+				if got := form.Get(key); got != value {
+					t.Errorf("expected %v %q, got %q", key, value, got)
+				}
+			}
+			if tc.tags == nil && form.Get("Tags.member.1.Key") != "" {
+				t.Errorf("expected no session tags, got %v", form)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	tt := []struct {
+		userAgent string
+		expected  string
+	}{
+		{userAgent: "", expected: " hydrate"},
+		{userAgent: "pipeline/1234", expected: " pipeline/1234"},
+		{userAgent: "deploy", expected: " deploy"},
+	}
+
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+	defer func(u, e string) { *userAgent, *endpoint = u, e }(*userAgent, *endpoint)
+	for _, tc := range tt {
+		t.Run(tc.userAgent, func(t *testing.T) {
+			var header string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Get("User-Agent")
+				w.Write([]byte(`{"Parameter": {"Name": "/app/db_pass", "Value": "hunter2"}}`))
+			}))
+			defer srv.Close()
+			*userAgent, *endpoint = tc.userAgent, srv.URL
+
+			opts := append(configOptions("us-east-1"), config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("AKIADEPLOY", "secret", "")))
+			cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ssm.NewFromConfig(cfg).GetParameter(context.Background(), &ssm.GetParameterInput{Name: aws.String("/app/db_pass")}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(header, " hydrate") || !strings.Contains(header, tc.expected) {
+				t.Errorf("expected user agent with %q, got %q", tc.expected, header)
+			}
+		})
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	for name := range subcommands {
+		if !strings.Contains(usage.Error(), "hydrate "+name+" ") {
+			t.Errorf("expected usage of hydrate %v", name)
+		}
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	tt := []struct {
+		name     string
+		region   string
+		profile  string
+		endpoint string
+	}{
+		{name: "defaults"},
+		{name: "region", region: "eu-west-1"},
+		{name: "profile", profile: "dev-sso"},
+		{name: "endpoint", region: "us-east-1", endpoint: "http://localhost:4566"},
+	}
+
+	defer func(p, e string) { *profile, *endpoint = p, e }(*profile, *endpoint)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			*profile, *endpoint = tc.profile, tc.endpoint
+			var opts config.LoadOptions
+			for _, fn := range configOptions(tc.region) {
+				if err := fn(&opts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if opts.RetryMode != aws.RetryModeAdaptive {
+				t.Errorf("expected adaptive retries, got %q", opts.RetryMode)
+			}
+			if opts.Region != tc.region || opts.SharedConfigProfile != tc.profile {
+				t.Errorf("expected region %q and profile %q, got %q and %q", tc.region, tc.profile, opts.Region, opts.SharedConfigProfile)
+			}
+			if opts.BaseEndpoint != tc.endpoint {
+				t.Errorf("expected endpoint %q, got %q", tc.endpoint, opts.BaseEndpoint)
+			}
+		})
+	}
+}
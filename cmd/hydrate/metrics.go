@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// metricsTimeout bounds pushing the metrics, so that an unreachable
+// Pushgateway never holds up CI runs.
+const metricsTimeout = 5 * time.Second
+
+// runMetrics pushes the metrics of a one-shot run on exit, see --push-metrics.
+type runMetrics struct {
+	url   string
+	start time.Time
+	stats func() map[string]hydrate.ProviderStats
+}
+
+// pushedMetrics is set by --push-metrics, and pushed once by pushMetrics.
+var pushedMetrics *runMetrics
+
+type metric struct {
+	name   string
+	help   string
+	labels map[string]string
+	value  float64
+}
+
+// pushMetrics pushes the run's metrics, if --push-metrics is set and they
+// weren't pushed yet. The err is the run's failure, if any. Failing to push
+// only logs a warning, since it must never fail the run itself.
+func pushMetrics(err error) {
+	m := pushedMetrics
+	if m == nil {
+		return
+	}
+	pushedMetrics = nil
+
+	if perr := m.push(m.collect(err)); perr != nil {
+		logger.Log(hydrate.LevelWarn, "failed to push metrics", "url", m.url, "error", perr)
+	}
+}
+
+func (m *runMetrics) collect(err error) []metric {
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+	metrics := []metric{
+		{name: "hydrate_run_duration_seconds", help: "Duration of the hydrate run.", value: time.Since(m.start).Seconds()},
+		{name: "hydrate_run_success", help: "Whether the hydrate run succeeded (1) or failed (0).", value: success},
+		{name: "hydrate_run_timestamp_seconds", help: "Unix time the hydrate run finished at.", value: float64(time.Now().Unix())},
+	}
+
+	stats := m.stats()
+	providers := make([]string, 0, len(stats))
+	for name := range stats {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	// Each metric's samples must be grouped, by provider.
+	for _, counter := range []struct {
+		name, help string
+		value      func(hydrate.ProviderStats) int
+	}{
+		{"hydrate_secrets_fetched", "Secrets fetched from the provider.", func(s hydrate.ProviderStats) int { return s.Fetched }},
+		{"hydrate_secrets_cached", "Secrets served from the --cache-dir.", func(s hydrate.ProviderStats) int { return s.Cached }},
+		{"hydrate_secrets_failed", "Secrets that failed to fetch, including those that don't exist.", func(s hydrate.ProviderStats) int { return s.Failed }},
+	} {
+		for _, name := range providers {
+			metrics = append(metrics, metric{
+				name:   counter.name,
+				help:   counter.help,
+				labels: map[string]string{"provider": name},
+				value:  float64(counter.value(stats[name])),
+			})
+		}
+	}
+	return metrics
+}
+
+// push pushes the metrics to an OTLP/HTTP endpoint, if the URL's path ends
+// with /v1/metrics, or else to a Prometheus Pushgateway. Pushgateway URLs
+// without a /metrics/job/<job> grouping key are pushed to the hydrate job;
+// their metrics are replaced by each run.
+func (m *runMetrics) push(metrics []metric) error {
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return errors.Wrap(err, "invalid --push-metrics URL")
+	}
+
+	var (
+		method      = http.MethodPut
+		contentType = "text/plain; version=0.0.4"
+		body        []byte
+	)
+	if strings.HasSuffix(u.Path, "/v1/metrics") {
+		method, contentType = http.MethodPost, "application/json"
+		if body, err = otlpMetrics(metrics); err != nil {
+			return err
+		}
+	} else {
+		if !strings.Contains(u.Path, "/metrics/job/") {
+			u.Path = strings.TrimRight(u.Path, "/") + "/metrics/job/hydrate"
+		}
+		body = prometheusMetrics(metrics)
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	client := &http.Client{Timeout: metricsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// prometheusMetrics encodes the metrics in the Prometheus text format.
+func prometheusMetrics(metrics []metric) []byte {
+	var b bytes.Buffer
+	for i, m := range metrics {
+		if i == 0 || metrics[i-1].name != m.name {
+			fmt.Fprintf(&b, "# HELP %v %v\n# TYPE %v gauge\n", m.name, m.help, m.name)
+		}
+		b.WriteString(m.name)
+		if len(m.labels) > 0 {
+			keys := make([]string, 0, len(m.labels))
+			for key := range m.labels {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			labels := make([]string, len(keys))
+			for i, key := range keys {
+				labels[i] = fmt.Sprintf("%v=%q", key, m.labels[key])
+			}
+			fmt.Fprintf(&b, "{%v}", strings.Join(labels, ","))
+		}
+		fmt.Fprintf(&b, " %v\n", strconv.FormatFloat(m.value, 'f', -1, 64))
+	}
+	return b.Bytes()
+}
+
+// otlpMetrics encodes the metrics as gauges of an OTLP/HTTP JSON request.
+func otlpMetrics(metrics []metric) ([]byte, error) {
+	type attribute struct {
+		Key   string            `json:"key"`
+		Value map[string]string `json:"value"`
+	}
+	type dataPoint struct {
+		TimeUnixNano string      `json:"timeUnixNano"`
+		AsDouble     float64     `json:"asDouble"`
+		Attributes   []attribute `json:"attributes,omitempty"`
+	}
+	type gauge struct {
+		DataPoints []dataPoint `json:"dataPoints"`
+	}
+	type otlpMetric struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Gauge       gauge  `json:"gauge"`
+	}
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	var otlp []otlpMetric
+	for _, m := range metrics {
+		if len(otlp) == 0 || otlp[len(otlp)-1].Name != m.name {
+			otlp = append(otlp, otlpMetric{Name: m.name, Description: m.help})
+		}
+		point := dataPoint{TimeUnixNano: now, AsDouble: m.value}
+		for key, value := range m.labels {
+			point.Attributes = append(point.Attributes, attribute{Key: key, Value: map[string]string{"stringValue": value}})
+		}
+		last := &otlp[len(otlp)-1]
+		last.Gauge.DataPoints = append(last.Gauge.DataPoints, point)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []attribute{{Key: "service.name", Value: map[string]string{"stringValue": "hydrate"}}},
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "hydrate"},
+				"metrics": otlp,
+			}},
+		}},
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+func testMetrics(url string) *runMetrics {
+	return &runMetrics{url: url, start: time.Now().Add(-2 * time.Second), stats: func() map[string]hydrate.ProviderStats {
+		return map[string]hydrate.ProviderStats{
+			"vault": {Fetched: 1},
+			"ssm":   {Fetched: 12, Cached: 3, Failed: 1},
+		}
+	}}
+}
+
+func TestCollectMetrics(t *testing.T) {
+	tt := []struct {
+		name    string
+		err     error
+		success float64
+	}{
+		{name: "success", success: 1},
+		{name: "failure", err: errors.New("failed"), success: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := testMetrics("").collect(tc.err)
+			values := map[string]float64{}
+			for _, m := range metrics {
+				values[m.name+"/"+m.labels["provider"]] = m.value
+			}
+			if values["hydrate_run_success/"] != tc.success {
+				t.Errorf("expected success %v, got %v", tc.success, values["hydrate_run_success/"])
+			}
+			if d := values["hydrate_run_duration_seconds/"]; d < 2 || d > 10 {
+				t.Errorf("expected a duration of about 2s, got %v", d)
+			}
+			for key, expected := range map[string]float64{
+				"hydrate_secrets_fetched/ssm":   12,
+				"hydrate_secrets_fetched/vault": 1,
+				"hydrate_secrets_cached/ssm":    3,
+				"hydrate_secrets_failed/ssm":    1,
+				"hydrate_secrets_failed/vault":  0,
+			} {
+				if values[key] != expected {
+					t.Errorf("expected %v of %v, got %v", expected, key, values[key])
+				}
+			}
+		})
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := []metric{
+		{name: "hydrate_run_success", help: "Whether the run succeeded.", value: 1},
+		{name: "hydrate_secrets_fetched", help: "Secrets fetched.", labels: map[string]string{"provider": "ssm"}, value: 12},
+		{name: "hydrate_secrets_fetched", help: "Secrets fetched.", labels: map[string]string{"provider": "vault"}, value: 0.5},
+	}
+	expected := `# HELP hydrate_run_success Whether the run succeeded.
+# TYPE hydrate_run_success gauge
+hydrate_run_success 1
+# HELP hydrate_secrets_fetched Secrets fetched.
+# TYPE hydrate_secrets_fetched gauge
+hydrate_secrets_fetched{provider="ssm"} 12
+hydrate_secrets_fetched{provider="vault"} 0.5
+`
+	if text := string(prometheusMetrics(metrics)); text != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, text)
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	tt := []struct {
+		name        string
+		path        string
+		status      int
+		method      string
+		expected    string // Path pushed to.
+		contentType string
+		err         string
+	}{
+		{name: "pushgateway", path: "/metrics/job/hydrate/pipeline/deploy", status: 200, method: "PUT", expected: "/metrics/job/hydrate/pipeline/deploy", contentType: "text/plain; version=0.0.4"},
+		{name: "default job", path: "/", status: 202, method: "PUT", expected: "/metrics/job/hydrate", contentType: "text/plain; version=0.0.4"},
+		{name: "otlp", path: "/v1/metrics", status: 200, method: "POST", expected: "/v1/metrics", contentType: "application/json"},
+		{name: "status", path: "/metrics/job/hydrate", status: 500, method: "PUT", expected: "/metrics/job/hydrate", err: "unexpected status 500"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var method, path, contentType string
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+				body, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			m := testMetrics(srv.URL + tc.path)
+			err := m.push(m.collect(nil))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != tc.method || path != tc.expected || contentType != tc.contentType {
+				t.Errorf("expected %v %v (%v), got %v %v (%v)", tc.method, tc.expected, tc.contentType, method, path, contentType)
+			}
+			if tc.method == "POST" {
+				var otlp struct {
+					ResourceMetrics []struct {
+						ScopeMetrics []struct {
+							Metrics []struct {
+								Name  string `json:"name"`
+								Gauge struct {
+									DataPoints []json.RawMessage `json:"dataPoints"`
+								} `json:"gauge"`
+							} `json:"metrics"`
+						} `json:"scopeMetrics"`
+					} `json:"resourceMetrics"`
+				}
+				if err := json.Unmarshal(body, &otlp); err != nil {
+					t.Fatal(err)
+				}
+				metrics := otlp.ResourceMetrics[0].ScopeMetrics[0].Metrics
+				if len(metrics) != 6 || metrics[3].Name != "hydrate_secrets_fetched" || len(metrics[3].Gauge.DataPoints) != 2 {
+					t.Errorf("expected 6 metrics with a data point per provider, got %s", body)
+				}
+			} else if !strings.Contains(string(body), `hydrate_secrets_fetched{provider="ssm"} 12`) {
+				t.Errorf("expected the fetched secrets, got %s", body)
+			}
+		})
+	}
+}
+
+func TestPushMetricsOnce(t *testing.T) {
+	pushes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes++
+	}))
+	defer srv.Close()
+
+	pushedMetrics = testMetrics(srv.URL)
+	pushMetrics(errors.New("failed"))
+	pushMetrics(nil)
+	if pushes != 1 || pushedMetrics != nil {
+		t.Errorf("expected the metrics to be pushed once, got %v pushes", pushes)
+	}
+}
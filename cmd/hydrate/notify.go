@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// notifyTimeout bounds each webhook notification, and waiting for them
+// before exiting.
+const notifyTimeout = 10 * time.Second
+
+// notifyQueueSize bounds the notifications waiting to be posted, beyond
+// which they're dropped rather than piling up behind a slow webhook.
+const notifyQueueSize = 64
+
+// Notification events, see notifier.
+const (
+	eventParameterChanged = "parameter_changed"
+	eventHydrationFailed  = "hydration_failed"
+)
+
+// Failure classes, repeats of which are notified of once per interval and
+// targets, whatever their errors, see notifier.failed.
+const (
+	failureHydration   = "hydration"   // Of a template, object or request.
+	failureUnavailable = "unavailable" // Shed, timed out or throttled.
+	failureRenewal     = "renewal"     // Of the secrets of hydrate exec.
+	failureFatal       = "fatal"       // The daemon exits.
+)
+
+// notification is the JSON body posted to --notify-url webhooks, except
+// Slack's, which are posted a {"text":"..."} message.
+type notification struct {
+	Event     string    `json:"event"`
+	Source    string    `json:"source"` // ie. "hydrate watch".
+	Parameter string    `json:"parameter,omitempty"`
+	Operation string    `json:"operation,omitempty"` // Of parameter changes, ie. Update.
+	Targets   []string  `json:"targets,omitempty"`   // Re-hydrated templates, or failing objects.
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// notifier posts notifications of changed parameters and failed hydrations
+// of the daemon modes to webhooks, so that on-call engineers learn about
+// rotations and broken references without watching the logs. Repeats of a
+// failure are only posted once per --notify-interval, and notifications
+// are posted one at a time from a bounded queue.
+type notifier struct {
+	source   string
+	urls     []string
+	on       string
+	interval time.Duration
+
+	mu    sync.Mutex
+	sent  map[string]time.Time // By failure class and targets.
+	swept time.Time
+	start sync.Once
+	queue chan notification
+	wg    sync.WaitGroup
+}
+
+// notifyFlags registers the --notify-* flags of the daemon command.
+func notifyFlags(fs *flag.FlagSet) *notifier {
+	n := &notifier{source: fs.Name(), sent: map[string]time.Time{}}
+	fs.Var((*urlFlags)(&n.urls), "notify-url", "post notifications to the Slack incoming webhook or HTTP endpoint, ie. https://hooks.slack.com/services/... (repeatable)")
+	fs.StringVar(&n.on, "notify-on", "changes,failures", "comma-separated events to notify of: changes (of referenced parameters), failures (of hydrations)")
+	fs.DurationVar(&n.interval, "notify-interval", 5*time.Minute, "notify of repeats of the same failure at most once per duration")
+	return n
+}
+
+// check fails on unknown --notify-on events; call it once flags are parsed.
+func (n *notifier) check() {
+	for _, event := range strings.Split(n.on, ",") {
+		if event != "changes" && event != "failures" {
+			log.Fatal(errors.Errorf("%v: unknown --notify-on=%v, expected changes or failures", n.source, event))
+		}
+	}
+}
+
+// changed notifies of the parameter change re-hydrating the targets.
+func (n *notifier) changed(parameter, operation string, targets []string) {
+	if !n.enabled("changes") {
+		return
+	}
+	n.post(notification{Event: eventParameterChanged, Parameter: parameter, Operation: operation, Targets: targets})
+}
+
+// failed notifies of the failed hydration of the targets, ie. templates or
+// an object, unless a failure of the class was notified of for the same
+// targets within the interval. The errors aren't compared, as they vary.
+func (n *notifier) failed(class string, err error, targets ...string) {
+	if !n.enabled("failures") {
+		return
+	}
+	key := class + "\x00" + strings.Join(targets, "\x00")
+	now := time.Now()
+	n.mu.Lock()
+	if now.Sub(n.swept) >= n.interval {
+		// Forget expired failures, so that they don't pile up.
+		for key, sent := range n.sent {
+			if now.Sub(sent) >= n.interval {
+				delete(n.sent, key)
+			}
+		}
+		n.swept = now
+	}
+	if sent, ok := n.sent[key]; ok && now.Sub(sent) < n.interval {
+		n.mu.Unlock()
+		return
+	}
+	n.sent[key] = now
+	n.mu.Unlock()
+
+	n.post(notification{Event: eventHydrationFailed, Targets: targets, Error: err.Error()})
+}
+
+// fatal notifies of the error the daemon exits with, and exits.
+func (n *notifier) fatal(err error) {
+	n.failed(failureFatal, err)
+	n.wait()
+	log.Fatal(err)
+}
+
+func (n *notifier) enabled(event string) bool {
+	return n != nil && len(n.urls) > 0 && strings.Contains(","+n.on+",", ","+event+",")
+}
+
+// post queues the notification to be posted to the webhooks in the
+// background, or drops it if the queue is full. Failures are only logged,
+// notifications must never stall the daemon.
+func (n *notifier) post(msg notification) {
+	n.start.Do(func() {
+		n.queue = make(chan notification, notifyQueueSize)
+		go n.run()
+	})
+
+	msg.Source, msg.Time = n.source, time.Now().UTC()
+	n.wg.Add(1)
+	select {
+	case n.queue <- msg:
+	default:
+		n.wg.Done()
+		logger.Log(hydrate.LevelWarn, "dropped notification", "event", msg.Event, "queued", notifyQueueSize)
+	}
+}
+
+// run posts the queued notifications.
+func (n *notifier) run() {
+	for msg := range n.queue {
+		for _, u := range n.urls {
+			if err := postNotification(u, msg); err != nil {
+				logger.Log(hydrate.LevelWarn, "failed to notify", "url", webhookHost(u), "error", err)
+			}
+		}
+		n.wg.Done()
+	}
+}
+
+// wait waits for the queued notifications, ie. before exiting.
+func (n *notifier) wait() {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(notifyTimeout):
+	}
+}
+
+func postNotification(u string, msg notification) error {
+	var body interface{} = msg
+	if isSlackWebhook(u) {
+		body = map[string]string{"text": slackText(msg)}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.New(strings.Replace(err.Error(), u, webhookHost(u), -1))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+func isSlackWebhook(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && parsed.Host == "hooks.slack.com"
+}
+
+func slackText(msg notification) string {
+	var text string
+	switch msg.Event {
+	case eventParameterChanged:
+		text = fmt.Sprintf(":arrows_counterclockwise: *%v*: parameter `%v` changed (%v), re-hydrated %v", msg.Source, msg.Parameter, msg.Operation, strings.Join(msg.Targets, ", "))
+	default:
+		text = fmt.Sprintf(":rotating_light: *%v*: hydration failed: %v", msg.Source, msg.Error)
+		if len(msg.Targets) > 0 {
+			text += " (" + strings.Join(msg.Targets, ", ") + ")"
+		}
+	}
+	return text
+}
+
+// webhookHost strips the path of webhook URLs, whose tokens are secrets, ie.
+// of Slack's https://hooks.slack.com/services/T000/B000/XXXX.
+func webhookHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "webhook"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// urlFlags collects repeated flags.
+type urlFlags []string
+
+func (f *urlFlags) String() string {
+	return ""
+}
+
+func (f *urlFlags) Set(value string) error {
+	if _, err := url.ParseRequestURI(value); err != nil {
+		return errors.Errorf("expected a URL, got %q", webhookHost(value))
+	}
+	*f = append(*f, value)
+	return nil
+}
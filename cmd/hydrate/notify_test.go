@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNotifierFailed(t *testing.T) {
+	type failure struct {
+		class   string
+		err     string
+		targets []string
+	}
+	tt := []struct {
+		name     string
+		on       string
+		failures []failure
+		posted   int
+	}{
+		{
+			name: "varying errors",
+			on:   "failures",
+			failures: []failure{
+				{failureHydration, "failed to fetch parameters, 12 requests throttled", []string{"a.yml"}},
+				{failureHydration, "failed to fetch parameters, 13 requests throttled", []string{"a.yml"}},
+			},
+			posted: 1,
+		},
+		{
+			name: "targets",
+			on:   "changes,failures",
+			failures: []failure{
+				{failureHydration, "missing parameter", []string{"Secret ns/a"}},
+				{failureHydration, "missing parameter", []string{"Secret ns/b"}},
+				{failureHydration, "other missing parameter", []string{"Secret ns/a"}},
+			},
+			posted: 2,
+		},
+		{
+			name: "classes",
+			on:   "failures",
+			failures: []failure{
+				{failureHydration, "failed", []string{"a.yml"}},
+				{failureRenewal, "failed", []string{"a.yml"}},
+			},
+			posted: 2,
+		},
+		{
+			name:     "changes only",
+			on:       "changes",
+			failures: []failure{{failureHydration, "failed", []string{"a.yml"}}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var posted []notification
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var msg notification
+				if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+					t.Error(err)
+				}
+				mu.Lock()
+				posted = append(posted, msg)
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			n := &notifier{source: "hydrate test", urls: []string{srv.URL}, on: tc.on, interval: time.Minute, sent: map[string]time.Time{}}
+			for _, f := range tc.failures {
+				n.failed(f.class, errors.New(f.err), f.targets...)
+			}
+			n.wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(posted) != tc.posted {
+				t.Errorf("expected %v notifications, got %v: %+v", tc.posted, len(posted), posted)
+			}
+			for _, msg := range posted {
+				if msg.Event != eventHydrationFailed || msg.Source != "hydrate test" || msg.Error == "" {
+					t.Errorf("unexpected notification %+v", msg)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifierForgetsExpiredFailures(t *testing.T) {
+	n := &notifier{urls: []string{"http://127.0.0.1:0"}, on: "failures", interval: time.Minute, sent: map[string]time.Time{}}
+	n.queue = make(chan notification, notifyQueueSize)
+	n.start.Do(func() {}) // Don't post.
+
+	n.sent["old"] = time.Now().Add(-2 * time.Minute)
+	n.failed(failureHydration, errors.New("failed"), "a.yml")
+	if _, ok := n.sent["old"]; ok {
+		t.Error("expected the expired failure to be forgotten")
+	}
+	if len(n.sent) != 1 || len(n.queue) != 1 {
+		t.Errorf("expected 1 failure queued, got %v sent and %v queued", len(n.sent), len(n.queue))
+	}
+}
+
+func TestNotifierDropsBeyondQueue(t *testing.T) {
+	n := &notifier{urls: []string{"http://127.0.0.1:0"}, on: "failures", sent: map[string]time.Time{}}
+	n.queue = make(chan notification, notifyQueueSize)
+	n.start.Do(func() {}) // Don't post.
+
+	for i := 0; i < notifyQueueSize+10; i++ {
+		n.post(notification{Event: eventHydrationFailed})
+	}
+	if len(n.queue) != notifyQueueSize {
+		t.Errorf("expected %v queued notifications, got %v", notifyQueueSize, len(n.queue))
+	}
+}
+
+func TestNotifierNil(t *testing.T) {
+	var n *notifier
+	n.failed(failureHydration, errors.New("failed"))
+	n.changed("/app/db_pass", "Update", nil)
+}
+
+func TestSlackText(t *testing.T) {
+	tt := []struct {
+		name     string
+		msg      notification
+		expected string
+	}{
+		{
+			name:     "changed",
+			msg:      notification{Event: eventParameterChanged, Source: "hydrate watch", Parameter: "/app/db_pass", Operation: "Update", Targets: []string{"a.yml", "b.yml"}},
+			expected: ":arrows_counterclockwise: *hydrate watch*: parameter `/app/db_pass` changed (Update), re-hydrated a.yml, b.yml",
+		},
+		{
+			name:     "failed",
+			msg:      notification{Event: eventHydrationFailed, Source: "hydrate webhook", Error: "missing parameter", Targets: []string{"Secret ns/a"}},
+			expected: ":rotating_light: *hydrate webhook*: hydration failed: missing parameter (Secret ns/a)",
+		},
+		{
+			name:     "fatal",
+			msg:      notification{Event: eventHydrationFailed, Source: "hydrate watch", Error: "failed to receive SQS messages"},
+			expected: ":rotating_light: *hydrate watch*: hydration failed: failed to receive SQS messages",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if text := slackText(tc.msg); text != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, text)
+			}
+		})
+	}
+}
+
+func TestWebhookHost(t *testing.T) {
+	tt := []struct {
+		url      string
+		expected string
+		slack    bool
+	}{
+		{"https://hooks.slack.com/services/T000/B000/XXXX", "https://hooks.slack.com", true},
+		{"http://alerts.internal:8080/hydrate?token=secret", "http://alerts.internal:8080", false},
+	}
+
+	for _, tc := range tt {
+		if host := webhookHost(tc.url); host != tc.expected || strings.Contains(host, "XXXX") {
+			t.Errorf("%v: expected %q, got %q", tc.url, tc.expected, host)
+		}
+		if slack := isSlackWebhook(tc.url); slack != tc.slack {
+			t.Errorf("%v: expected slack %v, got %v", tc.url, tc.slack, slack)
+		}
+	}
+}
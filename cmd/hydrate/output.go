@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// exitBrokenPipe is the conventional exit status of processes
+// killed by SIGPIPE (128+13), ie. when `| head` closes the pipe.
+const exitBrokenPipe = 141
+
+// writeStdout writes the complete output to STDOUT at once, so that
+// consumers (ie. kubectl) never apply partially hydrated output.
+func writeStdout(b []byte) error {
+	n, err := os.Stdout.Write(b)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// fatal logs the error and exits with a non-zero status; broken pipes
+// exit with exitBrokenPipe status. Any --push-metrics are pushed first.
+func fatal(err error) {
+	pushMetrics(err)
+	if errors.Is(err, syscall.EPIPE) {
+		logger.Log(hydrate.LevelError, "output closed before all data was written (broken pipe)")
+		os.Exit(exitBrokenPipe)
+	}
+	log.Fatal(err)
+}
+
+// printFilenames prints the names of the written files, one per line,
+// or NUL-delimited for `xargs -0` if nullDelimited.
+func printFilenames(filenames []string, nullDelimited bool) error {
+	delim := "\n"
+	if nullDelimited {
+		delim = "\x00"
+	}
+	for _, filename := range filenames {
+		if _, err := io.WriteString(os.Stdout, filename+delim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
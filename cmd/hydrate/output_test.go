@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPrintFilenames(t *testing.T) {
+	tt := []struct {
+		filenames     []string
+		nullDelimited bool
+		expected      string
+	}{
+		{filenames: []string{"out/a.yml", "out/my file.yml"}, expected: "out/a.yml\nout/my file.yml\n"},
+		{filenames: []string{"out/a.yml", "out/my\nfile.yml"}, nullDelimited: true, expected: "out/a.yml\x00out/my\nfile.yml\x00"},
+		{filenames: nil, nullDelimited: true, expected: ""},
+	}
+
+	for _, tc := range tt {
+		out := captureStdout(t, func() {
+			if err := printFilenames(tc.filenames, tc.nullDelimited); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if out != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, out)
+		}
+	}
+}
+
+func TestWriteStdoutBrokenPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	defer w.Close()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	err = writeStdout([]byte("db_pass: hunter2\n"))
+	os.Stdout = stdout
+
+	if !errors.Is(err, syscall.EPIPE) {
+		t.Errorf("expected %v, got %v", syscall.EPIPE, err)
+	}
+}
+
+func TestTimedOut(t *testing.T) {
+	*timeout = 30 * time.Second
+	defer func() { *timeout = 0 }()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{name: "deadline", ctx: expired, expected: "hydrate: canceled after --timeout=30s: failed"},
+		{name: "canceled", ctx: canceled, expected: "failed"},
+		{name: "running", ctx: context.Background(), expected: "failed"},
+	}
+
+	for _, tc := range tt {
+		if err := timedOut(tc.ctx, errors.New("failed")); err.Error() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestParseChaos(t *testing.T) {
+	tt := []struct {
+		value       string
+		probability float64
+		latency     time.Duration
+		err         string
+	}{
+		{value: "0.1", probability: 0.1},
+		{value: "1,200ms", probability: 1, latency: 200 * time.Millisecond},
+		{value: "1.5", err: "expected probability between 0 and 1"},
+		{value: "often", err: "expected probability between 0 and 1"},
+		{value: "0.1,soon", err: "invalid --chaos=0.1,soon latency"},
+	}
+
+	for _, tc := range tt {
+		probability, latency, err := parseChaos(tc.value)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.value, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if probability != tc.probability || latency != tc.latency {
+			t.Errorf("%v: expected %v,%v, got %v,%v", tc.value, tc.probability, tc.latency, probability, latency)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// deadlineMargin is left of the API server's timeout of webhook calls to
+// respond in, see requestTimeout.
+const deadlineMargin = 500 * time.Millisecond
+
+// unavailableError is a hydration that failed because the secret store was
+// unavailable, rather than because of the document: it was shed, timed out
+// or throttled.
+type unavailableError struct {
+	error
+}
+
+// Cause returns the original error, see github.com/pkg/errors.
+func (e *unavailableError) Cause() error {
+	return e.error
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.error
+}
+
+func isUnavailable(err error) bool {
+	var u *unavailableError
+	return errors.As(err, &u)
+}
+
+// notifyFailed notifies of the failed hydration of the targets. Failures
+// of the secret store being unavailable are notified of once for all
+// targets, rather than for every shed request.
+func (s *server) notifyFailed(err error, targets ...string) {
+	if isUnavailable(err) {
+		s.notify.failed(failureUnavailable, err)
+		return
+	}
+	s.notify.failed(failureHydration, err, targets...)
+}
+
+// admit reserves one of the --max-in-flight hydrations, unless the request
+// is shed. The release func must be called once the hydration is done.
+func (s *server) admit() (release func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wait := time.Until(s.shedUntil); wait > 0 {
+		return nil, &unavailableError{errors.Errorf("shedding load for %v, AWS throttled recent hydrations", wait.Round(time.Second))}
+	}
+	if s.maxInFlight > 0 && s.inFlight >= s.maxInFlight {
+		return nil, &unavailableError{errors.Errorf("shedding load, %v hydrations in flight (--max-in-flight)", s.inFlight)}
+	}
+	s.inFlight++
+	return func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}, nil
+}
+
+// hydrateWithin runs the hydration with the ctx, whose deadline cancels
+// its AWS calls, Vault requests and plugins, so that requests never block
+// for longer. Errors of timed out or throttled hydrations are
+// unavailableErrors, and throttling sheds requests for --throttle-backoff.
+func (s *server) hydrateWithin(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.classify(ctx, fn(ctx))
+}
+
+func (s *server) classify(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() == context.DeadlineExceeded:
+		return &unavailableError{errors.Wrapf(err, "canceled after the request's deadline of %v", s.deadline(ctx))}
+	case hydrate.IsThrottled(err):
+		if s.throttleBackoff > 0 {
+			s.mu.Lock()
+			s.shedUntil = time.Now().Add(s.throttleBackoff)
+			s.mu.Unlock()
+		}
+		return &unavailableError{err}
+	}
+	return err
+}
+
+// deadline returns the timeout of the ctx, as set by requestTimeout.
+func (s *server) deadline(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return s.timeout
+}
+
+type timeoutKey struct{}
+
+// requestTimeout returns the ctx of the request, canceled after --timeout,
+// or the timeout the API server calls webhooks with (the "timeout" query
+// parameter, ie. "10s"), less a margin to respond in, if it's shorter.
+func (s *server) requestTimeout(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := s.timeout
+	if t, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && t-deadlineMargin < timeout {
+		timeout = t - deadlineMargin
+		if timeout <= 0 {
+			timeout = t
+		}
+	}
+	ctx := context.WithValue(r.Context(), timeoutKey{}, timeout)
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+func TestAdmit(t *testing.T) {
+	tt := []struct {
+		name        string
+		maxInFlight int
+		inFlight    int
+		shedUntil   time.Time
+		err         string
+	}{
+		{name: "admitted", maxInFlight: 2, inFlight: 1},
+		{name: "no limit", inFlight: 100},
+		{name: "in flight", maxInFlight: 2, inFlight: 2, err: "2 hydrations in flight (--max-in-flight)"},
+		{name: "throttled", maxInFlight: 2, shedUntil: time.Now().Add(time.Minute), err: "AWS throttled recent hydrations"},
+		{name: "backed off", maxInFlight: 2, shedUntil: time.Now().Add(-time.Second)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{maxInFlight: tc.maxInFlight, inFlight: tc.inFlight, shedUntil: tc.shedUntil}
+			release, err := s.admit()
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) || !isUnavailable(err) {
+					t.Fatalf("expected unavailable error %q, got %v", tc.err, err)
+				}
+				if s.inFlight != tc.inFlight {
+					t.Errorf("expected %v in flight, got %v", tc.inFlight, s.inFlight)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.inFlight != tc.inFlight+1 {
+				t.Errorf("expected %v in flight, got %v", tc.inFlight+1, s.inFlight)
+			}
+			release()
+			if s.inFlight != tc.inFlight {
+				t.Errorf("expected %v in flight once released, got %v", tc.inFlight, s.inFlight)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	throttled := errors.Wrap(&smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}, `failed to fetch "/app/db_pass" parameter`)
+	tt := []struct {
+		name        string
+		err         error
+		expired     bool
+		backoff     time.Duration
+		unavailable bool
+		shed        bool
+		message     string
+	}{
+		{name: "nil"},
+		{name: "invalid", err: errors.New("missing parameter"), message: "missing parameter"},
+		{name: "deadline", err: context.DeadlineExceeded, expired: true, unavailable: true, message: "canceled after the request's deadline of 1s"},
+		{name: "throttled", err: throttled, backoff: time.Minute, unavailable: true, shed: true, message: "Rate exceeded"},
+		{name: "throttled without backoff", err: throttled, unavailable: true, message: "Rate exceeded"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{timeout: time.Second, throttleBackoff: tc.backoff}
+			ctx := context.Background()
+			if tc.expired {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, time.Now().Add(-time.Second))
+				defer cancel()
+			}
+			err := s.classify(ctx, tc.err)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.message) {
+				t.Fatalf("expected error %q, got %v", tc.message, err)
+			}
+			if isUnavailable(err) != tc.unavailable {
+				t.Errorf("expected unavailable %v, got %v", tc.unavailable, isUnavailable(err))
+			}
+			if shed := time.Now().Before(s.shedUntil); shed != tc.shed {
+				t.Errorf("expected shedding %v, got %v", tc.shed, shed)
+			}
+		})
+	}
+}
+
+func TestHydrateWithinDeadline(t *testing.T) {
+	s := &server{timeout: 10 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	err := s.hydrateWithin(ctx, func(ctx context.Context) error {
+		<-ctx.Done() // Like a canceled AWS call.
+		return errors.Wrap(ctx.Err(), "failed to fetch parameters")
+	})
+	if !isUnavailable(err) || !strings.Contains(err.Error(), "canceled after the request's deadline of 10ms") {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tt := []struct {
+		url      string
+		expected time.Duration
+	}{
+		{url: "/mutate", expected: 8 * time.Second},
+		{url: "/mutate?timeout=10s", expected: 8 * time.Second},
+		{url: "/mutate?timeout=5s", expected: 5*time.Second - deadlineMargin},
+		{url: "/mutate?timeout=300ms", expected: 300 * time.Millisecond},
+		{url: "/mutate?timeout=invalid", expected: 8 * time.Second},
+	}
+
+	s := &server{timeout: 8 * time.Second}
+	for _, tc := range tt {
+		ctx, cancel := s.requestTimeout(httptest.NewRequest("POST", tc.url, nil))
+		if timeout := s.deadline(ctx); timeout != tc.expected {
+			t.Errorf("%v: expected timeout %v, got %v", tc.url, tc.expected, timeout)
+		}
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > tc.expected {
+			t.Errorf("%v: expected a deadline within %v, got %v", tc.url, tc.expected, deadline)
+		}
+		cancel()
+	}
+}
+
+func TestNotifyFailed(t *testing.T) {
+	var mu sync.Mutex
+	var posted []notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notification
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		posted = append(posted, msg)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	n := &notifier{source: "hydrate webhook", urls: []string{srv.URL}, on: "failures", interval: time.Minute, sent: map[string]time.Time{}}
+	s := &server{notify: n}
+	for _, target := range []string{"Secret ns/a", "Secret ns/b", "Secret ns/c"} {
+		s.notifyFailed(&unavailableError{errors.New("shedding load, 64 hydrations in flight (--max-in-flight)")}, target)
+		s.notifyFailed(errors.New("missing parameter"), target)
+	}
+	n.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var unavailable, failed int
+	for _, msg := range posted {
+		if len(msg.Targets) == 0 {
+			unavailable++
+		} else {
+			failed++
+		}
+	}
+	if unavailable != 1 || failed != 3 {
+		t.Errorf("expected 1 unavailable and 3 failed notifications, got %v and %v: %+v", unavailable, failed, posted)
+	}
+}
+
+// blockingHydrator blocks until its ctx is done, like a hung AWS call.
+type blockingHydrator struct{}
+
+func (blockingHydrator) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	<-ctx.Done()
+	return errors.Wrap(ctx.Err(), "failed to fetch parameters")
+}
+
+func TestMutateFailurePolicy(t *testing.T) {
+	tt := []struct {
+		name     string
+		failOpen bool
+		store    hydrator
+		inFlight int
+		allowed  bool
+		warning  bool
+	}{
+		{name: "timed out closed", store: blockingHydrator{}},
+		{name: "timed out open", failOpen: true, store: blockingHydrator{}, allowed: true, warning: true},
+		{name: "shed closed", store: replaceHydrator{}, inFlight: 1},
+		{name: "shed open", failOpen: true, store: replaceHydrator{}, inFlight: 1, allowed: true, warning: true},
+		{name: "invalid open", failOpen: true, store: replaceHydrator{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{ttl: time.Hour, timeout: 20 * time.Millisecond, maxInFlight: 1, inFlight: tc.inFlight, failOpen: tc.failOpen, store: tc.store, created: time.Now()}
+			object := `{"kind":"Secret","stringData":{"pass":"$fail"}}`
+			body := `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"1","kind":{"kind":"Secret"},"operation":"CREATE","name":"app","namespace":"ns","object":` + object + `}}`
+			w := httptest.NewRecorder()
+			s.mutate(w, httptest.NewRequest("POST", "/mutate?timeout=10s", strings.NewReader(body)))
+
+			var review admissionReview
+			if err := json.NewDecoder(w.Body).Decode(&review); err != nil {
+				t.Fatal(err)
+			}
+			resp := review.Response
+			if resp.Allowed != tc.allowed {
+				t.Errorf("expected allowed %v, got %+v", tc.allowed, resp)
+			}
+			if warning := len(resp.Warnings) > 0; warning != tc.warning {
+				t.Errorf("expected warning %v, got %q", tc.warning, resp.Warnings)
+			}
+			if len(resp.Patch) > 0 {
+				t.Errorf("expected no patch, got %s", resp.Patch)
+			}
+		})
+	}
+}
+
+func TestServeShed(t *testing.T) {
+	tt := []struct {
+		name  string
+		s     *server
+		store hydrator
+	}{
+		{name: "in flight", s: &server{maxInFlight: 1, inFlight: 1}, store: replaceHydrator{}},
+		{name: "throttled", s: &server{shedUntil: time.Now().Add(time.Minute)}, store: replaceHydrator{}},
+		{name: "timed out", s: &server{}, store: blockingHydrator{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.s
+			s.ttl, s.timeout, s.store, s.created = time.Hour, 20*time.Millisecond, tc.store, time.Now()
+			w := httptest.NewRecorder()
+			s.hydrate(w, httptest.NewRequest("POST", "/hydrate", strings.NewReader("pass: $$\n")))
+			if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+				t.Errorf("expected status 503 with Retry-After, got %v %v: %v", w.Code, w.Header(), w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// referenceRe matches values that already are hydrate references,
+	// ie. "$SECRET:/app/db", "$$" or "postgres://${SECRET:pass}@db".
+	referenceRe = regexp.MustCompile(`^\$(\$|[A-Z]+\??(:|$))|\$\{[A-Z]+\??:`)
+
+	// paramNameRe matches valid Parameter Store names.
+	paramNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.\-/]+$`)
+)
+
+// tagFlags collects repeated --tag=key=value flags.
+type tagFlags []types.Tag
+
+func (t *tagFlags) String() string {
+	return ""
+}
+
+func (t *tagFlags) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return errors.Errorf("expected key=value, got %q", value)
+	}
+	*t = append(*t, types.Tag{Key: aws.String(value[:i]), Value: aws.String(value[i+1:])})
+	return nil
+}
+
+func push(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate push", flag.ExitOnError)
+		region    = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath  = flags.String("path", "", "AWS SSM Parameter Store path to store the values under, ie. /app/prod")
+		format    = flags.String("format", "", "input file format: json, yaml (defaults to file extension)")
+		kmsKeyID  = flags.String("kms-key-id", "", "KMS key to encrypt the parameters with (defaults to aws/ssm)")
+		overwrite = flags.Bool("overwrite", false, "replace parameters that already exist")
+		tags      tagFlags
+	)
+	flags.Var(&tags, "tag", "tag the parameters, ie. --tag=team=payments (repeatable)")
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *basePath == "" || !strings.HasPrefix(*basePath, "/") || flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate push: usage: hydrate push --path=/app/prod secrets.yml > template.yml"))
+	}
+
+	r := openInput(flags.Arg(0), format)
+	defer r.Close()
+	if *format != "json" && !isYAMLFormat(*format) {
+		log.Fatal(errors.Errorf("hydrate push: unsupported format %q, expected json or yaml", *format))
+	}
+
+	p := &pusher{
+		ctx:       context.Background(),
+		ssm:       newSSM(*region),
+		basePath:  *basePath,
+		kmsKeyID:  *kmsKeyID,
+		overwrite: *overwrite,
+		tags:      tags,
+	}
+
+	// Store all values first, to never print a partial template.
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(r)
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate push: failed to decode input"))
+		}
+		if err := p.node(&node, nil); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate push"))
+		}
+		docs = append(docs, &node)
+	}
+
+	var b bytes.Buffer
+	if *format == "json" {
+		for _, doc := range docs {
+			if err := writeJSONNode(&b, doc, ""); err != nil {
+				log.Fatal(errors.Wrap(err, "hydrate push: failed to encode template"))
+			}
+			b.WriteByte('\n')
+		}
+	} else {
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		for _, doc := range docs {
+			if err := enc.Encode(doc); err != nil {
+				log.Fatal(errors.Wrap(err, "hydrate push: failed to encode template"))
+			}
+		}
+	}
+	if err := writeStdout(b.Bytes()); err != nil {
+		fatal(err)
+	}
+	logger.Log(hydrate.LevelInfo, "stored parameters", "count", p.pushed, "path", *basePath)
+}
+
+func isYAMLFormat(format string) bool {
+	return format == "yml" || format == "yaml"
+}
+
+// pusher stores the string values of a document as SecureString parameters
+// named by their field path, and replaces them with $SECRET: references.
+type pusher struct {
+	ctx       context.Context
+	ssm       *ssm.Client
+	basePath  string
+	kmsKeyID  string
+	overwrite bool
+	tags      []types.Tag
+	pushed    int
+}
+
+func (p *pusher) node(node *yaml.Node, field []string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := p.node(n, field); err != nil {
+				return err
+			}
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Tag == "!!merge" {
+				continue // Stored where the anchor is defined.
+			}
+			key := node.Content[i].Value
+			if err := p.node(node.Content[i+1], append(field[:len(field):len(field)], key)); err != nil {
+				return err
+			}
+		}
+
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			if err := p.node(n, append(field[:len(field):len(field)], strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+
+	case yaml.ScalarNode:
+		// Numbers and booleans would become strings, leave them as they are.
+		if node.Tag != "!!str" || node.Value == "" || referenceRe.MatchString(node.Value) {
+			return nil
+		}
+		key := strings.Join(field, "/")
+		if !paramNameRe.MatchString(key) {
+			return errors.Errorf("field %q can't be stored as a parameter, its name may only contain a-z, A-Z, 0-9, _.-/", strings.Join(field, "."))
+		}
+		if err := p.put(path.Join(p.basePath, key), node.Value); err != nil {
+			return err
+		}
+		node.Value = "$SECRET:" + key // Relative to --path.
+		node.Style = 0
+	}
+	return nil
+}
+
+func (p *pusher) put(name, value string) error {
+	logger.Log(hydrate.LevelInfo, "storing secret", "key", name, "into", "AWS SSM Parameter Store")
+
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      types.ParameterTypeSecureString,
+		Overwrite: aws.Bool(p.overwrite),
+	}
+	if p.kmsKeyID != "" {
+		input.KeyId = aws.String(p.kmsKeyID)
+	}
+	if !p.overwrite {
+		input.Tags = p.tags // Not allowed together with Overwrite.
+	}
+	if _, err := p.ssm.PutParameter(p.ctx, input); err != nil {
+		var exists *types.ParameterAlreadyExists
+		if errors.As(err, &exists) {
+			return errors.Errorf("%q parameter already exists, use --overwrite to replace it", name)
+		}
+		return errors.Wrapf(err, "failed to store %q parameter", name)
+	}
+
+	if p.overwrite && len(p.tags) > 0 {
+		_, err := p.ssm.AddTagsToResource(p.ctx, &ssm.AddTagsToResourceInput{
+			ResourceId:   aws.String(name),
+			ResourceType: types.ResourceTypeForTaggingParameter,
+			Tags:         p.tags,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to tag %q parameter", name)
+		}
+	}
+	p.pushed++
+	return nil
+}
+
+// writeJSONNode writes the node decoded from JSON input as JSON, keeping
+// its key order and numbers.
+func writeJSONNode(b *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := writeJSONNode(b, n, indent); err != nil {
+				return err
+			}
+		}
+
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		b.WriteString(open)
+		for i := 0; i < len(node.Content); i += step {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString("\n" + indent + "  ")
+			if step == 2 {
+				key, _ := json.Marshal(node.Content[i].Value)
+				b.Write(key)
+				b.WriteString(": ")
+			}
+			if err := writeJSONNode(b, node.Content[i+step-1], indent+"  "); err != nil {
+				return err
+			}
+		}
+		if len(node.Content) > 0 {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString(close)
+
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			b.WriteString(node.Value) // Numbers, booleans and null as they are.
+			return nil
+		}
+		value, err := json.Marshal(node.Value)
+		if err != nil {
+			return err
+		}
+		b.Write(value)
+
+	default:
+		return errors.Errorf("unexpected YAML node in JSON input at line %v", node.Line)
+	}
+	return nil
+}
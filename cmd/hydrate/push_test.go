@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"gopkg.in/yaml.v3"
+)
+
+// fakePutSSM stores the parameters of PutParameter calls, recording the
+// calls as "<action> <name> <tags>".
+type fakePutSSM struct {
+	mu     sync.Mutex
+	params map[string]string
+	calls  []string
+}
+
+func (f *fakePutSSM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name, ResourceId, Value string
+		Overwrite               bool
+		Tags                    []struct{ Key, Value string }
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSSM.")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tags []string
+	for _, tag := range input.Tags {
+		tags = append(tags, tag.Key+"="+tag.Value)
+	}
+	f.calls = append(f.calls, strings.TrimSpace(action+" "+input.Name+input.ResourceId+" "+strings.Join(tags, ",")))
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if _, ok := f.params[input.Name]; ok && action == "PutParameter" && !input.Overwrite {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "ParameterAlreadyExists", "message": "exists"})
+		return
+	}
+	if action == "PutParameter" {
+		f.params[input.Name] = input.Value
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"Version": 1})
+}
+
+func newFakePutSSM(t *testing.T, params map[string]string) (*fakePutSSM, *ssm.Client) {
+	f := &fakePutSSM{params: params}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, ssm.NewFromConfig(aws.Config{
+		BaseEndpoint: aws.String(srv.URL),
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+	})
+}
+
+func TestPusher(t *testing.T) {
+	tt := []struct {
+		name      string
+		input     string
+		existing  map[string]string
+		overwrite bool
+		tags      tagFlags
+		template  string
+		params    map[string]string
+		calls     []string
+		err       string
+	}{
+		{
+			name:     "values",
+			input:    "db:\n  pass: hunter2\n  port: 5432\nhosts:\n  - a\nref: $SECRET:/shared/key\nempty: \"\"\n",
+			template: "db:\n  pass: $SECRET:db/pass\n  port: 5432\nhosts:\n  - $SECRET:hosts/0\nref: $SECRET:/shared/key\nempty: \"\"\n",
+			params:   map[string]string{"/app/db/pass": "hunter2", "/app/hosts/0": "a"},
+			calls:    []string{"PutParameter /app/db/pass", "PutParameter /app/hosts/0"},
+		},
+		{
+			name:     "tags",
+			input:    "user: app\n",
+			tags:     tagFlags{{Key: aws.String("team"), Value: aws.String("payments")}},
+			template: "user: $SECRET:user\n",
+			params:   map[string]string{"/app/user": "app"},
+			calls:    []string{"PutParameter /app/user team=payments"},
+		},
+		{
+			name:      "overwritten and tagged",
+			input:     "user: app\n",
+			existing:  map[string]string{"/app/user": "old"},
+			overwrite: true,
+			tags:      tagFlags{{Key: aws.String("team"), Value: aws.String("payments")}},
+			template:  "user: $SECRET:user\n",
+			params:    map[string]string{"/app/user": "app"},
+			calls:     []string{"PutParameter /app/user", "AddTagsToResource /app/user team=payments"},
+		},
+		{
+			name:     "exists",
+			input:    "user: app\n",
+			existing: map[string]string{"/app/user": "old"},
+			err:      `"/app/user" parameter already exists, use --overwrite`,
+		},
+		{
+			name:  "invalid name",
+			input: "\"db pass\": hunter2\n",
+			err:   `field "db pass" can't be stored as a parameter`,
+		},
+	}
+
+	for _, tc := range tt {
+		params := map[string]string{}
+		for name, value := range tc.existing {
+			params[name] = value
+		}
+		f, svc := newFakePutSSM(t, params)
+		p := &pusher{ctx: context.Background(), ssm: svc, basePath: "/app", overwrite: tc.overwrite, tags: tc.tags}
+
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(tc.input), &node); err != nil {
+			t.Fatal(err)
+		}
+		err := p.node(&node, nil)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.template {
+			t.Errorf("%v: expected template %q, got %q", tc.name, tc.template, b.String())
+		}
+		if !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("%v: expected parameters %v, got %v", tc.name, tc.params, params)
+		}
+		if !reflect.DeepEqual(f.calls, tc.calls) {
+			t.Errorf("%v: expected calls %q, got %q", tc.name, tc.calls, f.calls)
+		}
+		if p.pushed != len(tc.params) {
+			t.Errorf("%v: expected %v pushed, got %v", tc.name, len(tc.params), p.pushed)
+		}
+	}
+}
+
+func TestWriteJSONNode(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{input: `{"b": "x", "a": 1.50, "c": [true, null]}`, expected: "{\n  \"b\": \"x\",\n  \"a\": 1.50,\n  \"c\": [\n    true,\n    null\n  ]\n}"},
+		{input: `{"s": "say \"hi\""}`, expected: "{\n  \"s\": \"say \\\"hi\\\"\"\n}"},
+		{input: `{"empty": {}}`, expected: "{\n  \"empty\": {}\n}"},
+	}
+
+	for _, tc := range tt {
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(tc.input), &node); err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := writeJSONNode(&b, &node, ""); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.input, tc.expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+type refresher interface {
+	FieldReferencesContext(ctx context.Context, r io.Reader, format string, k8s bool) ([]hydrate.Reference, error)
+	Refresh(ctx context.Context, w io.Writer, template, hydrated io.Reader, format string, changed func(parameter string) bool) ([]string, error)
+}
+
+type lockedProvider interface {
+	versionResolver
+	Lock() *hydrate.Lock
+}
+
+// refreshFile re-hydrates the fields of the previously hydrated file whose
+// parameters have a new version since the lock file was written, and then
+// updates both files. Parameters pinned by labels, ie. "/app/db_pass#prod",
+// are always re-fetched, their previous versions aren't locked.
+func refreshFile(ctx context.Context, ps refresher, provider lockedProvider, template, hydrated, format, lockFile string, logger hydrate.Logger) error {
+	if format == "" {
+		format = strings.TrimLeft(filepath.Ext(template), ".")
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	input, err := ioutil.ReadFile(template)
+	if err != nil {
+		return errors.Wrap(err, "hydrate: failed to read template")
+	}
+	output, err := ioutil.ReadFile(hydrated)
+	if err != nil {
+		return errors.Wrap(err, "hydrate: failed to read --refresh file")
+	}
+	ctx = hydrate.WithIncludeDir(ctx, filepath.Dir(template))
+
+	refs, err := ps.FieldReferencesContext(ctx, bytes.NewReader(input), format, false)
+	if err != nil {
+		return errors.Wrap(err, "hydrate")
+	}
+	var params []string
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref.Field != "" && !seen[ref.Parameter] {
+			seen[ref.Parameter] = true
+			params = append(params, ref.Parameter)
+		}
+	}
+	current, err := provider.Versions(ctx, params)
+	if err != nil {
+		return errors.Wrap(err, "hydrate")
+	}
+
+	changed := map[string]bool{}
+	for _, param := range params {
+		if strings.Contains(param, ":") {
+			continue // Pinned to a version, which never changes.
+		}
+		version, ok := current[param]
+		if locked, wasLocked := lock.Parameters[param]; !ok || !wasLocked || version != locked {
+			changed[param] = true
+		}
+	}
+	logger.Log(hydrate.LevelInfo, "refreshing parameters with new versions", "changed", len(changed), "unchanged", len(params)-len(changed))
+
+	var b bytes.Buffer
+	fields, err := ps.Refresh(ctx, &b, bytes.NewReader(input), bytes.NewReader(output), format, func(parameter string) bool {
+		return changed[parameter]
+	})
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		logger.Log(hydrate.LevelDebug, "refreshed field", "field", field)
+	}
+	if len(fields) > 0 {
+		if err := writeInPlace(hydrated, b.Bytes(), ""); err != nil {
+			return errors.Wrap(err, "hydrate: failed to write --refresh file")
+		}
+	}
+
+	// Keep the versions of the unchanged parameters, which weren't fetched.
+	updated := &hydrate.Lock{Parameters: map[string]int64{}}
+	for param, version := range lock.Parameters {
+		if seen[param] {
+			updated.Parameters[param] = version
+		}
+	}
+	for param, version := range provider.Lock().Parameters {
+		updated.Parameters[param] = version
+	}
+	return writeLock(lockFile, updated)
+}
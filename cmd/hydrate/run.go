@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// pipelineAPIVersion is the apiVersion of pipeline specs.
+const pipelineAPIVersion = "hydrate.pressly.com/v1alpha1"
+
+// pipeline is a declarative hydration spec, executed by hydrate run:
+//
+//	apiVersion: hydrate.pressly.com/v1alpha1
+//	kind: Pipeline
+//	providers:
+//	  backend: ssm
+//	  path: /app/prod
+//	transforms:
+//	  k8s: true
+//	  pins:
+//	    database.password: vault:kv/app#db_pw
+//	  vars:
+//	    Env: prod
+//	outputs:
+//	  - sources: [manifests/*.yml]
+//	    outDir: hydrated/
+//	  - sources: [app.toml]
+//	    format: toml
+//	    toK8sSecret: app,prod
+//	    file: hydrated/app-secret.yml
+type pipeline struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+
+	// Providers configures where $SECRET, $$ and other references are
+	// fetched from.
+	Providers struct {
+		Backend     string        `yaml:"backend"` // ssm, secretsmanager, vault
+		Region      string        `yaml:"region"`
+		Profile     string        `yaml:"profile"`
+		EndpointURL string        `yaml:"endpointURL"`
+		Path        string        `yaml:"path"`
+		Throughput  string        `yaml:"throughput"`
+		RateLimit   int           `yaml:"rateLimit"`
+		Concurrency int           `yaml:"concurrency"`
+		CacheDir    string        `yaml:"cacheDir"`
+		CacheTTL    time.Duration `yaml:"cacheTTL"`
+		Timeout     time.Duration `yaml:"timeout"`
+	} `yaml:"providers"`
+
+	// Transforms apply to all outputs.
+	Transforms struct {
+		K8s           bool              `yaml:"k8s"`
+		K8sAll        bool              `yaml:"k8sAll"`
+		Generate      bool              `yaml:"generate"`
+		Missing       string            `yaml:"missing"`  // error, empty, keep
+		Pins          map[string]string `yaml:"pins"`     // Field patterns to references, see --pin.
+		Vars          map[string]string `yaml:"vars"`     // Of parameter paths and templates, see --var.
+		VarFiles      []string          `yaml:"varFiles"` // See --var-file.
+		EncryptFields []string          `yaml:"encryptFields"`
+		EncryptKMSKey string            `yaml:"encryptKMSKey"`
+		EncryptAge    []string          `yaml:"encryptAge"`
+	} `yaml:"transforms"`
+
+	Outputs []pipelineOutput `yaml:"outputs"`
+}
+
+// pipelineOutput hydrates the sources into a file, a directory or in place.
+type pipelineOutput struct {
+	Sources      []string `yaml:"sources"` // Files, directories or globs.
+	Format       string   `yaml:"format"`
+	OutputFormat string   `yaml:"outputFormat"`
+	ToK8sSecret  string   `yaml:"toK8sSecret"` // name[,namespace]
+
+	SecretLabels      map[string]string `yaml:"secretLabels"`
+	SecretAnnotations map[string]string `yaml:"secretAnnotations"`
+
+	File   string `yaml:"file"`   // Of a single source.
+	OutDir string `yaml:"outDir"` // Of any number of sources.
+	Write  bool   `yaml:"write"`  // In place.
+	Backup string `yaml:"backup"` // Suffix of the originals kept by write.
+}
+
+func runPipeline(args []string) {
+	var (
+		flags  = flag.NewFlagSet("hydrate run", flag.ExitOnError)
+		dryRun = flags.Bool("dry-run", false, "print the hydrate commands of the pipeline without running them")
+	)
+	parseFlags(flags, args)
+
+	if flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate run: usage: hydrate run pipeline.yaml"))
+	}
+	filename := flags.Arg(0)
+
+	p, err := readPipeline(filename)
+	if err != nil {
+		log.Fatal(errors.Wrapf(err, "hydrate run: %v", filename))
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate run"))
+	}
+
+	// Paths of the spec are relative to it, just like $INCLUDE: paths.
+	dir := filepath.Dir(filename)
+	for i, out := range p.Outputs {
+		cmdArgs := p.args(out)
+		if *dryRun {
+			fmt.Println(commandLine(append([]string{"hydrate"}, cmdArgs...), out.File))
+			continue
+		}
+		if err := runOutput(bin, dir, cmdArgs, out.File); err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate run: outputs[%v]", i))
+		}
+	}
+}
+
+func readPipeline(filename string) (*pipeline, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p pipeline
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true) // Typos shouldn't silently change what's hydrated.
+	if err := dec.Decode(&p); err != nil {
+		return nil, errors.Wrap(err, "failed to decode pipeline")
+	}
+	if p.Kind != "Pipeline" {
+		return nil, errors.Errorf("expected kind: Pipeline, got %q", p.Kind)
+	}
+	if len(p.Outputs) == 0 {
+		return nil, errors.New("no outputs")
+	}
+
+	for i, out := range p.Outputs {
+		targets := 0
+		for _, set := range []bool{out.File != "", out.OutDir != "", out.Write} {
+			if set {
+				targets++
+			}
+		}
+		switch {
+		case len(out.Sources) == 0:
+			return nil, errors.Errorf("outputs[%v]: no sources", i)
+		case targets != 1:
+			return nil, errors.Errorf("outputs[%v]: expected exactly one of file, outDir or write", i)
+		case out.File != "" && len(out.Sources) > 1:
+			return nil, errors.Errorf("outputs[%v]: file expects a single source, use outDir", i)
+		}
+	}
+	return &p, nil
+}
+
+// args returns the hydrate flags and arguments of the output.
+func (p *pipeline) args(out pipelineOutput) []string {
+	var args []string
+	str := func(name, value string) {
+		if value != "" {
+			args = append(args, "--"+name+"="+value)
+		}
+	}
+	num := func(name string, value int) {
+		if value != 0 {
+			args = append(args, "--"+name+"="+strconv.Itoa(value))
+		}
+	}
+	dur := func(name string, value time.Duration) {
+		if value != 0 {
+			args = append(args, "--"+name+"="+value.String())
+		}
+	}
+	boolean := func(name string, value bool) {
+		if value {
+			args = append(args, "--"+name)
+		}
+	}
+	keyValues := func(name string, values map[string]string) {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			args = append(args, "--"+name+"="+key+"="+values[key])
+		}
+	}
+
+	str("backend", p.Providers.Backend)
+	str("region", p.Providers.Region)
+	str("profile", p.Providers.Profile)
+	str("endpoint-url", p.Providers.EndpointURL)
+	str("path", p.Providers.Path)
+	str("throughput", p.Providers.Throughput)
+	num("rate-limit", p.Providers.RateLimit)
+	num("concurrency", p.Providers.Concurrency)
+	str("cache-dir", p.Providers.CacheDir)
+	dur("cache-ttl", p.Providers.CacheTTL)
+	dur("timeout", p.Providers.Timeout)
+
+	boolean("k8s", p.Transforms.K8s)
+	boolean("k8s-all", p.Transforms.K8sAll)
+	boolean("generate", p.Transforms.Generate)
+	str("missing", p.Transforms.Missing)
+	keyValues("pin", p.Transforms.Pins)
+	str("var-file", strings.Join(p.Transforms.VarFiles, ","))
+	keyValues("var", p.Transforms.Vars)
+	str("encrypt-fields", strings.Join(p.Transforms.EncryptFields, ","))
+	str("encrypt-kms-key", p.Transforms.EncryptKMSKey)
+	str("encrypt-age", strings.Join(p.Transforms.EncryptAge, ","))
+
+	str("format", out.Format)
+	str("output-format", out.OutputFormat)
+	str("to-k8s-secret", out.ToK8sSecret)
+	keyValues("secret-label", out.SecretLabels)
+	keyValues("secret-annotation", out.SecretAnnotations)
+	str("out-dir", out.OutDir)
+	boolean("write", out.Write)
+	str("backup", out.Backup)
+
+	return append(args, out.Sources...)
+}
+
+// runOutput runs hydrate in dir, writing its output into the file, if any,
+// once it succeeded.
+func runOutput(bin, dir string, args []string, file string) error {
+	var stdout bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	if file != "" {
+		cmd.Stdout = &stdout
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "%v", commandLine(append([]string{"hydrate"}, args...), file))
+	}
+	if file == "" {
+		return nil
+	}
+
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, stdout.Bytes(), 0600)
+}
+
+// commandLine returns the shell-quoted command, redirected into the file.
+func commandLine(args []string, file string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if strings.ContainsAny(arg, " \t\n'\"$*?[]{}|&;<>()\\`~#") {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	line := strings.Join(quoted, " ")
+	if file != "" {
+		line += " > " + file
+	}
+	return line
+}
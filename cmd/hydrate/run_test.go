@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPipeline(t *testing.T) {
+	tt := []struct {
+		name     string
+		spec     string
+		expected [][]string
+		err      string
+	}{
+		{
+			name: "outputs",
+			spec: `kind: Pipeline
+providers:
+  path: /app/prod
+  cacheTTL: 5m
+transforms:
+  k8s: true
+outputs:
+  - sources: [manifests/]
+    outDir: hydrated/
+  - sources: [app.toml]
+    toK8sSecret: app,prod
+    secretLabels: {team: web, app: api}
+    file: app-secret.yml
+`,
+			expected: [][]string{
+				{"--path=/app/prod", "--cache-ttl=5m0s", "--k8s", "--out-dir=hydrated/", "manifests/"},
+				{"--path=/app/prod", "--cache-ttl=5m0s", "--k8s", "--to-k8s-secret=app,prod", "--secret-label=app=api", "--secret-label=team=web", "app.toml"},
+			},
+		},
+		{
+			name: "pins",
+			spec: `kind: Pipeline
+transforms:
+  pins:
+    database.password: vault:kv/app#db_pw
+    api.*: ssm:/app/prod/api_key
+outputs:
+  - sources: [config.yml]
+    file: secrets.yml
+`,
+			expected: [][]string{{"--pin=api.*=ssm:/app/prod/api_key", "--pin=database.password=vault:kv/app#db_pw", "config.yml"}},
+		},
+		{
+			name: "vars",
+			spec: `kind: Pipeline
+transforms:
+  varFiles: [vars/common.yml, vars/prod.yml]
+  vars:
+    Env: prod
+outputs:
+  - sources: [config.yml]
+    write: true
+`,
+			expected: [][]string{{"--var-file=vars/common.yml,vars/prod.yml", "--var=Env=prod", "--write", "config.yml"}},
+		},
+		{name: "kind", spec: "kind: Config\noutputs: [{sources: [a.yml], write: true}]\n", err: `expected kind: Pipeline, got "Config"`},
+		{name: "no outputs", spec: "kind: Pipeline\n", err: "no outputs"},
+		{name: "no sources", spec: "kind: Pipeline\noutputs: [{write: true}]\n", err: "outputs[0]: no sources"},
+		{name: "two targets", spec: "kind: Pipeline\noutputs: [{sources: [a.yml], write: true, outDir: out}]\n", err: "expected exactly one of file, outDir or write"},
+		{name: "file of many sources", spec: "kind: Pipeline\noutputs: [{sources: [a.yml, b.yml], file: out.yml}]\n", err: "file expects a single source"},
+		{name: "unknown field", spec: "kind: Pipeline\noutput: []\n", err: "field output not found"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "pipeline.yaml")
+			if err := ioutil.WriteFile(filename, []byte(tc.spec), 0600); err != nil {
+				t.Fatal(err)
+			}
+			p, err := readPipeline(filename)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var args [][]string
+			for _, out := range p.Outputs {
+				args = append(args, p.args(out))
+			}
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, args)
+			}
+		})
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tt := []struct {
+		args     []string
+		file     string
+		expected string
+	}{
+		{args: []string{"hydrate", "--k8s", "a.yml"}, expected: "hydrate --k8s a.yml"},
+		{args: []string{"hydrate", "--path=/app/it's"}, file: "out.yml", expected: `hydrate '--path=/app/it'\''s' > out.yml`},
+	}
+
+	for _, tc := range tt {
+		if line := commandLine(tc.args, tc.file); line != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, line)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// SARIF 2.1.0 report of validate and scan findings, the subset used by
+// GitHub code scanning, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name           string      `json:"name"`
+			InformationURI string      `json:"informationUri"`
+			Rules          []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+const (
+	sarifMissingRule   = "missing-parameter"
+	sarifPlaintextRule = "plaintext-secret"
+)
+
+var sarifRules = []sarifRule{
+	{ID: sarifMissingRule, ShortDescription: sarifMessage{"Referenced parameter doesn't exist in AWS SSM Parameter Store"}},
+	{ID: sarifPlaintextRule, ShortDescription: sarifMessage{"Secret value is stored in plain text instead of referencing a parameter"}},
+}
+
+func newSarifLog() *sarifLog {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "hydrate"
+	run.Tool.Driver.InformationURI = "https://github.com/pressly/hydrate"
+	run.Tool.Driver.Rules = sarifRules
+
+	return &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
+
+// add reports an error of the rule at the file's line, if line > 0.
+func (l *sarifLog) add(ruleID, file string, line int, message string) {
+	var loc sarifLocation
+	loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(file)
+	if line > 0 {
+		loc.PhysicalLocation.Region = &sarifRegion{StartLine: line}
+	}
+	l.Runs[0].Results = append(l.Runs[0].Results, sarifResult{
+		RuleID:    ruleID,
+		Level:     "error",
+		Message:   sarifMessage{message},
+		Locations: []sarifLocation{loc},
+	})
+}
+
+// sarifReport reports the references of missing parameters.
+func sarifReport(missing []fileRef) *sarifLog {
+	l := newSarifLog()
+	for _, ref := range missing {
+		field := ref.Field
+		if field == "" {
+			field = "(template)"
+		}
+		l.add(sarifMissingRule, ref.file, 0, fmt.Sprintf("%v references %q parameter, which doesn't exist", field, ref.Parameter))
+	}
+	return l
+}
+
+// scanReport reports the plaintext secrets.
+func scanReport(secrets []plaintextSecret) *sarifLog {
+	l := newSarifLog()
+	for _, s := range secrets {
+		l.add(sarifPlaintextRule, s.file, s.line, s.String())
+	}
+	return l
+}
+
+func (l *sarifLog) write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pressly/hydrate"
+)
+
+func TestSarifReport(t *testing.T) {
+	type result struct {
+		RuleID    string
+		Level     string
+		Message   struct{ Text string }
+		Locations []struct {
+			PhysicalLocation struct {
+				ArtifactLocation struct{ URI string }
+				Region           *struct{ StartLine int }
+			}
+		}
+	}
+
+	tt := []struct {
+		name     string
+		log      *sarifLog
+		rule     string
+		message  string
+		uri      string
+		line     int
+		expected int
+	}{
+		{name: "no findings", log: sarifReport(nil)},
+		{
+			name:     "missing parameter",
+			log:      sarifReport([]fileRef{{"manifests/app.yml", hydrate.Reference{Field: "db.password", Parameter: "/app/db_pass"}}}),
+			rule:     sarifMissingRule,
+			message:  `db.password references "/app/db_pass" parameter, which doesn't exist`,
+			uri:      "manifests/app.yml",
+			expected: 1,
+		},
+		{
+			name:     "template",
+			log:      sarifReport([]fileRef{{"app.env.tmpl", hydrate.Reference{Parameter: "/app/db_pass"}}}),
+			rule:     sarifMissingRule,
+			message:  `(template) references "/app/db_pass" parameter, which doesn't exist`,
+			uri:      "app.env.tmpl",
+			expected: 1,
+		},
+		{
+			name:     "plaintext secret",
+			log:      scanReport([]plaintextSecret{{file: "app.yml", field: "db.password", line: 3, reason: `"password" field`}}),
+			rule:     sarifPlaintextRule,
+			message:  `db.password looks like a plaintext secret ("password" field), use a $SECRET: reference`,
+			uri:      "app.yml",
+			line:     3,
+			expected: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		b, err := json.Marshal(tc.log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report struct {
+			Version string
+			Runs    []struct {
+				Tool struct {
+					Driver struct{ Rules []struct{ ID string } }
+				}
+				Results []result
+			}
+		}
+		if err := json.Unmarshal(b, &report); err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Version != "2.1.0" || len(report.Runs) != 1 {
+			t.Fatalf("%v: expected a SARIF 2.1.0 run, got %s", tc.name, b)
+		}
+		var rules []string
+		for _, rule := range report.Runs[0].Tool.Driver.Rules {
+			rules = append(rules, rule.ID)
+		}
+		if !reflect.DeepEqual(rules, []string{sarifMissingRule, sarifPlaintextRule}) {
+			t.Errorf("%v: unexpected rules %v", tc.name, rules)
+		}
+
+		results := report.Runs[0].Results
+		if len(results) != tc.expected {
+			t.Fatalf("%v: expected %v results, got %s", tc.name, tc.expected, b)
+		}
+		if tc.expected == 0 {
+			continue
+		}
+		r := results[0]
+		if r.RuleID != tc.rule || r.Level != "error" || r.Message.Text != tc.message {
+			t.Errorf("%v: unexpected result %+v", tc.name, r)
+		}
+		loc := r.Locations[0].PhysicalLocation
+		if loc.ArtifactLocation.URI != tc.uri {
+			t.Errorf("%v: expected uri %q, got %q", tc.name, tc.uri, loc.ArtifactLocation.URI)
+		}
+		switch {
+		case tc.line == 0 && loc.Region != nil:
+			t.Errorf("%v: expected no region, got %+v", tc.name, loc.Region)
+		case tc.line > 0 && (loc.Region == nil || loc.Region.StartLine != tc.line):
+			t.Errorf("%v: expected line %v, got %+v", tc.name, tc.line, loc.Region)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeyRe matches field names of secret values, ie. "db_password",
+// "apiKey" or "GITHUB_TOKEN".
+var secretKeyRe = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|api[_-]?key|private[_-]?key|credential)`)
+
+// secretMetaKeyRe matches field names describing secrets rather than holding
+// them, ie. "secretName", "password_file" or "tokenUrl".
+var secretMetaKeyRe = regexp.MustCompile(`(?i)(name|ref|file|path|url|arn|id)$`)
+
+// tokenRe matches values that could be generated keys and tokens.
+var tokenRe = regexp.MustCompile(`^[A-Za-z0-9+/=_\-]{20,}$`)
+
+// minTokenEntropy is the Shannon entropy per character, in bits, from which
+// unreferenced token-like values are reported. Random base64 values of 20+
+// characters are above it, words and identifiers mostly below.
+const minTokenEntropy = 4.0
+
+// plaintextSecret is a field whose value looks like a secret stored in
+// plain text, instead of a reference to a parameter.
+type plaintextSecret struct {
+	file   string
+	field  string
+	line   int
+	reason string
+}
+
+func (s plaintextSecret) String() string {
+	return fmt.Sprintf("%v looks like a plaintext secret (%v), use a $SECRET: reference", s.field, s.reason)
+}
+
+func scan(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate scan", flag.ExitOnError)
+		format    = flags.String("format", "", "input file format: json, yaml (defaults to file extension)")
+		sarifFile = flags.String("sarif", "", "write the findings as SARIF into the file, ie. for GitHub code scanning")
+	)
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 {
+		log.Fatal(errors.New("hydrate scan: usage: hydrate scan [--sarif=hydrate.sarif] ./manifests"))
+	}
+	filenames, _, err := expandInputs(flags.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var secrets []plaintextSecret
+	for _, filename := range filenames {
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = strings.TrimLeft(filepath.Ext(filename), ".")
+		}
+		if fileFormat != "json" && !isYAMLFormat(fileFormat) {
+			logger.Log(hydrate.LevelWarn, "scan: skipping file, only json and yaml are supported", "file", filename)
+			continue
+		}
+
+		found, err := scanFile(filename)
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate scan: %v", filename))
+		}
+		secrets = append(secrets, found...)
+	}
+
+	for _, s := range secrets {
+		fmt.Printf("%v:%v: %v\n", s.file, s.line, s)
+	}
+	if *sarifFile != "" {
+		if err := writeFile(*sarifFile, scanReport(secrets).write); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate scan: failed to write SARIF report"))
+		}
+	}
+	if len(secrets) > 0 {
+		os.Exit(1)
+	}
+}
+
+func scanFile(filename string) ([]plaintextSecret, error) {
+	if filename == "-" {
+		return scanSecrets(os.Stdin, filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return scanSecrets(f, filename)
+}
+
+// scanSecrets reports the plaintext secrets of the JSON or YAML documents.
+func scanSecrets(r io.Reader, filename string) ([]plaintextSecret, error) {
+	var secrets []plaintextSecret
+	dec := yaml.NewDecoder(r)
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to decode input")
+		}
+		scanNode(&node, "", "", func(field, key string, value *yaml.Node) {
+			if reason := secretReason(key, value.Value); reason != "" {
+				secrets = append(secrets, plaintextSecret{file: filename, field: field, line: value.Line, reason: reason})
+			}
+		})
+	}
+	return secrets, nil
+}
+
+// scanNode passes the string values of the node to fn, along with their
+// field path and the name of the field holding them.
+func scanNode(node *yaml.Node, field, key string, fn func(field, key string, value *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			scanNode(n, field, key, fn)
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			path := name
+			if field != "" {
+				path = field + "." + name
+			}
+			scanNode(node.Content[i+1], path, name, fn)
+		}
+
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			scanNode(n, field+"["+strconv.Itoa(i)+"]", key, fn)
+		}
+
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" {
+			fn(field, key, node)
+		}
+	}
+}
+
+// secretReason returns why the value of the field named key looks like a
+// plaintext secret, or "" if it doesn't.
+func secretReason(key, value string) string {
+	if value == "" || referenceRe.MatchString(value) {
+		return ""
+	}
+	if secretKeyRe.MatchString(key) && !secretMetaKeyRe.MatchString(key) {
+		return fmt.Sprintf("%q field", key)
+	}
+	if tokenRe.MatchString(value) && strings.ContainsAny(value, "0123456789") && entropy(value) >= minTokenEntropy {
+		return "high entropy value"
+	}
+	return ""
+}
+
+// entropy returns the Shannon entropy of the string, in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	var bits float64
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
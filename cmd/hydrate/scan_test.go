@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanSecrets(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected []plaintextSecret
+	}{
+		{
+			name:  "secret fields",
+			input: "db:\n  host: db.local\n  password: hunter2\napi:\n  apiKey: abc\n  tokens:\n    - t0k3n\n",
+			expected: []plaintextSecret{
+				{file: "f.yml", field: "db.password", line: 3, reason: `"password" field`},
+				{file: "f.yml", field: "api.apiKey", line: 5, reason: `"apiKey" field`},
+				{file: "f.yml", field: "api.tokens[0]", line: 7, reason: `"tokens" field`},
+			},
+		},
+		{
+			name:  "references",
+			input: "password: $SECRET:/app/db_pass\nsecret: $$\ntoken: ${SECRET:t}\napi_key: $GENERATE:hex(32)\nsmtp_password: \"\"\n",
+		},
+		{
+			name:  "describing secrets",
+			input: "secretName: app-tls\npassword_file: /run/secrets/db\ntokenUrl: https://auth.local/token\n",
+		},
+		{
+			name:     "high entropy",
+			input:    `{"webhook": "Zm9vYmFyCg4xQ9vLp2KrT7sWmN3e", "image": "nginx-ingress-controller-v1", "sha": "951ebbd70f3cd71018c1fe9636f291a59ed2fff4"}`,
+			expected: []plaintextSecret{{file: "f.yml", field: "webhook", line: 1, reason: "high entropy value"}},
+		},
+		{
+			name:  "non-strings",
+			input: "password: 1234\ntoken: true\n",
+		},
+		{
+			name:     "multiple documents",
+			input:    "kind: Secret\n---\nkind: Secret\nstringData:\n  secret: s3cr3t\n",
+			expected: []plaintextSecret{{file: "f.yml", field: "stringData.secret", line: 5, reason: `"secret" field`}},
+		},
+	}
+
+	for _, tc := range tt {
+		secrets, err := scanSecrets(strings.NewReader(tc.input), "f.yml")
+		if err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(secrets, tc.expected) {
+			t.Errorf("%v: expected %v, got %v", tc.name, tc.expected, secrets)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// maxServeBody is the max size of documents accepted by hydrate serve.
+const maxServeBody = 10 << 20
+
+func serve(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate serve", flag.ExitOnError)
+		listen    = flags.String("listen", "127.0.0.1:8080", "address to listen on, ie. :8080 for all interfaces")
+		region    = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath  = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		role      = flags.String("role", "", "assume the IAM role to fetch secrets with, ie. arn:aws:iam::123456789012:role/hydrate")
+		cacheTTL  = flags.Duration("cache-ttl", 5*time.Minute, "serve fetched secrets from memory for the duration, ie. 30s (0 = fetch on every request)")
+		timeout   = flags.Duration("timeout", 30*time.Second, "cancel requests, including in-flight AWS calls, after the duration")
+		rate      = flags.Int("rate-limit", 0, "max AWS API calls per second shared by all requests (0 = no limit)")
+		inFlight  = flags.Int("max-in-flight", 64, "shed requests beyond the number of concurrent hydrations with 503 (0 = no limit)")
+		backoff   = flags.Duration("throttle-backoff", 5*time.Second, "shed requests with 503 for the duration once AWS throttled a hydration, instead of adding to the throttling (0 = never)")
+		tlsCert   = flags.String("tls-cert", "", "serve HTTPS with the PEM certificate file, requires --tls-key")
+		tlsKey    = flags.String("tls-key", "", "PEM private key file of --tls-cert")
+		clientCA  = flags.String("client-ca", "", "require client certificates signed by the PEM CA file (mTLS), requires --tls-cert")
+		tokenFile = flags.String("token-file", "", "require requests to send the file's token as \"Authorization: Bearer <token>\"")
+	)
+	notify := notifyFlags(flags)
+	awsFlags(flags)
+	parseFlags(flags, args)
+	notify.check()
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal(errors.New("hydrate serve: --tls-cert and --tls-key must be set together"))
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		log.Fatal(errors.New("hydrate serve: --client-ca requires --tls-cert and --tls-key"))
+	}
+
+	requireRole("hydrate serve", "--role", *role)
+	cfg := newConfig(*region)
+	if *role != "" {
+		cfg = assumeRole(cfg, *role)
+	}
+	s := &server{cfg: cfg, basePath: *basePath, limiter: hydrate.NewRateLimiter(*rate), ttl: *cacheTTL, timeout: *timeout, maxInFlight: *inFlight, throttleBackoff: *backoff, notify: notify}
+	if *tokenFile != "" {
+		token, err := readToken(*tokenFile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate serve"))
+		}
+		s.token = token
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hydrate", s.authorize(s.hydrate))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	srv := s.httpServer(*listen, mux)
+
+	if *clientCA != "" {
+		tlsConfig, err := clientCAConfig(*clientCA)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate serve"))
+		}
+		srv.TLSConfig = tlsConfig
+	}
+	if s.token == "" && srv.TLSConfig == nil && !isLoopback(*listen) {
+		logger.Log(hydrate.LevelWarn, "serving secrets without authentication, set --token-file or --client-ca", "listen", *listen)
+	}
+
+	logger.Log(hydrate.LevelInfo, "serving", "listen", *listen, "tls", *tlsCert != "")
+	if *tlsCert != "" {
+		log.Fatal(srv.ListenAndServeTLS(*tlsCert, *tlsKey))
+	}
+	log.Fatal(srv.ListenAndServe())
+}
+
+// server hydrates documents of requests with a secret store that's shared
+// between requests until its secrets are older than the ttl.
+type server struct {
+	cfg      aws.Config
+	basePath string
+	limiter  *hydrate.RateLimiter // Shared by the secret stores.
+	ttl      time.Duration
+	timeout  time.Duration
+	token    string // Bearer token of requests, if set.
+
+	// Requests are shed beyond maxInFlight hydrations, and for the
+	// throttleBackoff once AWS throttled one, see admit.
+	maxInFlight     int
+	throttleBackoff time.Duration
+	failOpen        bool // Admit objects unhydrated, see mutate.
+	notify          *notifier
+
+	mu        sync.Mutex
+	store     hydrator
+	created   time.Time
+	inFlight  int
+	shedUntil time.Time
+}
+
+// httpServer returns the HTTP server of the handler, whose connections
+// can't outlast the --timeout of requests by much, ie. of slow clients.
+func (s *server) httpServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       s.timeout + 10*time.Second,
+		WriteTimeout:      s.timeout + 10*time.Second,
+	}
+}
+
+// authorize responds with 401 to requests without the bearer token, if the
+// server has one.
+func (s *server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// readToken returns the token of the file, without surrounding whitespace.
+func readToken(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read --token-file")
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.Errorf("--token-file %v is empty", filename)
+	}
+	return token, nil
+}
+
+// clientCAConfig returns the TLS config requiring client certificates
+// signed by the CAs of the PEM file.
+func clientCAConfig(filename string) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read --client-ca")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("--client-ca %v has no PEM certificates", filename)
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}, nil
+}
+
+// isLoopback reports whether the listen address only accepts connections
+// of the local host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// paramStore returns the shared secret store, or a fresh one once the
+// secrets of the current one expired, so that they're fetched again.
+func (s *server) paramStore() hydrator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.store == nil || time.Since(s.created) >= s.ttl {
+		// Only setting a cache dir fails, which servers keep in memory.
+		paramStore, _ := hydrate.NewHydrator(hydrate.SSMProvider(ssm.NewFromConfig(s.cfg)), hydrate.Options{
+			BasePath:    s.basePath,
+			Backends:    backends(s.cfg),
+			Logger:      logger,
+			RateLimiter: s.limiter,
+		})
+		s.store, s.created = paramStore, time.Now()
+	}
+	return s.store
+}
+
+// hydrate handles POST /hydrate?format=yaml&output-format=json&k8s=true
+// requests, responding with the hydrated document. The format defaults to
+// the Content-Type of the request, or yaml.
+func (s *server) hydrate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "expected POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = contentFormat(r.Header.Get("Content-Type"))
+	}
+	outputFormat := query.Get("output-format")
+	switch format {
+	case "json", "yml", "yaml", "toml", "env":
+	default:
+		http.Error(w, fmt.Sprintf("unsupported format %q, expected json, yaml, toml or env", format), http.StatusBadRequest)
+		return
+	}
+
+	release, err := s.admit()
+	if err != nil {
+		s.notifyFailed(err)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	ctx, cancel := s.requestTimeout(r)
+	defer cancel()
+	// Documents of requests mustn't read files of the server.
+	ctx = hydrate.WithoutIncludes(ctx)
+
+	var b bytes.Buffer
+	body := http.MaxBytesReader(w, r.Body, maxServeBody)
+	if err := s.hydrateWithin(ctx, func(ctx context.Context) error {
+		return s.paramStore().HydrateFormatContext(ctx, &b, body, format, outputFormat, query.Get("k8s") == "true")
+	}); err != nil {
+		logger.Log(hydrate.LevelError, "failed to hydrate request", "method", r.Method, "url", r.URL, "error", err)
+		s.notifyFailed(err)
+		status := http.StatusUnprocessableEntity
+		if isUnavailable(err) {
+			w.Header().Set("Retry-After", "1")
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if outputFormat == "" {
+		outputFormat = format
+	}
+	if contentType, ok := formatContentTypes[outputFormat]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	io.Copy(w, &b)
+}
+
+var formatContentTypes = map[string]string{
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+	"yml":    "application/yaml",
+	"yaml":   "application/yaml",
+	"toml":   "application/toml",
+	"env":    "text/plain",
+}
+
+// contentFormat returns the format of the Content-Type, or yaml.
+func contentFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return "json"
+	case "application/toml":
+		return "toml"
+	default:
+		return "yaml"
+	}
+}
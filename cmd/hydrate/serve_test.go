@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeHydrate(t *testing.T) {
+	tt := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		token       string // Of the server.
+		auth        string // Of the request.
+		body        string
+		status      int
+		expected    string
+		responseCT  string
+	}{
+		{name: "yaml", method: "POST", url: "/hydrate", body: "pass: $$\n", status: 200, expected: "PASS: $$\n", responseCT: "application/yaml"},
+		{name: "content type", method: "POST", url: "/hydrate", contentType: "application/json", body: `{"pass": "$$"}`, status: 200, expected: `{"PASS": "$$"}`, responseCT: "application/json"},
+		{name: "output format", method: "POST", url: "/hydrate?format=toml&output-format=env", body: "pass = \"$$\"\n", status: 200, responseCT: "text/plain", expected: "PASS = \"$$\"\n"},
+		{name: "method", method: "GET", url: "/hydrate", status: 405},
+		{name: "format", method: "POST", url: "/hydrate?format=xml", status: 400},
+		{name: "failure", method: "POST", url: "/hydrate", body: "fail: $$\n", status: 422},
+		{name: "token", method: "POST", url: "/hydrate", token: "s3cret", auth: "Bearer s3cret", body: "pass: $$\n", status: 200, expected: "PASS: $$\n", responseCT: "application/yaml"},
+		{name: "wrong token", method: "POST", url: "/hydrate", token: "s3cret", auth: "Bearer other", body: "pass: $$\n", status: 401},
+		{name: "no token", method: "POST", url: "/hydrate", token: "s3cret", body: "pass: $$\n", status: 401},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{token: tc.token, ttl: time.Hour, timeout: time.Second, store: &fakeHydrator{}, created: time.Now()}
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			w := httptest.NewRecorder()
+			s.authorize(s.hydrate)(w, req)
+
+			if w.Code != tc.status {
+				t.Fatalf("expected status %v, got %v: %v", tc.status, w.Code, w.Body)
+			}
+			if tc.status != 200 {
+				return
+			}
+			if w.Body.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tc.responseCT {
+				t.Errorf("expected Content-Type %v, got %v", tc.responseCT, ct)
+			}
+		})
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tt := []struct {
+		addr     string
+		expected bool
+	}{
+		{addr: "127.0.0.1:8080", expected: true},
+		{addr: "localhost:8080", expected: true},
+		{addr: "[::1]:8080", expected: true},
+		{addr: ":8080", expected: false},
+		{addr: "0.0.0.0:8080", expected: false},
+		{addr: "10.0.0.1:8080", expected: false},
+	}
+
+	for _, tc := range tt {
+		if loopback := isLoopback(tc.addr); loopback != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.addr, tc.expected, loopback)
+		}
+	}
+}
+
+func TestReadToken(t *testing.T) {
+	dir := t.TempDir()
+	tt := []struct {
+		data     string
+		expected string
+		err      string
+	}{
+		{data: "s3cret\n", expected: "s3cret"},
+		{data: " \n", err: "is empty"},
+	}
+
+	for i, tc := range tt {
+		filename := filepath.Join(dir, fmt.Sprintf("token%v", i))
+		if err := ioutil.WriteFile(filename, []byte(tc.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		token, err := readToken(filename)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.data, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || token != tc.expected {
+			t.Errorf("%q: expected %q, got %q (%v)", tc.data, tc.expected, token, err)
+		}
+	}
+}
+
+func TestClientCA(t *testing.T) {
+	dir := t.TempDir()
+	caFile, ca := writeCert(t, dir, "ca", nil)
+	_, client := writeCert(t, dir, "client", ca)
+	_, other := writeCert(t, dir, "other", nil)
+
+	cfg, err := clientCAConfig(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	tt := []struct {
+		name string
+		cert *tls.Certificate
+		ok   bool
+	}{
+		{name: "signed by the CA", cert: client, ok: true},
+		{name: "signed by another CA", cert: other},
+		{name: "no certificate"},
+	}
+
+	for _, tc := range tt {
+		tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+		if tc.cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*tc.cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if tc.ok != (err == nil) {
+			t.Errorf("%v: expected ok %v, got %v", tc.name, tc.ok, err)
+		}
+	}
+
+	if _, err := clientCAConfig(filepath.Join(dir, "ca.key")); err == nil {
+		t.Error("expected an error of a file without certificates")
+	}
+}
+
+// writeCert writes a PEM certificate, signed by the parent or self-signed
+// CA, and its key into the dir.
+func writeCert(t *testing.T, dir, name string, parent *tls.Certificate) (string, *tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, &cert
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sopsType maps hydrate formats to SOPS input/output types.
+func sopsType(format string) (string, error) {
+	switch format {
+	case "yml", "yaml":
+		return "yaml", nil
+	case "json":
+		return "json", nil
+	default:
+		return "", errors.Errorf("SOPS doesn't support %q format", format)
+	}
+}
+
+// sopsDecrypt decrypts a SOPS/helm-secrets encrypted values file
+// using the sops binary, which must be installed in $PATH.
+func sopsDecrypt(input []byte, format string) ([]byte, error) {
+	typ, err := sopsType(format)
+	if err != nil {
+		return nil, err
+	}
+	return runSOPS(input, "--decrypt", "--input-type", typ, "--output-type", typ, "/dev/stdin")
+}
+
+// sopsEncrypt re-encrypts hydrated data. The SOPS creation rules (keys)
+// are looked up in .sops.yaml as if the data was stored in filename.
+func sopsEncrypt(input []byte, format, filename string) ([]byte, error) {
+	typ, err := sopsType(format)
+	if err != nil {
+		return nil, err
+	}
+	return runSOPS(input, "--encrypt", "--input-type", typ, "--output-type", typ, "--filename-override", filename, "/dev/stdin")
+}
+
+func runSOPS(input []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sops", args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "sops %v: %v", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// hydrateSOPS decrypts the SOPS encrypted input file, hydrates the remaining
+// secret references and writes the result to STDOUT, either as plaintext
+// or re-encrypted by SOPS.
+func hydrateSOPS(ctx context.Context, h hydrator, filename, format, outputFormat, emit string, k8s bool) error {
+	if emit != "plaintext" && emit != "encrypted" {
+		return errors.Errorf("hydrate: unknown --sops=%q, expected plaintext or encrypted", emit)
+	}
+
+	r := openInput(filename, &format)
+	input, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return errors.Wrap(err, "hydrate: failed to read input")
+	}
+
+	plaintext, err := sopsDecrypt(input, format)
+	if err != nil {
+		return errors.Wrap(err, "hydrate: failed to decrypt SOPS file")
+	}
+
+	var b bytes.Buffer
+	if err := h.HydrateFormatContext(ctx, &b, bytes.NewReader(plaintext), format, outputFormat, k8s); err != nil {
+		return err
+	}
+
+	out := b.Bytes()
+	if emit == "encrypted" {
+		if outputFormat == "" {
+			outputFormat = format
+		}
+		if filename == "-" {
+			filename = "stdin." + outputFormat
+		}
+		if out, err = sopsEncrypt(out, outputFormat, filename); err != nil {
+			return errors.Wrap(err, "hydrate: failed to re-encrypt SOPS file")
+		}
+	}
+
+	return writeStdout(out)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSOPS installs a sops script in $PATH, which "decrypts" ENC[value]
+// into value, "encrypts" each value as ENC[value] and fails on "fail".
+func fakeSOPS(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+input=$(cat)
+case "$input" in *fail*) echo "sops: boom" >&2; exit 1;; esac
+case "$1" in
+--decrypt) printf '%s\n' "$input" | sed 's/ENC\[\([^]]*\)\]/\1/g';;
+--encrypt) printf '# %s\n' "$*"; printf '%s\n' "$input" | sed 's/: \(.*\)$/: ENC[\1]/';;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "sops"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+// upperHydrator upper-cases the values of its inputs.
+type upperHydrator struct{}
+
+func (upperHydrator) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, strings.ToUpper(string(data)))
+	return err
+}
+
+func TestHydrateSOPS(t *testing.T) {
+	fakeSOPS(t)
+
+	tt := []struct {
+		input    string
+		filename string
+		emit     string
+		expected string
+		err      string
+	}{
+		{
+			input:    "db_pass: ENC[secret]\n",
+			filename: "values.yaml",
+			emit:     "plaintext",
+			expected: "DB_PASS: SECRET\n",
+		},
+		{
+			input:    "db_pass: ENC[secret]\n",
+			filename: "values.yaml",
+			emit:     "encrypted",
+			expected: "# --encrypt --input-type yaml --output-type yaml --filename-override values.yaml /dev/stdin\nDB_PASS: ENC[SECRET]\n",
+		},
+		{
+			input:    `{"a": "ENC[b]"}`,
+			filename: "values.json",
+			emit:     "plaintext",
+			expected: `{"A": "B"}` + "\n",
+		},
+		{input: "a = 1\n", filename: "values.toml", emit: "plaintext", err: `SOPS doesn't support "toml" format`},
+		{input: "fail: yes\n", filename: "values.yaml", emit: "plaintext", err: "failed to decrypt SOPS file: sops --decrypt: sops: boom: exit status 1"},
+		{input: "a: b\n", filename: "values.yaml", emit: "yes", err: `unknown --sops="yes"`},
+	}
+
+	for _, tc := range tt {
+		filename := filepath.Join(t.TempDir(), tc.filename)
+		if err := ioutil.WriteFile(filename, []byte(tc.input), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var err error
+		out := captureStdout(t, func() {
+			err = hydrateSOPS(context.Background(), upperHydrator{}, filename, "", "", tc.emit, false)
+		})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.filename, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = strings.Replace(out, filename, tc.filename, -1)
+		if out != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.filename, tc.expected, out)
+		}
+	}
+}
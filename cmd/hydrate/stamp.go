@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+func stamp(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate stamp", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters, ie. /app/{{.Tenant}}")
+		format   = flags.String("format", "", "input file format: json, yaml, toml (defaults to file extension)")
+		output   = flags.String("output-format", "", "output format (defaults to input format)")
+		k8s      = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+		tenants  = flags.String("tenants", "", "YAML file mapping tenant names to their variables")
+		outDir   = flags.String("out-dir", ".", "write hydrated files into <out-dir>/<tenant>/")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *tenants == "" {
+		log.Fatal(errors.New("hydrate stamp: --tenants=[tenants.yaml] must be provided"))
+	}
+	if flags.NArg() != 1 {
+		log.Fatal(errors.New("hydrate stamp: exactly one template file must be provided"))
+	}
+	filename := flags.Arg(0)
+
+	b, err := ioutil.ReadFile(*tenants)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate stamp: failed to read tenants file"))
+	}
+	var vars map[string]map[string]interface{}
+	if err := yaml.Unmarshal(b, &vars); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate stamp: failed to decode tenants file"))
+	}
+
+	r := openInput(filename, format)
+	input, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate stamp: failed to read template"))
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// One paramStore for all tenants to share the secrets cache.
+	paramStore := hydrate.ParamStore(newSSM(*region), *basePath)
+	paramStore.SetLogger(logger)
+
+	if filename == "-" {
+		filename = "stdin." + *format
+	}
+	for _, name := range names {
+		tenantVars := vars[name]
+		if tenantVars == nil {
+			tenantVars = map[string]interface{}{}
+		}
+		tenantVars["Tenant"] = name
+		paramStore.SetVars(tenantVars)
+
+		var b bytes.Buffer
+		if err := paramStore.HydrateFormat(&b, bytes.NewReader(input), *format, *output, *k8s); err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate stamp: tenant %q", name))
+		}
+
+		out := filepath.Join(*outDir, name, filepath.Base(filename))
+		if *output != "" {
+			out = out[:len(out)-len(filepath.Ext(out))] + "." + *output
+		}
+		if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate stamp"))
+		}
+		if err := ioutil.WriteFile(out, b.Bytes(), 0600); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate stamp"))
+		}
+		logger.Log(hydrate.LevelInfo, "wrote tenant", "tenant", name, "file", out)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// runState is the progress of a batch run persisted by --state, so that an
+// interrupted run resumes with the files that weren't hydrated yet instead
+// of fetching everything again.
+type runState struct {
+	filename string
+
+	mu    sync.Mutex
+	Files map[string]fileState `json:"files"` // By input file.
+}
+
+// fileState records the hashes of a hydrated file's input and output, so
+// that files changed since are hydrated again.
+type fileState struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+func readRunState(filename string) (*runState, error) {
+	state := &runState{filename: filename, Files: map[string]fileState{}}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read state")
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode state %v", filename)
+	}
+	if state.Files == nil {
+		state.Files = map[string]fileState{}
+	}
+	return state, nil
+}
+
+// done reports whether the file was hydrated into out by a previous run,
+// and neither changed since. Files hydrated in place only have an output.
+func (s *runState) done(filename, out string, inPlace bool) bool {
+	s.mu.Lock()
+	prev, ok := s.Files[filename]
+	s.mu.Unlock()
+	if !ok || fileHash(out) != prev.Output {
+		return false
+	}
+	return inPlace || fileHash(filename) == prev.Input
+}
+
+// record persists the hydration of the file, with the input's hash from
+// before it was hydrated.
+func (s *runState) record(filename, inputHash, out string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Files[filename] = fileState{Input: inputHash, Output: fileHash(out)}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a temp file first, so that an interrupted run never leaves
+	// a corrupt state behind.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.filename), "."+filepath.Base(s.filename)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+// remove deletes the state once all files were hydrated, so that the next
+// run starts over.
+func (s *runState) remove() error {
+	if err := os.Remove(s.filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// fileHash returns the hex-encoded SHA-256 of the file, or "" if it can't
+// be read.
+func fileHash(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return hashBytes(data)
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
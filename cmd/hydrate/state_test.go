@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunState(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	in, out := write("app.yml", "pass: $$\n"), write("out.yml", "pass: hunter2\n")
+
+	stateFile := filepath.Join(dir, "run.json")
+	state, err := readRunState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.record(in, fileHash(in), out); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name     string
+		change   func()
+		inPlace  bool
+		expected bool
+	}{
+		{name: "unchanged", change: func() {}, expected: true},
+		{name: "input changed", change: func() { write("app.yml", "user: $$\n") }, expected: false},
+		{name: "input changed in place", change: func() {}, inPlace: true, expected: true},
+		{name: "output changed", change: func() { write("out.yml", "pass: x\n") }, expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.change()
+			state, err := readRunState(stateFile) // As resumed by the next run.
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done := state.done(in, out, tc.inPlace); done != tc.expected {
+				t.Errorf("expected done %v, got %v", tc.expected, done)
+			}
+		})
+	}
+
+	if err := state.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expected state to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// Parameter Store throughput tuning. The API quota is shared by all clients
+// of the account and region: 40 requests per second by default, or 10,000
+// with higher throughput enabled. Batches are up to 10 parameters either way.
+const (
+	standardRateLimit     = 40
+	highThroughputWorkers = 32
+)
+
+type throughputDetector interface {
+	HighThroughput(ctx context.Context) (bool, error)
+}
+
+// highThroughput resolves --throughput=auto|standard|high, detecting the
+// account's setting in auto mode.
+func highThroughput(ctx context.Context, p throughputDetector, throughput string) (bool, error) {
+	switch throughput {
+	case "standard":
+		return false, nil
+	case "high":
+		return true, nil
+	case "auto":
+		high, err := p.HighThroughput(ctx)
+		if err != nil {
+			logger.Log(hydrate.LevelWarn, "assuming standard throughput, set --throughput to skip detection", "error", err)
+			return false, nil
+		}
+		return high, nil
+	default:
+		return false, errors.Errorf("hydrate: unknown --throughput=%v, expected auto, standard or high", throughput)
+	}
+}
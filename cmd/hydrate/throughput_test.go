@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeDetector struct {
+	high bool
+	err  error
+}
+
+func (d fakeDetector) HighThroughput(ctx context.Context) (bool, error) {
+	return d.high, d.err
+}
+
+func TestHighThroughput(t *testing.T) {
+	tt := []struct {
+		throughput string
+		detector   fakeDetector
+		expected   bool
+		err        string
+	}{
+		{throughput: "standard", detector: fakeDetector{high: true}},
+		{throughput: "high", expected: true},
+		{throughput: "auto", detector: fakeDetector{high: true}, expected: true},
+		{throughput: "auto"},
+		{throughput: "auto", detector: fakeDetector{high: true, err: errors.New("denied")}},
+		{throughput: "max", err: "unknown --throughput=max"},
+	}
+
+	for _, tc := range tt {
+		high, err := highThroughput(context.Background(), tc.detector, tc.throughput)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.throughput, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if high != tc.expected {
+			t.Errorf("%v %+v: expected %v, got %v", tc.throughput, tc.detector, tc.expected, high)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+func validate(args []string) {
+	var (
+		flags     = flag.NewFlagSet("hydrate validate", flag.ExitOnError)
+		region    = flags.String("region", "", "AWS region (defaults to $AWS_DEFAULT_REGION)")
+		basePath  = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		format    = flags.String("format", "", "input file format: json, yaml, toml, env (defaults to file extension)")
+		k8s       = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+		roRole    = flags.String("read-only-role", "", "assume the IAM role for the existence checks, ie. a CI role without ssm:GetParameter")
+		sarifFile = flags.String("sarif", "", "write the missing parameters as SARIF into the file, ie. for GitHub code scanning")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 {
+		log.Fatal(errors.New("hydrate validate: usage: hydrate validate --path=/app/prod [--sarif=hydrate.sarif] ./manifests"))
+	}
+	filenames, _, err := expandInputs(flags.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := newConfig(*region)
+	ssmProvider := hydrate.SSMProvider(ssm.NewFromConfig(cfg))
+	paramStore := hydrate.New(ssmProvider, *basePath)
+	setBackends(paramStore, cfg)
+	paramStore.SetLogger(logger)
+
+	checker := ssmProvider
+	if *roRole != "" {
+		checker = hydrate.SSMProvider(ssm.NewFromConfig(assumeRole(cfg, *roRole)))
+		checker.SetLogger(logger)
+	}
+	missing, err := dryRun(context.Background(), paramStore, checker, nil, filenames, *format, *k8s)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate validate"))
+	}
+	if *sarifFile != "" {
+		if err := writeFile(*sarifFile, sarifReport(missing).write); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate validate: failed to write SARIF report"))
+		}
+	}
+	if len(missing) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// readVars returns the variables of the comma-separated YAML or JSON
+// --var-file files, overridden by later files and then by the --var flags.
+func readVars(files string, vars map[string]string) (map[string]interface{}, error) {
+	if files == "" && len(vars) == 0 {
+		return nil, nil
+	}
+
+	data := map[string]interface{}{}
+	if files != "" {
+		for _, filename := range strings.Split(files, ",") {
+			b, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read var file")
+			}
+			var fileVars map[string]interface{}
+			if err := yaml.Unmarshal(b, &fileVars); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode var file %v, expected a YAML or JSON object", filename)
+			}
+			for key, value := range fileVars {
+				data[key] = value
+			}
+		}
+	}
+	for key, value := range vars {
+		data[key] = value
+	}
+	return data, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadVars(t *testing.T) {
+	tt := []struct {
+		name     string
+		files    map[string]string // Written in order of the --var-file flag.
+		vars     map[string]string
+		expected map[string]interface{}
+		err      string
+	}{
+		{name: "none"},
+		{
+			name:     "vars",
+			vars:     map[string]string{"Env": "prod"},
+			expected: map[string]interface{}{"Env": "prod"},
+		},
+		{
+			name:     "yaml file",
+			files:    map[string]string{"a.yml": "Env: sit\nRegion: us-east-1\n"},
+			expected: map[string]interface{}{"Env": "sit", "Region": "us-east-1"},
+		},
+		{
+			name:     "json file overridden by var",
+			files:    map[string]string{"a.json": `{"Env": "sit", "Replicas": 3}`},
+			vars:     map[string]string{"Env": "prod"},
+			expected: map[string]interface{}{"Env": "prod", "Replicas": 3},
+		},
+		{name: "not an object", files: map[string]string{"a.yml": "- sit\n- prod\n"}, err: "expected a YAML or JSON object"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var filenames []string
+			dir := t.TempDir()
+			for name, data := range tc.files {
+				filename := filepath.Join(dir, name)
+				if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+					t.Fatal(err)
+				}
+				filenames = append(filenames, filename)
+			}
+			data, err := readVars(strings.Join(filenames, ","), tc.vars)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestReadVarsOverriddenByLaterFiles(t *testing.T) {
+	dir := t.TempDir()
+	common, prod := filepath.Join(dir, "common.yml"), filepath.Join(dir, "prod.yml")
+	if err := ioutil.WriteFile(common, []byte("Env: sit\nRegion: us-east-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(prod, []byte("Env: prod\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readVars(common+","+prod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"Env": "prod", "Region": "us-east-1"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestReadVarsMissingFile(t *testing.T) {
+	if _, err := readVars(filepath.Join(t.TempDir(), "missing.yml"), nil); err == nil || !strings.Contains(err.Error(), "failed to read var file") {
+		t.Errorf("expected a read error, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+	"gopkg.in/yaml.v3"
+)
+
+func verify(args []string) {
+	var (
+		flags       = flag.NewFlagSet("hydrate verify", flag.ExitOnError)
+		region      = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath    = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		filename    = flags.String("f", "", "Secret manifest template to hydrate, ie. secret.yaml")
+		against     = flags.String("against", "", "hydrated Secrets to verify: live (the cluster's, via kubectl) or a manifest file, ie. hydrated/secret.yaml")
+		namespace   = flags.String("namespace", "", "namespace of Secrets without one (defaults to kubectl's)")
+		kubeContext = flags.String("context", "", "with --against=live, kubectl context to verify against (defaults to the current one)")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *filename == "" || *against == "" {
+		log.Fatal(errors.New("hydrate verify: usage: hydrate verify -f secret.yaml --against=live|hydrated.yaml"))
+	}
+
+	// Read the artifact first, so that a missing file fails before fetching.
+	var artifact map[string]*k8sSecret
+	if *against != "live" {
+		var err error
+		if artifact, err = readSecrets(*against, *namespace); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate verify"))
+		}
+	}
+
+	format := "yaml" // Also reads JSON manifests.
+	r := openInput(*filename, &format)
+	defer r.Close()
+
+	var b bytes.Buffer
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	paramStore.SetLogger(logger)
+	setBackends(paramStore, cfg)
+	if err := paramStore.Hydrate(&b, r, format, true); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate verify"))
+	}
+	desired, err := decodeSecrets(&b, *namespace)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate verify"))
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stale := 0
+	for _, name := range names {
+		secret := desired[name]
+		var existing *k8sSecret
+		if *against == "live" {
+			if existing, err = liveSecret(secret.Metadata.Name, secret.Metadata.Namespace, *kubeContext); err != nil {
+				log.Fatal(errors.Wrapf(err, "hydrate verify: %v", name))
+			}
+		} else {
+			existing = artifact[name]
+		}
+
+		n, err := verifySecret(os.Stdout, name, secret, existing)
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "hydrate verify: %v", name))
+		}
+		stale += n
+	}
+	if stale > 0 {
+		logger.Log(hydrate.LevelError, "hydrated Secrets are stale", "keys", stale)
+		os.Exit(1)
+	}
+}
+
+// verifySecret writes the keys of the hydrated Secret whose values differ
+// from the existing Secret's, or that it lacks, without revealing any
+// values. Keys only the existing Secret has are ignored. It returns the
+// number of stale keys.
+func verifySecret(w io.Writer, name string, secret, existing *k8sSecret) (int, error) {
+	if existing == nil {
+		fmt.Fprintf(w, "%v: doesn't exist\n", name)
+		return 1, nil
+	}
+	desired, err := secret.values()
+	if err != nil {
+		return 0, err
+	}
+	current, err := existing.values()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	stale := 0
+	for _, key := range keys {
+		value, ok := current[key]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "missing  %v: %v\n", name, key)
+		case value != desired[key]:
+			fmt.Fprintf(w, "stale    %v: %v\n", name, key)
+		default:
+			continue
+		}
+		stale++
+	}
+	if stale == 0 {
+		fmt.Fprintf(w, "%v: up to date\n", name)
+	}
+	return stale, nil
+}
+
+// readSecrets reads the Secrets of the manifest file, see decodeSecrets.
+func readSecrets(filename, namespace string) (map[string]*k8sSecret, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeSecrets(f, namespace)
+}
+
+// decodeSecrets decodes the Secrets of the YAML or JSON manifests by their
+// "secret/<namespace>/<name>", defaulting their namespace to namespace.
+func decodeSecrets(r io.Reader, namespace string) (map[string]*k8sSecret, error) {
+	secrets := map[string]*k8sSecret{}
+	dec := yaml.NewDecoder(r)
+	for {
+		var secret k8sSecret
+		if err := dec.Decode(&secret); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to decode manifest")
+		}
+		if secret.Kind != "Secret" {
+			continue
+		}
+		if secret.Metadata.Namespace == "" {
+			secret.Metadata.Namespace = namespace
+		}
+		name := "secret/" + secret.Metadata.Name
+		if secret.Metadata.Namespace != "" {
+			name = "secret/" + secret.Metadata.Namespace + "/" + secret.Metadata.Name
+		}
+		secrets[name] = &secret
+	}
+	return secrets, nil
+}
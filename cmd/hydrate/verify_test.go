@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestVerifySecret(t *testing.T) {
+	secret := &k8sSecret{StringData: map[string]string{"db_pass": "hunter2", "api_key": "k3y"}}
+	tt := []struct {
+		name     string
+		existing *k8sSecret
+		stale    int
+		expected string
+	}{
+		{
+			name:     "up to date",
+			existing: &k8sSecret{Data: map[string]string{"db_pass": "aHVudGVyMg==", "api_key": "azN5"}, StringData: map[string]string{"extra": "kept"}},
+			expected: "secret/ns/app: up to date\n",
+		},
+		{
+			name:     "stale",
+			existing: &k8sSecret{StringData: map[string]string{"db_pass": "old", "api_key": "k3y"}},
+			stale:    1,
+			expected: "stale    secret/ns/app: db_pass\n",
+		},
+		{
+			name:     "missing key",
+			existing: &k8sSecret{StringData: map[string]string{"db_pass": "hunter2"}},
+			stale:    1,
+			expected: "missing  secret/ns/app: api_key\n",
+		},
+		{
+			name:     "doesn't exist",
+			stale:    1,
+			expected: "secret/ns/app: doesn't exist\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			stale, err := verifySecret(&b, "secret/ns/app", secret, tc.existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stale != tc.stale {
+				t.Errorf("expected %v stale keys, got %v", tc.stale, stale)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b.String())
+			}
+			if strings.Contains(b.String(), "hunter2") || strings.Contains(b.String(), "old") {
+				t.Errorf("output reveals values: %q", b.String())
+			}
+		})
+	}
+}
+
+func TestVerifySecretInvalidData(t *testing.T) {
+	secret := &k8sSecret{StringData: map[string]string{"db_pass": "hunter2"}}
+	existing := &k8sSecret{Data: map[string]string{"db_pass": "not base64!"}}
+	if _, err := verifySecret(&bytes.Buffer{}, "secret/app", secret, existing); err == nil || !strings.Contains(err.Error(), `failed to decode "db_pass" data`) {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+}
+
+func TestDecodeSecrets(t *testing.T) {
+	manifests := `kind: Secret
+metadata:
+  name: app
+stringData:
+  db_pass: hunter2
+---
+kind: ConfigMap
+metadata:
+  name: app
+---
+kind: Secret
+metadata:
+  name: worker
+  namespace: jobs
+data:
+  api_key: azN5
+`
+	tt := []struct {
+		name      string
+		namespace string
+		expected  []string
+	}{
+		{name: "no namespace", expected: []string{"secret/app", "secret/jobs/worker"}},
+		{name: "default namespace", namespace: "prod", expected: []string{"secret/jobs/worker", "secret/prod/app"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			secrets, err := decodeSecrets(strings.NewReader(manifests), tc.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for name := range secrets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, names)
+			}
+		})
+	}
+
+	if _, err := decodeSecrets(strings.NewReader("kind: [\n"), ""); err == nil || !strings.Contains(err.Error(), "failed to decode manifest") {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+}
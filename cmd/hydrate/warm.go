@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+func warm(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate warm", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "AWS SSM Parameter Store path whose subtree to cache, ie. /app/prod")
+		cacheDir = flags.String("cache-dir", "", "directory to persist the parameters into, see hydrate --cache-dir")
+		rate     = flags.Int("rate-limit", 0, "max AWS SSM API calls per second (0 = no limit)")
+	)
+	awsFlags(flags)
+	parseFlags(flags, args)
+
+	if *basePath == "" || *cacheDir == "" || flags.NArg() != 0 {
+		log.Fatal(errors.New("hydrate warm: usage: hydrate warm --path=/app/prod --cache-dir=/var/cache/hydrate"))
+	}
+
+	paramStore := hydrate.ParamStore(newSSM(*region), *basePath)
+	paramStore.SetLogger(logger)
+	paramStore.SetRateLimit(*rate)
+	if err := paramStore.SetCache(*cacheDir, 0); err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate warm"))
+	}
+
+	n, err := paramStore.Warm(context.Background(), *basePath)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "hydrate warm"))
+	}
+	logger.Log(hydrate.LevelInfo, "cached parameters", "count", n, "path", *basePath, "dir", *cacheDir)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+type watchedHydrator interface {
+	hydrator
+	References(r io.Reader, format string, k8s bool) ([]string, error)
+	Forget(keys ...string)
+}
+
+// parameterChangeEvent is an EventBridge "Parameter Store Change" event.
+type parameterChangeEvent struct {
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		Name      string `json:"name"`
+		Operation string `json:"operation"`
+	} `json:"detail"`
+}
+
+func watch(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate watch", flag.ExitOnError)
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		format   = flags.String("format", "", "input file format: json, yaml, toml (defaults to file extensions)")
+		k8s      = flags.Bool("k8s", false, "hydrate Kubernetes Secret/ConfigMap objects' base64-encoded data fields")
+		queueURL = flags.String("queue-url", "", "SQS queue receiving EventBridge \"Parameter Store Change\" events")
+		outDir   = flags.String("out-dir", "", "write hydrated files into directory")
+		kubectl  = flags.Bool("kubectl-apply", false, "push hydrated manifests to the cluster via `kubectl apply -f -`")
+	)
+	notify := notifyFlags(flags)
+	awsFlags(flags)
+	parseFlags(flags, args)
+	notify.check()
+
+	if *queueURL == "" {
+		log.Fatal(errors.New("hydrate watch: --queue-url must be provided"))
+	}
+	if *outDir == "" && !*kubectl {
+		log.Fatal(errors.New("hydrate watch: --out-dir or --kubectl-apply must be provided"))
+	}
+	if flags.NArg() == 0 {
+		log.Fatal(errors.New("hydrate watch: at least one template file must be provided"))
+	}
+
+	cfg := newConfig(*region)
+	paramStore := hydrate.ParamStore(ssm.NewFromConfig(cfg), *basePath)
+	queue := sqs.NewFromConfig(cfg)
+	paramStore.SetLogger(logger)
+
+	w := &watcher{
+		h: paramStore,
+		opts: batchOptions{
+			format: *format,
+			k8s:    *k8s,
+			outDir: *outDir,
+		},
+		kubectl: *kubectl,
+		refs:    map[string][]string{},
+		notify:  notify,
+	}
+
+	for _, template := range flags.Args() {
+		if err := w.index(template); err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate watch"))
+		}
+		if err := w.emit(template); err != nil {
+			notify.fatal(errors.Wrapf(err, "hydrate watch: %v", template))
+		}
+	}
+	logger.Log(hydrate.LevelInfo, "watching parameters for changes", "parameters", len(w.refs), "templates", flags.NArg())
+
+	for {
+		out, err := queue.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:            queueURL,
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+		})
+		if err != nil {
+			notify.fatal(errors.Wrap(err, "hydrate watch: failed to receive SQS messages"))
+		}
+
+		for _, msg := range out.Messages {
+			if err := w.handle(aws.ToString(msg.Body)); err != nil {
+				// Leave the message in the queue to retry after
+				// its visibility timeout.
+				logger.Log(hydrate.LevelError, "failed to handle change", "error", err)
+				continue
+			}
+			_, err := queue.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
+				QueueUrl:      queueURL,
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			if err != nil {
+				logger.Log(hydrate.LevelWarn, "failed to delete SQS message", "error", err)
+			}
+		}
+	}
+}
+
+type watcher struct {
+	h       watchedHydrator
+	opts    batchOptions
+	kubectl bool
+	refs    map[string][]string // Parameter -> templates.
+	notify  *notifier
+}
+
+// index records the parameters referenced by the template.
+func (w *watcher) index(template string) error {
+	f, err := os.Open(template)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	params, err := w.h.References(f, w.format(template), w.opts.k8s)
+	if err != nil {
+		return errors.Wrapf(err, "%v", template)
+	}
+	for _, param := range params {
+		w.refs[param] = append(w.refs[param], template)
+	}
+	return nil
+}
+
+func (w *watcher) format(template string) string {
+	if w.opts.format != "" {
+		return w.opts.format
+	}
+	return strings.TrimLeft(filepath.Ext(template), ".")
+}
+
+// handle re-hydrates all templates referencing the changed parameter.
+func (w *watcher) handle(body string) error {
+	var event parameterChangeEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return errors.Wrap(err, "failed to decode EventBridge event")
+	}
+	if event.DetailType != "Parameter Store Change" {
+		return nil
+	}
+
+	templates := w.refs[event.Detail.Name]
+	if len(templates) == 0 {
+		return nil
+	}
+
+	logger.Log(hydrate.LevelInfo, "parameter changed, re-hydrating templates", "key", event.Detail.Name, "operation", event.Detail.Operation, "templates", len(templates))
+	w.h.Forget(event.Detail.Name)
+
+	for _, template := range templates {
+		if err := w.emit(template); err != nil {
+			err = errors.Wrapf(err, "failed to re-hydrate %v", template)
+			w.notify.failed(failureHydration, err, template)
+			return err
+		}
+	}
+	w.notify.changed(event.Detail.Name, event.Detail.Operation, templates)
+	return nil
+}
+
+func (w *watcher) emit(template string) error {
+	if w.opts.outDir != "" {
+		if _, err := hydrateFile(context.Background(), w.h, template, w.opts); err != nil {
+			return err
+		}
+	}
+	if !w.kubectl {
+		return nil
+	}
+
+	f, err := os.Open(template)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	if err := w.h.HydrateFormatContext(context.Background(), &b, f, w.format(template), "", w.opts.k8s); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = &b
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return errors.Wrap(cmd.Run(), "kubectl apply")
+}
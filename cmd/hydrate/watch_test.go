@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var secretRef = regexp.MustCompile(`\$SECRET:(\S+)`)
+
+// fakeWatchedHydrator replaces $SECRET:<name> references by its values.
+type fakeWatchedHydrator struct {
+	values    map[string]string
+	forgotten []string
+}
+
+func (h *fakeWatchedHydrator) References(r io.Reader, format string, k8s bool) ([]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, m := range secretRef.FindAllStringSubmatch(string(data), -1) {
+		refs = append(refs, m[1])
+	}
+	return refs, nil
+}
+
+func (h *fakeWatchedHydrator) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, secretRef.ReplaceAllStringFunc(string(data), func(ref string) string {
+		return h.values[strings.TrimPrefix(ref, "$SECRET:")]
+	}))
+	return err
+}
+
+func (h *fakeWatchedHydrator) Forget(keys ...string) {
+	h.forgotten = append(h.forgotten, keys...)
+}
+
+func TestWatcher(t *testing.T) {
+	tt := []struct {
+		event     string
+		values    map[string]string
+		expected  map[string]string
+		forgotten []string
+		err       string
+	}{
+		{
+			event:     `{"detail-type": "Parameter Store Change", "detail": {"name": "/app/db_pass", "operation": "Update"}}`,
+			values:    map[string]string{"/app/db_pass": "new", "/app/api_key": "k3y"},
+			expected:  map[string]string{"app.yml": "db_pass: new\n", "api.yml": "api_key: k3y\n", "db.yml": "db_pass: new\n"},
+			forgotten: []string{"/app/db_pass"},
+		},
+		{
+			event:    `{"detail-type": "Parameter Store Change", "detail": {"name": "/app/unrelated", "operation": "Update"}}`,
+			values:   map[string]string{"/app/db_pass": "new", "/app/api_key": "new"},
+			expected: map[string]string{"app.yml": "db_pass: old\n", "api.yml": "api_key: k3y\n", "db.yml": "db_pass: old\n"},
+		},
+		{
+			event:    `{"detail-type": "Scheduled Event", "detail": {"name": "/app/db_pass"}}`,
+			values:   map[string]string{"/app/db_pass": "new", "/app/api_key": "new"},
+			expected: map[string]string{"app.yml": "db_pass: old\n", "api.yml": "api_key: k3y\n", "db.yml": "db_pass: old\n"},
+		},
+		{
+			event: `not json`,
+			err:   "failed to decode EventBridge event",
+		},
+	}
+
+	for _, tc := range tt {
+		in, out := t.TempDir(), t.TempDir()
+		templates := map[string]string{"app.yml": "db_pass: $SECRET:/app/db_pass\n", "api.yml": "api_key: $SECRET:/app/api_key\n", "db.yml": "db_pass: $SECRET:/app/db_pass\n"}
+
+		h := &fakeWatchedHydrator{values: map[string]string{"/app/db_pass": "old", "/app/api_key": "k3y"}}
+		w := &watcher{h: h, opts: batchOptions{outDir: out}, refs: map[string][]string{}}
+		for name, data := range templates {
+			template := filepath.Join(in, name)
+			if err := ioutil.WriteFile(template, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.index(template); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.emit(template); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		h.values = tc.values
+		err := w.handle(tc.event)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, expected := range tc.expected {
+			data, err := ioutil.ReadFile(filepath.Join(out, in, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != expected {
+				t.Errorf("%v: expected %q, got %q", name, expected, data)
+			}
+		}
+		if !reflect.DeepEqual(h.forgotten, tc.forgotten) {
+			t.Errorf("expected to forget %v, got %v", tc.forgotten, h.forgotten)
+		}
+	}
+}
+
+func TestWatcherKubectl(t *testing.T) {
+	dir := t.TempDir()
+	applied := filepath.Join(dir, "applied")
+	script := "#!/bin/sh\necho \"$@\" > " + applied + "\ncat >> " + applied + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	template := filepath.Join(dir, "secret.yml")
+	if err := ioutil.WriteFile(template, []byte("db_pass: $SECRET:/app/db_pass\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &watcher{h: &fakeWatchedHydrator{values: map[string]string{"/app/db_pass": "hunter2"}}, kubectl: true}
+	if err := w.emit(template); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "apply -f -\ndb_pass: hunter2\n"; string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+}
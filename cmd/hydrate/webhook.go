@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/hydrate"
+)
+
+// admissionReview is an admission.k8s.io/v1 AdmissionReview, of which only
+// the fields used by the webhook are decoded.
+type admissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *admissionRequest  `json:"request,omitempty"`
+	Response   *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       string           `json:"uid"`
+	Kind      groupVersionKind `json:"kind"`
+	Name      string           `json:"name"`
+	Namespace string           `json:"namespace"`
+	Operation string           `json:"operation"` // CREATE, UPDATE, DELETE, CONNECT
+	Object    json.RawMessage  `json:"object"`
+}
+
+type groupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+type admissionResponse struct {
+	UID       string           `json:"uid"`
+	Allowed   bool             `json:"allowed"`
+	Result    *admissionStatus `json:"status,omitempty"`
+	PatchType string           `json:"patchType,omitempty"`
+	Patch     []byte           `json:"patch,omitempty"` // Base64-encoded by encoding/json.
+	Warnings  []string         `json:"warnings,omitempty"`
+}
+
+type admissionStatus struct {
+	Message string `json:"message"`
+}
+
+// jsonPatchOp is an RFC 6902 JSON Patch operation.
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func webhook(args []string) {
+	var (
+		flags    = flag.NewFlagSet("hydrate webhook", flag.ExitOnError)
+		listen   = flags.String("listen", ":8443", "address to listen on")
+		tlsCert  = flags.String("tls-cert", "", "TLS certificate file of the webhook, ie. /etc/webhook/tls.crt")
+		tlsKey   = flags.String("tls-key", "", "TLS private key file of the webhook, ie. /etc/webhook/tls.key")
+		region   = flags.String("region", "", "AWS region (defaults to $AWS_REGION, $AWS_DEFAULT_REGION or the --profile region)")
+		basePath = flags.String("path", "", "base path for AWS SSM Parameter Store parameters")
+		role     = flags.String("role", "", "assume the IAM role to fetch secrets with, ie. arn:aws:iam::123456789012:role/hydrate")
+		cacheTTL = flags.Duration("cache-ttl", 5*time.Minute, "serve fetched secrets from memory for the duration, ie. 30s (0 = fetch on every request)")
+		timeout  = flags.Duration("timeout", 8*time.Second, "deny requests not hydrated within the duration, or the API server's timeoutSeconds if shorter")
+		rate     = flags.Int("rate-limit", 0, "max AWS API calls per second shared by all requests (0 = no limit)")
+		inFlight = flags.Int("max-in-flight", 64, "shed requests beyond the number of concurrent hydrations (0 = no limit)")
+		backoff  = flags.Duration("throttle-backoff", 5*time.Second, "shed requests for the duration once AWS throttled a hydration, instead of adding to the throttling (0 = never)")
+		policy   = flags.String("failure-policy", "fail", "objects of shed, timed out or throttled requests: fail (deny them, fail closed) or ignore (admit them unhydrated, fail open)")
+		clientCA = flags.String("client-ca", "", "require client certificates of the API server signed by the PEM CA file (mTLS)")
+	)
+	notify := notifyFlags(flags)
+	awsFlags(flags)
+	parseFlags(flags, args)
+	notify.check()
+
+	if *tlsCert == "" || *tlsKey == "" {
+		log.Fatal(errors.New("hydrate webhook: --tls-cert and --tls-key must be provided, the API server only calls webhooks over HTTPS"))
+	}
+
+	if *policy != "fail" && *policy != "ignore" {
+		log.Fatal(errors.Errorf("hydrate webhook: unknown --failure-policy=%v, expected fail or ignore", *policy))
+	}
+	requireRole("hydrate webhook", "--role", *role)
+	cfg := newConfig(*region)
+	if *role != "" {
+		cfg = assumeRole(cfg, *role)
+	}
+	s := &server{cfg: cfg, basePath: *basePath, limiter: hydrate.NewRateLimiter(*rate), ttl: *cacheTTL, timeout: *timeout, maxInFlight: *inFlight, throttleBackoff: *backoff, failOpen: *policy == "ignore", notify: notify}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mutate", s.mutate)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	srv := s.httpServer(*listen, mux)
+	if *clientCA != "" {
+		tlsConfig, err := clientCAConfig(*clientCA)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "hydrate webhook"))
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	logger.Log(hydrate.LevelInfo, "serving admission webhook", "listen", *listen)
+	log.Fatal(srv.ListenAndServeTLS(*tlsCert, *tlsKey))
+}
+
+// mutate handles AdmissionReview requests of ConfigMaps and Secrets,
+// responding with a patch of their hydrated data. Objects that fail to
+// hydrate are denied, so that references are never persisted unhydrated,
+// unless the secret store was unavailable and --failure-policy=ignore.
+func (s *server) mutate(w http.ResponseWriter, r *http.Request) {
+	var review admissionReview
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxServeBody)).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview request", http.StatusBadRequest)
+		return
+	}
+	req := review.Request
+
+	resp := &admissionResponse{UID: req.UID, Allowed: true}
+	ctx, cancel := s.requestTimeout(r)
+	defer cancel()
+	patch, err := s.hydratePatch(ctx, req)
+	if err != nil {
+		s.notifyFailed(err, fmt.Sprintf("%v %v/%v", req.Kind.Kind, req.Namespace, req.Name))
+	}
+	if err != nil && s.failOpen && isUnavailable(err) {
+		logger.Log(hydrate.LevelWarn, "admitted unhydrated", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "error", err)
+		resp.Warnings = []string{"hydrate: admitted unhydrated (--failure-policy=ignore): " + err.Error()}
+	} else if err != nil {
+		logger.Log(hydrate.LevelError, "denied", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "error", err)
+		resp.Allowed = false
+		resp.Result = &admissionStatus{Message: err.Error()}
+	} else if len(patch) > 0 {
+		logger.Log(hydrate.LevelInfo, "hydrated", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name)
+		resp.PatchType = "JSONPatch"
+		if resp.Patch, err = json.Marshal(patch); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admissionReview{
+		APIVersion: "admission.k8s.io/v1",
+		Kind:       "AdmissionReview",
+		Response:   resp,
+	})
+}
+
+// hydratePatch returns the JSON Patch replacing the data fields of the
+// object with the hydrated ones, if any changed.
+func (s *server) hydratePatch(ctx context.Context, req *admissionRequest) ([]jsonPatchOp, error) {
+	switch req.Kind.Kind {
+	case "ConfigMap", "Secret":
+	default:
+		return nil, nil // Not configured to intercept, leave it.
+	}
+	if req.Operation != "CREATE" && req.Operation != "UPDATE" {
+		return nil, nil
+	}
+
+	release, err := s.admit()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx = hydrate.WithoutIncludes(ctx)
+
+	var b bytes.Buffer
+	if err := s.hydrateWithin(ctx, func(ctx context.Context) error {
+		return s.paramStore().HydrateFormatContext(ctx, &b, bytes.NewReader(req.Object), "json", "", true)
+	}); err != nil {
+		return nil, err
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(req.Object, &before); err != nil {
+		return nil, errors.Wrap(err, "failed to decode object")
+	}
+	if err := json.Unmarshal(b.Bytes(), &after); err != nil {
+		return nil, errors.Wrap(err, "failed to decode hydrated object")
+	}
+
+	var patch []jsonPatchOp
+	for _, field := range []string{"data", "stringData", "binaryData"} {
+		if value, ok := after[field]; ok && !reflect.DeepEqual(before[field], value) {
+			patch = append(patch, jsonPatchOp{Op: "replace", Path: "/" + field, Value: value})
+		}
+	}
+	return patch, nil
+}
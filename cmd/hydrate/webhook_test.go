@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// replaceHydrator replaces the "$$" references of its inputs by "hydrated",
+// failing inputs referencing "$fail".
+type replaceHydrator struct{}
+
+func (replaceHydrator) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(data), "$fail") {
+		return errors.New(`failed to fetch "/app/fail" parameter`)
+	}
+	_, err = io.WriteString(w, strings.Replace(string(data), "$$", "hydrated", -1))
+	return err
+}
+
+func TestMutate(t *testing.T) {
+	tt := []struct {
+		name     string
+		kind     string
+		op       string
+		object   string
+		allowed  bool
+		expected []jsonPatchOp
+		message  string
+	}{
+		{
+			name:     "secret",
+			kind:     "Secret",
+			op:       "CREATE",
+			object:   `{"kind":"Secret","stringData":{"pass":"$$"}}`,
+			allowed:  true,
+			expected: []jsonPatchOp{{Op: "replace", Path: "/stringData", Value: map[string]interface{}{"pass": "hydrated"}}},
+		},
+		{
+			name:     "configmap",
+			kind:     "ConfigMap",
+			op:       "UPDATE",
+			object:   `{"kind":"ConfigMap","metadata":{"name":"$$"},"data":{"pass":"$$"},"binaryData":{"x":"eA=="}}`,
+			allowed:  true,
+			expected: []jsonPatchOp{{Op: "replace", Path: "/data", Value: map[string]interface{}{"pass": "hydrated"}}},
+		},
+		{name: "unchanged", kind: "Secret", op: "CREATE", object: `{"kind":"Secret","data":{"a":"YQ=="}}`, allowed: true},
+		{name: "other kind", kind: "Pod", op: "CREATE", object: `{"kind":"Pod","data":{"pass":"$$"}}`, allowed: true},
+		{name: "delete", kind: "Secret", op: "DELETE", object: `{"kind":"Secret","stringData":{"pass":"$$"}}`, allowed: true},
+		{name: "failure", kind: "Secret", op: "CREATE", object: `{"kind":"Secret","stringData":{"pass":"$fail"}}`, message: `failed to fetch "/app/fail" parameter`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{ttl: time.Hour, timeout: time.Second, store: replaceHydrator{}, created: time.Now()}
+			review, err := json.Marshal(admissionReview{
+				APIVersion: "admission.k8s.io/v1",
+				Kind:       "AdmissionReview",
+				Request: &admissionRequest{
+					UID:       "uid",
+					Kind:      groupVersionKind{Version: "v1", Kind: tc.kind},
+					Name:      "app",
+					Namespace: "default",
+					Operation: tc.op,
+					Object:    json.RawMessage(tc.object),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			s.mutate(w, httptest.NewRequest("POST", "/mutate", strings.NewReader(string(review))))
+
+			var out admissionReview
+			if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			resp := out.Response
+			if resp == nil || resp.UID != "uid" {
+				t.Fatalf("expected a response of the uid, got %+v", resp)
+			}
+			if resp.Allowed != tc.allowed {
+				t.Fatalf("expected allowed %v, got %+v", tc.allowed, resp)
+			}
+			if tc.message != "" && (resp.Result == nil || !strings.Contains(resp.Result.Message, tc.message)) {
+				t.Errorf("expected message %q, got %+v", tc.message, resp.Result)
+			}
+
+			var patch []jsonPatchOp
+			if len(resp.Patch) > 0 {
+				if resp.PatchType != "JSONPatch" {
+					t.Errorf("expected JSONPatch, got %q", resp.PatchType)
+				}
+				if err := json.Unmarshal(resp.Patch, &patch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(patch, tc.expected) {
+				t.Errorf("expected patch %+v, got %+v", tc.expected, patch)
+			}
+		})
+	}
+}
+
+func TestMutateInvalid(t *testing.T) {
+	s := &server{ttl: time.Hour, timeout: time.Second, store: replaceHydrator{}, created: time.Now()}
+	for _, body := range []string{"", "{}", "not json"} {
+		w := httptest.NewRecorder()
+		s.mutate(w, httptest.NewRequest("POST", "/mutate", strings.NewReader(body)))
+		if w.Code != 400 {
+			t.Errorf("%q: expected status 400, got %v", body, w.Code)
+		}
+	}
+}
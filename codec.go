@@ -0,0 +1,328 @@
+package hydrate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Encoder writes hydrated documents in a custom output format, ie. Java
+// properties, PEM bundle or Java keystore. All documents of the input are passed at once,
+// as multi-document YAML input results in multiple documents.
+type Encoder func(w io.Writer, docs []map[string]interface{}) error
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{
+		"json":       encodeJSON,
+		"ndjson":     encodeNDJSON,
+		"yaml":       encodeYAML,
+		"yml":        encodeYAML,
+		"toml":       encodeTOML,
+		"env":        encodeDotenv,
+		"env-export": encodeEnvExport,
+		"env-null":   encodeEnvNull,
+	}
+)
+
+// encodeJSON writes a single document as an object, and multiple documents,
+// ie. of multi-document YAML manifests, as an array of objects.
+func encodeJSON(w io.Writer, docs []map[string]interface{}) error {
+	switch len(docs) {
+	case 0:
+		return errors.New("JSON output expects a document, got none")
+	case 1:
+		return json.NewEncoder(w).Encode(docs[0])
+	default:
+		return json.NewEncoder(w).Encode(docs)
+	}
+}
+
+// encodeNDJSON writes each document as an object on its own line, see
+// http://ndjson.org.
+func encodeNDJSON(w io.Writer, docs []map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeYAML(w io.Writer, docs []map[string]interface{}) error {
+	enc := yaml.NewEncoder(w)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// encodeTOML writes a single document as it is. TOML has no multiple
+// documents nor top-level arrays, so multiple documents are written as
+// a [[documents]] array of tables.
+func encodeTOML(w io.Writer, docs []map[string]interface{}) error {
+	switch len(docs) {
+	case 0:
+		return errors.New("TOML output expects a document, got none")
+	case 1:
+		return toml.NewEncoder(w).Encode(docs[0])
+	default:
+		return toml.NewEncoder(w).Encode(map[string]interface{}{"documents": docs})
+	}
+}
+
+// RegisterEncoder makes an output format available by the provided name,
+// ie. for the CLI's --output-format flag. If RegisterEncoder is called
+// twice with the same name or enc is nil, it panics.
+func RegisterEncoder(format string, enc Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	if enc == nil {
+		panic("hydrate: RegisterEncoder encoder is nil")
+	}
+	if _, dup := encoders[format]; dup {
+		panic("hydrate: RegisterEncoder called twice for format " + format)
+	}
+	encoders[format] = enc
+}
+
+// inputFormats are the formats hydrated by HydrateFormat, including aliases.
+var inputFormats = []string{
+	"dotenv", "env", "json", "netrc", "npmrc", "pip.conf", "pipconf",
+	"properties", "pypirc", "template", "tmpl", "toml", "yaml", "yml",
+}
+
+// InputFormats returns a sorted list of the names of the input formats,
+// including aliases, ie. "yml" of "yaml".
+func InputFormats() []string {
+	return append([]string(nil), inputFormats...)
+}
+
+// OutputFormats returns a sorted list of the names of the registered
+// output formats.
+func OutputFormats() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	formats := make([]string, 0, len(encoders))
+	for format := range encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func lookupEncoder(format string) (Encoder, error) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	enc, ok := encoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	return enc, nil
+}
+
+func decodeDocuments(r io.Reader, format string) ([]interface{}, error) {
+	var docs []interface{}
+
+	switch format {
+	case "json":
+		var data interface{}
+		if err := json.NewDecoder(r).Decode(&data); err != nil {
+			return nil, errors.Wrap(err, "failed to decode JSON")
+		}
+		docs = append(docs, data)
+
+	case "yml", "yaml":
+		dec := yaml.NewDecoder(r)
+		for {
+			var data interface{}
+			if err := dec.Decode(&data); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, errors.Wrap(err, "failed to decode YAML")
+			}
+			docs = append(docs, data)
+		}
+
+	case "toml":
+		var data map[string]interface{}
+		if _, err := toml.NewDecoder(r).Decode(&data); err != nil {
+			return nil, errors.Wrap(err, "failed to decode TOML")
+		}
+		docs = append(docs, data)
+
+	case "env", "dotenv":
+		data, err := decodeDotenv(r)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, data)
+
+	case "properties":
+		data, err := decodeProperties(r)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, data)
+
+	default:
+		return nil, fmt.Errorf("unknown file format %q", format)
+	}
+
+	return docs, nil
+}
+
+// convertTypes maps the decoded values of the document to types that the
+// outputFormat can represent, ie. TOML has no null and YAML non-string keys
+// aren't valid JSON.
+func convertTypes(value interface{}, format, outputFormat, field string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if val == nil && outputFormat == "toml" {
+				delete(v, key) // An absent key is TOML's closest to null.
+				continue
+			}
+			converted, err := convertTypes(val, format, outputFormat, joinField(field, key))
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = val
+		}
+		return convertTypes(m, format, outputFormat, field)
+
+	case []interface{}:
+		for i, val := range v {
+			if val == nil && outputFormat == "toml" {
+				return nil, errors.Errorf("%q: TOML output has no null value", joinField(field, strconv.Itoa(i)))
+			}
+			converted, err := convertTypes(val, format, outputFormat, joinField(field, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+
+	case []map[string]interface{}: // TOML array of tables.
+		for i, table := range v {
+			if _, err := convertTypes(table, format, outputFormat, joinField(field, strconv.Itoa(i))); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+
+	case float64:
+		// JSON has no integers, but TOML does.
+		if format == "json" && outputFormat == "toml" && v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), nil
+		}
+		return v, nil
+
+	case time.Time:
+		// TOML's local date-times, dates and times have no zone, keep
+		// them as they were written.
+		if outputFormat == "toml" {
+			return v, nil
+		}
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999"), nil
+		case "date-local":
+			return v.Format("2006-01-02"), nil
+		case "time-local":
+			return v.Format("15:04:05.999999999"), nil
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// k8sSecretKeyRe matches valid keys of Kubernetes Secret data.
+var k8sSecretKeyRe = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// K8sSecretEncoder returns an Encoder writing the flat hydrated document as
+// a v1 Secret manifest with the base64-encoded values in data, ie. to
+// register as the "k8s-secret" output format. Multi-line values are kept
+// as they are. Labels and annotations are optional.
+func K8sSecretEncoder(name, namespace string, labels, annotations map[string]string) Encoder {
+	return func(w io.Writer, docs []map[string]interface{}) error {
+		if len(docs) != 1 {
+			return errors.Errorf("Secret output expects one document, got %v", len(docs))
+		}
+
+		data := map[string]string{}
+		for key, value := range docs[0] {
+			if !k8sSecretKeyRe.MatchString(key) {
+				return errors.Errorf("%q: Secret keys may only contain a-z, A-Z, 0-9, -._", key)
+			}
+			var s string
+			switch value := value.(type) {
+			case map[string]interface{}, []interface{}, []map[string]interface{}:
+				return errors.Errorf("%q: Secret output supports only scalar values, got %T", key, value)
+			case nil:
+			case []byte:
+				s = string(value)
+			default:
+				s = fmt.Sprint(value)
+			}
+			data[key] = base64.StdEncoding.EncodeToString([]byte(s))
+		}
+
+		var secret struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name        string            `yaml:"name"`
+				Namespace   string            `yaml:"namespace,omitempty"`
+				Labels      map[string]string `yaml:"labels,omitempty"`
+				Annotations map[string]string `yaml:"annotations,omitempty"`
+			} `yaml:"metadata"`
+			Type string            `yaml:"type"`
+			Data map[string]string `yaml:"data"`
+		}
+		secret.APIVersion, secret.Kind, secret.Type = "v1", "Secret", "Opaque"
+		secret.Metadata.Name, secret.Metadata.Namespace = name, namespace
+		secret.Metadata.Labels, secret.Metadata.Annotations = labels, annotations
+		secret.Data = data
+
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&secret); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+}
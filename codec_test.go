@@ -0,0 +1,255 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHydrateFormat(t *testing.T) {
+	RegisterEncoder("test-keys", func(w io.Writer, docs []map[string]interface{}) error {
+		for _, doc := range docs {
+			var keys []string
+			for key, value := range doc {
+				keys = append(keys, fmt.Sprintf("%v=%v", key, value))
+			}
+			sort.Strings(keys)
+			fmt.Fprintln(w, strings.Join(keys, " "))
+		}
+		return nil
+	})
+
+	tt := []struct {
+		format, outputFormat string
+		input                string
+		expected             string
+		err                  string
+	}{
+		{format: "yaml", outputFormat: "json", input: "db_pass: $$\nport: 5432\n", expected: `{"db_pass":"hunter2","port":5432}` + "\n"},
+		{format: "json", outputFormat: "yaml", input: `{"db_pass": "$$"}`, expected: "db_pass: hunter2\n"},
+		{format: "json", outputFormat: "toml", input: `{"user": "$SECRET"}`, expected: "user = \"app\"\n"},
+		{format: "toml", outputFormat: "json", input: "user = \"$SECRET\"\n", expected: `{"user":"app"}` + "\n"},
+		{format: "yaml", outputFormat: "yml", input: "a: &a $$\nb: *a\n", expected: "a: &a hunter2\nb: *a\n"},
+		{format: "json", outputFormat: "", input: `{"user": "$SECRET"}`, expected: `{"user": "app"}` + "\n"},
+		{format: "yaml", outputFormat: "test-keys", input: "user: $SECRET\n---\n---\napi_key: $$\n", expected: "user=app\napi_key=k3y\n"},
+		{format: "yaml", outputFormat: "json", input: "a: 1\n---\nb: 2\n", expected: `[{"a":1},{"b":2}]` + "\n"},
+		{format: "yaml", outputFormat: "ndjson", input: "a: 1\n---\nb: 2\n", expected: `{"a":1}` + "\n" + `{"b":2}` + "\n"},
+		{format: "yaml", outputFormat: "toml", input: "a: 1\n---\nb: 2\n", expected: "[[documents]]\n  a = 1\n\n[[documents]]\n  b = 2\n"},
+		{format: "yaml", outputFormat: "json", input: "---\n", err: "JSON output expects a document, got none"},
+		{format: "yaml", outputFormat: "json", input: "- a\n", err: "expected yaml document to be an object"},
+		{format: "json", outputFormat: "xml", input: "{}", err: `unknown output format "xml"`},
+		{format: "json", outputFormat: "yaml", input: `{"missing": "$SECRET:/app/missing"}`, err: `failed to hydrate "missing" field`},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/db_pass": "hunter2", "/app/a": "hunter2", "/app/user": "app", "/app/api_key": "k3y"})
+
+		var b bytes.Buffer
+		err := ps.HydrateFormat(&b, strings.NewReader(tc.input), tc.format, tc.outputFormat, false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v -> %v: expected error %q, got %v", tc.format, tc.outputFormat, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v -> %v: expected %q, got %q", tc.format, tc.outputFormat, tc.expected, b.String())
+		}
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	tt := []struct {
+		format string
+		enc    Encoder
+		panic  string
+	}{
+		{format: "test-noop", enc: func(io.Writer, []map[string]interface{}) error { return nil }},
+		{format: "test-noop", enc: func(io.Writer, []map[string]interface{}) error { return nil }, panic: "hydrate: RegisterEncoder called twice for format test-noop"},
+		{format: "json", enc: encodeJSON, panic: "hydrate: RegisterEncoder called twice for format json"},
+		{format: "test-nil", panic: "hydrate: RegisterEncoder encoder is nil"},
+	}
+
+	for _, tc := range tt {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil && tc.panic != "" || r != nil && fmt.Sprint(r) != tc.panic {
+					t.Errorf("%v: expected panic %q, got %v", tc.format, tc.panic, r)
+				}
+			}()
+			RegisterEncoder(tc.format, tc.enc)
+		}()
+	}
+
+	formats := OutputFormats()
+	if !sort.StringsAreSorted(formats) || !strings.Contains(strings.Join(formats, ","), "test-noop,toml,yaml,yml") {
+		t.Errorf("expected sorted output formats, got %v", formats)
+	}
+}
+
+func TestHydrateDocument(t *testing.T) {
+	tt := []struct {
+		format   string
+		input    string
+		expected map[string]interface{}
+		report   *Report
+		err      string
+	}{
+		{
+			format:   "yaml",
+			input:    "db:\n  pass: $$\n  user: $SECRET:/app/user\nport: 5432\n",
+			expected: map[string]interface{}{"db": map[string]interface{}{"pass": "hunter2", "user": "app"}, "port": 5432},
+			report: &Report{
+				Fields:     []Reference{{Field: "db.pass", Parameter: "/app/pass", Provider: "ssm"}, {Field: "db.user", Parameter: "/app/user", Provider: "ssm"}},
+				Parameters: []string{"ssm:/app/pass", "ssm:/app/user"},
+			},
+		},
+		{
+			format:   "json",
+			input:    `{"a": "$SECRET:/app/user", "b": "$SECRET:/app/user"}`,
+			expected: map[string]interface{}{"a": "app", "b": "app"},
+			report: &Report{
+				Fields:     []Reference{{Field: "a", Parameter: "/app/user", Provider: "ssm"}, {Field: "b", Parameter: "/app/user", Provider: "ssm"}},
+				Parameters: []string{"ssm:/app/user"},
+			},
+		},
+		{
+			format:   "env",
+			input:    "USER=$SECRET:/app/user\nDEBUG=1\n",
+			expected: map[string]interface{}{"USER": "app", "DEBUG": "1"},
+			report:   &Report{Fields: []Reference{{Field: "USER", Parameter: "/app/user", Provider: "ssm"}}, Parameters: []string{"ssm:/app/user"}},
+		},
+		{format: "yaml", input: "", expected: map[string]interface{}{}, report: &Report{}},
+		{format: "yaml", input: "a: 1\n---\nb: 2\n", err: "expected a single yaml document, got 2"},
+		{format: "yaml", input: "- a\n", err: "expected yaml document to be an object"},
+		{format: "yaml", input: "missing: $$\n", err: `"/app/missing"`},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/pass": "hunter2", "/app/user": "app"})
+
+		data, report, err := ps.HydrateDocument(context.Background(), strings.NewReader(tc.input), tc.format)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, tc.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tc.input, tc.expected, data)
+		}
+		if !reflect.DeepEqual(report, tc.report) {
+			t.Errorf("%q: expected report %+v, got %+v", tc.input, tc.report, report)
+		}
+	}
+}
+
+func TestConvertTypes(t *testing.T) {
+	tt := []struct {
+		format, outputFormat string
+		input                string
+		expected             string
+		err                  string
+	}{
+		{format: "json", outputFormat: "toml", input: `{"port": 5432, "ratio": 0.5, "n": null, "user": "$SECRET"}`, expected: "port = 5432\nratio = 0.5\nuser = \"app\"\n"},
+		{format: "yaml", outputFormat: "json", input: "ports:\n  1: a\n  2: b\n", expected: `{"ports":{"1":"a","2":"b"}}` + "\n"},
+		{format: "toml", outputFormat: "json", input: "day = 2024-01-02\nat = 2024-01-02T03:04:05\n", expected: `{"at":"2024-01-02T03:04:05","day":"2024-01-02"}` + "\n"},
+		{format: "toml", outputFormat: "toml", input: "day = 2024-01-02\n", expected: "day = 2024-01-02\n"},
+		{format: "json", outputFormat: "toml", input: `{"hosts": ["a", null]}`, err: `"hosts.1": TOML output has no null value`},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/user": "app"})
+
+		var b bytes.Buffer
+		err := ps.HydrateFormat(&b, strings.NewReader(tc.input), tc.format, tc.outputFormat, false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v -> %v: expected error %q, got %v", tc.format, tc.outputFormat, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v -> %v: expected %q, got %q", tc.format, tc.outputFormat, tc.expected, b.String())
+		}
+	}
+}
+
+func TestK8sSecretEncoder(t *testing.T) {
+	tt := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		docs      []map[string]interface{}
+		expected  string
+		err       string
+	}{
+		{
+			name:     "app",
+			docs:     []map[string]interface{}{{"db_pass": "hunter2", "port": 5432, "empty": nil}},
+			expected: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\ntype: Opaque\ndata:\n  db_pass: aHVudGVyMg==\n  empty: \"\"\n  port: NTQzMg==\n",
+		},
+		{
+			name:      "app",
+			namespace: "prod",
+			labels:    map[string]string{"app": "api"},
+			docs:      []map[string]interface{}{{"key": "k3y"}},
+			expected:  "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\n  namespace: prod\n  labels:\n    app: api\ntype: Opaque\ndata:\n  key: azN5\n",
+		},
+		{
+			name:     "app",
+			docs:     []map[string]interface{}{{"tls.crt": "-----BEGIN-----\nMIIB\n-----END-----\n"}},
+			expected: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\ntype: Opaque\ndata:\n  tls.crt: LS0tLS1CRUdJTi0tLS0tCk1JSUIKLS0tLS1FTkQtLS0tLQo=\n",
+		},
+		{name: "app", docs: []map[string]interface{}{{"db pass": "x"}}, err: `"db pass": Secret keys may only contain`},
+		{name: "app", docs: []map[string]interface{}{{"db": map[string]interface{}{"pass": "x"}}}, err: `"db": Secret output supports only scalar values`},
+		{name: "app", docs: []map[string]interface{}{{}, {}}, err: "Secret output expects one document, got 2"},
+	}
+
+	for _, tc := range tt {
+		var b bytes.Buffer
+		err := K8sSecretEncoder(tc.name, tc.namespace, tc.labels, nil)(&b, tc.docs)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, b.String())
+		}
+	}
+}
+
+func TestInputFormats(t *testing.T) {
+	formats := InputFormats()
+	if !sort.StringsAreSorted(formats) {
+		t.Errorf("expected sorted input formats, got %v", formats)
+	}
+	ps := testStore(t, map[string]string{})
+	for _, format := range append(formats, "xml") {
+		var b bytes.Buffer
+		err := ps.Hydrate(&b, strings.NewReader(""), format, false)
+		if unknown := err != nil && strings.Contains(err.Error(), "unknown file format"); unknown != (format == "xml") {
+			t.Errorf("%v: unexpected error %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package hydrate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const missingPrefix = "$HYDRATE_MISSING:"
+
+func missingValue(key string) string {
+	return missingPrefix + key
+}
+
+// Difference describes a field that hydrates differently against two
+// base paths. Secret values are never exposed; Left and Right hold either
+// "set" or "missing", ie. when the parameter doesn't exist under that path.
+type Difference struct {
+	Field string
+	Left  string
+	Right string
+}
+
+func (d Difference) String() string {
+	if d.Left == d.Right {
+		return fmt.Sprintf("%v: values differ", d.Field)
+	}
+	return fmt.Sprintf("%v: %v in left, %v in right", d.Field, d.Left, d.Right)
+}
+
+// Compare hydrates the same input against the left and right parameter
+// stores (ie. different base paths) and returns the fields whose values
+// differ, sorted by field path. Parameters missing on either side are
+// reported as differences instead of failing the hydration.
+func Compare(left, right *paramStore, r io.Reader, format string, k8s bool) ([]Difference, error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read input")
+	}
+
+	leftFields, err := left.flatHydrate(input, format, k8s)
+	if err != nil {
+		return nil, errors.Wrap(err, "left")
+	}
+	rightFields, err := right.flatHydrate(input, format, k8s)
+	if err != nil {
+		return nil, errors.Wrap(err, "right")
+	}
+
+	var diffs []Difference
+	for field, l := range leftFields {
+		r := rightFields[field]
+		if l == r {
+			continue
+		}
+		diffs = append(diffs, Difference{
+			Field: field,
+			Left:  fieldStatus(l),
+			Right: fieldStatus(r),
+		})
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Field < diffs[j].Field
+	})
+
+	return diffs, nil
+}
+
+func fieldStatus(value string) string {
+	if strings.HasPrefix(value, missingPrefix) {
+		return "missing"
+	}
+	return "set"
+}
+
+// flatHydrate hydrates the input, tolerating missing parameters,
+// and returns the hydrated leaf values keyed by their field path.
+func (ps *paramStore) flatHydrate(input []byte, format string, k8s bool) (map[string]string, error) {
+	tolerant := ps.clone()
+	tolerant.missing = map[string]bool{}
+	tolerant.encryption = nil // Compare the values, not their ciphertexts.
+
+	var b bytes.Buffer
+	if err := tolerant.Hydrate(&b, bytes.NewReader(input), format, k8s); err != nil {
+		return nil, err
+	}
+
+	docs, err := decodeDocuments(&b, format)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	for i, doc := range docs {
+		prefix := ""
+		if len(docs) > 1 {
+			prefix = fmt.Sprintf("#%v ", i)
+		}
+		flatten(fields, prefix, doc)
+	}
+	return fields, nil
+}
+
+func flatten(fields map[string]string, path string, value interface{}) {
+	join := func(key string) string {
+		if path == "" || strings.HasSuffix(path, " ") {
+			return path + key
+		}
+		return path + "." + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			flatten(fields, join(key), value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			flatten(fields, fmt.Sprintf("%v[%v]", path, i), value)
+		}
+	default:
+		fields[path] = fmt.Sprint(v)
+	}
+}
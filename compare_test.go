@@ -0,0 +1,78 @@
+package hydrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	params := map[string]string{
+		"/app/stage/db_pass": "stage-pass",
+		"/app/prod/db_pass":  "prod-pass",
+		"/app/stage/api_key": "k3y",
+		"/app/prod/api_key":  "k3y",
+		"/app/stage/token":   "t0ken",
+		"/shared/user":       "app",
+	}
+
+	tt := []struct {
+		format   string
+		k8s      bool
+		input    string
+		expected []Difference
+	}{
+		{
+			format: "yaml",
+			input:  "db:\n  db_pass: $$\n  user: $SECRET:/shared/user\napi_key: $$\ntoken: $$\n",
+			expected: []Difference{
+				{Field: "db.db_pass", Left: "set", Right: "set"},
+				{Field: "token", Left: "set", Right: "missing"},
+			},
+		},
+		{
+			format: "json",
+			input:  `{"hosts": {"a": {"token": "$SECRET"}, "b": {"api_key": "$SECRET"}}}`,
+			expected: []Difference{
+				{Field: "hosts.a.token", Left: "set", Right: "missing"},
+			},
+		},
+		{
+			format: "yaml",
+			input:  "a: $SECRET:/shared/user\n---\ntoken: $$\n",
+			expected: []Difference{
+				{Field: "#1 token", Left: "set", Right: "missing"},
+			},
+		},
+		{
+			format: "toml",
+			input:  "api_key = \"$$\"\n",
+		},
+	}
+
+	for _, tc := range tt {
+		_, svc := newFakeSSM(t, params)
+		diffs, err := Compare(ParamStore(svc, "/app/stage"), ParamStore(svc, "/app/prod"), strings.NewReader(tc.input), tc.format, tc.k8s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(diffs, tc.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tc.input, tc.expected, diffs)
+		}
+	}
+}
+
+func TestDifference(t *testing.T) {
+	tt := []struct {
+		diff     Difference
+		expected string
+	}{
+		{Difference{Field: "db.pass", Left: "set", Right: "set"}, "db.pass: values differ"},
+		{Difference{Field: "token", Left: "set", Right: "missing"}, "token: set in left, missing in right"},
+	}
+	for _, tc := range tt {
+		if s := tc.diff.String(); s != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, s)
+		}
+	}
+}
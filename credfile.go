@@ -0,0 +1,129 @@
+package hydrate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Credential file formats, hydrated line by line. Only the credential
+// fields are hydrated, everything else (incl. comments) is kept as is.
+var credentialFields = map[string][]string{
+	"npmrc":   {"_authToken", "_auth", "_password", "password"},
+	"pypirc":  {"password", "token"},
+	"pipconf": {"password", "token"},
+	"netrc":   {"password"},
+}
+
+var (
+	iniLineRe      = regexp.MustCompile(`^(\s*)([^=;#\[\s][^=]*?)(\s*=\s*)(.*?)(\s*)$`)
+	netrcPasswdRe  = regexp.MustCompile(`(\bpassword\s+)(\S+)`)
+	credentialLine = map[string]func(ps *paramStore, ctx context.Context, line string, fields []string) (string, error){
+		"npmrc":   (*paramStore).hydrateINILine,
+		"pypirc":  (*paramStore).hydrateINILine,
+		"pipconf": (*paramStore).hydrateINILine,
+		"netrc":   (*paramStore).hydrateNetrcLine,
+	}
+)
+
+func credentialFormat(format string) string {
+	if format == "pip.conf" {
+		return "pipconf"
+	}
+	return strings.TrimPrefix(format, ".")
+}
+
+// hydrateCredentials hydrates .npmrc, .pypirc, .netrc and pip.conf files.
+func (ps *paramStore) hydrateCredentials(ctx context.Context, w io.Writer, r io.Reader, format string) error {
+	format = credentialFormat(format)
+	fields := credentialFields[format]
+	hydrateLine := credentialLine[format]
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line, err := hydrateLine(ps, ctx, scanner.Text(), fields)
+		if err != nil {
+			return errors.Wrapf(err, "failed to hydrate %v line %v", format, n)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "failed to read %v file", format)
+	}
+	return nil
+}
+
+// hydrateINILine hydrates `key = value` lines of INI-like files. For .npmrc
+// scoped keys, ie. `//registry.npmjs.org/:_authToken`, the field name is
+// the part after the last colon.
+func (ps *paramStore) hydrateINILine(ctx context.Context, line string, fields []string) (string, error) {
+	m := iniLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return line, nil
+	}
+	key := m[2]
+	field := key[strings.LastIndex(key, ":")+1:]
+	if !containsString(fields, field) {
+		return line, nil
+	}
+
+	secret, err := ps.hydrateKeyValue(ctx, field, m[4])
+	if err != nil || secret == nil {
+		return line, err
+	}
+	sealed, err := ps.sealLine(field, *secret)
+	if err != nil {
+		return line, err
+	}
+	return m[1] + key + m[3] + sealed + m[5], nil
+}
+
+// hydrateNetrcLine hydrates `password <value>` tokens of .netrc files.
+func (ps *paramStore) hydrateNetrcLine(ctx context.Context, line string, fields []string) (string, error) {
+	var err error
+	line = netrcPasswdRe.ReplaceAllStringFunc(line, func(match string) string {
+		m := netrcPasswdRe.FindStringSubmatch(match)
+		secret, herr := ps.hydrateKeyValue(ctx, "password", m[2])
+		if herr == nil && secret != nil {
+			var sealed string
+			if sealed, herr = ps.sealLine("password", *secret); herr == nil {
+				return m[1] + sealed
+			}
+		}
+		if herr != nil {
+			err = herr
+		}
+		return match
+	})
+	return line, err
+}
+
+// sealLine seals the secret of the field like seal, provided that the
+// ciphertext fits on the line, ie. it isn't ASCII-armored by age.
+func (ps *paramStore) sealLine(field, secret string) (string, error) {
+	sealed, err := ps.seal([]string{field}, secret)
+	if err != nil {
+		return "", err
+	}
+	if sealed != secret && strings.Contains(sealed, "\n") {
+		return "", errors.Errorf("can't encrypt %q field into a single line, use --encrypt-kms-key instead of --encrypt-age", field)
+	}
+	return sealed, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
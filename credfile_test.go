@@ -0,0 +1,61 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHydrateCredentials(t *testing.T) {
+	tt := []struct {
+		format   string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			format:   "npmrc",
+			input:    "registry=https://registry.npmjs.org/\n//registry.npmjs.org/:_authToken = $SECRET:/app/npm_token\n; _auth = $SECRET:/app/npm_token\nemail=$SECRET:/app/npm_token\n",
+			expected: "registry=https://registry.npmjs.org/\n//registry.npmjs.org/:_authToken = t0ken\n; _auth = $SECRET:/app/npm_token\nemail=$SECRET:/app/npm_token\n",
+		},
+		{
+			format:   "pypirc",
+			input:    "[distutils]\nindex-servers = pypi\n\n[pypi]\n  username = __token__\n  password = $$\n",
+			expected: "[distutils]\nindex-servers = pypi\n\n[pypi]\n  username = __token__\n  password = hunter2\n",
+		},
+		{
+			format:   "pip.conf",
+			input:    "[global]\nindex-url = https://pypi.example.com/simple\ntoken=$SECRET:/app/npm_token  \n",
+			expected: "[global]\nindex-url = https://pypi.example.com/simple\ntoken=t0ken  \n",
+		},
+		{
+			format:   "netrc",
+			input:    "machine a.example.com login app password $SECRET:/app/password\n# machine b.example.com\nmachine b.example.com\n  login ci\n  password $SECRET:/app/npm_token\n",
+			expected: "machine a.example.com login app password hunter2\n# machine b.example.com\nmachine b.example.com\n  login ci\n  password t0ken\n",
+		},
+		{
+			format: "netrc",
+			input:  "machine a\nmachine b login app password $SECRET:/app/missing\n",
+			err:    "failed to hydrate netrc line 2",
+		},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/password": "hunter2", "/app/npm_token": "t0ken"})
+
+		var b bytes.Buffer
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), tc.format, false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.format, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected:\n%s\ngot:\n%s", tc.format, tc.expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package hydrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// directiveRe matches references whose fetched value is encoded by output
+// directives, ie. "$SECRET:/app/userdata|gzip|base64". The directives go
+// after any default, which is encoded too.
+var directiveRe = regexp.MustCompile(`^(\$\$|\$[A-Z]+\??(?::.*?)?)((?:\|(?:gzip|base64))+)$`)
+
+// hydrateDirectives hydrates the value, if it's a reference with output
+// directives, and encodes the hydrated secret by each directive in turn.
+// It returns nil for other values. Dry runs, redactions and references kept
+// as they are, see SetMissing, aren't encoded.
+func (ps *paramStore) hydrateDirectives(ctx context.Context, key, value string) (*string, error) {
+	m := directiveRe.FindStringSubmatch(value)
+	if m == nil {
+		return nil, nil
+	}
+	ref, directives := m[1], strings.Split(m[2][1:], "|")
+	if directives[len(directives)-1] == "gzip" {
+		return nil, errors.Errorf("%v=%q: |gzip must be followed by |base64, compressed values aren't valid text", key, value)
+	}
+
+	secret, err := ps.hydrateKeyValue(ctx, key, ref)
+	if err != nil || secret == nil {
+		return secret, err
+	}
+	if *secret == ref {
+		return &value, nil
+	}
+	if ps.refs != nil || ps.redaction != RedactNone {
+		return secret, nil
+	}
+
+	encoded := *secret
+	for _, directive := range directives {
+		if encoded, err = encodeDirective(directive, encoded); err != nil {
+			return nil, errors.Wrapf(err, "%v=%q", key, value)
+		}
+	}
+	return &encoded, nil
+}
+
+func encodeDirective(directive, value string) (string, error) {
+	switch directive {
+	case "gzip":
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write([]byte(value)); err != nil {
+			return "", errors.Wrap(err, "failed to gzip")
+		}
+		if err := zw.Close(); err != nil {
+			return "", errors.Wrap(err, "failed to gzip")
+		}
+		return b.String(), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	}
+	return "", errors.Errorf("unknown directive |%v", directive)
+}
@@ -0,0 +1,93 @@
+package hydrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestHydrateDirectives(t *testing.T) {
+	params := map[string]string{
+		"/app/key":  "k3y",
+		"/app/blob": strings.Repeat("#!/bin/sh\necho hello\n", 100),
+	}
+	tt := []struct {
+		name     string
+		value    string
+		missing  Missing
+		expected string
+		gunzip   bool
+		err      string
+	}{
+		{name: "base64", value: "$SECRET:/app/key|base64", expected: "azN5"},
+		{name: "gzip base64", value: "$SECRET:/app/blob|gzip|base64", expected: params["/app/blob"], gunzip: true},
+		{name: "shorthand", value: "$$|base64", expected: "azN5"},
+		{name: "twice", value: "$SECRET:/app/key|base64|base64", expected: "YXpONQ=="},
+		{name: "default", value: "$SECRET:/app/missing|fallback|base64", expected: "ZmFsbGJhY2s="},
+		{name: "optional", value: "$SECRET?:/app/missing|base64", expected: ""},
+		{name: "inline", value: "Basic ${SECRET:/app/key|base64}", expected: "Basic azN5"},
+		{name: "kept", value: "$SECRET:/app/missing|gzip|base64", missing: MissingKeep, expected: "$SECRET:/app/missing|gzip|base64"},
+		{name: "missing", value: "$SECRET:/app/missing|gzip|base64", err: `"/app/missing"`},
+		{name: "trailing gzip", value: "$SECRET:/app/blob|gzip", err: "|gzip must be followed by |base64"},
+		{name: "no directive", value: "$SECRET:/app/key|gzipped", expected: "k3y"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := testStore(t, params)
+			ps.SetMissing(tc.missing)
+			secret, err := ps.hydrateKeyValue(context.Background(), "key", tc.value)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret == nil {
+				t.Fatal("expected a hydrated value, got nil")
+			}
+			value := *secret
+			if tc.gunzip {
+				value = gunzipBase64(t, value)
+			}
+			if value != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestHydrateDirectivesRedacted(t *testing.T) {
+	ps := testStore(t, map[string]string{"/app/key": "k3y"})
+	ps.SetRedaction(RedactRef)
+	secret, err := ps.hydrateKeyValue(context.Background(), "key", "$SECRET:/app/key|gzip|base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || strings.Contains(*secret, "k3y") || *secret == "azN5" {
+		t.Errorf("expected a redacted, unencoded value, got %v", secret)
+	}
+}
+
+func gunzipBase64(t *testing.T, value string) string {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(plain)
+}
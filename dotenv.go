@@ -0,0 +1,245 @@
+package hydrate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var dotenvLineRe = regexp.MustCompile(`^(\s*(?:export\s+)?)([A-Za-z_][A-Za-z0-9_.]*)(\s*=\s*)(.*)$`)
+
+// dotenvValue is a parsed dotenv value. Unquoted values end at the
+// first " #" comment, which is kept in the suffix.
+type dotenvValue struct {
+	value  string
+	quote  byte // '"', '\'' or 0.
+	suffix string
+}
+
+func parseDotenvValue(s string) (dotenvValue, error) {
+	if s == "" {
+		return dotenvValue{}, nil
+	}
+
+	switch s[0] {
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return dotenvValue{}, errors.New("unterminated single-quoted value")
+		}
+		return dotenvValue{value: s[1 : end+1], quote: '\'', suffix: s[end+2:]}, nil
+
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(s[i])
+				}
+			case c == '"':
+				return dotenvValue{value: b.String(), quote: '"', suffix: s[i+1:]}, nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return dotenvValue{}, errors.New("unterminated double-quoted value")
+	}
+
+	value, suffix := s, ""
+	if i := strings.Index(s, " #"); i >= 0 {
+		value, suffix = s[:i], s[i:]
+	}
+	trimmed := strings.TrimRight(value, " \t")
+	return dotenvValue{value: trimmed, suffix: value[len(trimmed):] + suffix}, nil
+}
+
+var dotenvSafeRe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// quoteDotenv quotes the value, if needed. Single quotes are preferred,
+// since their content is never expanded by dotenv parsers nor shells.
+func quoteDotenv(value string, quote byte) string {
+	if quote == 0 && dotenvSafeRe.MatchString(value) {
+		return value
+	}
+	if quote != '"' && !strings.ContainsAny(value, "'\r\n") {
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(value) + `"`
+}
+
+// quoteShell quotes the value for POSIX shells, if needed, ie. for eval or
+// source. Single-quoted values are taken byte for byte, including newlines
+// and non-ASCII bytes, so only single quotes themselves need escaping.
+func quoteShell(value string) string {
+	if value != "" && dotenvSafeRe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+var shellNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// hydrateDotenv hydrates .env files line by line, keeping comments,
+// blank lines and the order of variables.
+func (ps *paramStore) hydrateDotenv(ctx context.Context, w io.Writer, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line, err := ps.hydrateDotenvLine(ctx, scanner.Text())
+		if err != nil {
+			return errors.Wrapf(err, "failed to hydrate env line %v", n)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read env file")
+	}
+	return nil
+}
+
+func (ps *paramStore) hydrateDotenvLine(ctx context.Context, line string) (string, error) {
+	m := dotenvLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return line, nil // Blank line or comment.
+	}
+	key := m[2]
+
+	v, err := parseDotenvValue(m[4])
+	if err != nil {
+		return "", errors.Wrapf(err, "%v", key)
+	}
+	secret, err := ps.hydrateKeyValue(ctx, key, ps.pin([]string{key}, v.value))
+	if err != nil || secret == nil {
+		return line, err
+	}
+	sealed, err := ps.seal([]string{key}, *secret)
+	if err != nil {
+		return "", err
+	}
+	return m[1] + key + m[3] + quoteDotenv(sealed, v.quote) + v.suffix, nil
+}
+
+// decodeDotenv decodes .env files into a flat map of strings.
+func decodeDotenv(r io.Reader) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		m := dotenvLineRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		v, err := parseDotenvValue(m[4])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode env line %v", n)
+		}
+		data[m[2]] = v.value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read env file")
+	}
+	return data, nil
+}
+
+// encodeDotenv writes flat documents as KEY=VALUE lines, sorted by key.
+func encodeDotenv(w io.Writer, docs []map[string]interface{}) error {
+	return encodeEnv(w, docs, func(key, value string) (string, error) {
+		return key + "=" + quoteDotenv(value, 0) + "\n", nil
+	})
+}
+
+// encodeEnvExport writes flat documents as `export KEY='VALUE'` lines for
+// eval or source, sorted by key.
+func encodeEnvExport(w io.Writer, docs []map[string]interface{}) error {
+	return encodeEnv(w, docs, func(key, value string) (string, error) {
+		if !shellNameRe.MatchString(key) {
+			return "", errors.Errorf("%q: env-export output expects shell variable names", key)
+		}
+		if strings.IndexByte(value, 0) >= 0 {
+			return "", errors.Errorf("%q: env vars can't contain NUL bytes", key)
+		}
+		return "export " + key + "=" + quoteShell(value) + "\n", nil
+	})
+}
+
+// encodeEnvNull writes flat documents as unquoted KEY=VALUE entries, each
+// terminated by a NUL byte like /proc/<pid>/environ, ie. for xargs -0 or
+// env -0. Values may contain newlines and quotes as they are.
+func encodeEnvNull(w io.Writer, docs []map[string]interface{}) error {
+	return encodeEnv(w, docs, func(key, value string) (string, error) {
+		if strings.ContainsAny(key, "=\x00") || strings.IndexByte(value, 0) >= 0 {
+			return "", errors.Errorf("%q: env vars can't contain NUL bytes, nor names \"=\"", key)
+		}
+		return key + "=" + value + "\x00", nil
+	})
+}
+
+// EncodeEnv writes the KEY=VALUE environment variables, ie. of os.Environ,
+// in the env, env-export or env-null output format.
+func EncodeEnv(w io.Writer, env []string, format string) error {
+	switch format {
+	case "env", "env-export", "env-null":
+	default:
+		return errors.Errorf("unknown env format %q, expected env, env-export or env-null", format)
+	}
+	enc, err := lookupEncoder(format)
+	if err != nil {
+		return err
+	}
+	doc := make(map[string]interface{}, len(env))
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i > 0 {
+			doc[kv[:i]] = kv[i+1:]
+		}
+	}
+	return enc(w, []map[string]interface{}{doc})
+}
+
+// encodeEnv writes the entries of flat documents, sorted by key.
+func encodeEnv(w io.Writer, docs []map[string]interface{}, entry func(key, value string) (string, error)) error {
+	for _, doc := range docs {
+		keys := make([]string, 0, len(doc))
+		for key := range doc {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			var s string
+			switch value := doc[key].(type) {
+			case map[string]interface{}, []interface{}:
+				return errors.Errorf("%q: env output supports only scalar values, got %T", key, value)
+			case nil:
+			default:
+				s = fmt.Sprint(value)
+			}
+			line, err := entry(key, s)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHydrateDotenv(t *testing.T) {
+	secrets := map[string]string{
+		"/app/plain":   "s3cr3t",
+		"/app/spaces":  "two words",
+		"/app/quote":   "it's",
+		"/app/newline": "a\nb",
+		"/app/shell":   "$HOME `id`",
+	}
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{"A=$SECRET:/app/plain", "A=s3cr3t"},
+		{"export A = $SECRET:/app/plain", "export A = s3cr3t"},
+		{"A=$SECRET:/app/plain # Comment.", "A=s3cr3t # Comment."},
+		{"A=$SECRET:/app/spaces", "A='two words'"},
+		{"A=$SECRET:/app/quote", `A="it's"`},
+		{"A=$SECRET:/app/newline", `A="a\nb"`},
+		{"A=$SECRET:/app/shell", "A='$HOME `id`'"},
+		{`A="$SECRET:/app/shell"`, `A="\$HOME \` + "`id\\`" + `"`},
+		{"A='$SECRET:/app/plain' # Quoted.", "A='s3cr3t' # Quoted."},
+		{"A=unchanged value", "A=unchanged value"},
+		{"# A=$SECRET:/app/plain", "# A=$SECRET:/app/plain"},
+		{"", ""},
+	}
+
+	for _, tc := range tt {
+		var output bytes.Buffer
+		if err := testStore(t, secrets).Hydrate(&output, strings.NewReader(tc.input), "env", false); err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+			continue
+		}
+		if got := strings.TrimSuffix(output.String(), "\n"); got != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, got)
+		}
+	}
+}
+
+func TestParseDotenvValue(t *testing.T) {
+	tt := []struct {
+		input string
+		value dotenvValue
+		err   bool
+	}{
+		{input: "", value: dotenvValue{}},
+		{input: "plain  # Comment.", value: dotenvValue{value: "plain", suffix: "  # Comment."}},
+		{input: "a#b", value: dotenvValue{value: "a#b"}},
+		{input: `'single \n' # C`, value: dotenvValue{value: `single \n`, quote: '\'', suffix: " # C"}},
+		{input: `"double \n \"x\" \\"`, value: dotenvValue{value: "double \n \"x\" \\", quote: '"'}},
+		{input: `'unterminated`, err: true},
+		{input: `"unterminated`, err: true},
+	}
+	for _, tc := range tt {
+		value, err := parseDotenvValue(tc.input)
+		if tc.err != (err != nil) {
+			t.Errorf("%q: expected error %v, got %v", tc.input, tc.err, err)
+			continue
+		}
+		if value != tc.value {
+			t.Errorf("%q: expected %+v, got %+v", tc.input, tc.value, value)
+		}
+	}
+}
+
+func TestDotenvFormat(t *testing.T) {
+	tt := []struct {
+		input        string
+		format       string
+		outputFormat string
+		expected     string
+		err          string
+	}{
+		{input: "B='two words'\nA=$SECRET:/app/plain # Comment.\n", format: "env", outputFormat: "json", expected: `{"A":"s3cr3t","B":"two words"}` + "\n"},
+		{input: "b: two words\na: $SECRET:/app/plain\nn: 1\nempty: null\n", format: "yaml", outputFormat: "env", expected: "a=s3cr3t\nb='two words'\nempty=\nn=1\n"},
+		{input: "a:\n  b: c\n", format: "yaml", outputFormat: "env", err: `"a": env output supports only scalar values`},
+		{input: "A=x\nB='unterminated\n", format: "env", outputFormat: "json", err: "failed to decode env line 2"},
+	}
+	for _, tc := range tt {
+		var output bytes.Buffer
+		err := testStore(t, map[string]string{"/app/plain": "s3cr3t"}).HydrateFormat(&output, strings.NewReader(tc.input), tc.format, tc.outputFormat, false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+			continue
+		}
+		if output.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, output.String())
+		}
+	}
+}
+
+func TestEncodeEnv(t *testing.T) {
+	env := []string{"B=two words", "A=it's", "EMPTY="}
+	tt := []struct {
+		format   string
+		env      []string
+		expected string
+		err      bool
+	}{
+		{format: "env", env: env, expected: "A=\"it's\"\nB='two words'\nEMPTY=\n"},
+		{format: "env-export", env: env, expected: "export A='it'\\''s'\nexport B='two words'\nexport EMPTY=''\n"},
+		{format: "env-null", env: env, expected: "A=it's\x00B=two words\x00EMPTY=\x00"},
+		{format: "env-export", env: []string{"NOT.SHELL=x"}, err: true},
+		{format: "env-null", env: []string{"A=\x00"}, err: true},
+		{format: "yaml", env: env, err: true},
+	}
+	for _, tc := range tt {
+		var output bytes.Buffer
+		err := EncodeEnv(&output, tc.env, tc.format)
+		if tc.err != (err != nil) {
+			t.Errorf("%v %q: expected error %v, got %v", tc.format, tc.env, tc.err, err)
+			continue
+		}
+		if !tc.err && output.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.format, tc.expected, output.String())
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package hydrate
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Empty controls how null and empty string values are hydrated, see
+// SetEmpty.
+type Empty int
+
+const (
+	EmptySkip    Empty = iota // Keep them as they are, the default.
+	EmptyHydrate              // Hydrate them like "$$" values.
+	EmptyError                // Fail the hydration.
+)
+
+// ParseEmpty parses "skip", "hydrate" or "error", ie. of an --empty flag.
+func ParseEmpty(s string) (Empty, error) {
+	switch s {
+	case "skip":
+		return EmptySkip, nil
+	case "hydrate":
+		return EmptyHydrate, nil
+	case "error":
+		return EmptyError, nil
+	}
+	return EmptySkip, errors.Errorf("unknown empty mode %q, expected skip, hydrate or error", s)
+}
+
+// SetEmpty sets how null and empty string values are hydrated. Some teams
+// leave values empty to mean "fill from the Parameter Store", which
+// EmptyHydrate fetches the parameter of the field's key for, like "$$".
+// Others leave them intentionally blank, which EmptySkip keeps, and
+// EmptyError catches values left empty by mistake.
+func (ps *paramStore) SetEmpty(e Empty) {
+	ps.emptyMode = e
+}
+
+// hydrateEmpty hydrates the null or empty value of the key according to
+// the SetEmpty mode. It returns nil for values kept as they are.
+func (ps *paramStore) hydrateEmpty(ctx context.Context, key string) (*string, error) {
+	if key == "" {
+		return nil, nil // Not a field, ie. of Lookup.
+	}
+	switch ps.emptyMode {
+	case EmptyHydrate:
+		secret, err := ps.hydrateKeyValue(ctx, key, "$$")
+		if err != nil || secret == nil || *secret == "$$" {
+			return nil, err // Kept as is, see SetMissing.
+		}
+		return secret, nil
+	case EmptyError:
+		return nil, errors.Errorf("%v is empty", key)
+	}
+	return nil, nil
+}
@@ -0,0 +1,72 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseEmpty(t *testing.T) {
+	for s, expected := range map[string]Empty{"skip": EmptySkip, "hydrate": EmptyHydrate, "error": EmptyError} {
+		if e, err := ParseEmpty(s); err != nil || e != expected {
+			t.Errorf("%v: expected %v, got %v, %v", s, expected, e, err)
+		}
+	}
+	if _, err := ParseEmpty("fill"); err == nil || !strings.Contains(err.Error(), `unknown empty mode "fill"`) {
+		t.Errorf("expected an unknown mode error, got %v", err)
+	}
+}
+
+func TestHydrateEmpty(t *testing.T) {
+	params := map[string]string{
+		"/app/db_pass": "hunter2",
+		"/app/api_key": "k3y",
+		"/app/DB_PASS": "hunter2",
+	}
+	tt := []struct {
+		name     string
+		mode     Empty
+		format   string
+		k8s      bool
+		input    string
+		expected string
+		err      string
+	}{
+		{name: "skip yaml", format: "yaml", input: "db_pass: ~\napi_key: \"\"\n", expected: "db_pass: ~\napi_key: \"\"\n"},
+		{name: "hydrate yaml", mode: EmptyHydrate, format: "yaml", input: "db_pass: ~\napi_key: \"\"\nport:\n", expected: "db_pass: hunter2\napi_key: \"k3y\"\nport:\n"},
+		{name: "hydrate json", mode: EmptyHydrate, format: "json", input: `{"db_pass": null, "api_key": ""}`, expected: `{"db_pass": "hunter2", "api_key": "k3y"}` + "\n"},
+		{name: "hydrate env", mode: EmptyHydrate, format: "env", input: "DB_PASS=\n", expected: "DB_PASS=hunter2\n"},
+		{
+			name:     "hydrate k8s",
+			mode:     EmptyHydrate,
+			format:   "yaml",
+			k8s:      true,
+			input:    "kind: Secret\nmetadata:\n  name: app\nstringData:\n  db_pass: ~\n",
+			expected: "kind: Secret\nmetadata:\n    name: app\nstringData:\n    db_pass: hunter2\n",
+		},
+		{name: "error yaml", mode: EmptyError, format: "yaml", input: "db:\n  pass: ~\n", err: `failed to hydrate "db.pass" field: pass is empty`},
+		{name: "error json", mode: EmptyError, format: "json", input: `{"db": {"pass": ""}}`, err: "pass is empty"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := testStore(t, params)
+			ps.SetEmpty(tc.mode)
+			ps.SetMissing(MissingKeep)
+			var b bytes.Buffer
+			err := ps.Hydrate(&b, strings.NewReader(tc.input), tc.format, tc.k8s)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b.String())
+			}
+		})
+	}
+}
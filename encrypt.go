@@ -0,0 +1,229 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pkg/errors"
+)
+
+// FieldCipher encrypts individual hydrated values, see EncryptFields.
+type FieldCipher interface {
+	// Encrypt returns the ciphertext of a hydrated value as a string
+	// that can be embedded into the output document.
+	Encrypt(plaintext string) (string, error)
+
+	// Manifest describes how to decrypt the ciphertexts.
+	Manifest() map[string]interface{}
+}
+
+type fieldEncryption struct {
+	patterns []string
+	cipher   FieldCipher
+	fields   map[string]bool
+}
+
+// EncryptFields makes all subsequent hydrations emit ciphertexts instead of
+// plaintext secrets for the fields matching any of the patterns, ie.
+// "database.password" or "api.*". Fields are dot-separated paths and
+// each "*" matches a single path segment.
+func (ps *paramStore) EncryptFields(patterns []string, cipher FieldCipher) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(fieldToSlash(pattern), ""); err != nil {
+			return errors.Wrapf(err, "invalid field pattern %q", pattern)
+		}
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.encryption = &fieldEncryption{
+		patterns: patterns,
+		cipher:   cipher,
+		fields:   map[string]bool{},
+	}
+	return nil
+}
+
+// EncryptionManifest describes the encrypted fields and how to decrypt them.
+type EncryptionManifest struct {
+	Fields []string               `json:"fields"`
+	Cipher map[string]interface{} `json:"cipher"`
+}
+
+// Write encodes the manifest as a JSON document.
+func (m *EncryptionManifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// EncryptionManifest returns the manifest of the fields encrypted so far,
+// or nil if EncryptFields wasn't called.
+func (ps *paramStore) EncryptionManifest() *EncryptionManifest {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.encryption == nil {
+		return nil
+	}
+	m := &EncryptionManifest{
+		Fields: []string{},
+		Cipher: ps.encryption.cipher.Manifest(),
+	}
+	for field := range ps.encryption.fields {
+		m.Fields = append(m.Fields, field)
+	}
+	sort.Strings(m.Fields)
+	return m
+}
+
+// seal encrypts the hydrated secret of the field, if the field matches
+// any of the EncryptFields patterns.
+func (ps *paramStore) seal(field []string, secret string) (string, error) {
+	if ps.refs != nil {
+		ps.recordField(strings.Join(field, "."))
+		return secret, nil
+	}
+	if ps.encryption == nil {
+		return secret, nil
+	}
+
+	name := strings.Join(field, ".")
+	for _, pattern := range ps.encryption.patterns {
+		if ok, _ := path.Match(fieldToSlash(pattern), fieldToSlash(name)); !ok {
+			continue
+		}
+
+		ciphertext, err := ps.encryption.cipher.Encrypt(secret)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to encrypt %q field", name)
+		}
+
+		ps.mu.Lock()
+		ps.encryption.fields[name] = true
+		ps.mu.Unlock()
+
+		return ciphertext, nil
+	}
+	return secret, nil
+}
+
+func fieldToSlash(field string) string {
+	return strings.Replace(field, ".", "/", -1)
+}
+
+type kmsCipher struct {
+	keyID        string
+	encryptedKey []byte
+	aead         cipher.AEAD
+}
+
+// KMSCipher encrypts values with AES-256-GCM using a data key generated
+// by the KMS key keyID. The encrypted data key is part of the manifest,
+// so that the values can be decrypted with kms:Decrypt permission only.
+func KMSCipher(svc *kms.Client, keyID string) (FieldCipher, error) {
+	out, err := svc.GenerateDataKey(context.Background(), &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate data key with KMS key %q", keyID)
+	}
+
+	block, err := aes.NewCipher(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsCipher{
+		keyID:        aws.ToString(out.KeyId),
+		encryptedKey: out.CiphertextBlob,
+		aead:         aead,
+	}, nil
+}
+
+// Encrypt returns ENC[AES256_GCM,<base64 of nonce and ciphertext>].
+func (c *kmsCipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return "ENC[AES256_GCM," + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+func (c *kmsCipher) Manifest() map[string]interface{} {
+	return map[string]interface{}{
+		"type":               "kms",
+		"algorithm":          "AES256_GCM",
+		"kms_key_id":         c.keyID,
+		"encrypted_data_key": base64.StdEncoding.EncodeToString(c.encryptedKey),
+	}
+}
+
+type ageCipher struct {
+	recipients []string
+	parsed     []age.Recipient
+}
+
+// AgeCipher encrypts values to the given age X25519 recipients (age1...).
+func AgeCipher(recipients ...string) (FieldCipher, error) {
+	c := &ageCipher{recipients: recipients}
+	for _, r := range recipients {
+		parsed, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid age recipient %q", r)
+		}
+		c.parsed = append(c.parsed, parsed)
+	}
+	if len(c.parsed) == 0 {
+		return nil, errors.New("at least one age recipient must be provided")
+	}
+	return c, nil
+}
+
+// Encrypt returns the ASCII-armored age ciphertext.
+func (c *ageCipher) Encrypt(plaintext string) (string, error) {
+	var b bytes.Buffer
+	a := armor.NewWriter(&b)
+	w, err := age.Encrypt(a, c.parsed...)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := a.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (c *ageCipher) Manifest() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "age",
+		"recipients": c.recipients,
+	}
+}
@@ -0,0 +1,208 @@
+package hydrate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// testCipher "encrypts" values as ENC[<plaintext>], or as armored
+// multi-line blocks like age.
+type testCipher struct {
+	armored bool
+}
+
+func (c testCipher) Encrypt(plaintext string) (string, error) {
+	if c.armored {
+		return "-----BEGIN-----\n" + plaintext + "\n-----END-----\n", nil
+	}
+	return "ENC[" + plaintext + "]", nil
+}
+
+func (c testCipher) Manifest() map[string]interface{} {
+	return map[string]interface{}{"type": "test"}
+}
+
+func TestEncryptFields(t *testing.T) {
+	tt := []struct {
+		format   string
+		k8s      bool
+		patterns []string
+		armored  bool
+		input    string
+		expected string
+		fields   []string
+		err      string
+	}{
+		{
+			format:   "yaml",
+			patterns: []string{"database.password"},
+			input:    "database:\n  user: $SECRET:/app/user\n  password: $SECRET:/app/db_pass\n",
+			expected: "database:\n    user: app\n    password: ENC[hunter2]\n",
+			fields:   []string{"database.password"},
+		},
+		{
+			format:   "json",
+			patterns: []string{"api.*"},
+			input:    `{"api": {"key": "$SECRET:/app/api_key", "user": "$SECRET:/app/user"}, "user": "$SECRET:/app/user"}`,
+			expected: `{"api": {"key": "ENC[k3y]", "user": "ENC[app]"}, "user": "app"}` + "\n",
+			fields:   []string{"api.key", "api.user"},
+		},
+		{
+			format:   "toml",
+			patterns: []string{"*"},
+			input:    "user = \"$SECRET:/app/user\"\n\n[db]\npass = \"$SECRET:/app/db_pass\"\n",
+			expected: "user = \"ENC[app]\"\n\n[db]\npass = \"hunter2\"\n",
+			fields:   []string{"user"},
+		},
+		{
+			format:   "yaml",
+			k8s:      true,
+			patterns: []string{"stringData.db_pass"},
+			input:    "kind: Secret\nmetadata:\n  name: app\nstringData:\n  db_pass: $SECRET:/app/db_pass\n  user: $SECRET:/app/user\n",
+			expected: "kind: Secret\nmetadata:\n    name: app\nstringData:\n    db_pass: ENC[hunter2]\n    user: app\n",
+			fields:   []string{"stringData.db_pass"},
+		},
+		{
+			format:   "yaml",
+			patterns: []string{"nothing"},
+			input:    "user: $SECRET:/app/user\n",
+			expected: "user: app\n",
+			fields:   []string{},
+		},
+		{
+			format:   "npmrc",
+			patterns: []string{"_authToken"},
+			input:    "//registry.npmjs.org/:_authToken=$SECRET:/app/api_key\n",
+			expected: "//registry.npmjs.org/:_authToken=ENC[k3y]\n",
+			fields:   []string{"_authToken"},
+		},
+		{
+			format:   "pypirc",
+			patterns: []string{"password"},
+			input:    "[pypi]\nusername = app\npassword = $SECRET:/app/db_pass\n",
+			expected: "[pypi]\nusername = app\npassword = ENC[hunter2]\n",
+			fields:   []string{"password"},
+		},
+		{
+			format:   "netrc",
+			patterns: []string{"password"},
+			input:    "machine example.com login app password $SECRET:/app/db_pass\n",
+			expected: "machine example.com login app password ENC[hunter2]\n",
+			fields:   []string{"password"},
+		},
+		{
+			format:   "env",
+			patterns: []string{"DB_PASS"},
+			input:    "# Database.\nDB_PASS=$SECRET:/app/db_pass\nUSER=$SECRET:/app/user\n",
+			expected: "# Database.\nDB_PASS='ENC[hunter2]'\nUSER=app\n",
+			fields:   []string{"DB_PASS"},
+		},
+		{
+			format:   "tmpl",
+			patterns: []string{"db_pass"},
+			input:    "DB_PASS={{ secret \"db_pass\" }}\nUSER={{ secret \"user\" }}\n",
+			expected: "DB_PASS=ENC[hunter2]\nUSER=app\n",
+			fields:   []string{"db_pass"},
+		},
+		{
+			format:   "netrc",
+			patterns: []string{"password"},
+			armored:  true,
+			input:    "machine example.com login app password $SECRET:/app/db_pass\n",
+			err:      `can't encrypt "password" field into a single line`,
+		},
+		{
+			format:   "pipconf",
+			patterns: []string{"password"},
+			armored:  true,
+			input:    "[global]\npassword = $SECRET:/app/db_pass\n",
+			err:      `can't encrypt "password" field into a single line`,
+		},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/db_pass": "hunter2", "/app/api_key": "k3y", "/app/user": "app"})
+		if err := ps.EncryptFields(tc.patterns, testCipher{armored: tc.armored}); err != nil {
+			t.Fatal(err)
+		}
+
+		var output bytes.Buffer
+		err := ps.Hydrate(&output, strings.NewReader(tc.input), tc.format, tc.k8s)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.format, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != tc.expected {
+			t.Errorf("%v: expected:\n%s\ngot:\n%s", tc.format, tc.expected, output.String())
+		}
+
+		m := ps.EncryptionManifest()
+		expected := &EncryptionManifest{Fields: tc.fields, Cipher: map[string]interface{}{"type": "test"}}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("%v: expected manifest %+v, got %+v", tc.format, expected, m)
+		}
+	}
+}
+
+func TestEncryptFieldsErrors(t *testing.T) {
+	ps := testStore(t, map[string]string{})
+	if m := ps.EncryptionManifest(); m != nil {
+		t.Errorf("expected no manifest, got %+v", m)
+	}
+	if err := ps.EncryptFields([]string{"["}, testCipher{}); err == nil || !strings.Contains(err.Error(), `invalid field pattern "["`) {
+		t.Errorf("expected invalid pattern error, got %v", err)
+	}
+
+	for _, recipients := range [][]string{nil, {"age1invalid"}} {
+		if _, err := AgeCipher(recipients...); err == nil {
+			t.Errorf("%q: expected error", recipients)
+		}
+	}
+}
+
+func TestAgeCipher(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := AgeCipher(identity.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := c.Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ciphertext, armor.Header) {
+		t.Fatalf("expected armored ciphertext, got %q", ciphertext)
+	}
+
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(ciphertext)), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "hunter2" {
+		t.Errorf("expected %q, got %q", "hunter2", plaintext)
+	}
+
+	expected := map[string]interface{}{"type": "age", "recipients": []string{identity.Recipient().String()}}
+	if m := c.Manifest(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected manifest %v, got %v", expected, m)
+	}
+}
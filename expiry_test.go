@@ -0,0 +1,44 @@
+package hydrate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpires(t *testing.T) {
+	testPlugin(t)
+	srv, _ := newFakeVault(t, map[string]string{
+		"database/creds/app": `{"lease_duration": 3600, "data": {"username": "v-app", "password": "p4ss"}}`,
+		"kv/app":             `{"data": {"key": "k3y"}}`,
+	})
+	sts := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tt := []struct {
+		input   string
+		expires func(time.Time) bool
+	}{
+		{input: "a: $SECRET:/app/db_pass\nb: $VAULT:kv/app#key\nc: $PLUGIN:test:db\n", expires: time.Time.IsZero},
+		{input: "a: $PLUGIN:test:sts\n", expires: sts.Equal},
+		{input: "a: $VAULT:database/creds/app#password\n", expires: func(expires time.Time) bool {
+			return expires.After(time.Now().Add(59*time.Minute)) && expires.Before(time.Now().Add(61*time.Minute))
+		}},
+		// The earliest expiry wins.
+		{input: "a: $PLUGIN:test:sts\nb: $VAULT:database/creds/app#password\n", expires: func(expires time.Time) bool {
+			return expires.Before(sts)
+		}},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/db_pass": "hunter2"})
+		ps.SetBackend("VAULT", VaultProvider(VaultConfig{Address: srv.URL, Token: "token"}))
+
+		var b strings.Builder
+		if err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false); err != nil {
+			t.Fatal(err)
+		}
+		if expires := ps.Expires(); !tc.expires(expires) {
+			t.Errorf("%q: unexpected expiry %v", tc.input, expires)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OutputFunc receives the hydrated contents of a single file, identified
+// by its slash-separated path within the walked file system.
+type OutputFunc func(name string, data []byte) error
+
+// FS walks fsys (ie. embed.FS or os.DirFS), hydrates all files matching glob
+// and passes the results to out. The file format is inferred from the file
+// extension. Glob patterns without a slash are matched against the file's
+// base name, others against the whole path; an empty glob matches all files.
+// "$INCLUDE:" paths are resolved within fsys.
+func (ps *paramStore) FS(ctx context.Context, fsys fs.FS, glob string, out OutputFunc) error {
+	if _, err := path.Match(glob, ""); err != nil {
+		return errors.Wrapf(err, "invalid glob pattern %q", glob)
+	}
+
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || !matchGlob(glob, name) {
+			return nil
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %q", name)
+		}
+		defer f.Close()
+
+		// Includes are read from fsys too, relative to the file.
+		var b bytes.Buffer
+		format := strings.TrimLeft(path.Ext(name), ".")
+		if err := ps.HydrateContext(withIncludeFS(ctx, fsys, path.Dir(name)), &b, f, format, false); err != nil {
+			return errors.Wrapf(err, "failed to hydrate %q", name)
+		}
+
+		return out(name, b.Bytes())
+	})
+}
+
+func matchGlob(glob, name string) bool {
+	if glob == "" {
+		return true
+	}
+	if !strings.Contains(glob, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(glob, name)
+	return ok
+}
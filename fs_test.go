@@ -0,0 +1,131 @@
+package hydrate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.yml":            {Data: []byte("db_pass: $SECRET:/app/db_pass\n")},
+		"conf/api.json":      {Data: []byte(`{"key": "$SECRET:/app/api_key"}`)},
+		"conf/app.toml":      {Data: []byte("user = \"$SECRET:/app/user\"\n")},
+		"conf/nested/db.yml": {Data: []byte("db_pass: $$\n")},
+		"README.md":          {Data: []byte("# Configs\n")},
+	}
+
+	tt := []struct {
+		glob     string
+		expected map[string]string
+		err      string
+	}{
+		{
+			glob: "*.yml",
+			expected: map[string]string{
+				"app.yml":            "db_pass: hunter2\n",
+				"conf/nested/db.yml": "db_pass: hunter2\n",
+			},
+		},
+		{
+			glob: "conf/*",
+			expected: map[string]string{
+				"conf/api.json": `{"key": "k3y"}` + "\n",
+				"conf/app.toml": "user = \"app\"\n",
+			},
+		},
+		{
+			glob:     "conf/*/*.yml",
+			expected: map[string]string{"conf/nested/db.yml": "db_pass: hunter2\n"},
+		},
+		{glob: "*.txt", expected: map[string]string{}},
+		{glob: "", err: `failed to hydrate "README.md"`},
+		{glob: "[", err: "invalid glob pattern"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.glob, func(t *testing.T) {
+			ps := testStore(t, map[string]string{"/app/db_pass": "hunter2", "/app/api_key": "k3y", "/app/user": "app"})
+
+			output := map[string]string{}
+			err := ps.FS(context.Background(), fsys, tc.glob, func(name string, data []byte) error {
+				output[name] = string(data)
+				return nil
+			})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(output, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestFSCanceled(t *testing.T) {
+	ps := testStore(t, map[string]string{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ps.FS(ctx, fstest.MapFS{"app.yml": {Data: []byte("a: b\n")}}, "", func(name string, data []byte) error {
+		t.Errorf("unexpected output of %v", name)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestFSIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/config.yml":  {Data: []byte("db: $INCLUDE:../common/db.yml\n")},
+		"app/config.json": {Data: []byte(`{"db": "$INCLUDE:../common/db.json", "port": 8080}`)},
+		"app/escape.yml":  {Data: []byte("db: $INCLUDE:../../etc/passwd\n")},
+		"app/cycle.yml":   {Data: []byte("self: $INCLUDE:cycle.yml\n")},
+		"common/db.yml":   {Data: []byte("password: $SECRET:/app/db_pass\n")},
+		"common/db.json":  {Data: []byte(`{"password": "$SECRET:/app/db_pass"}`)},
+	}
+
+	tt := []struct {
+		glob     string
+		expected string
+		err      string
+	}{
+		{glob: "config.yml", expected: "db:\n    password: hunter2\n"},
+		{glob: "config.json", expected: `{"db": {"password":"hunter2"}, "port": 8080}` + "\n"},
+		{glob: "escape.yml", err: "outside of the hydrated file system"},
+		{glob: "cycle.yml", err: "cycle"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.glob, func(t *testing.T) {
+			ps := testStore(t, map[string]string{"/app/db_pass": "hunter2"})
+
+			var output strings.Builder
+			err := ps.FS(context.Background(), fsys, tc.glob, func(name string, data []byte) error {
+				output.Write(data)
+				return nil
+			})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, output.String())
+			}
+		})
+	}
+}
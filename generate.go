@@ -0,0 +1,128 @@
+package hydrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var generatorRe = regexp.MustCompile(`^(password|alnum|hex|base64)\((\d+)\)$`)
+
+const (
+	alnumChars    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	passwordChars = alnumChars + "!#%*+-.:=?@^_~"
+)
+
+// EnableGenerate allows "$GENERATE:password(32)" values, which generate
+// a random value and store it via the provider (see SecretWriter), unless
+// the secret already exists. Supported generators are password(n),
+// alnum(n), hex(n) and base64(n), where n is the length of password and
+// alnum values, and the number of random bytes of hex and base64 values.
+func (ps *paramStore) EnableGenerate() {
+	ps.generate = true
+}
+
+// generateSecret returns the existing value of the key secret, or
+// generates a new one and stores it via the provider. Both are fetched
+// and stored like any other secret, within the rate limit and budget.
+func (ps *paramStore) generateSecret(ctx context.Context, key, generator string) (string, error) {
+	m := generatorRe.FindStringSubmatch(generator)
+	if m == nil {
+		return "", errors.Errorf("unknown generator %q, expected password(n), alnum(n), hex(n) or base64(n)", generator)
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil || n < 1 || n > 4096 {
+		return "", errors.Errorf("invalid length of %q generator", generator)
+	}
+
+	path, err := ps.paramPath(key)
+	if err != nil {
+		return "", err
+	}
+	if ps.refs != nil {
+		ps.record(path)
+		return "", nil
+	}
+	if ps.redaction != RedactNone {
+		return "<generated:" + path + ">", nil // Never stored by previews.
+	}
+	if !ps.generate {
+		return "", errors.Errorf("%q would write a generated value to %q parameter, enable it with --generate", generator, path)
+	}
+	writer, ok := ps.provider.(SecretWriter)
+	if !ok {
+		return "", errors.Errorf("%q would write a generated value to %q, but the secret provider can't store secrets", generator, path)
+	}
+
+	// Keep the existing value, if any.
+	secret, err := ps.fetch(ctx, ps.provider, ps.secretKey(path), path)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	secret, err = randomValue(m[1], n)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to generate %q value", generator)
+	}
+
+	if err := ps.reserve(path); err != nil {
+		return "", err
+	}
+	err = ps.call(ctx, func() error {
+		return writer.PutSecret(ctx, path, secret)
+	})
+	if err != nil {
+		ps.release(path)
+		// Possibly created concurrently by someone else, use theirs.
+		if existing, gerr := ps.fetch(ctx, ps.provider, ps.secretKey(path), path); gerr == nil {
+			return existing, nil
+		}
+		return "", errors.Wrapf(err, "failed to store generated %q secret", path)
+	}
+	if err := ps.spend(path, secret); err != nil {
+		return "", err
+	}
+
+	ps.secrets.Store(ps.secretKey(path), secret)
+	return secret, nil
+}
+
+func randomValue(generator string, n int) (string, error) {
+	switch generator {
+	case "hex", "base64":
+		b := make([]byte, n)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		if generator == "hex" {
+			return hex.EncodeToString(b), nil
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+
+	case "password", "alnum":
+		chars := alnumChars
+		if generator == "password" {
+			chars = passwordChars
+		}
+		b := make([]byte, n)
+		for i := range b {
+			j, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = chars[j.Int64()]
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("unknown generator %q", generator)
+}
@@ -0,0 +1,98 @@
+package hydrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSecret(t *testing.T) {
+	tt := []struct {
+		generator string
+		key       string
+		expected  *regexp.Regexp
+		err       string
+	}{
+		{generator: "password(32)", key: "existing", expected: regexp.MustCompile(`^kept$`)},
+		{generator: "password(32)", key: "db_pass", expected: regexp.MustCompile(`^[a-zA-Z0-9!#%*+\-.:=?@^_~]{32}$`)},
+		{generator: "alnum(24)", key: "db_pass", expected: regexp.MustCompile(`^[a-zA-Z0-9]{24}$`)},
+		{generator: "hex(16)", key: "db_pass", expected: regexp.MustCompile(`^[0-9a-f]{32}$`)},
+		{generator: "base64(3)", key: "db_pass", expected: regexp.MustCompile(`^[a-zA-Z0-9+/]{4}$`)},
+		{generator: "password(32)", key: "raced", expected: regexp.MustCompile(`^theirs$`)},
+		{generator: "uuid()", key: "db_pass", err: `unknown generator "uuid()"`},
+		{generator: "hex(0)", key: "db_pass", err: `invalid length of "hex(0)" generator`},
+		{generator: "hex(4097)", key: "db_pass", err: `invalid length of "hex(4097)" generator`},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/existing": "kept"})
+		f.races = map[string]string{"/app/raced": "theirs"}
+		provider := SSMProvider(svc)
+		provider.SetKMSKeyID("alias/app")
+		ps := New(provider, "/app")
+		ps.EnableGenerate()
+
+		secret, err := ps.generateSecret(context.Background(), tc.key, tc.generator)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.generator, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tc.expected.MatchString(secret) {
+			t.Errorf("%v: expected %v, got %q", tc.generator, tc.expected, secret)
+		}
+
+		// Cached and stored once.
+		if again, err := ps.generateSecret(context.Background(), tc.key, tc.generator); err != nil || again != secret {
+			t.Errorf("%v: expected %q again, got %q, %v", tc.generator, secret, again, err)
+		}
+		if stored := f.values("/app/" + tc.key); stored[len(stored)-1] != secret {
+			t.Errorf("%v: expected %q to be stored, got %q", tc.generator, secret, stored)
+		}
+		if tc.key == "db_pass" && f.keys["/app/db_pass"] != "alias/app" {
+			t.Errorf("%v: expected the generated secret to be encrypted by alias/app, got %q", tc.generator, f.keys)
+		}
+		if n := f.called("PutParameter"); tc.key == "existing" && n != 0 || tc.key != "existing" && n != 1 {
+			t.Errorf("%v: unexpected %v PutParameter calls", tc.generator, n)
+		}
+		if versions := provider.Lock().Parameters; versions["/app/"+tc.key] != 1 {
+			t.Errorf("%v: expected version 1 in the lock, got %v", tc.generator, versions)
+		}
+	}
+}
+
+func TestGenerateSecretBudget(t *testing.T) {
+	f, svc := newFakeSSM(t, map[string]string{})
+	ps := ParamStore(svc, "/app")
+	ps.EnableGenerate()
+	ps.SetBudget(1, 0)
+
+	if _, err := ps.generateSecret(context.Background(), "a", "hex(16)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ps.generateSecret(context.Background(), "b", "hex(16)"); err == nil || !strings.Contains(err.Error(), "--max-secrets") {
+		t.Fatalf("expected the budget to be exceeded, got %v", err)
+	}
+	if n := f.called("PutParameter"); n != 1 {
+		t.Errorf("expected 1 stored secret, got %v", n)
+	}
+}
+
+func TestGenerateDisabled(t *testing.T) {
+	f, svc := newFakeSSM(t, map[string]string{})
+	ps := ParamStore(svc, "/app")
+
+	var b strings.Builder
+	err := ps.Hydrate(&b, strings.NewReader("db_pass: $GENERATE:password(32)\n"), "yaml", false)
+	if err == nil || !strings.Contains(err.Error(), `"password(32)" would write a generated value to "/app/db_pass" parameter, enable it with --generate`) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if n := f.called("PutParameter"); n != 0 {
+		t.Errorf("unexpected %v PutParameter calls", n)
+	}
+}
@@ -0,0 +1,165 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Reference is a parameter referenced by a field of the input.
+type Reference struct {
+	Field     string // ie. "spec.env[0].value", empty for templates.
+	Parameter string // ie. "/app/sit1/db_password"
+	Provider  string // ie. "ssm", see NamedSecretProvider.
+}
+
+// References returns the sorted parameter paths referenced by the input,
+// without fetching any of them from the Parameter Store.
+func (ps *paramStore) References(r io.Reader, format string, k8s bool) ([]string, error) {
+	rec, err := ps.recordReferences(context.Background(), r, format, k8s)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(rec.refs))
+	for path := range rec.refs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// FieldReferences returns the parameters referenced by each field of the
+// input, sorted by field, without fetching any of them.
+func (ps *paramStore) FieldReferences(r io.Reader, format string, k8s bool) ([]Reference, error) {
+	return ps.FieldReferencesContext(context.Background(), r, format, k8s)
+}
+
+// FieldReferencesContext is like FieldReferences, resolving includes
+// relative to the ctx's include dir, see WithIncludeDir.
+func (ps *paramStore) FieldReferencesContext(ctx context.Context, r io.Reader, format string, k8s bool) ([]Reference, error) {
+	rec, err := ps.recordReferences(ctx, r, format, k8s)
+	if err != nil {
+		return nil, err
+	}
+	rec.recordField("") // Template references aren't hydrated into fields.
+	sort.SliceStable(rec.fieldRefs, func(i, j int) bool {
+		return rec.fieldRefs[i].Field < rec.fieldRefs[j].Field
+	})
+	return rec.fieldRefs, nil
+}
+
+// ProviderReferences returns the first field of the input referencing
+// each provider by the provider's name, ie. "ssm" or "vault", see
+// NamedSecretProvider, without fetching any secrets. Fields of template
+// references are empty.
+func (ps *paramStore) ProviderReferences(ctx context.Context, r io.Reader, format string, k8s bool) (map[string]string, error) {
+	rec, err := ps.recordReferences(ctx, r, format, k8s)
+	if err != nil {
+		return nil, err
+	}
+	rec.recordField("")
+	return rec.providers, nil
+}
+
+// recordReferences hydrates the input in refs mode.
+func (ps *paramStore) recordReferences(ctx context.Context, r io.Reader, format string, k8s bool) (*paramStore, error) {
+	rec := ps.clone()
+	rec.refs = map[string]bool{}
+	rec.providers = map[string]string{}
+	if err := rec.HydrateContext(ctx, ioutil.Discard, r, format, k8s); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// record records the parameter path in refs mode. It's attributed to the
+// field being hydrated by seal, once the field's value is complete.
+func (ps *paramStore) record(path string) {
+	ps.refs[path] = true
+	ps.pending = append(ps.pending, path)
+	ps.pendingProviders = append(ps.pendingProviders, namespace("", ps.provider))
+}
+
+func (ps *paramStore) recordField(field string) {
+	for _, path := range ps.pending {
+		ps.fieldRefs = append(ps.fieldRefs, Reference{Field: field, Parameter: path, Provider: namespace("", ps.provider)})
+	}
+	ps.pending = nil
+
+	for _, name := range ps.pendingProviders {
+		if _, ok := ps.providers[name]; !ok {
+			ps.providers[name] = field
+		}
+	}
+	ps.pendingProviders = nil
+}
+
+// KMSKeyIDs returns the KMS key used to encrypt each of the given
+// SecureString parameters, pinned or not. Parameters of other types are
+// omitted.
+func (p *ssmProvider) KMSKeyIDs(ctx context.Context, paths []string) (map[string]string, error) {
+	keys := map[string]string{}
+
+	names, refs := referencesByName(paths)
+	err := p.describeParameters(ctx, names, func(param types.ParameterMetadata) {
+		if param.KeyId == nil {
+			return
+		}
+		for _, path := range refs[aws.ToString(param.Name)] {
+			keys[path] = aws.ToString(param.KeyId)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Graph describes which parameters are referenced by which files,
+// and which KMS keys the parameters are encrypted with.
+type Graph struct {
+	Files   map[string][]string `json:"files"`
+	KMSKeys map[string]string   `json:"kmsKeys,omitempty"`
+}
+
+// WriteJSON writes the graph as a JSON document.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	fmt.Fprintln(w, "digraph hydrate {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	files := make([]string, 0, len(g.Files))
+	for file := range g.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		fmt.Fprintf(w, "\t%q [shape=box];\n", file)
+		for _, param := range g.Files[file] {
+			fmt.Fprintf(w, "\t%q -> %q;\n", file, param)
+		}
+	}
+	params := make([]string, 0, len(g.KMSKeys))
+	for param := range g.KMSKeys {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		fmt.Fprintf(w, "\t%q [shape=diamond];\n", g.KMSKeys[param])
+		fmt.Fprintf(w, "\t%q -> %q;\n", param, g.KMSKeys[param])
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
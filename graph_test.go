@@ -0,0 +1,239 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	tt := []struct {
+		format   string
+		k8s      bool
+		input    string
+		expected []string
+	}{
+		{
+			format:   "yaml",
+			input:    "db:\n  pass: $SECRET:/app/db_pass\n  user: $$\napi_key: $SECRET\nname: app\n",
+			expected: []string{"/app/api_key", "/app/db_pass", "/app/user"},
+		},
+		{
+			format:   "json",
+			input:    `{"a": "$SECRET:/shared/key", "b": "$SECRET:/shared/key"}`,
+			expected: []string{"/shared/key"},
+		},
+		{
+			format:   "toml",
+			input:    "token = \"$$\"\n",
+			expected: []string{"/app/token"},
+		},
+		{
+			format:   "yaml",
+			k8s:      true,
+			input:    "kind: Secret\nmetadata:\n  name: app\nstringData:\n  db_pass: $$\n",
+			expected: []string{"/app/db_pass"},
+		},
+		{
+			format:   "yaml",
+			input:    "name: app\n",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		refs, err := ParamStore(nil, "/app").References(strings.NewReader(tc.input), tc.format, tc.k8s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(refs, tc.expected) {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, refs)
+		}
+	}
+}
+
+func TestFieldReferences(t *testing.T) {
+	tt := []struct {
+		format   string
+		input    string
+		expected []Reference
+	}{
+		{
+			format: "yaml",
+			input:  "db:\n  url: postgres://${SECRET:/app/user}:${SECRET:/app/db_pass}@host/db\n  user: $$\nhosts: [$SECRET:/app/h1, $SECRET:/app/h2]\nname: app\n",
+			expected: []Reference{
+				{Field: "db.url", Parameter: "/app/user", Provider: "ssm"},
+				{Field: "db.url", Parameter: "/app/db_pass", Provider: "ssm"},
+				{Field: "db.user", Parameter: "/app/user", Provider: "ssm"},
+				{Field: "hosts[0]", Parameter: "/app/h1", Provider: "ssm"},
+				{Field: "hosts[1]", Parameter: "/app/h2", Provider: "ssm"},
+			},
+		},
+		{
+			format:   "json",
+			input:    `{"b": "$SECRET:/shared/key", "a": "$GENERATE:hex(16)"}`,
+			expected: []Reference{{Field: "a", Parameter: "/app/a", Provider: "ssm"}, {Field: "b", Parameter: "/shared/key", Provider: "ssm"}},
+		},
+		{
+			format:   "tmpl",
+			input:    `{{ version "db_pass" }} {{ secret "user" }}`,
+			expected: []Reference{{Parameter: "/app/db_pass", Provider: "ssm"}, {Parameter: "/app/user", Provider: "ssm"}},
+		},
+		{
+			format:   "yaml",
+			input:    "name: app\n",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		ps := ParamStore(nil, "/app")
+		ps.SetVars(map[string]interface{}{})
+		refs, err := ps.FieldReferences(strings.NewReader(tc.input), tc.format, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(refs, tc.expected) {
+			t.Errorf("%q: expected %+v, got %+v", tc.input, tc.expected, refs)
+		}
+	}
+}
+
+func TestProviderReferences(t *testing.T) {
+	tt := []struct {
+		name     string
+		format   string
+		input    string
+		expected map[string]string
+	}{
+		{
+			name:     "ssm",
+			format:   "yaml",
+			input:    "db:\n  user: app\n  pass: $SECRET:/app/db_pass\nkey: $$\n",
+			expected: map[string]string{"ssm": "db.pass"},
+		},
+		{
+			name:     "vault only",
+			format:   "env",
+			input:    "DB_PASS=$VAULT:kv/app#db_pass\n",
+			expected: map[string]string{"vault": "DB_PASS"},
+		},
+		{
+			name:     "mixed",
+			format:   "json",
+			input:    `{"a": "$VAULT:kv/app#a", "b": "$SECRETSMANAGER:app/b", "c": "$SECRET:/app/c"}`,
+			expected: map[string]string{"vault": "a", "secretsmanager": "b", "ssm": "c"},
+		},
+		{
+			name:     "template",
+			format:   "tmpl",
+			input:    `{{ secret "db_pass" }}`,
+			expected: map[string]string{"ssm": ""},
+		},
+		{name: "none", format: "yaml", input: "name: app\n", expected: map[string]string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := ParamStore(nil, "/app")
+			ps.SetBackend("VAULT", VaultProvider(VaultConfig{}))
+			ps.SetBackend("SECRETSMANAGER", SecretsManagerProvider(nil))
+			refs, err := ps.ProviderReferences(context.Background(), strings.NewReader(tc.input), tc.format, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(refs, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, refs)
+			}
+		})
+	}
+}
+
+func TestKMSKeyIDs(t *testing.T) {
+	params, keys := map[string]string{}, map[string]string{}
+	var paths []string
+	for i := 0; i < 120; i++ {
+		name := fmt.Sprintf("/app/param_%03d", i)
+		params[name] = "value"
+		if i%2 == 0 {
+			keys[name] = "alias/app"
+		}
+		paths = append(paths, name)
+	}
+	paths = append(paths, "/app/missing", "/app/param_000:1", "/app/param_001#prod")
+	f, svc := newFakeSSM(t, params)
+	f.keys = map[string]string{}
+	for name, key := range keys {
+		f.keys[name] = key
+	}
+	keys["/app/param_000:1"] = "alias/app" // Pinned references of the same parameter.
+	got, err := SSMProvider(svc).KMSKeyIDs(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, keys) {
+		t.Errorf("expected %v KMS keys, got %v", len(keys), got)
+	}
+	// 3 chunks of up to 50 names, 5 + 5 + 2 pages of up to 10 parameters.
+	if n := f.called("DescribeParameters"); n != 12 {
+		t.Errorf("expected 12 DescribeParameters calls, got %v", n)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	g := &Graph{
+		Files:   map[string][]string{"b.yml": {"/app/db_pass"}, "a.yml": {"/app/api_key", "/app/db_pass"}},
+		KMSKeys: map[string]string{"/app/db_pass": "alias/app"},
+	}
+
+	tt := []struct {
+		write    func(w *bytes.Buffer) error
+		expected string
+	}{
+		{
+			write: func(w *bytes.Buffer) error { return g.WriteDOT(w) },
+			expected: `digraph hydrate {
+	rankdir=LR;
+	"a.yml" [shape=box];
+	"a.yml" -> "/app/api_key";
+	"a.yml" -> "/app/db_pass";
+	"b.yml" [shape=box];
+	"b.yml" -> "/app/db_pass";
+	"alias/app" [shape=diamond];
+	"/app/db_pass" -> "alias/app";
+}
+`,
+		},
+		{
+			write: func(w *bytes.Buffer) error { return g.WriteJSON(w) },
+			expected: `{
+  "files": {
+    "a.yml": [
+      "/app/api_key",
+      "/app/db_pass"
+    ],
+    "b.yml": [
+      "/app/db_pass"
+    ]
+  },
+  "kmsKeys": {
+    "/app/db_pass": "alias/app"
+  }
+}
+`,
+		},
+	}
+
+	for _, tc := range tt {
+		var b bytes.Buffer
+		if err := tc.write(&b); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, b.String())
+		}
+	}
+}
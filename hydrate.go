@@ -1,10 +1,13 @@
 package hydrate
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
@@ -12,20 +15,48 @@ import (
 )
 
 func (ps *paramStore) Hydrate(w io.Writer, r io.Reader, format string, k8s bool) error {
+	return ps.HydrateContext(context.Background(), w, r, format, k8s)
+}
+
+// HydrateContext hydrates the input like Hydrate. Fetching secrets is
+// canceled once the ctx is done, ie. on timeout.
+func (ps *paramStore) HydrateContext(ctx context.Context, w io.Writer, r io.Reader, format string, k8s bool) error {
+	r, err := ps.expandIncludes(ctx, r, format)
+	if err != nil {
+		return err
+	}
+	r, err = ps.prefetch(ctx, r, format, k8s)
+	if err != nil {
+		return err
+	}
+	return ps.hydrate(ctx, w, r, format, k8s)
+}
+
+func (ps *paramStore) hydrate(ctx context.Context, w io.Writer, r io.Reader, format string, k8s bool) error {
 	switch format {
 	case "json":
-		dec := json.NewDecoder(r)
+		input, err := ioutil.ReadAll(r)
+		if err != nil {
+			return errors.Wrap(err, "failed to read JSON data")
+		}
+		dec := json.NewDecoder(bytes.NewReader(input))
+		dec.UseNumber()
 		var data map[string]interface{}
 		if err := dec.Decode(&data); err != nil {
 			return errors.Wrap(err, "failed to decode JSON")
 		}
-		if err := ps.hydrateData(data, k8s); err != nil {
+		if err := ps.hydrateData(ctx, data, k8s); err != nil {
 			return err
 		}
-		enc := json.NewEncoder(w)
-		if err := enc.Encode(data); err != nil {
+		// Write the input with the hydrated values replaced, keeping
+		// its key order, formatting and numbers.
+		output, err := updateJSON(input, data)
+		if err != nil {
 			return errors.Wrap(err, "failed to encode JSON")
 		}
+		if _, err := w.Write(output); err != nil {
+			return err
+		}
 
 	case "yml", "yaml":
 		dec := yaml.NewDecoder(r)
@@ -33,17 +64,31 @@ func (ps *paramStore) Hydrate(w io.Writer, r io.Reader, format string, k8s bool)
 
 		// Support multiple YAML documents within a single file.
 		for {
-			var data map[string]interface{}
-			if err := dec.Decode(&data); err != nil {
+			var node yaml.Node
+			if err := dec.Decode(&node); err != nil {
 				if err == io.EOF { // Last document.
 					break
 				}
 				return errors.Wrap(err, "failed to decode YAML")
 			}
-			if err := ps.hydrateData(data, k8s); err != nil {
-				return err
+
+			if k8s {
+				var data map[string]interface{}
+				if err := node.Decode(&data); err != nil {
+					return errors.Wrap(err, "failed to decode YAML")
+				}
+				if err := ps.hydrateData(ctx, data, k8s); err != nil {
+					return err
+				}
+				updateYAMLNode(&node, data)
+			} else {
+				// Hydrate the node tree to preserve anchors and aliases.
+				if err := ps.hydrateYAMLNode(ctx, &node, nil, map[*yaml.Node]bool{}); err != nil {
+					return err
+				}
 			}
-			if err := enc.Encode(data); err != nil {
+
+			if err := enc.Encode(&node); err != nil {
 				return errors.Wrap(err, "failed to encode YAML")
 			}
 		}
@@ -57,17 +102,164 @@ func (ps *paramStore) Hydrate(w io.Writer, r io.Reader, format string, k8s bool)
 		if err := toml.Unmarshal(b, &data); err != nil {
 			return errors.Wrap(err, "failed to decode TOML")
 		}
-		if err := ps.hydrateData(data, k8s); err != nil {
+		if err := ps.hydrateData(ctx, data, k8s); err != nil {
 			return err
 		}
+		if output, ok := updateTOML(b, data); ok {
+			if _, err := w.Write(output); err != nil {
+				return err
+			}
+			break
+		}
+		// Values within arrays or inline tables were hydrated,
+		// re-encode the whole document.
 		enc := toml.NewEncoder(w)
 		if err := enc.Encode(data); err != nil {
 			return errors.Wrap(err, "failed to encode TOML")
 		}
 
+	case "npmrc", "pypirc", "netrc", "pipconf", "pip.conf":
+		return ps.hydrateCredentials(ctx, w, r, format)
+
+	case "tmpl", "template":
+		return ps.hydrateTemplate(ctx, w, r)
+
+	case "env", "dotenv":
+		return ps.hydrateDotenv(ctx, w, r)
+
+	case "properties":
+		return ps.hydrateProperties(ctx, w, r)
+
 	default:
 		return fmt.Errorf("failed to hydrate: unknown file format %q", format)
 	}
 
 	return nil
 }
+
+// HydrateFormat hydrates the input like Hydrate, but writes the output in
+// a different format using the outputFormat's registered Encoder,
+// see RegisterEncoder. Values are mapped to types that the output format
+// can represent, ie. null fields are omitted from TOML output.
+func (ps *paramStore) HydrateFormat(w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	return ps.HydrateFormatContext(context.Background(), w, r, format, outputFormat, k8s)
+}
+
+// HydrateFormatContext hydrates the input like HydrateFormat, canceled once
+// the ctx is done.
+func (ps *paramStore) HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error {
+	if outputFormat == "" || outputFormat == format || isYAML(format) && isYAML(outputFormat) {
+		return ps.HydrateContext(ctx, w, r, format, k8s)
+	}
+
+	enc, err := lookupEncoder(outputFormat)
+	if err != nil {
+		return errors.Wrap(err, "failed to hydrate")
+	}
+
+	if r, err = ps.expandIncludes(ctx, r, format); err != nil {
+		return err
+	}
+	r, err = ps.prefetch(ctx, r, format, k8s)
+	if err != nil {
+		return err
+	}
+
+	docs, err := decodeDocuments(r, format)
+	if err != nil {
+		return errors.Wrap(err, "failed to hydrate")
+	}
+
+	var data []map[string]interface{}
+	for _, doc := range docs {
+		if doc == nil {
+			continue // Empty YAML document.
+		}
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("failed to hydrate: expected %v document to be an object, got %T", format, doc)
+		}
+		if err := ps.hydrateData(ctx, m, k8s); err != nil {
+			return err
+		}
+		if _, err := convertTypes(m, format, outputFormat, ""); err != nil {
+			return errors.Wrapf(err, "failed to convert %v to %v", format, outputFormat)
+		}
+		data = append(data, m)
+	}
+
+	if err := enc(w, data); err != nil {
+		return errors.Wrapf(err, "failed to encode %v", outputFormat)
+	}
+	return nil
+}
+
+// Report describes a hydration of HydrateDocument or HydrateAll.
+type Report struct {
+	Fields     []Reference // Hydrated fields and their parameters, sorted by field.
+	Parameters []string    // Referenced "<provider>:<path>" parameters, sorted.
+}
+
+// HydrateDocument hydrates the input like Hydrate, but returns the hydrated
+// data structure instead of encoding it, ie. to use the config directly.
+// The input must be a single json, yaml, toml or env document.
+func (ps *paramStore) HydrateDocument(ctx context.Context, r io.Reader, format string) (map[string]interface{}, *Report, error) {
+	r, err := ps.expandIncludes(ctx, r, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read input")
+	}
+
+	refs, err := ps.FieldReferencesContext(ctx, bytes.NewReader(input), format, false)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to hydrate")
+	}
+	report := newReport(refs)
+
+	r, err = ps.prefetch(ctx, bytes.NewReader(input), format, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	docs, err := decodeDocuments(r, format)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to hydrate")
+	}
+	if len(docs) > 1 {
+		return nil, nil, errors.Errorf("failed to hydrate: expected a single %v document, got %v", format, len(docs))
+	}
+
+	data := map[string]interface{}{} // Empty YAML document.
+	if len(docs) == 1 && docs[0] != nil {
+		m, ok := docs[0].(map[string]interface{})
+		if !ok {
+			return nil, nil, errors.Errorf("failed to hydrate: expected %v document to be an object, got %T", format, docs[0])
+		}
+		data = m
+	}
+	if err := ps.hydrateData(ctx, data, false); err != nil {
+		return nil, nil, err
+	}
+	return data, report, nil
+}
+
+// newReport returns the report of the field references of a document.
+func newReport(refs []Reference) *Report {
+	report := &Report{Fields: refs}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		key := ref.Provider + ":" + ref.Parameter
+		if !seen[key] {
+			seen[key] = true
+			report.Parameters = append(report.Parameters, key)
+		}
+	}
+	sort.Strings(report.Parameters)
+	return report
+}
+
+func isYAML(format string) bool {
+	return format == "yml" || format == "yaml"
+}
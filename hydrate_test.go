@@ -0,0 +1,308 @@
+package hydrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// fakeSSM serves the parameters of its map over the AWS SSM Parameter Store
+// API, and its secrets over the AWS Secrets Manager API, recording the
+// actions called.
+type fakeSSM struct {
+	mu       sync.Mutex
+	params   map[string]string
+	secrets  map[string]string         // Secrets Manager secrets by name.
+	history  map[string][]string       // Values of versions 1..n by name, instead of params.
+	keys     map[string]string         // KMS keys of SecureString parameters by name.
+	labels   map[string]map[string]int // Versions of labels of parameters by name.
+	fails    map[string]apiFailure     // Failures of GetParameter(s) calls by name.
+	races    map[string]string         // Values stored concurrently by others on PutParameter by name.
+	settings map[string]string         // Service settings by ID.
+	calls    []string
+}
+
+// apiFailure is an AWS API error response.
+type apiFailure struct {
+	code, message string
+}
+
+// newFakeSSM starts a fakeSSM of the params and returns an SSM client of it.
+func newFakeSSM(t *testing.T, params map[string]string) (*fakeSSM, *ssm.Client) {
+	f := &fakeSSM{params: params}
+	return f, ssm.NewFromConfig(f.config(t))
+}
+
+// newFakeSecretsManager starts a fakeSSM of the Secrets Manager secrets
+// and returns a Secrets Manager client of it.
+func newFakeSecretsManager(t *testing.T, secrets map[string]string) (*fakeSSM, *secretsmanager.Client) {
+	f := &fakeSSM{secrets: secrets}
+	return f, secretsmanager.NewFromConfig(f.config(t))
+}
+
+// config starts the fakeSSM server and returns an AWS config of it.
+func (f *fakeSSM) config(t *testing.T) aws.Config {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return aws.Config{
+		BaseEndpoint: aws.String(srv.URL),
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+	}
+}
+
+// testStore returns a paramStore of the params with the /app base path.
+func testStore(t *testing.T, params map[string]string) *paramStore {
+	_, svc := newFakeSSM(t, params)
+	return ParamStore(svc, "/app")
+}
+
+// called returns the number of calls of the action.
+func (f *fakeSSM) called(action string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, call := range f.calls {
+		if call == action {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeSSM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSSM.")
+	var input map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, action)
+	output, code := f.serve(action, input)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(output)
+}
+
+func (f *fakeSSM) serve(action string, input map[string]interface{}) (interface{}, int) {
+	switch action {
+	case "GetParameter":
+		name, _ := input["Name"].(string)
+		if fail, ok := f.fails[name]; ok {
+			return apiError(fail.code, "%v", fail.message), http.StatusBadRequest
+		}
+		p, ok := f.parameter(name)
+		if !ok {
+			return apiError("ParameterNotFound", "parameter %v not found", name), http.StatusBadRequest
+		}
+		return map[string]interface{}{"Parameter": p}, http.StatusOK
+
+	case "GetParameters":
+		names, _ := input["Names"].([]interface{})
+		if len(names) > 10 {
+			return apiError("ValidationException", "too many names: %v", len(names)), http.StatusBadRequest
+		}
+		var params, invalid []interface{}
+		for _, name := range names {
+			// The whole batch fails if any of the names does.
+			if fail, ok := f.fails[name.(string)]; ok {
+				return apiError(fail.code, "%v", fail.message), http.StatusBadRequest
+			}
+			if p, ok := f.parameter(name.(string)); ok {
+				params = append(params, p)
+			} else {
+				invalid = append(invalid, name)
+			}
+		}
+		return map[string]interface{}{"Parameters": params, "InvalidParameters": invalid}, http.StatusOK
+
+	case "PutParameter":
+		name, _ := input["Name"].(string)
+		if value, ok := f.races[name]; ok {
+			f.params[name] = value
+		}
+		if overwrite, _ := input["Overwrite"].(bool); !overwrite && len(f.values(name)) > 0 {
+			return apiError("ParameterAlreadyExists", "parameter %v already exists", name), http.StatusBadRequest
+		}
+		value, _ := input["Value"].(string)
+		if f.history == nil {
+			f.history = map[string][]string{}
+		}
+		f.history[name] = append(f.values(name), value)
+		if key, ok := input["KeyId"].(string); ok {
+			if f.keys == nil {
+				f.keys = map[string]string{}
+			}
+			f.keys[name] = key
+		}
+		return map[string]interface{}{"Version": len(f.values(name))}, http.StatusOK
+
+	case "GetParametersByPath":
+		path, _ := input["Path"].(string)
+		recursive, _ := input["Recursive"].(bool)
+		var names []string
+		for name := range f.params {
+			if !strings.HasPrefix(name, strings.TrimSuffix(path, "/")+"/") {
+				continue
+			}
+			if !recursive && strings.Contains(strings.TrimPrefix(name, strings.TrimSuffix(path, "/")+"/"), "/") {
+				continue
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var params []interface{}
+		names, next := page(names, input["NextToken"])
+		for _, name := range names {
+			p, _ := f.parameter(name)
+			params = append(params, p)
+		}
+		return map[string]interface{}{"Parameters": params, "NextToken": next}, http.StatusOK
+
+	case "DescribeParameters":
+		var names []string
+		filters, _ := input["ParameterFilters"].([]interface{})
+		for _, filter := range filters {
+			values, _ := filter.(map[string]interface{})["Values"].([]interface{})
+			if len(values) > 50 {
+				return apiError("ValidationException", "too many filter values: %v", len(values)), http.StatusBadRequest
+			}
+			for _, value := range values {
+				if len(f.values(value.(string))) > 0 {
+					names = append(names, value.(string))
+				}
+			}
+		}
+		sort.Strings(names)
+
+		var metadata []interface{}
+		names, next := page(names, input["NextToken"])
+		for _, name := range names {
+			m := map[string]interface{}{"Name": name, "Type": "String", "Version": 1}
+			if values := f.values(name); len(values) > 0 {
+				m["Version"] = len(values)
+			}
+			if key, ok := f.keys[name]; ok {
+				m["Type"], m["KeyId"] = "SecureString", key
+			}
+			metadata = append(metadata, m)
+		}
+		return map[string]interface{}{"Parameters": metadata, "NextToken": next}, http.StatusOK
+
+	case "GetParameterHistory":
+		name, _ := input["Name"].(string)
+		values := f.values(name)
+		if len(values) == 0 {
+			return apiError("ParameterNotFound", "parameter %v not found", name), http.StatusBadRequest
+		}
+		var history []interface{}
+		for v := range values {
+			h := map[string]interface{}{"Name": name, "Version": v + 1}
+			for label, version := range f.labels[name] {
+				if version == v+1 {
+					h["Labels"] = []string{label}
+				}
+			}
+			history = append(history, h)
+		}
+		return map[string]interface{}{"Parameters": history}, http.StatusOK
+
+	case "GetServiceSetting":
+		id, _ := input["SettingId"].(string)
+		value, ok := f.settings[id]
+		if !ok {
+			return apiError("AccessDeniedException", "not authorized to get %v", id), http.StatusBadRequest
+		}
+		return map[string]interface{}{"ServiceSetting": map[string]interface{}{"SettingId": id, "SettingValue": value}}, http.StatusOK
+
+	case "secretsmanager.GetSecretValue":
+		name, _ := input["SecretId"].(string)
+		secret, ok := f.secrets[name]
+		if !ok {
+			return apiError("ResourceNotFoundException", "secret %v not found", name), http.StatusBadRequest
+		}
+		return map[string]interface{}{"Name": name, "SecretString": secret}, http.StatusOK
+
+	default:
+		return apiError("InvalidAction", "unknown action %v", action), http.StatusBadRequest
+	}
+}
+
+// fakePageSize is the number of results per page of the fakeSSM.
+const fakePageSize = 10
+
+// page returns the page of the names starting at the token, and the token
+// of the next page, if any.
+func page(names []string, token interface{}) ([]string, interface{}) {
+	offset := 0
+	if token, ok := token.(string); ok {
+		offset, _ = strconv.Atoi(token)
+	}
+	names = names[offset:]
+	if len(names) > fakePageSize {
+		return names[:fakePageSize], strconv.Itoa(offset + fakePageSize)
+	}
+	return names, nil
+}
+
+// values returns the values of the versions of the named parameter.
+func (f *fakeSSM) values(name string) []string {
+	if values, ok := f.history[name]; ok {
+		return values
+	}
+	if value, ok := f.params[name]; ok {
+		return []string{value}
+	}
+	return nil
+}
+
+// parameter returns the named parameter, or its "name:version".
+func (f *fakeSSM) parameter(name string) (map[string]interface{}, bool) {
+	version, selector := 0, ""
+	if i := strings.LastIndex(name, ":"); i > 0 {
+		version, _ = strconv.Atoi(name[i+1:])
+		name, selector = name[:i], name[i:]
+	}
+	values := f.values(name)
+	if version == 0 {
+		version = len(values)
+	}
+	if version == 0 || version > len(values) {
+		return nil, false
+	}
+	param := map[string]interface{}{
+		"Name":             name,
+		"Value":            values[version-1],
+		"Type":             "SecureString",
+		"Version":          version,
+		"ARN":              "arn:aws:ssm:us-east-1:123456789012:parameter" + name,
+		"LastModifiedDate": 1700000000 + version,
+	}
+	if selector != "" {
+		param["Selector"] = selector
+	}
+	return param, true
+}
+
+func apiError(code, format string, args ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"__type": code, "message": fmt.Sprintf(format, args...)}
+}
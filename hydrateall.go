@@ -0,0 +1,187 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Document is an in-memory input of HydrateAll.
+type Document struct {
+	Name         string // Identifies the document in results and errors, ie. a tenant.
+	Data         []byte
+	Format       string // Input format, ie. json, yaml, toml or env.
+	OutputFormat string // Defaults to Format.
+	K8s          bool   // Hydrate Kubernetes Secret/ConfigMap data fields.
+}
+
+// Result is the hydration of a Document by HydrateAll.
+type Result struct {
+	Name   string
+	Output []byte  // The hydrated document, nil if it failed.
+	Report *Report // The document's fields and parameters, nil if invalid.
+	Err    error
+}
+
+// Option configures HydrateAll.
+type Option func(*bulkOptions)
+
+type bulkOptions struct {
+	concurrency int
+	failFast    bool
+}
+
+// DocumentConcurrency sets the number of documents HydrateAll hydrates
+// concurrently. Defaults to 8.
+func DocumentConcurrency(n int) Option {
+	return func(o *bulkOptions) {
+		o.concurrency = n
+	}
+}
+
+// FailFast makes HydrateAll cancel the remaining documents once one fails.
+// Their results have the context's error.
+func FailFast() Option {
+	return func(o *bulkOptions) {
+		o.failFast = true
+	}
+}
+
+// HydrateAll hydrates the documents concurrently, ie. the configs of all
+// tenants of a platform service. The parameters referenced by all documents
+// are prefetched at once, so that parameters shared among the documents are
+// fetched once, and then served from the cache like any secret fetched by the
+// hydrator. It returns the results in the order of the documents, and an
+// error listing the documents that failed, if any.
+func (ps *paramStore) HydrateAll(ctx context.Context, docs []Document, opts ...Option) ([]Result, error) {
+	o := bulkOptions{concurrency: 8}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = 1
+	}
+
+	results := make([]Result, len(docs))
+	inputs := make([][]byte, len(docs))
+	var keys []string
+	seen := map[string]bool{}
+	for i, doc := range docs {
+		results[i].Name = doc.Name
+		inputs[i] = doc.Data
+
+		// Invalid documents are reported by their hydration.
+		r, err := ps.expandIncludes(ctx, bytes.NewReader(doc.Data), doc.Format)
+		if err != nil {
+			continue
+		}
+		input, err := ioutil.ReadAll(r)
+		if err != nil {
+			continue
+		}
+		refs, err := ps.FieldReferencesContext(ctx, bytes.NewReader(input), doc.Format, doc.K8s)
+		if err != nil {
+			continue
+		}
+		inputs[i] = input
+		results[i].Report = newReport(refs)
+		for _, ref := range refs {
+			if !seen[ref.Parameter] {
+				seen[ref.Parameter] = true
+				keys = append(keys, ref.Parameter)
+			}
+		}
+	}
+	if len(keys) > 0 && ps.redaction != RedactRef {
+		if err := ps.prefetchKeys(ctx, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		jobs = make(chan int)
+	)
+	for n := 0; n < o.concurrency && n < len(docs); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				doc := docs[i]
+				outputFormat := doc.OutputFormat
+				if outputFormat == "" {
+					outputFormat = doc.Format
+				}
+				var b bytes.Buffer
+				if err := ps.HydrateFormatContext(ctx, &b, bytes.NewReader(inputs[i]), doc.Format, outputFormat, doc.K8s); err != nil {
+					results[i].Err = err
+					if o.failFast {
+						cancel()
+					}
+					continue
+				}
+				results[i].Output = b.Bytes()
+			}
+		}()
+	}
+	for i := range docs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil && (parent.Err() != nil || errors.Cause(result.Err) != context.Canceled) {
+			failed = append(failed, fmt.Sprintf("%v: %v", result.Name, result.Err))
+		}
+	}
+	if err := parent.Err(); err != nil {
+		return results, err
+	}
+	if len(failed) > 0 {
+		return results, errors.Errorf("failed to hydrate %v of %v documents: %v", len(failed), len(docs), strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// MergeReports consolidates the reports of the results of HydrateAll into
+// one, whose fields are prefixed by the document names, ie. "tenant-a:db.dsn".
+func MergeReports(results []Result) *Report {
+	merged := &Report{}
+	seen := map[string]bool{}
+	for _, result := range results {
+		if result.Report == nil {
+			continue
+		}
+		for _, ref := range result.Report.Fields {
+			ref.Field = result.Name + ":" + ref.Field
+			merged.Fields = append(merged.Fields, ref)
+		}
+		for _, param := range result.Report.Parameters {
+			if !seen[param] {
+				seen[param] = true
+				merged.Parameters = append(merged.Parameters, param)
+			}
+		}
+	}
+	sort.SliceStable(merged.Fields, func(i, j int) bool {
+		return merged.Fields[i].Field < merged.Fields[j].Field
+	})
+	sort.Strings(merged.Parameters)
+	return merged
+}
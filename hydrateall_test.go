@@ -0,0 +1,122 @@
+package hydrate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHydrateAll(t *testing.T) {
+	params := map[string]string{
+		"/app/db_pass": "hunter2",
+		"/app/api_key": "k3y",
+	}
+	tt := []struct {
+		name    string
+		docs    []Document
+		opts    []Option
+		outputs []string
+		errs    []string
+		err     string
+		batches int // Of GetParameters, if set.
+		fields  []string
+	}{
+		{
+			name: "shared parameters",
+			docs: []Document{
+				{Name: "tenant-a", Data: []byte("pass: $SECRET:db_pass\n"), Format: "yaml"},
+				{Name: "tenant-b", Data: []byte(`{"pass": "$SECRET:db_pass", "key": "$SECRET:api_key"}`), Format: "json", OutputFormat: "env"},
+			},
+			outputs: []string{"pass: hunter2\n", "key=k3y\npass=hunter2\n"},
+			batches: 1,
+			fields:  []string{"tenant-a:pass", "tenant-b:key", "tenant-b:pass"},
+		},
+		{
+			name: "failures",
+			docs: []Document{
+				{Name: "tenant-a", Data: []byte("pass: $SECRET:db_pass\n"), Format: "yaml"},
+				{Name: "tenant-b", Data: []byte("pass: $SECRET:missing\n"), Format: "yaml"},
+				{Name: "tenant-c", Data: []byte("pass: [\n"), Format: "yaml"},
+			},
+			outputs: []string{"pass: hunter2\n", "", ""},
+			errs:    []string{"", "ParameterNotFound", "yaml"},
+			err:     "failed to hydrate 2 of 3 documents: tenant-b: ",
+			fields:  []string{"tenant-a:pass", "tenant-b:pass"},
+		},
+		{
+			name: "fail fast",
+			docs: []Document{
+				{Name: "tenant-a", Data: []byte("pass: $SECRET:missing\n"), Format: "yaml"},
+				{Name: "tenant-b", Data: []byte("pass: $SECRET:db_pass\n"), Format: "yaml"},
+			},
+			opts:    []Option{FailFast(), DocumentConcurrency(1)},
+			outputs: []string{"", ""},
+			errs:    []string{"ParameterNotFound", "context canceled"},
+			err:     "failed to hydrate 1 of 2 documents: tenant-a: ",
+			fields:  []string{"tenant-a:pass", "tenant-b:pass"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, svc := newFakeSSM(t, params)
+			results, err := ParamStore(svc, "/app").HydrateAll(context.Background(), tc.docs, tc.opts...)
+			if tc.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+			if len(results) != len(tc.docs) {
+				t.Fatalf("expected %v results, got %v", len(tc.docs), len(results))
+			}
+			for i, result := range results {
+				if result.Name != tc.docs[i].Name {
+					t.Errorf("expected result %v of %v, got %v", i, tc.docs[i].Name, result.Name)
+				}
+				if string(result.Output) != tc.outputs[i] {
+					t.Errorf("%v: expected %q, got %q", result.Name, tc.outputs[i], result.Output)
+				}
+				if tc.errs == nil || tc.errs[i] == "" {
+					if result.Err != nil {
+						t.Errorf("%v: %v", result.Name, result.Err)
+					}
+				} else if result.Err == nil || !strings.Contains(result.Err.Error(), tc.errs[i]) {
+					t.Errorf("%v: expected error %q, got %v", result.Name, tc.errs[i], result.Err)
+				}
+			}
+			if batches := f.called("GetParameters"); tc.batches > 0 && batches != tc.batches {
+				t.Errorf("expected %v GetParameters calls, got %v", tc.batches, batches)
+			}
+
+			var fields []string
+			for _, ref := range MergeReports(results).Fields {
+				fields = append(fields, ref.Field)
+			}
+			if !reflect.DeepEqual(fields, tc.fields) {
+				t.Errorf("expected merged fields %q, got %q", tc.fields, fields)
+			}
+		})
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	results := []Result{
+		{Name: "b", Report: newReport([]Reference{{Field: "pass", Parameter: "/app/db_pass", Provider: "ssm"}})},
+		{Name: "a", Report: newReport([]Reference{{Field: "pass", Parameter: "/app/db_pass", Provider: "ssm"}, {Field: "key", Parameter: "/app/api_key", Provider: "ssm"}})},
+		{Name: "invalid"},
+	}
+	merged := MergeReports(results)
+	expected := &Report{
+		Fields: []Reference{
+			{Field: "a:key", Parameter: "/app/api_key", Provider: "ssm"},
+			{Field: "a:pass", Parameter: "/app/db_pass", Provider: "ssm"},
+			{Field: "b:pass", Parameter: "/app/db_pass", Provider: "ssm"},
+		},
+		Parameters: []string{"ssm:/app/api_key", "ssm:/app/db_pass"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %+v, got %+v", expected, merged)
+	}
+}
@@ -0,0 +1,378 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// includePrefix marks values replaced by the content of another template,
+// ie. "$INCLUDE:common/db.yml", before hydration.
+const includePrefix = "$INCLUDE:"
+
+type includeKey struct{}
+
+// includeState is the directory that include paths are relative to, and
+// the files being included, to detect cycles. Files are read from the fsys
+// of hydrated file systems, see FS, with slash-separated paths within it.
+type includeState struct {
+	fsys     fs.FS
+	dir      string
+	stack    []string
+	disabled bool // See WithoutIncludes.
+}
+
+// WithIncludeDir returns a copy of ctx resolving "$INCLUDE:" paths of the
+// hydrated input relative to dir, ie. the input file's directory, instead
+// of the current directory. Paths of included files are relative to their
+// own directory. Includes disabled by WithoutIncludes stay disabled.
+func WithIncludeDir(ctx context.Context, dir string) context.Context {
+	if includeStateOf(ctx).disabled {
+		return ctx
+	}
+	return context.WithValue(ctx, includeKey{}, includeState{dir: dir})
+}
+
+// WithoutIncludes returns a copy of ctx failing the hydration of inputs with
+// "$INCLUDE:" values, ie. of untrusted documents that mustn't read local files.
+func WithoutIncludes(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeKey{}, includeState{disabled: true})
+}
+
+func includeStateOf(ctx context.Context) includeState {
+	state, _ := ctx.Value(includeKey{}).(includeState)
+	if state.dir == "" {
+		state.dir = "."
+	}
+	return state
+}
+
+// withIncludeFS returns a copy of ctx resolving "$INCLUDE:" paths within
+// fsys, relative to dir, unless includes are disabled.
+func withIncludeFS(ctx context.Context, fsys fs.FS, dir string) context.Context {
+	if includeStateOf(ctx).disabled {
+		return ctx
+	}
+	return context.WithValue(ctx, includeKey{}, includeState{fsys: fsys, dir: dir})
+}
+
+// open returns the absolute path of the included file, or its path within
+// the fsys, and the state of includes within it.
+func (s includeState) open(ref string) (string, includeState, error) {
+	name := strings.TrimPrefix(ref, includePrefix)
+	var abs, dir string
+	if s.fsys != nil {
+		abs = path.Join(s.dir, name)
+		if path.IsAbs(name) || !fs.ValidPath(abs) {
+			return "", s, errors.Errorf("failed to include %q: outside of the hydrated file system", ref)
+		}
+		dir = path.Dir(abs)
+	} else {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(s.dir, name)
+		}
+		var err error
+		if abs, err = filepath.Abs(name); err != nil {
+			return "", s, err
+		}
+		dir = filepath.Dir(abs)
+	}
+	for i, file := range s.stack {
+		if file == abs {
+			cycle := append(append([]string{}, s.stack[i:]...), abs)
+			return "", s, errors.Errorf("include cycle: %v", strings.Join(cycle, " -> "))
+		}
+	}
+	stack := append(append([]string{}, s.stack...), abs)
+	return abs, includeState{fsys: s.fsys, dir: dir, stack: stack}, nil
+}
+
+// read opens the included file returned by open.
+func (s includeState) read(filename string) (io.ReadCloser, error) {
+	if s.fsys != nil {
+		return s.fsys.Open(filename)
+	}
+	return os.Open(filename)
+}
+
+func isInclude(value string) bool {
+	return strings.HasPrefix(value, includePrefix)
+}
+
+// expandIncludes returns the json, yaml or toml input with the values of
+// "$INCLUDE:path" replaced by the document of the file at path, so that
+// shared blocks, ie. a common DB config, can be reused across templates.
+// Inputs without includes are returned as they are, and the documents are
+// spliced into JSON and TOML in place, like hydrated values.
+func (ps *paramStore) expandIncludes(ctx context.Context, r io.Reader, format string) (io.Reader, error) {
+	switch format {
+	case "json", "yml", "yaml", "toml":
+	default:
+		return r, nil
+	}
+
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read input")
+	}
+	if !bytes.Contains(input, []byte(includePrefix)) {
+		return bytes.NewReader(input), nil
+	}
+	state := includeStateOf(ctx)
+	if state.disabled {
+		return nil, errors.Errorf("%v values are disabled", includePrefix)
+	}
+
+	var b bytes.Buffer
+	if isYAML(format) {
+		dec := yaml.NewDecoder(bytes.NewReader(input))
+		enc := yaml.NewEncoder(&b)
+		for {
+			var node yaml.Node
+			if err := dec.Decode(&node); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, errors.Wrap(err, "failed to decode YAML")
+			}
+			if err := includeYAML(&node, state); err != nil {
+				return nil, err
+			}
+			if err := enc.Encode(&node); err != nil {
+				return nil, errors.Wrap(err, "failed to encode YAML")
+			}
+		}
+		return &b, nil
+	}
+
+	var output []byte
+	if format == "json" {
+		output, err = includeJSON(input, state)
+	} else {
+		output, err = includeTOML(input, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(output), nil
+}
+
+// includeJSON returns the JSON input with the included documents spliced
+// in place of the "$INCLUDE:" values, keeping the key order, formatting and
+// numbers of the input. Included JSON files are spliced as they are.
+func includeJSON(input []byte, state includeState) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(input))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON")
+	}
+	data, err := includeData(data, state, readIncludeJSON)
+	if err != nil {
+		return nil, err
+	}
+	output, err := updateJSON(input, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode JSON")
+	}
+	return output, nil
+}
+
+// includeTOML returns the TOML input with the included documents spliced
+// in place of the "$INCLUDE:" values, as inline tables, keeping the key
+// order, formatting and comments of the input. Includes within arrays or
+// inline tables re-encode the whole document.
+func includeTOML(input []byte, state includeState) ([]byte, error) {
+	var data map[string]interface{}
+	if err := toml.Unmarshal(input, &data); err != nil {
+		return nil, errors.Wrap(err, "failed to decode TOML")
+	}
+	if _, err := includeData(data, state, readIncludeData); err != nil {
+		return nil, err
+	}
+	if output, ok := updateTOML(input, data); ok {
+		return output, nil
+	}
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(data); err != nil {
+		return nil, errors.Wrap(err, "failed to encode TOML")
+	}
+	return b.Bytes(), nil
+}
+
+// includeYAML replaces the "$INCLUDE:" scalars of the node tree with the
+// root nodes of the included documents.
+func includeYAML(node *yaml.Node, state includeState) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && isInclude(node.Value) {
+		filename, state, err := state.open(node.Value)
+		if err != nil {
+			return err
+		}
+		included, err := readIncludeNode(filename, state)
+		if err != nil {
+			return errors.Wrapf(err, "failed to include %q", node.Value)
+		}
+		if err := includeYAML(included, state); err != nil {
+			return err
+		}
+		*node = *included
+		return nil
+	}
+
+	for _, n := range node.Content {
+		if err := includeYAML(n, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readIncludeNode(filename string, state includeState) (*yaml.Node, error) {
+	switch format := strings.TrimLeft(filepath.Ext(filename), "."); format {
+	case "json", "yml", "yaml":
+	case "toml":
+		data, err := readInclude(filename, state)
+		if err != nil {
+			return nil, err
+		}
+		var node yaml.Node
+		if err := node.Encode(data); err != nil {
+			return nil, err
+		}
+		return &node, nil
+	default:
+		return nil, errors.Errorf("unsupported file format %q, expected json, yaml or toml", format)
+	}
+
+	// JSON is read as YAML too, keeping the key order.
+	f, err := state.read(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc yaml.Node
+	if err := yaml.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode")
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.New("empty document")
+	}
+	return doc.Content[0], nil
+}
+
+// includeReader reads the document of the included file, with its own
+// includes replaced.
+type includeReader func(filename string, state includeState) (interface{}, error)
+
+// readIncludeData reads the included document as decoded data.
+func readIncludeData(filename string, state includeState) (interface{}, error) {
+	included, err := readInclude(filename, state)
+	if err != nil {
+		return nil, err
+	}
+	return includeData(included, state, readIncludeData)
+}
+
+// readIncludeJSON reads JSON documents as they are, to be spliced into
+// JSON, and others like readIncludeData.
+func readIncludeJSON(filename string, state includeState) (interface{}, error) {
+	if path.Ext(filename) != ".json" {
+		return readIncludeData(filename, state)
+	}
+	f, err := state.read(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	input, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	included, err := includeJSON(input, state)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(included), nil
+}
+
+// includeData replaces the "$INCLUDE:" values of the decoded data with the
+// included documents, as read by read.
+func includeData(data interface{}, state includeState, read includeReader) (interface{}, error) {
+	switch v := data.(type) {
+	case string:
+		if !isInclude(v) {
+			return v, nil
+		}
+		filename, state, err := state.open(v)
+		if err != nil {
+			return nil, err
+		}
+		included, err := read(filename, state)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to include %q", v)
+		}
+		return included, nil
+
+	case map[string]interface{}:
+		for key, value := range v {
+			included, err := includeData(value, state, read)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = included
+		}
+
+	case []interface{}:
+		for i, value := range v {
+			included, err := includeData(value, state, read)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = included
+		}
+
+	case []map[string]interface{}:
+		for _, table := range v {
+			if _, err := includeData(table, state, read); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+func readInclude(filename string, state includeState) (interface{}, error) {
+	format := strings.TrimLeft(filepath.Ext(filename), ".")
+	switch format {
+	case "json", "yml", "yaml", "toml":
+	default:
+		return nil, errors.Errorf("unsupported file format %q, expected json, yaml or toml", format)
+	}
+
+	f, err := state.read(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	docs, err := decodeDocuments(f, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) != 1 {
+		return nil, errors.Errorf("expected a single document, got %v", len(docs))
+	}
+	return docs[0], nil
+}
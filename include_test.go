@@ -0,0 +1,113 @@
+package hydrate
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExpandIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"common/db.yml":    {Data: []byte("host: db.internal\nport: 5432\n")},
+		"common/db.json":   {Data: []byte(`{"host": "db.internal", "id": 9007199254740993, "auth": "$INCLUDE:auth.toml"}`)},
+		"common/auth.toml": {Data: []byte("user = \"app\"\n")},
+		"cycle/a.yml":      {Data: []byte("b: $INCLUDE:b.yml\n")},
+		"cycle/b.yml":      {Data: []byte("a: $INCLUDE:a.yml\n")},
+	}
+	tt := []struct {
+		name     string
+		format   string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "JSON keeps key order, formatting and numbers",
+			format:   "json",
+			input:    "{\n  \"z\": 9007199254740993,\n  \"db\": \"$INCLUDE:common/db.yml\",\n  \"a\": 1.50\n}\n",
+			expected: "{\n  \"z\": 9007199254740993,\n  \"db\": {\"host\":\"db.internal\",\"port\":5432},\n  \"a\": 1.50\n}\n",
+		},
+		{
+			name:     "JSON includes JSON as it is",
+			format:   "json",
+			input:    `{"db": "$INCLUDE:common/db.json"}`,
+			expected: `{"db": {"host":"db.internal","id":9007199254740993,"auth":{"user":"app"}}}` + "\n",
+		},
+		{
+			name:     "TOML keeps comments",
+			format:   "toml",
+			input:    "# App config.\nname = \"app\" # The name.\n\n[server]\ndb = \"$INCLUDE:common/db.yml\" # Shared.\n",
+			expected: "# App config.\nname = \"app\" # The name.\n\n[server]\ndb = { host = \"db.internal\", port = 5432 } # Shared.\n",
+		},
+		{
+			name:     "YAML",
+			format:   "yaml",
+			input:    "db: $INCLUDE:common/db.yml\n",
+			expected: "db:\n    host: db.internal\n    port: 5432\n",
+		},
+		{
+			name:   "outside of the file system",
+			format: "yaml",
+			input:  "db: $INCLUDE:../db.yml\n",
+			err:    "outside of the hydrated file system",
+		},
+		{
+			name:   "absolute path",
+			format: "json",
+			input:  `{"db": "$INCLUDE:/etc/hosts.json"}`,
+			err:    "outside of the hydrated file system",
+		},
+		{
+			name:   "cycle",
+			format: "yaml",
+			input:  "a: $INCLUDE:cycle/a.yml\n",
+			err:    "include cycle: cycle/a.yml -> cycle/b.yml -> cycle/a.yml",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := withIncludeFS(context.Background(), fsys, ".")
+			r, err := testStore(t, nil).expandIncludes(ctx, strings.NewReader(tc.input), tc.format)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestExpandIncludesDisabled(t *testing.T) {
+	fsys := fstest.MapFS{"db.yml": {Data: []byte("host: db.internal\n")}}
+	tt := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "disabled", ctx: WithoutIncludes(context.Background())},
+		{name: "dir", ctx: WithIncludeDir(WithoutIncludes(context.Background()), ".")},
+		{name: "file system", ctx: withIncludeFS(WithoutIncludes(context.Background()), fsys, ".")},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := testStore(t, nil).expandIncludes(tc.ctx, strings.NewReader("db: $INCLUDE:db.yml\n"), "yaml")
+			if err == nil || !strings.Contains(err.Error(), "$INCLUDE: values are disabled") {
+				t.Fatalf("expected includes to stay disabled, got %v", err)
+			}
+		})
+	}
+}
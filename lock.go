@@ -0,0 +1,118 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/pkg/errors"
+)
+
+// Lock pins parameter paths to the exact versions used by a previous run.
+type Lock struct {
+	Parameters map[string]int64 `json:"parameters"`
+}
+
+// ReadLock decodes a lock file.
+func ReadLock(r io.Reader) (*Lock, error) {
+	var lock Lock
+	if err := json.NewDecoder(r).Decode(&lock); err != nil {
+		return nil, errors.Wrap(err, "failed to decode lock file")
+	}
+	if lock.Parameters == nil {
+		lock.Parameters = map[string]int64{}
+	}
+	return &lock, nil
+}
+
+// Write encodes the lock file. Parameters are sorted by path,
+// so that version bumps show up as minimal diffs.
+func (l *Lock) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(l); err != nil {
+		return errors.Wrap(err, "failed to encode lock file")
+	}
+	return nil
+}
+
+// Lock returns the versions of all parameters fetched so far.
+func (p *ssmProvider) Lock() *Lock {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lock := &Lock{Parameters: map[string]int64{}}
+	for key, metadata := range p.metadata {
+		if _, selector := parameterSelector(key); selector != "" {
+			continue // Pinned by the reference already.
+		}
+		lock.Parameters[key] = metadata.Version
+	}
+	return lock
+}
+
+// Versions resolves the current version of each parameter reference without
+// reading its value, ie. to pin "$SECRET:/app/db_pass" references as
+// "$SECRET:/app/db_pass:3". Labels of "/app/db_pass#prod" references are
+// resolved to the version they point to. Missing parameters are omitted.
+func (p *ssmProvider) Versions(ctx context.Context, paths []string) (map[string]int64, error) {
+	versions := map[string]int64{}
+
+	var latest []string
+	for _, path := range paths {
+		name, selector := parameterSelector(path)
+		switch {
+		case selector == "":
+			latest = append(latest, path)
+
+		case strings.HasPrefix(path[len(name):], ":"):
+			version, err := strconv.ParseInt(selector[1:], 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("%q has an invalid version, expected a number", path)
+			}
+			versions[path] = version
+
+		default:
+			label := selector[1:]
+			pages := ssm.NewGetParameterHistoryPaginator(p.ssm, &ssm.GetParameterHistoryInput{
+				Name: aws.String(name),
+			})
+			for pages.HasMorePages() {
+				out, err := pages.NextPage(ctx)
+				var notFound *types.ParameterNotFound
+				if errors.As(err, &notFound) {
+					break
+				} else if err != nil {
+					return nil, errors.Wrapf(p.explainError(ctx, err, name), "failed to get %q parameter history", name)
+				}
+				for _, h := range out.Parameters {
+					for _, l := range h.Labels {
+						if l == label {
+							versions[path] = h.Version
+						}
+					}
+				}
+			}
+		}
+	}
+
+	err := p.describeParameters(ctx, latest, func(param types.ParameterMetadata) {
+		versions[aws.ToString(param.Name)] = param.Version
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Freeze makes all subsequent fetches use the exact parameter versions
+// recorded in the lock. Parameters missing from the lock fail to hydrate.
+func (p *ssmProvider) Freeze(lock *Lock) {
+	p.frozen = lock
+}
@@ -0,0 +1,137 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	tt := []struct {
+		lock     *Lock // Frozen versions, if any.
+		input    string
+		expected string
+		versions map[string]int64
+		err      string
+	}{
+		{
+			input:    "api_key: $$\ndb_pass: $$\n",
+			expected: "api_key: k3y\ndb_pass: hunter2\n",
+			versions: map[string]int64{"/app/db_pass": 2, "/app/api_key": 1},
+		},
+		{
+			lock:     &Lock{Parameters: map[string]int64{"/app/db_pass": 1, "/app/api_key": 1}},
+			input:    "api_key: $$\ndb_pass: $$\n",
+			expected: "api_key: k3y\ndb_pass: old\n",
+			versions: map[string]int64{"/app/db_pass": 1, "/app/api_key": 1},
+		},
+		{
+			lock:     &Lock{Parameters: map[string]int64{"/app/api_key": 1}},
+			input:    "api_key: $$\ndb_pass: $SECRET:/app/db_pass:1\n",
+			expected: "api_key: k3y\ndb_pass: old\n",
+			versions: map[string]int64{"/app/api_key": 1},
+		},
+		{
+			lock:  &Lock{Parameters: map[string]int64{"/app/api_key": 1}},
+			input: "db_pass: $$\n",
+			err:   `"/app/db_pass" parameter is not in the lock file`,
+		},
+		{
+			lock:  &Lock{Parameters: map[string]int64{"/app/db_pass": 3}},
+			input: "db_pass: $$\n",
+			err:   `failed to fetch "/app/db_pass:3" parameter`,
+		},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/api_key": "k3y"})
+		f.history = map[string][]string{"/app/db_pass": {"old", "hunter2"}}
+		provider := SSMProvider(svc)
+		ps := New(provider, "/app")
+		if tc.lock != nil {
+			provider.Freeze(tc.lock)
+		}
+
+		var output bytes.Buffer
+		err := ps.Hydrate(&output, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, output.String())
+		}
+		if lock := provider.Lock(); !reflect.DeepEqual(lock.Parameters, tc.versions) {
+			t.Errorf("expected versions %v, got %v", tc.versions, lock.Parameters)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	tt := []struct {
+		paths    []string
+		expected map[string]int64
+		err      string
+	}{
+		{paths: []string{"/app/db_pass", "/app/api_key"}, expected: map[string]int64{"/app/db_pass": 2, "/app/api_key": 1}},
+		{paths: []string{"/app/db_pass:1", "/app/db_pass#stable"}, expected: map[string]int64{"/app/db_pass:1": 1, "/app/db_pass#stable": 1}},
+		{paths: []string{"/app/missing", "/app/missing#stable", "/app/db_pass#none"}, expected: map[string]int64{}},
+		{paths: []string{"/app/db_pass:latest"}, err: `"/app/db_pass:latest" has an invalid version`},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/api_key": "k3y"})
+		f.history = map[string][]string{"/app/db_pass": {"old", "hunter2"}}
+		f.labels = map[string]map[string]int{"/app/db_pass": {"stable": 1}}
+
+		versions, err := SSMProvider(svc).Versions(context.Background(), tc.paths)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.paths, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(versions, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.paths, tc.expected, versions)
+		}
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	lock := &Lock{Parameters: map[string]int64{"/app/b": 2, "/app/a": 10}}
+
+	var b bytes.Buffer
+	if err := lock.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"parameters\": {\n    \"/app/a\": 10,\n    \"/app/b\": 2\n  }\n}\n"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	read, err := ReadLock(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, lock) {
+		t.Errorf("expected %v, got %v", lock, read)
+	}
+
+	empty, err := ReadLock(strings.NewReader("{}"))
+	if err != nil || empty.Parameters == nil {
+		t.Errorf("expected empty lock, got %v, %v", empty, err)
+	}
+	if _, err := ReadLock(strings.NewReader("{")); err == nil {
+		t.Error("expected error decoding invalid lock file")
+	}
+}
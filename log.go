@@ -0,0 +1,161 @@
+package hydrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Logger receives the library's progress messages, ie. the parameters being
+// fetched, with alternating key-value pairs of details. Neither ever contains
+// secret values, at any level.
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(level Level, msg string, keyvals ...interface{})
+
+// Log calls f(level, msg, keyvals...).
+func (f LoggerFunc) Log(level Level, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// defaultLogger is used until SetLogger is called.
+var defaultLogger = TextLogger(os.Stderr, LevelInfo)
+
+// TextLogger returns a Logger writing messages of at least the min level
+// as `hydrate: msg key="value"` lines into w.
+func TextLogger(w io.Writer, min Level) Logger {
+	return &streamLogger{w: w, min: min, format: formatText}
+}
+
+// JSONLogger returns a Logger writing messages of at least the min level
+// as `{"level":"info","msg":"...","key":"value"}` lines into w.
+func JSONLogger(w io.Writer, min Level) Logger {
+	return &streamLogger{w: w, min: min, format: formatJSON}
+}
+
+type streamLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	min    Level
+	format func(b *bytes.Buffer, level Level, msg string, keyvals []interface{})
+}
+
+func (l *streamLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < l.min {
+		return
+	}
+	var b bytes.Buffer
+	l.format(&b, level, msg, keyvals)
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b.Bytes())
+}
+
+func formatText(b *bytes.Buffer, level Level, msg string, keyvals []interface{}) {
+	b.WriteString("hydrate: ")
+	if level >= LevelWarn {
+		b.WriteString(level.String() + ": ")
+	}
+	b.WriteString(msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch v := keyvals[i+1].(type) {
+		case string:
+			fmt.Fprintf(b, " %v=%q", keyvals[i], v)
+		case error:
+			fmt.Fprintf(b, " %v=%q", keyvals[i], v.Error())
+		default:
+			fmt.Fprintf(b, " %v=%v", keyvals[i], v)
+		}
+	}
+}
+
+func formatJSON(b *bytes.Buffer, level Level, msg string, keyvals []interface{}) {
+	fmt.Fprintf(b, `{"level":%q,"msg":`, level.String())
+	writeJSON(b, msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		b.WriteByte(',')
+		writeJSON(b, fmt.Sprint(keyvals[i]))
+		b.WriteByte(':')
+		value := keyvals[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		writeJSON(b, value)
+	}
+	b.WriteByte('}')
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// logging is embedded by providers to log via the paramStore's Logger,
+// see SetLogger.
+type logging struct {
+	logger Logger
+}
+
+// SetLogger sets the Logger of progress messages, os.Stderr by default.
+func (l *logging) SetLogger(logger Logger) {
+	l.logger = logger
+}
+
+func (l *logging) log(level Level, msg string, keyvals ...interface{}) {
+	logger := l.logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+	logger.Log(level, msg, keyvals...)
+}
+
+// SetLogger sets the Logger of the paramStore and its providers, ie. a
+// TextLogger of warnings only to silence progress messages. Messages are
+// written to os.Stderr by default.
+func (ps *paramStore) SetLogger(logger Logger) {
+	ps.logging.SetLogger(logger)
+
+	providers := []SecretProvider{ps.provider}
+	for _, p := range ps.backends {
+		providers = append(providers, p)
+	}
+	for _, p := range providers {
+		if p, ok := p.(interface{ SetLogger(Logger) }); ok {
+			p.SetLogger(logger)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package hydrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	tt := []struct {
+		name     string
+		logger   func(b *strings.Builder) Logger
+		level    Level
+		msg      string
+		keyvals  []interface{}
+		expected string
+	}{
+		{
+			name:     "text",
+			logger:   func(b *strings.Builder) Logger { return TextLogger(b, LevelInfo) },
+			level:    LevelInfo,
+			msg:      "fetching secret",
+			keyvals:  []interface{}{"key", "/app/db", "count", 2},
+			expected: "hydrate: fetching secret key=\"/app/db\" count=2\n",
+		},
+		{
+			name:     "text warning",
+			logger:   func(b *strings.Builder) Logger { return TextLogger(b, LevelInfo) },
+			level:    LevelWarn,
+			msg:      "failed to cache secret",
+			keyvals:  []interface{}{"error", errors.New("disk full")},
+			expected: "hydrate: warn: failed to cache secret error=\"disk full\"\n",
+		},
+		{
+			name:   "below level",
+			logger: func(b *strings.Builder) Logger { return TextLogger(b, LevelWarn) },
+			level:  LevelInfo,
+			msg:    "fetching secret",
+		},
+		{
+			name:     "json",
+			logger:   func(b *strings.Builder) Logger { return JSONLogger(b, LevelDebug) },
+			level:    LevelDebug,
+			msg:      "serving secret from cache",
+			keyvals:  []interface{}{"key", "/app/db", "count", 2, "error", errors.New("x")},
+			expected: `{"level":"debug","msg":"serving secret from cache","key":"/app/db","count":2,"error":"x"}` + "\n",
+		},
+		{
+			name:     "odd keyvals",
+			logger:   func(b *strings.Builder) Logger { return JSONLogger(b, LevelDebug) },
+			level:    LevelError,
+			msg:      "failed",
+			keyvals:  []interface{}{"key"},
+			expected: `{"level":"error","msg":"failed"}` + "\n",
+		},
+	}
+
+	for _, tc := range tt {
+		var b strings.Builder
+		tc.logger(&b).Log(tc.level, tc.msg, tc.keyvals...)
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.name, tc.expected, b.String())
+		}
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	var b strings.Builder
+	ps := testStore(t, map[string]string{"/app/db": "s3cr3t"})
+	ps.SetLogger(TextLogger(&b, LevelDebug))
+
+	if _, err := ps.GetSecret("/app/db"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hydrate: fetching secret key=\"/app/db\" from=\"AWS SSM Parameter Store\"\n"; b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+	if strings.Contains(b.String(), "s3cr3t") {
+		t.Error("expected no secret values logged")
+	}
+}
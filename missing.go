@@ -0,0 +1,68 @@
+package hydrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Missing controls how references to secrets that don't exist are
+// hydrated, see SetMissing.
+type Missing int
+
+const (
+	MissingError Missing = iota // Fail the hydration, the default.
+	MissingEmpty                // Hydrate them as empty strings.
+	MissingKeep                 // Keep the references as they are.
+)
+
+// ParseMissing parses "error", "empty" or "keep", ie. of a --missing flag.
+func ParseMissing(s string) (Missing, error) {
+	switch s {
+	case "error":
+		return MissingError, nil
+	case "empty":
+		return MissingEmpty, nil
+	case "keep":
+		return MissingKeep, nil
+	}
+	return MissingError, errors.Errorf("unknown missing mode %q, expected error, empty or keep", s)
+}
+
+// SetMissing sets how references to secrets that don't exist are hydrated,
+// ie. for configs shared between environments where not every secret exists
+// yet. References with a default value, ie. "$SECRET:/app/flag|off", and
+// optional ones, ie. "$SECRET?:/app/key", never fail.
+func (ps *paramStore) SetMissing(m Missing) {
+	ps.missingMode = m
+}
+
+// splitDefault splits the "/app/flag|default" reference into its key and
+// default value.
+func splitDefault(ref string) (key, value string, ok bool) {
+	i := strings.Index(ref, "|")
+	if i < 0 {
+		return ref, "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+// missingSecret hydrates the reference of a secret that failed to fetch
+// according to the SetMissing mode, if it doesn't exist. Failing misses
+// suggest similar parameters, see suggest.
+func (ps *paramStore) missingSecret(ctx context.Context, value string, err error) (*string, error) {
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	switch ps.missingMode {
+	case MissingEmpty:
+		ps.log(LevelWarn, "secret doesn't exist, hydrating it empty", "ref", value)
+		empty := ""
+		return &empty, nil
+	case MissingKeep:
+		ps.log(LevelWarn, "secret doesn't exist, keeping its reference", "ref", value)
+		return &value, nil
+	}
+	return nil, ps.suggest(ctx, err)
+}
@@ -0,0 +1,74 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMissing(t *testing.T) {
+	tt := []struct {
+		missing  Missing
+		input    string
+		expected string
+		err      string
+	}{
+		{input: "flag: $SECRET:/app/flag|off\n", expected: "flag: \"off\"\n"},
+		{input: "flag: $SECRET:/app/db_pass|off\n", expected: "flag: hunter2\n"},
+		{input: "url: $SECRET:/app/url|http://localhost:8080\n", expected: "url: http://localhost:8080\n"},
+		{input: "key: $SECRET?:/app/key\n", expected: "key: \"\"\n"},
+		{input: "key: $SECRET:/app/key\n", err: `"/app/key" doesn't exist`},
+		{input: "key: $$\n", err: `"/app/key" doesn't exist`},
+		{missing: MissingEmpty, input: "key: $$\npass: $$\n", expected: "key: \"\"\npass: \"\"\n"},
+		{missing: MissingEmpty, input: "key: $SECRET:/app/key\n", expected: "key: \"\"\n"},
+		{missing: MissingKeep, input: "key: $SECRET:/app/key\n", expected: "key: $SECRET:/app/key\n"},
+		{missing: MissingKeep, input: "key: $SECRET?:/app/key\n", expected: "key: $SECRET?:/app/key\n"},
+		{missing: MissingKeep, input: "url: postgres://${SECRET:/app/user}@db/${SECRET:/app/db_pass}\n", expected: "url: postgres://${SECRET:/app/user}@db/hunter2\n"},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/db_pass": "hunter2"})
+		ps.SetMissing(tc.missing)
+
+		var b bytes.Buffer
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, b.String())
+		}
+	}
+}
+
+func TestParseMissing(t *testing.T) {
+	tt := []struct {
+		value    string
+		expected Missing
+		err      string
+	}{
+		{value: "error", expected: MissingError},
+		{value: "empty", expected: MissingEmpty},
+		{value: "keep", expected: MissingKeep},
+		{value: "ignore", err: `unknown missing mode "ignore"`},
+	}
+
+	for _, tc := range tt {
+		m, err := ParseMissing(tc.value)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.value, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || m != tc.expected {
+			t.Errorf("%q: expected %v, got %v (%v)", tc.value, tc.expected, m, err)
+		}
+	}
+}
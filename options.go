@@ -0,0 +1,101 @@
+package hydrate
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Hydrator hydrates documents, ie. for services embedding hydration to
+// depend on. It's implemented by the hydrators of New, ParamStore and
+// NewHydrator, which are safe for concurrent use once configured.
+type Hydrator interface {
+	Hydrate(w io.Writer, r io.Reader, format string, k8s bool) error
+	HydrateContext(ctx context.Context, w io.Writer, r io.Reader, format string, k8s bool) error
+	HydrateFormat(w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error
+	HydrateFormatContext(ctx context.Context, w io.Writer, r io.Reader, format, outputFormat string, k8s bool) error
+	HydrateDocument(ctx context.Context, r io.Reader, format string) (map[string]interface{}, *Report, error)
+	HydrateAll(ctx context.Context, docs []Document, opts ...Option) ([]Result, error)
+	Lookup(value string) (string, error)
+}
+
+var _ Hydrator = (*paramStore)(nil)
+
+// Options configures the hydrator of NewHydrator. The zero value hydrates
+// like New with an empty base path.
+type Options struct {
+	// BasePath resolves relative keys, ie. of "$$" shorthands.
+	BasePath string
+
+	// Backends are the providers of "$<NAME>:<key>" references by name,
+	// see SetBackend.
+	Backends map[string]SecretProvider
+
+	Logger      Logger    // See SetLogger.
+	Missing     Missing   // See SetMissing.
+	Empty       Empty     // See SetEmpty.
+	Redaction   Redaction // See SetRedaction.
+	RateLimit   int       // Max AWS API calls per second, see SetRateLimit.
+	Concurrency int       // Prefetch requests in flight, see SetConcurrency.
+
+	// RateLimiter, if set, is shared with other hydrators instead of
+	// RateLimit, see SetRateLimiter.
+	RateLimiter *RateLimiter
+
+	// CacheDir persists the fetched secrets for up to CacheTTL, see SetCache.
+	CacheDir string
+	CacheTTL time.Duration
+
+	// MaxSecrets and MaxBytes abort hydrations fetching more, see SetBudget.
+	MaxSecrets int
+	MaxBytes   int
+
+	Vars        map[string]interface{} // See SetVars.
+	Pins        map[string]string      // Field patterns to references, see PinFields.
+	K8sDeepScan bool                   // See EnableK8sDeepScan.
+	Generate    bool                   // See EnableGenerate.
+}
+
+// NewHydrator returns a hydrator fetching secrets from the provider,
+// configured by the opts, ie. instead of calling each of its setters.
+func NewHydrator(provider SecretProvider, opts Options) (*paramStore, error) {
+	ps := New(provider, opts.BasePath)
+	if opts.Logger != nil {
+		ps.SetLogger(opts.Logger)
+	}
+	for name, backend := range opts.Backends {
+		ps.SetBackend(name, backend)
+	}
+	ps.SetMissing(opts.Missing)
+	ps.SetEmpty(opts.Empty)
+	ps.SetRedaction(opts.Redaction)
+	if opts.RateLimiter != nil {
+		ps.SetRateLimiter(opts.RateLimiter)
+	} else {
+		ps.SetRateLimit(opts.RateLimit)
+	}
+	ps.SetConcurrency(opts.Concurrency)
+	if opts.CacheDir != "" {
+		if err := ps.SetCache(opts.CacheDir, opts.CacheTTL); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxSecrets > 0 || opts.MaxBytes > 0 {
+		ps.SetBudget(opts.MaxSecrets, opts.MaxBytes)
+	}
+	if opts.Vars != nil {
+		ps.SetVars(opts.Vars)
+	}
+	if len(opts.Pins) > 0 {
+		if err := ps.PinFields(opts.Pins); err != nil {
+			return nil, err
+		}
+	}
+	if opts.K8sDeepScan {
+		ps.EnableK8sDeepScan()
+	}
+	if opts.Generate {
+		ps.EnableGenerate()
+	}
+	return ps, nil
+}
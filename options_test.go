@@ -0,0 +1,66 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHydrator(t *testing.T) {
+	backend := SecretProviderFunc(func(ctx context.Context, key string) (string, error) {
+		return "vault:" + key, nil
+	})
+	tt := []struct {
+		name     string
+		opts     Options
+		input    string
+		expected string
+		err      string
+	}{
+		{name: "base path", opts: Options{BasePath: "/app"}, input: "pass: $$\n", expected: "pass: hunter2\n"},
+		{name: "backends", opts: Options{BasePath: "/app", Backends: map[string]SecretProvider{"VAULT": backend}}, input: "key: $VAULT:secret#key\n", expected: "key: vault:secret#key\n"},
+		{name: "missing", opts: Options{BasePath: "/app", Missing: MissingEmpty}, input: "other: $$\n", expected: "other: \"\"\n"},
+		{name: "redaction", opts: Options{BasePath: "/app", Redaction: RedactRef}, input: "pass: $$\n", expected: "pass: <redacted:/app/pass>\n"},
+		{name: "vars", opts: Options{BasePath: "/{{.App}}", Vars: map[string]interface{}{"App": "app"}}, input: "pass: $$\n", expected: "pass: hunter2\n"},
+		{name: "budget", opts: Options{BasePath: "/app", MaxSecrets: 1}, input: "pass: $$\nuser: $$\n", err: "--max-secrets"},
+		{name: "no base path", input: "pass: $$\n", err: "did you provide default path"},
+		{name: "generate", opts: Options{BasePath: "/app"}, input: "token: $GENERATE:hex(8)\n", err: "enable it with --generate"},
+		{name: "cache dir", opts: Options{CacheDir: "/dev/null/cache", CacheTTL: time.Hour}, err: "cache"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, svc := newFakeSSM(t, map[string]string{"/app/pass": "hunter2", "/app/user": "app"})
+			h, err := NewHydrator(SSMProvider(svc), tc.opts)
+			if err == nil {
+				var b bytes.Buffer
+				err = h.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+				if err == nil && b.String() != tc.expected {
+					t.Errorf("expected %q, got %q", tc.expected, b.String())
+				}
+			}
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error %q, got %v", tc.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNewHydratorRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(10)
+	_, svc := newFakeSSM(t, nil)
+	provider := SSMProvider(svc)
+	ps, err := NewHydrator(provider, Options{RateLimit: 1, RateLimiter: limiter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.limiter != limiter || provider.limiter != limiter {
+		t.Errorf("expected the shared limiter instead of --rate-limit")
+	}
+}
@@ -0,0 +1,99 @@
+package hydrate
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type fieldPin struct {
+	pattern string
+	ref     string
+}
+
+// PinFields makes hydrations fetch the fields matching the patterns from
+// their pinned references, whatever the fields' values are, ie. to centrally
+// control where the most sensitive values come from. Patterns are like those
+// of EncryptFields, ie. "database.password" or "api.*". References are
+// "$SECRET:/app/db_pw" or "$VAULT:kv/app#db_pw" values, or the shorthand
+// "<provider>:<key>", ie. "vault:kv/app#db_pw", where ssm stands for $SECRET.
+// Only scalar fields are pinned; fields matching several patterns are pinned
+// by the exact one, or else by the first in sorted order.
+func (ps *paramStore) PinFields(pins map[string]string) error {
+	var fieldPins []fieldPin
+	for pattern, ref := range pins {
+		if _, err := path.Match(fieldToSlash(pattern), ""); err != nil {
+			return errors.Wrapf(err, "invalid field pattern %q", pattern)
+		}
+		ref, err := parsePin(ref)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pin of %q field", pattern)
+		}
+		fieldPins = append(fieldPins, fieldPin{pattern: pattern, ref: ref})
+	}
+	sort.Slice(fieldPins, func(i, j int) bool {
+		return fieldPins[i].pattern < fieldPins[j].pattern
+	})
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.pins = fieldPins
+	return nil
+}
+
+// parsePin returns the reference of the "<provider>:<key>" shorthand.
+func parsePin(ref string) (string, error) {
+	if strings.HasPrefix(ref, "$") {
+		return ref, nil
+	}
+	i := strings.Index(ref, ":")
+	if i < 1 || i == len(ref)-1 {
+		return "", errors.Errorf("expected a $SECRET:<key> reference or <provider>:<key>, got %q", ref)
+	}
+	provider, key := strings.ToUpper(ref[:i]), ref[i+1:]
+	if provider == "SSM" {
+		provider = "SECRET"
+	}
+	return "$" + provider + ":" + key, nil
+}
+
+// pin returns the pinned reference of the field, if any, or else its value.
+func (ps *paramStore) pin(field []string, value string) string {
+	if ref, ok := ps.pinned(field); ok {
+		return ref
+	}
+	return value
+}
+
+// pinValue is like pin, for decoded values. Maps and arrays aren't pinned.
+func (ps *paramStore) pinValue(field []string, value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}, []map[string]interface{}:
+		return value
+	}
+	if ref, ok := ps.pinned(field); ok {
+		return ref
+	}
+	return value
+}
+
+// pinned returns the pinned reference of the field, see PinFields.
+func (ps *paramStore) pinned(field []string) (string, bool) {
+	if len(ps.pins) == 0 {
+		return "", false
+	}
+	name := strings.Join(field, ".")
+	for _, pin := range ps.pins {
+		if pin.pattern == name {
+			return pin.ref, true
+		}
+	}
+	for _, pin := range ps.pins {
+		if ok, _ := path.Match(fieldToSlash(pin.pattern), fieldToSlash(name)); ok {
+			return pin.ref, true
+		}
+	}
+	return "", false
+}
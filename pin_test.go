@@ -0,0 +1,108 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParsePin(t *testing.T) {
+	tt := []struct {
+		ref      string
+		expected string
+		err      bool
+	}{
+		{ref: "$SECRET:/app/db_pw", expected: "$SECRET:/app/db_pw"},
+		{ref: "ssm:/app/db_pw", expected: "$SECRET:/app/db_pw"},
+		{ref: "vault:kv/app#db_pw", expected: "$VAULT:kv/app#db_pw"},
+		{ref: "/app/db_pw", err: true},
+		{ref: "ssm:", err: true},
+		{ref: ":/app/db_pw", err: true},
+	}
+
+	for _, tc := range tt {
+		ref, err := parsePin(tc.ref)
+		if tc.err != (err != nil) || ref != tc.expected {
+			t.Errorf("%v: expected %q (error %v), got %q, %v", tc.ref, tc.expected, tc.err, ref, err)
+		}
+	}
+}
+
+func TestPinFields(t *testing.T) {
+	params := map[string]string{
+		"/app/db_pw":   "hunter2",
+		"/app/api_key": "k3y",
+		"/app/other":   "other",
+	}
+	tt := []struct {
+		name     string
+		pins     map[string]string
+		format   string
+		k8s      bool
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "yaml",
+			pins:     map[string]string{"database.password": "ssm:/app/db_pw"},
+			format:   "yaml",
+			input:    "database:\n  password: changeme\n  user: app\n",
+			expected: "database:\n    password: hunter2\n    user: app\n",
+		},
+		{
+			name:     "json",
+			pins:     map[string]string{"api.*": "$SECRET:/app/api_key"},
+			format:   "json",
+			input:    `{"api": {"key": "$SECRET:/app/other", "token": ""}}`,
+			expected: `{"api": {"key": "k3y", "token": "k3y"}}` + "\n",
+		},
+		{
+			name:     "exact over pattern",
+			pins:     map[string]string{"api.*": "ssm:/app/api_key", "api.key": "ssm:/app/db_pw"},
+			format:   "env",
+			input:    "api.key=\n",
+			expected: "api.key=hunter2\n",
+		},
+		{
+			name:     "k8s",
+			pins:     map[string]string{"stringData.db_pw": "ssm:/app/db_pw"},
+			format:   "yaml",
+			k8s:      true,
+			input:    "kind: Secret\nmetadata:\n  name: app\nstringData:\n  db_pw: changeme\n",
+			expected: "kind: Secret\nmetadata:\n    name: app\nstringData:\n    db_pw: hunter2\n",
+		},
+		{
+			name:     "maps",
+			pins:     map[string]string{"database": "ssm:/app/db_pw"},
+			format:   "yaml",
+			input:    "database:\n  user: app\n",
+			expected: "database:\n    user: app\n",
+		},
+		{name: "invalid pattern", pins: map[string]string{"api.[": "ssm:/app/api_key"}, err: `invalid field pattern "api.["`},
+		{name: "invalid ref", pins: map[string]string{"api.key": "/app/api_key"}, err: `invalid pin of "api.key" field`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := testStore(t, params)
+			err := ps.PinFields(tc.pins)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			if err := ps.Hydrate(&b, strings.NewReader(tc.input), tc.format, tc.k8s); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b.String())
+			}
+		})
+	}
+}
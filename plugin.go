@@ -0,0 +1,109 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProviderPluginPrefix is the name prefix of provider plugin executables,
+// which are looked up in $PATH, ie. hydrate-provider-vault.
+const ProviderPluginPrefix = "hydrate-provider-"
+
+// pluginRequest is written as a JSON document to the plugin's STDIN.
+type pluginRequest struct {
+	Version int    `json:"version"`
+	Key     string `json:"key"`
+}
+
+// pluginResponse is read as a JSON document from the plugin's STDOUT.
+type pluginResponse struct {
+	Value    string    `json:"value"`
+	Error    string    `json:"error,omitempty"`
+	NotFound bool      `json:"not_found,omitempty"` // The key doesn't exist, see ErrNotFound.
+	Expires  time.Time `json:"expires,omitempty"`   // Of time-boxed credentials, ie. STS.
+}
+
+// pluginProvider resolves "$PLUGIN:<name>:<key>" references by running
+// the hydrate-provider-<name> executable, similar to credential helpers.
+// Each lookup runs the plugin once, writing a {"version":1,"key":"..."}
+// request to its STDIN and reading a {"value":"..."} or {"error":"..."}
+// response from its STDOUT. Anything written to STDERR is reported on failure.
+// Plugin names can't contain path separators, so that only executables in
+// $PATH can be run.
+type pluginProvider struct {
+	mu      sync.Mutex
+	expires map[string]time.Time // Of the fetched references.
+}
+
+// PluginProvider returns the SecretProvider of "<name>:<key>" keys of
+// provider plugins, registered as the "PLUGIN" backend by New.
+func PluginProvider() SecretProvider {
+	return &pluginProvider{expires: map[string]time.Time{}}
+}
+
+func (p *pluginProvider) GetSecret(ctx context.Context, ref string) (string, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", errors.Errorf("%q doesn't look like a valid plugin reference, expected $PLUGIN:<name>:<key>", ref)
+	}
+	name, key := parts[0], parts[1]
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", errors.Errorf("%q isn't a valid plugin name", name)
+	}
+	resp, err := runPlugin(ctx, name, key)
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.expires[ref] = resp.Expires
+	p.mu.Unlock()
+	return resp.Value, nil
+}
+
+// Expiry returns the expiry reported by the plugin, see ExpiringSecretProvider.
+func (p *pluginProvider) Expiry(ref string) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expires[ref]
+}
+
+func runPlugin(ctx context.Context, name, key string) (*pluginResponse, error) {
+	bin, err := exec.LookPath(ProviderPluginPrefix + name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "provider plugin %q not found in $PATH", ProviderPluginPrefix+name)
+	}
+
+	req, err := json.Marshal(pluginRequest{Version: 1, Key: key})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "provider plugin %q failed: %v", name, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, errors.Wrapf(err, "provider plugin %q returned invalid response", name)
+	}
+	if resp.NotFound {
+		return nil, errors.Wrapf(ErrNotFound, "provider plugin %q: %q", name, key)
+	}
+	if resp.Error != "" {
+		return nil, errors.Errorf("provider plugin %q: %v", name, resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,108 @@
+package hydrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPlugin installs a hydrate-provider-test plugin in $PATH, which
+// responds to the "db", "sts", "missing", "denied" and "crash" keys, and an executable
+// outside of $PATH.
+func testPlugin(t *testing.T) string {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$(cat)" in
+*'"key":"db"'*) echo '{"value":"s3cr3t"}' ;;
+*'"key":"sts"'*) echo '{"value":"t0ken","expires":"2030-01-02T15:04:05Z"}' ;;
+*'"key":"missing"'*) echo '{"error":"no such key","not_found":true}' ;;
+*'"key":"denied"'*) echo '{"error":"denied"}' ;;
+*'"key":"crash"'*) echo 'boom' >&2; exit 1 ;;
+*) echo 'not json' ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, ProviderPluginPrefix+"test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	outside := filepath.Join(t.TempDir(), ProviderPluginPrefix+"outside")
+	if err := ioutil.WriteFile(outside, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return outside
+}
+
+func TestPluginReferences(t *testing.T) {
+	outside := testPlugin(t)
+
+	tt := []struct {
+		value    string
+		expected string
+		err      string
+	}{
+		{value: "$PLUGIN:test:db", expected: "s3cr3t"},
+		{value: "$PLUGIN:test:missing", err: `provider plugin "test": "missing": secret not found`},
+		{value: "$PLUGIN:test:denied", err: `provider plugin "test": denied`},
+		{value: "$PLUGIN:test:crash", err: `provider plugin "test" failed: boom`},
+		{value: "$PLUGIN:test:garbage", err: `provider plugin "test" returned invalid response`},
+		{value: "$PLUGIN:test", err: "doesn't look like a valid plugin reference"},
+		{value: "$PLUGIN:absent:db", err: `provider plugin "hydrate-provider-absent" not found in $PATH`},
+		{value: "$PLUGIN:../" + filepath.Base(filepath.Dir(outside)) + "/outside:db", err: "isn't a valid plugin name"},
+		{value: "$PLUGIN:..:db", err: `".." isn't a valid plugin name`},
+		{value: `$PLUGIN:a\b:db`, err: "isn't a valid plugin name"},
+	}
+	for _, tc := range tt {
+		ps := testStore(t, nil)
+		secret, err := ps.hydrateKeyValue(context.Background(), "key", tc.value)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.value, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+			continue
+		}
+		if secret == nil || *secret != tc.expected {
+			t.Errorf("%q: expected %q, got %v", tc.value, tc.expected, secret)
+		}
+	}
+}
+
+func TestPluginBudget(t *testing.T) {
+	testPlugin(t)
+
+	ps := testStore(t, nil)
+	ps.SetBudget(1, 0)
+	for _, value := range []string{"$PLUGIN:test:missing", "$PLUGIN:test:db", "$PLUGIN:test:db"} {
+		ps.hydrateKeyValue(context.Background(), "key", value)
+	}
+	secret, err := ps.hydrateKeyValue(context.Background(), "key", "$PLUGIN:test:db")
+	if err != nil || secret == nil || *secret != "s3cr3t" {
+		t.Fatalf("expected the cached s3cr3t, got %v, %v", secret, err)
+	}
+
+	// Failed lookups are free, but the budget of 1 secret is spent.
+	if _, err := ps.hydrateKeyValue(context.Background(), "key", "$PLUGIN:test:other"); err == nil || !strings.Contains(err.Error(), "--max-secrets") {
+		t.Errorf("expected the budget to be exceeded, got %v", err)
+	}
+}
+
+func TestPluginMissing(t *testing.T) {
+	testPlugin(t)
+
+	// Compare tolerates plugin secrets that don't exist.
+	left, right := testStore(t, nil), testStore(t, nil)
+	diffs, err := Compare(left, right, strings.NewReader("a: $PLUGIN:test:missing\nb: $PLUGIN:test:db\n"), "yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+}
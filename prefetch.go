@@ -0,0 +1,171 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// prefetch fetches the parameters referenced by the input up front, with up
+// to SetConcurrency requests in flight and in batches if the provider
+// supports it, so that hydration is served from the cache instead of issuing
+// one blocking request per value. It returns the input to hydrate.
+func (ps *paramStore) prefetch(ctx context.Context, r io.Reader, format string, k8s bool) (io.Reader, error) {
+	if ps.refs != nil || ps.redaction == RedactRef {
+		return r, nil
+	}
+	_, batched := ps.provider.(BatchSecretProvider)
+	if !batched && ps.concurrency <= 1 {
+		return r, nil // Nothing to gain over fetching while hydrating.
+	}
+
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read input")
+	}
+
+	// Invalid input is reported by the hydration itself.
+	keys, err := ps.References(bytes.NewReader(input), format, k8s)
+	if err != nil {
+		return bytes.NewReader(input), nil
+	}
+	if err := ps.prefetchKeys(ctx, keys); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(input), nil
+}
+
+// prefetchKeys fetches the secrets of the keys that aren't cached yet, in
+// batches if the provider supports it.
+func (ps *paramStore) prefetchKeys(ctx context.Context, keys []string) error {
+	provider, batched := ps.provider.(BatchSecretProvider)
+	size := 1
+	if batched {
+		size = maxBatchSize
+	}
+	var batches [][]string
+	for _, key := range keys {
+		if _, ok := ps.cached(ps.secretKey(key)); ok {
+			continue
+		}
+		if len(batches) == 0 || len(batches[len(batches)-1]) == size {
+			batches = append(batches, nil)
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], key)
+	}
+	if len(batches) == 0 {
+		return nil
+	}
+
+	workers := ps.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		jobs     = make(chan []string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range jobs {
+				var err error
+				if batched {
+					err = ps.fetchBatch(ctx, provider, batch)
+				} else {
+					err = ps.prefetchSecret(ctx, batch[0])
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- batch
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err() // Canceled before all batches were fetched.
+}
+
+// SetConcurrency sets the number of requests in flight while prefetching
+// the parameters referenced by the input. Defaults to 1.
+func (ps *paramStore) SetConcurrency(n int) {
+	ps.concurrency = n
+}
+
+// prefetchSecret fetches a secret of a provider without batch support.
+// Errors are left to the hydration to report, unless it was canceled.
+func (ps *paramStore) prefetchSecret(ctx context.Context, key string) error {
+	if _, err := ps.fetch(ctx, ps.provider, ps.secretKey(key), key); err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (ps *paramStore) fetchBatch(ctx context.Context, provider BatchSecretProvider, keys []string) error {
+	for i, key := range keys {
+		if err := ps.reserve(key); err != nil {
+			for _, key := range keys[:i] {
+				ps.release(key)
+			}
+			return err
+		}
+	}
+
+	var secrets map[string]string
+	err := ps.call(ctx, func() (err error) {
+		secrets, err = provider.GetSecrets(ctx, keys)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			for _, key := range keys {
+				ps.release(key)
+			}
+			return ctx.Err()
+		}
+		// Fall back to fetching one by one, which explains the errors.
+		secrets = nil
+	}
+
+	for _, key := range keys {
+		secret, ok := secrets[key]
+		if !ok {
+			ps.release(key)
+			continue
+		}
+		if err := ps.spend(key, secret); err != nil {
+			return err
+		}
+		ps.secrets.Store(ps.secretKey(key), secret)
+		ps.count(ps.secretKey(key), func(s *ProviderStats) { s.Fetched++ })
+		ps.persist(ps.secretKey(key), secret)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package hydrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPrefetch(t *testing.T) {
+	params := map[string]string{}
+	var input, output strings.Builder
+	for i := 0; i < 25; i++ {
+		params[fmt.Sprintf("/app/p%02d", i)] = fmt.Sprintf("v%v", i)
+		fmt.Fprintf(&input, "p%02d: $$\n", i)
+		fmt.Fprintf(&output, "p%02d: v%v\n", i, i)
+	}
+
+	tt := []struct {
+		input      string
+		expected   string
+		fails      map[string]apiFailure
+		frozen     *Lock
+		cached     []string
+		maxSecrets int
+		batches    int
+		singles    int
+		err        string
+	}{
+		// 25 parameters in 3 batches, served from the cache.
+		{input: input.String(), expected: output.String(), batches: 3},
+		// Cached parameters aren't fetched again.
+		{input: "a: $SECRET:/app/p00\nb: $SECRET:/app/p01\n", expected: "a: v0\nb: v1\n", cached: []string{"/app/p00"}, batches: 1},
+		// Missing parameters are fetched one by one for the error.
+		{input: "p00: $$\nmissing: $$\n", batches: 1, singles: 1, err: `"/app/missing"`},
+		// Failed batches fall back to fetching one by one.
+		{input: "p00: $$\np01: $$\n", fails: map[string]apiFailure{"/app/p01": {"AccessDeniedException", "denied"}}, batches: 1, singles: 2, err: "denied"},
+		// Frozen parameters are fetched by their locked versions, others are reported.
+		{input: "p00: $$\n", expected: "p00: v0\n", frozen: &Lock{Parameters: map[string]int64{"/app/p00": 1}}, batches: 1},
+		{input: "p00: $$\np01: $$\n", frozen: &Lock{Parameters: map[string]int64{"/app/p00": 1}}, batches: 1, err: `"/app/p01"`},
+		// The budget is checked before the batch is fetched.
+		{input: "p00: $$\np01: $$\n", maxSecrets: 1, err: "--max-secrets"},
+	}
+
+	for i, tc := range tt {
+		f, svc := newFakeSSM(t, params)
+		f.fails = tc.fails
+		provider := SSMProvider(svc)
+		if tc.frozen != nil {
+			provider.Freeze(tc.frozen)
+		}
+		ps := New(provider, "/app")
+		if tc.maxSecrets > 0 {
+			ps.SetBudget(tc.maxSecrets, 0)
+		}
+		for _, key := range tc.cached {
+			ps.secrets.Store(key, params[key])
+		}
+
+		var b strings.Builder
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", i, tc.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%v: %v", i, err)
+		} else if b.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", i, tc.expected, b.String())
+		}
+
+		if n := f.called("GetParameters"); n != tc.batches {
+			t.Errorf("%v: expected %v GetParameters calls, got %v", i, tc.batches, n)
+		}
+		if n := f.called("GetParameter"); n != tc.singles {
+			t.Errorf("%v: expected %v GetParameter calls, got %v", i, tc.singles, n)
+		}
+	}
+}
+
+// slowProvider serves its secrets after a delay, recording the max number
+// of requests in flight.
+type slowProvider struct {
+	mu       sync.Mutex
+	secrets  map[string]string
+	inFlight int
+	max      int
+}
+
+func (p *slowProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	p.mu.Lock()
+	p.inFlight++
+	if p.inFlight > p.max {
+		p.max = p.inFlight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+
+	secret, ok := p.secrets[key]
+	if !ok {
+		return "", errors.Wrapf(ErrNotFound, "%q", key)
+	}
+	return secret, nil
+}
+
+func TestPrefetchConcurrency(t *testing.T) {
+	secrets := map[string]string{}
+	var input, output strings.Builder
+	for i := 0; i < 20; i++ {
+		secrets[fmt.Sprintf("/app/p%02d", i)] = fmt.Sprintf("v%v", i)
+		fmt.Fprintf(&input, "p%02d: $$\n", i)
+		fmt.Fprintf(&output, "p%02d: v%v\n", i, i)
+	}
+
+	tt := []struct {
+		concurrency int
+		input       string
+		expected    string
+		err         string
+	}{
+		{concurrency: 0, input: input.String(), expected: output.String()},
+		{concurrency: 1, input: input.String(), expected: output.String()},
+		{concurrency: 8, input: input.String(), expected: output.String()},
+		{concurrency: 50, input: input.String(), expected: output.String()},
+		// Errors are reported by the hydration.
+		{concurrency: 8, input: "p00: $$\nmissing: $$\n", err: `"/app/missing"`},
+	}
+
+	for _, tc := range tt {
+		provider := &slowProvider{secrets: secrets}
+		ps := New(provider, "/app")
+		ps.SetConcurrency(tc.concurrency)
+
+		var b strings.Builder
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.concurrency, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.concurrency, tc.expected, b.String())
+		}
+
+		max := tc.concurrency
+		if max < 1 {
+			max = 1
+		}
+		if max > len(secrets) {
+			max = len(secrets)
+		}
+		if provider.max > max || max > 1 && provider.max < 2 {
+			t.Errorf("%v: expected up to %v requests in flight, got %v", tc.concurrency, max, provider.max)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package hydrate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// propertiesLine is a logical line of a Java .properties file, which may
+// span multiple physical lines ending with a backslash.
+type propertiesLine struct {
+	lines  []string // Physical lines, as they are.
+	prefix string   // Up to the value, ie. "  db.password = ".
+	key    string   // Unescaped.
+	value  string   // Unescaped.
+	ok     bool     // Not a blank line nor comment.
+}
+
+// propertiesScanner scans the logical lines of .properties files.
+type propertiesScanner struct {
+	scanner *bufio.Scanner
+	line    propertiesLine
+	n       int // Physical line number of the logical line's first line.
+	next    int
+}
+
+func newPropertiesScanner(r io.Reader) *propertiesScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &propertiesScanner{scanner: scanner}
+}
+
+func (s *propertiesScanner) Scan() bool {
+	if !s.scanner.Scan() {
+		return false
+	}
+	s.next++
+	s.n = s.next
+	s.line = propertiesLine{lines: []string{s.scanner.Text()}}
+
+	first := strings.TrimLeft(s.line.lines[0], " \t\f")
+	if first == "" || first[0] == '#' || first[0] == '!' {
+		return true
+	}
+
+	// Join the continuation lines, without their leading whitespace.
+	logical := s.line.lines[0]
+	for continued(logical) && s.scanner.Scan() {
+		s.next++
+		s.line.lines = append(s.line.lines, s.scanner.Text())
+		logical = logical[:len(logical)-1] + strings.TrimLeft(s.scanner.Text(), " \t\f")
+	}
+	if continued(logical) {
+		logical = logical[:len(logical)-1] // At EOF.
+	}
+
+	start := len(s.line.lines[0]) - len(first)
+	end := start
+	for end < len(logical) && !strings.ContainsRune("=: \t\f", rune(logical[end])) {
+		if logical[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end > len(logical) {
+		end = len(logical)
+	}
+	sep := end
+	for sep < len(logical) && strings.ContainsRune(" \t\f", rune(logical[sep])) {
+		sep++
+	}
+	if sep < len(logical) && (logical[sep] == '=' || logical[sep] == ':') {
+		sep++
+		for sep < len(logical) && strings.ContainsRune(" \t\f", rune(logical[sep])) {
+			sep++
+		}
+	}
+
+	s.line.prefix = logical[:sep]
+	s.line.key = unescapeProperties(logical[start:end])
+	s.line.value = unescapeProperties(logical[sep:])
+	s.line.ok = true
+	return true
+}
+
+func (s *propertiesScanner) Err() error {
+	if err := s.scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read properties file")
+	}
+	return nil
+}
+
+// continued reports whether the line ends with an odd number of
+// backslashes, ie. continues on the next line.
+func continued(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+func unescapeProperties(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if r, ok := parseUnit(s[i+1:]); ok {
+				units := []uint16{r}
+				i += 4
+				// Characters beyond the BMP, ie. emojis, are surrogate pairs.
+				if utf16.IsSurrogate(rune(r)) && strings.HasPrefix(s[i+1:], `\u`) {
+					if r2, ok := parseUnit(s[i+3:]); ok {
+						units = append(units, r2)
+						i += 6
+					}
+				}
+				b.WriteString(string(utf16.Decode(units)))
+				continue
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// parseUnit parses the 4 hex digits of a \uXXXX escape.
+func parseUnit(s string) (uint16, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(s[:4], 16, 16)
+	return uint16(r), err == nil
+}
+
+// escapeProperties escapes the value, escaping non-ASCII characters as
+// \uXXXX, since Properties.load reads ISO-8859-1 files.
+func escapeProperties(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && i == 0:
+			b.WriteString(`\ `) // Leading whitespace is skipped.
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04x`, unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// hydrateProperties hydrates Java .properties files line by line, keeping
+// comments, blank lines, continuation lines of values that aren't hydrated
+// and the order of properties.
+func (ps *paramStore) hydrateProperties(ctx context.Context, w io.Writer, r io.Reader) error {
+	scanner := newPropertiesScanner(r)
+	for scanner.Scan() {
+		line := scanner.line
+		if line.ok {
+			secret, err := ps.hydrateKeyValue(ctx, line.key, ps.pin([]string{line.key}, line.value))
+			if err != nil {
+				return errors.Wrapf(err, "failed to hydrate properties line %v", scanner.n)
+			}
+			if secret != nil {
+				sealed, err := ps.seal([]string{line.key}, *secret)
+				if err != nil {
+					return err
+				}
+				line.lines = []string{line.prefix + escapeProperties(sealed)}
+			}
+		}
+		for _, l := range line.lines {
+			if _, err := fmt.Fprintln(w, l); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// decodeProperties decodes .properties files into a flat map of strings.
+func decodeProperties(r io.Reader) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	scanner := newPropertiesScanner(r)
+	for scanner.Scan() {
+		if scanner.line.ok {
+			data[scanner.line.key] = scanner.line.value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
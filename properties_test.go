@@ -0,0 +1,92 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHydrateProperties(t *testing.T) {
+	secrets := map[string]string{
+		"/app/plain":   "s3cr3t",
+		"/app/escaped": " tab\there\\",
+		"/app/unicode": "café 🔑",
+	}
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{"db.password=$SECRET:/app/plain", "db.password=s3cr3t"},
+		{"  db.password : $SECRET:/app/plain", "  db.password : s3cr3t"},
+		{"db.password $SECRET:/app/plain", "db.password s3cr3t"},
+		{`db\ password=$SECRET:/app/plain`, `db\ password=s3cr3t`},
+		{"key=$SECRET:/app/escaped", `key=\ tab\there\\`},
+		{"key=$SECRET:/app/unicode", `key=caf\u00e9 \ud83d\udd11`},
+		{"key=$SECRET:\\\n    /app/plain", "key=s3cr3t"},
+		{"key=kept\\\n    value", "key=kept\\\n    value"},
+		{"# key=$SECRET:/app/plain", "# key=$SECRET:/app/plain"},
+		{"! key=$SECRET:/app/plain", "! key=$SECRET:/app/plain"},
+	}
+
+	for _, tc := range tt {
+		var output bytes.Buffer
+		if err := testStore(t, secrets).Hydrate(&output, strings.NewReader(tc.input), "properties", false); err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+			continue
+		}
+		if got := strings.TrimSuffix(output.String(), "\n"); got != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, got)
+		}
+	}
+}
+
+func TestUnescapeProperties(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{`plain`, "plain"},
+		{`a\tb\nc\rd\fe`, "a\tb\nc\rd\fe"},
+		{`\:\=\ \\`, `:= \`},
+		{`caf\u00e9`, "café"},
+		{`\ud83d\udd11`, "🔑"},
+		{`\u00zz`, "u00zz"},
+		{`trailing\`, `trailing\`},
+	}
+	for _, tc := range tt {
+		if got := unescapeProperties(tc.input); got != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, got)
+		}
+		if got := unescapeProperties(escapeProperties(tc.expected)); got != tc.expected {
+			t.Errorf("%q: expected escaping to round-trip, got %q", tc.expected, got)
+		}
+	}
+}
+
+func TestHydrateK8sProperties(t *testing.T) {
+	input := `kind: ConfigMap
+metadata:
+  name: app
+data:
+  application.properties: |
+    # Database
+    db.password=$SECRET:/app/plain
+    db.user=app
+`
+	expected := `kind: ConfigMap
+metadata:
+    name: app
+data:
+    application.properties: |
+        # Database
+        db.password=s3cr3t
+        db.user=app
+`
+	var output bytes.Buffer
+	if err := testStore(t, map[string]string{"/app/plain": "s3cr3t"}).Hydrate(&output, strings.NewReader(input), "yaml", true); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
@@ -0,0 +1,171 @@
+package hydrate
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SecretProvider fetches secrets from a secret store, ie. AWS SSM Parameter
+// Store, Vault, environment variables or a mock in tests.
+type SecretProvider interface {
+	// GetSecret returns the secret value of the key. If the secret doesn't
+	// exist, the returned error must match ErrNotFound (see errors.Is).
+	GetSecret(ctx context.Context, key string) (string, error)
+}
+
+// SecretWriter is implemented by providers that can store secrets,
+// ie. values generated by "$GENERATE:password(32)".
+type SecretWriter interface {
+	// PutSecret stores the secret, unless the key already exists.
+	PutSecret(ctx context.Context, key, value string) error
+}
+
+// BatchSecretProvider is implemented by providers that can fetch multiple
+// secrets at once, ie. via ssm.GetParameters. Before hydrating, all keys
+// referenced by the input are prefetched, up to maxBatchSize keys per call.
+type BatchSecretProvider interface {
+	SecretProvider
+
+	// GetSecrets returns the values of the keys. Keys that don't exist
+	// are omitted, they're fetched (and reported) one by one later.
+	GetSecrets(ctx context.Context, keys []string) (map[string]string, error)
+}
+
+// PathSecretProvider is implemented by providers that can fetch all
+// secrets of a subtree at once, ie. to warm the cache, see Warm.
+type PathSecretProvider interface {
+	GetSecretsByPath(ctx context.Context, path string) (map[string]string, error)
+}
+
+// maxBatchSize is the max number of keys passed to GetSecrets,
+// the limit of ssm.GetParameters.
+const maxBatchSize = 10
+
+// MetadataProvider is implemented by providers exposing metadata of
+// the secrets, ie. to embed their provenance via template functions.
+type MetadataProvider interface {
+	Metadata(ctx context.Context, key string) (Metadata, error)
+}
+
+// Metadata describes a secret's version and provenance.
+type Metadata struct {
+	Version      int64
+	LastModified time.Time
+	Type         string // ie. SecureString
+	ARN          string
+}
+
+// ExpiringSecretProvider is implemented by providers of time-boxed
+// secrets, ie. Vault leases or STS credentials.
+type ExpiringSecretProvider interface {
+	// Expiry returns when the fetched secret expires, or zero time.
+	Expiry(key string) time.Time
+}
+
+// NamedSecretProvider is implemented by providers naming the store they
+// fetch from, ie. "ssm". Secrets are cached and reported by "<name>:<key>",
+// so that a secret of one store is never served for another.
+type NamedSecretProvider interface {
+	Name() string
+}
+
+// ErrNotFound is returned by providers when a secret doesn't exist.
+var ErrNotFound = errors.New("secret not found")
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(ctx context.Context, key string) (string, error)
+
+// GetSecret calls f(ctx, key).
+func (f SecretProviderFunc) GetSecret(ctx context.Context, key string) (string, error) {
+	return f(ctx, key)
+}
+
+// New returns a hydrator fetching secrets from the provider. Relative
+// keys, ie. "$$" shorthands, are resolved against the basePath. Provider
+// plugins are registered as the "PLUGIN" backend, see PluginProvider.
+func New(provider SecretProvider, basePath string) *paramStore {
+	return &paramStore{
+		provider: provider,
+		secrets:  stringMap{},
+		basePath: basePath,
+		mu:       &sync.Mutex{},
+		stats:    map[string]*ProviderStats{},
+		backends: map[string]SecretProvider{"PLUGIN": PluginProvider()},
+	}
+}
+
+// SetBackend registers the provider for "$<NAME>:<key>" references, ie.
+// SetBackend("SECRETSMANAGER", provider) resolves "$SECRETSMANAGER:my-secret#db_password"
+// values. Keys are used as they are, without the base path.
+func (ps *paramStore) SetBackend(name string, provider SecretProvider) {
+	if ps.backends == nil {
+		ps.backends = map[string]SecretProvider{}
+	}
+	ps.backends[name] = provider
+	if p, ok := provider.(interface{ SetLogger(Logger) }); ok && ps.logger != nil {
+		p.SetLogger(ps.logger)
+	}
+}
+
+// backendRef splits "$<NAME>:<key>" values of registered backends.
+func (ps *paramStore) backendRef(value string) (name, key string, ok bool) {
+	if !strings.HasPrefix(value, "$") {
+		return "", "", false
+	}
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	name, key = value[1:i], value[i+1:]
+	if _, ok := ps.backends[name]; !ok {
+		return "", "", false
+	}
+	return name, key, true
+}
+
+func (ps *paramStore) getBackendSecret(ctx context.Context, name, key string) (string, error) {
+	key, err := ps.expandPath(key)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", errors.Errorf("empty $%v: reference", name)
+	}
+	if ps.refs != nil {
+		// Not a Parameter Store reference.
+		ps.pendingProviders = append(ps.pendingProviders, namespace(name, ps.backends[name]))
+		return "", nil
+	}
+	if ps.redaction != RedactNone {
+		return ps.redact(name+":"+key, func() (string, error) {
+			return ps.fetch(ctx, ps.backends[name], ps.cacheKey(name, ps.backends[name], key), key)
+		})
+	}
+	return ps.fetch(ctx, ps.backends[name], ps.cacheKey(name, ps.backends[name], key), key)
+}
+
+// namespace returns the name that the secrets of the provider, registered
+// by the backend name or the default one if empty, are cached under, see
+// NamedSecretProvider.
+func namespace(name string, provider SecretProvider) string {
+	if p, ok := provider.(NamedSecretProvider); ok {
+		return p.Name()
+	}
+	if name == "" {
+		return "default"
+	}
+	return strings.ToLower(name)
+}
+
+func (ps *paramStore) cacheKey(name string, provider SecretProvider, key string) string {
+	return namespace(name, provider) + ":" + key
+}
+
+// secretKey returns the cache key of the default provider's secret.
+func (ps *paramStore) secretKey(key string) string {
+	return ps.cacheKey("", ps.provider, key)
+}
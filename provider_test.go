@@ -0,0 +1,118 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// mapProvider is a read-only SecretProvider of its map.
+func mapProvider(secrets map[string]string) SecretProvider {
+	return SecretProviderFunc(func(ctx context.Context, key string) (string, error) {
+		secret, ok := secrets[key]
+		if !ok {
+			return "", errors.Wrapf(ErrNotFound, "%q", key)
+		}
+		return secret, nil
+	})
+}
+
+func TestSecretProvider(t *testing.T) {
+	provider := mapProvider(map[string]string{"/app/db_pass": "hunter2", "/shared/key": "k3y"})
+
+	tt := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{input: "db_pass: $$\nkey: $SECRET:/shared/key\n", expected: "db_pass: hunter2\nkey: k3y\n"},
+		{input: "missing: $$\n", err: `"/app/missing": secret not found`},
+		{input: "db_pass: $GENERATE:password(8)\n", err: "but the secret provider can't store secrets"},
+	}
+
+	for _, tc := range tt {
+		ps := New(provider, "/app")
+		ps.EnableGenerate()
+
+		var b bytes.Buffer
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, b.String())
+		}
+	}
+}
+
+func TestErrNotFound(t *testing.T) {
+	f, svc := newFakeSSM(t, map[string]string{"/app/db_pass": "hunter2"})
+	f.fails = map[string]apiFailure{"/app/denied": {"AccessDeniedException", "denied"}}
+	provider := SSMProvider(svc)
+
+	tt := []struct {
+		key      string
+		notFound bool
+	}{
+		{key: "/app/missing", notFound: true},
+		{key: "/app/denied", notFound: false},
+	}
+	for _, tc := range tt {
+		_, err := provider.GetSecret(context.Background(), tc.key)
+		if err == nil {
+			t.Fatalf("%v: expected an error", tc.key)
+		}
+		if errors.Is(err, ErrNotFound) != tc.notFound {
+			t.Errorf("%v: expected errors.Is(%v, ErrNotFound) to be %v", tc.key, err, tc.notFound)
+		}
+	}
+
+	// Compare tolerates the misses of any provider.
+	diffs, err := Compare(New(mapProvider(map[string]string{"/app/db_pass": "a"}), "/app"), ParamStore(svc, "/app"), strings.NewReader("db_pass: $$\napi_key: $$\n"), "yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Field != "db_pass" {
+		t.Errorf("expected db_pass to differ, got %v", diffs)
+	}
+}
+
+func TestHighThroughput(t *testing.T) {
+	tt := []struct {
+		setting  map[string]string
+		expected bool
+		err      string
+	}{
+		{setting: map[string]string{highThroughputSetting: "true"}, expected: true},
+		{setting: map[string]string{highThroughputSetting: "false"}},
+		{err: "failed to get Parameter Store throughput setting"},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, nil)
+		f.settings = tc.setting
+
+		high, err := SSMProvider(svc).HighThroughput(context.Background())
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.setting, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if high != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.setting, tc.expected, high)
+		}
+	}
+}
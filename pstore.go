@@ -2,78 +2,235 @@ package hydrate
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/pkg/errors"
 )
 
 //go:generate syncmap -pkg hydrate -name stringMap map[string]string
 
 type paramStore struct {
-	ssm      *ssm.SSM
+	provider SecretProvider
 	basePath string
 
 	secrets stringMap
+
+	// refs, if set, records the parameter paths requested via GetSecret
+	// instead of fetching them, see record.
+	refs      map[string]bool
+	fieldRefs []Reference
+	pending   []string // Recorded since the last hydrated field.
+
+	// providers records the first field referencing each provider by its
+	// name in refs mode, see ProviderReferences.
+	providers        map[string]string
+	pendingProviders []string
+
+	mu *sync.Mutex // Shared by clones, see clone.
+
+	// missing, if set, records parameters that don't exist instead
+	// of failing, and hydrates them as missingValue placeholders.
+	missing map[string]bool
+
+	limiter     *RateLimiter
+	concurrency int        // Prefetch requests in flight, see SetConcurrency.
+	cache       *diskCache // Persistent cache, see SetCache.
+	budget      *budget
+	stats       map[string]*ProviderStats // By provider, see Stats.
+
+	encryption *fieldEncryption
+	pins       []fieldPin // See PinFields.
+	vars       map[string]interface{}
+	generate   bool
+
+	k8sDeepScan bool      // Hydrate all Kubernetes kinds, see EnableK8sDeepScan.
+	missingMode Missing   // See SetMissing.
+	emptyMode   Empty     // See SetEmpty.
+	redaction   Redaction // See SetRedaction.
+
+	logging
+
+	backends map[string]SecretProvider // "$<NAME>:<key>" reference providers.
+	expires  time.Time                 // Earliest expiry of the fetched secrets.
 }
 
-func ParamStore(ssm *ssm.SSM, basePath string) *paramStore {
+// clone returns a paramStore configured like ps, with its own in-memory
+// secrets. The budget, stats, cache, rate limiter and field encryption are
+// shared, so that hydrations of the clone count towards those of ps.
+func (ps *paramStore) clone() *paramStore {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	backends := make(map[string]SecretProvider, len(ps.backends))
+	for name, provider := range ps.backends {
+		backends[name] = provider
+	}
 	return &paramStore{
-		ssm:      ssm,
-		secrets:  stringMap{},
-		basePath: basePath,
+		provider:    ps.provider,
+		basePath:    ps.basePath,
+		secrets:     stringMap{},
+		mu:          ps.mu,
+		limiter:     ps.limiter,
+		concurrency: ps.concurrency,
+		cache:       ps.cache,
+		budget:      ps.budget,
+		stats:       ps.stats,
+		encryption:  ps.encryption,
+		pins:        ps.pins,
+		vars:        ps.vars,
+		generate:    ps.generate,
+		k8sDeepScan: ps.k8sDeepScan,
+		missingMode: ps.missingMode,
+		emptyMode:   ps.emptyMode,
+		redaction:   ps.redaction,
+		logging:     ps.logging,
+		backends:    backends,
 	}
 }
 
-func (ps *paramStore) GetSecret(key string) (string, error) {
+func (ps *paramStore) paramPath(key string) (string, error) {
 	if !strings.HasPrefix(key, "/") {
 		if ps.basePath == "" {
 			return "", errors.Errorf("%q doesn't look like a valid parameter path, did you provide default path, ie. --path=/app/sit1/ ?", key)
 		}
 		key = filepath.Join(ps.basePath, key)
 	}
+	return ps.expandPath(key)
+}
+
+func (ps *paramStore) GetSecret(key string) (string, error) {
+	ctx := context.Background()
+	secret, err := ps.getSecret(ctx, key)
+	if err != nil {
+		return "", ps.suggest(ctx, err)
+	}
+	return secret, nil
+}
+
+func (ps *paramStore) getSecret(ctx context.Context, key string) (string, error) {
+	key, err := ps.paramPath(key)
+	if err != nil {
+		return "", err
+	}
+
+	if ps.refs != nil {
+		ps.record(key)
+		return "", nil
+	}
+	if ps.redaction != RedactNone {
+		return ps.redact(key, func() (string, error) {
+			return ps.fetch(ctx, ps.provider, ps.secretKey(key), key)
+		})
+	}
+
+	return ps.fetch(ctx, ps.provider, ps.secretKey(key), key)
+}
 
-	if secret, ok := ps.secrets.Load(key); ok {
+// fetch returns the cached secret, or fetches it from the provider,
+// honoring the rate limit and budget.
+func (ps *paramStore) fetch(ctx context.Context, provider SecretProvider, cacheKey, key string) (string, error) {
+	if secret, ok := ps.cached(cacheKey); ok {
 		return secret, nil
 	}
 
-	fmt.Fprintf(os.Stderr, "hydrate: - fetching %q secret from AWS SSM Parameter Store\n", key)
+	if err := ps.reserve(key); err != nil {
+		return "", err
+	}
 
-	param, err := ps.ssm.GetParameter(&ssm.GetParameterInput{
-		Name:           aws.String(key),
-		WithDecryption: aws.Bool(true),
+	var secret string
+	err := ps.call(ctx, func() (err error) {
+		secret, err = provider.GetSecret(ctx, key)
+		return err
 	})
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to fetch %q parameter", key)
+		ps.release(key)
+		ps.count(cacheKey, func(s *ProviderStats) { s.Failed++ })
+		if ps.missing != nil && errors.Is(err, ErrNotFound) {
+			ps.mu.Lock()
+			ps.missing[key] = true
+			ps.mu.Unlock()
+			return missingValue(key), nil
+		}
+		return "", err
 	}
 
-	secret := *param.Parameter.Value
-	ps.secrets.Store(key, secret)
+	if err := ps.spend(key, secret); err != nil {
+		return "", err
+	}
+	ps.secrets.Store(cacheKey, secret)
+	ps.count(cacheKey, func(s *ProviderStats) { s.Fetched++ })
+
+	if p, ok := provider.(ExpiringSecretProvider); ok && !p.Expiry(key).IsZero() {
+		ps.expireAt(p.Expiry(key))
+	} else {
+		ps.persist(cacheKey, secret)
+	}
 
 	return secret, nil
 }
 
-func (ps *paramStore) hydrateData(data map[string]interface{}, k8s bool) error {
+// expireAt records the expiry of a fetched secret.
+func (ps *paramStore) expireAt(expires time.Time) {
+	if expires.IsZero() {
+		return
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.expires.IsZero() || expires.Before(ps.expires) {
+		ps.expires = expires
+	}
+}
+
+// Expires returns the earliest expiry of the secrets fetched so far,
+// or zero time if none of them expire, see ExpiringSecretProvider.
+func (ps *paramStore) Expires() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.expires
+}
+
+// Forget removes the parameters from the cache, so that they're fetched
+// again on next use, ie. after they've changed in the Parameter Store.
+func (ps *paramStore) Forget(keys ...string) {
+	for _, key := range keys {
+		ps.secrets.Delete(ps.secretKey(key))
+		if ps.cache != nil {
+			ps.cache.forget(ps.secretKey(key))
+		}
+	}
+	if f, ok := ps.provider.(interface{ Forget(keys ...string) }); ok {
+		f.Forget(keys...)
+	}
+}
+
+func (ps *paramStore) hydrateData(ctx context.Context, data map[string]interface{}, k8s bool) error {
 	if k8s {
-		return ps.hydrateK8sObject(data)
+		return ps.hydrateK8sObject(ctx, data)
 	}
-	return ps.hydrateMapRecursively(data, nil)
+	return ps.hydrateMapRecursively(ctx, data, nil)
 }
 
-func (ps *paramStore) hydrateK8sObject(data map[string]interface{}) error {
+func (ps *paramStore) hydrateK8sObject(ctx context.Context, data map[string]interface{}) error {
 	// Kubernetes object.
 	kind, _ := data["kind"].(string)
-	switch kind {
-	case "ConfigMap", "Secret":
+	switch {
+	case kind == "ConfigMap" || kind == "Secret":
 		kind = strings.ToLower(kind)
+	case ps.k8sDeepScan || k8sOptedIn(data):
+		return ps.hydrateMapRecursively(ctx, data, nil)
 	default:
-		return nil // Leave any objects that are not ConfigMap or Secret untouched.
+		return nil // Leave any other objects untouched, unless opted in.
 	}
 
 	metadata, ok := data["metadata"].(map[string]interface{})
@@ -92,9 +249,12 @@ func (ps *paramStore) hydrateK8sObject(data map[string]interface{}) error {
 	} {
 		loopOver, _ := data[field.name].(map[string]interface{})
 		for key, value := range loopOver {
+			if value == nil {
+				value = "" // Null, see SetEmpty.
+			}
 			strValue, ok := value.(string)
 			if !ok {
-				fmt.Fprintf(os.Stderr, "hydrate: k8s %v/%v: failed to decode %v (kind %T)\n", kind, name, key, value)
+				ps.log(LevelWarn, "k8s: failed to decode value", "object", kind+"/"+name, "key", key, "type", fmt.Sprintf("%T", value))
 				continue
 			}
 
@@ -110,10 +270,10 @@ func (ps *paramStore) hydrateK8sObject(data map[string]interface{}) error {
 
 			format := strings.TrimLeft(filepath.Ext(key), ".")
 			switch format {
-			case "json", "yml", "yaml", "toml":
-				fmt.Fprintf(os.Stderr, "hydrate: k8s %v/%v: %v (%v %v file, base64-encoded: %v)\n", kind, name, key, field.name, strings.ToUpper(format), field.encoded)
+			case "json", "yml", "yaml", "toml", "env", "properties":
+				ps.log(LevelDebug, "k8s: hydrating file", "object", kind+"/"+name, "field", field.name, "key", key, "format", format, "base64", field.encoded)
 
-				err := ps.Hydrate(valueWriter, valueReader, format, false)
+				err := ps.HydrateContext(ctx, valueWriter, valueReader, format, false)
 				if err != nil {
 					return errors.Wrapf(err, "hydrate: k8s %v/%v: failed to hydrate %v", kind, name, key)
 				}
@@ -124,14 +284,18 @@ func (ps *paramStore) hydrateK8sObject(data map[string]interface{}) error {
 
 			default:
 				// Just a value, not a file.
-				fmt.Fprintf(os.Stderr, "hydrate: k8s %v/%v: %v (%v value, base64-encoded: %v)\n", kind, name, key, field.name, field.encoded)
+				ps.log(LevelDebug, "k8s: hydrating value", "object", kind+"/"+name, "field", field.name, "key", key, "base64", field.encoded)
 
 				var valBuf bytes.Buffer
 				valBuf.ReadFrom(valueReader)
-				if secret, err := ps.hydrateKeyValue(key, valBuf.String()); err != nil {
+				if secret, err := ps.hydrateKeyValue(ctx, key, ps.pin([]string{field.name, key}, valBuf.String())); err != nil {
 					return errors.Wrapf(err, "hydrate: k8s %v/%v: failed to hydrate %v", kind, name, key)
 				} else if secret != nil {
-					valueWriter.Write([]byte(*secret))
+					sealed, err := ps.seal([]string{field.name, key}, *secret)
+					if err != nil {
+						return errors.Wrapf(err, "hydrate: k8s %v/%v", kind, name)
+					}
+					valueWriter.Write([]byte(sealed))
 					if closer, ok := valueWriter.(io.Closer); ok {
 						closer.Close()
 					}
@@ -141,24 +305,76 @@ func (ps *paramStore) hydrateK8sObject(data map[string]interface{}) error {
 		}
 	}
 
+	if kind == "secret" {
+		// Values aren't fetched by dry runs, compared environments nor redacted previews.
+		check := ps.refs == nil && ps.missing == nil && ps.redaction == RedactNone
+		if err := validateK8sSecret(data, check); err != nil {
+			return errors.Wrapf(err, "hydrate: k8s %v/%v", kind, name)
+		}
+	}
 	return nil
 }
 
-func (ps *paramStore) hydrateKeyValue(key, value string) (*string, error) {
+// k8sAnnotation opts Kubernetes objects of any kind into hydration.
+const k8sAnnotation = "hydrate.pressly.com/enabled"
+
+// EnableK8sDeepScan hydrates all fields of Kubernetes objects of any kind,
+// ie. Deployment env vars or custom resources, not just the data of Secrets
+// and ConfigMaps. Without it, only objects annotated with
+// hydrate.pressly.com/enabled: "true" are.
+func (ps *paramStore) EnableK8sDeepScan() {
+	ps.k8sDeepScan = true
+}
+
+func k8sOptedIn(data map[string]interface{}) bool {
+	metadata, _ := data["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	enabled, _ := annotations[k8sAnnotation].(string)
+	return enabled == "true"
+}
+
+func (ps *paramStore) hydrateKeyValue(ctx context.Context, key, value string) (*string, error) {
+	if m := modifierRe.FindStringSubmatch(value); m != nil {
+		return nil, errors.Errorf("%v=%q: !%v is only supported by JSON, YAML and TOML fields", key, value, m[2])
+	}
+	if directiveRe.MatchString(value) {
+		return ps.hydrateDirectives(ctx, key, value)
+	}
+	if value == "" {
+		return ps.hydrateEmpty(ctx, key)
+	}
+
 	// Match secret values and fetch from Param Store.
 	switch {
 	case value == "$$" || value == "$SECRET":
-		secret, err := ps.GetSecret(key)
+		secret, err := ps.getSecret(ctx, key)
 		if err != nil {
-			return nil, errors.Wrapf(err, "%v=%q", key, value)
+			return ps.missingSecret(ctx, value, errors.Wrapf(err, "%v=%q", key, value))
 		}
 
 		return &secret, nil
 
-	case strings.HasPrefix(value, "$SECRET:"):
-		secretKey := strings.TrimPrefix(value, "$SECRET:")
+	case strings.HasPrefix(value, "$SECRET:") || strings.HasPrefix(value, "$SECRET?:"):
+		optional := strings.HasPrefix(value, "$SECRET?:")
+		secretKey, def, hasDefault := splitDefault(value[strings.Index(value, ":")+1:])
 
-		secret, err := ps.GetSecret(secretKey)
+		secret, err := ps.getSecret(ctx, secretKey)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) && hasDefault {
+				return &def, nil
+			}
+			if errors.Is(err, ErrNotFound) && optional && ps.missingMode != MissingKeep {
+				return &secret, nil // Empty.
+			}
+			return ps.missingSecret(ctx, value, errors.Wrapf(err, "%v=%q", key, value))
+		}
+
+		return &secret, nil
+
+	case strings.HasPrefix(value, "$GENERATE:"):
+		generator := strings.TrimPrefix(value, "$GENERATE:")
+
+		secret, err := ps.generateSecret(ctx, key, generator)
 		if err != nil {
 			return nil, errors.Wrapf(err, "%v=%q", key, value)
 		}
@@ -166,38 +382,127 @@ func (ps *paramStore) hydrateKeyValue(key, value string) (*string, error) {
 		return &secret, nil
 	}
 
+	if name, ref, ok := ps.backendRef(value); ok {
+		secret, err := ps.getBackendSecret(ctx, name, ref)
+		if err != nil {
+			return ps.missingSecret(ctx, value, errors.Wrapf(err, "%v=%q", key, value))
+		}
+
+		return &secret, nil
+	}
+
+	if strings.Contains(value, "${") {
+		return ps.interpolate(ctx, key, value)
+	}
+
 	return nil, nil
 }
 
-func (ps *paramStore) hydrateMapRecursively(data map[string]interface{}, path []string) error {
+var interpolationRe = regexp.MustCompile(`\$\{([A-Z]+\??:[^}]+)\}`)
+
+// interpolate substitutes inline references anywhere within the value, ie.
+// "postgres://user:${SECRET:/app/db_pass}@host:5432/db". Any reference style
+// works inline, ie. ${SECRETSMANAGER:db#password} or ${PLUGIN:keeper:db}.
+func (ps *paramStore) interpolate(ctx context.Context, key, value string) (*string, error) {
+	var (
+		err      error
+		hydrated bool
+	)
+	result := interpolationRe.ReplaceAllStringFunc(value, func(match string) string {
+		if err != nil {
+			return match
+		}
+		ref := "$" + interpolationRe.FindStringSubmatch(match)[1]
+		var secret *string
+		if secret, err = ps.hydrateKeyValue(ctx, key, ref); err != nil || secret == nil || *secret == ref {
+			return match // Kept as is, see SetMissing.
+		}
+		hydrated = true
+		return *secret
+	})
+	if err != nil || !hydrated {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Lookup hydrates a single reference, ie. "$SECRET:/app/db/password" or
+// "$VAULT:secret/data/app#key". Other values are returned as they are.
+func (ps *paramStore) Lookup(value string) (string, error) {
+	if value == "$$" || value == "$SECRET" {
+		return "", errors.Errorf("%q has no key to derive the parameter path from, use $SECRET:<path>", value)
+	}
+	secret, err := ps.hydrateKeyValue(context.Background(), "", value)
+	if err != nil || secret == nil {
+		return value, err
+	}
+	return *secret, nil
+}
+
+func (ps *paramStore) hydrateMapRecursively(ctx context.Context, data map[string]interface{}, path []string) error {
 	for key, value := range data {
-		switch v := value.(type) {
+		switch v := ps.pinValue(append(path, key), value).(type) {
 		case string:
-			if secret, err := ps.hydrateKeyValue(key, v); err != nil {
+			if node, err := ps.hydrateStructured(ctx, key, v, append(path, key)); err != nil {
+				return err
+			} else if node != nil {
+				if data[key], err = structuredValue(node); err != nil {
+					return err
+				}
+			} else if secret, err := ps.hydrateKeyValue(ctx, key, v); err != nil {
 				return errors.Wrapf(err, "failed to hydrate %q field", strings.Join(append(path, key), "."))
 			} else if secret != nil {
-				data[key] = *secret
+				sealed, err := ps.seal(append(path, key), *secret)
+				if err != nil {
+					return err
+				}
+				data[key] = sealed
+			}
+
+		case nil:
+			if secret, err := ps.hydrateEmpty(ctx, key); err != nil {
+				return errors.Wrapf(err, "failed to hydrate %q field", strings.Join(append(path, key), "."))
+			} else if secret != nil {
+				sealed, err := ps.seal(append(path, key), *secret)
+				if err != nil {
+					return err
+				}
+				data[key] = sealed
 			}
 
 		case map[string]interface{}:
 			// Recursively go deeper.
-			if err := ps.hydrateMapRecursively(v, append(path, key)); err != nil {
+			if err := ps.hydrateMapRecursively(ctx, v, append(path, key)); err != nil {
 				return err
 			}
 
+		case []interface{}:
+			if err := ps.hydrateSliceRecursively(ctx, v, key, append(path, key)); err != nil {
+				return err
+			}
+
+		// TOML arrays of tables, ie. [[servers]].
+		case []map[string]interface{}:
+			for i, table := range v {
+				if err := ps.hydrateMapRecursively(ctx, table, indexPath(append(path, key), i)); err != nil {
+					return err
+				}
+			}
+
 		// Support YAML merge syntax: https://yaml.org/type/merge.html
 		// The encoder treats merge objects as a map[interface{}]interface{} type
 		// We convert the interface{} key to a string and assign it back to the original map
 		// so that the hydrated secrets can be available for the upstream caller.
+		// Non-string keys, ie. numbers, are converted too.
 		case map[interface{}]interface{}:
 			vv := map[string]interface{}{}
 			for k, v := range v {
-				vv[k.(string)] = v
+				vv[fmt.Sprint(k)] = v
 			}
 			data[key] = vv
 
 			// Recursively go deeper.
-			if err := ps.hydrateMapRecursively(vv, append(path, key)); err != nil {
+			if err := ps.hydrateMapRecursively(ctx, vv, append(path, key)); err != nil {
 				return err
 			}
 
@@ -205,3 +510,76 @@ func (ps *paramStore) hydrateMapRecursively(data map[string]interface{}, path []
 	}
 	return nil
 }
+
+// hydrateSliceRecursively hydrates the elements of an array, whether string
+// values or nested maps and arrays, ie. k8s `env:` blocks. String elements
+// are hydrated as values of the array's key, which "$$" values resolve to.
+func (ps *paramStore) hydrateSliceRecursively(ctx context.Context, data []interface{}, key string, path []string) error {
+	for i, value := range data {
+		elemPath := indexPath(path, i)
+
+		switch v := ps.pinValue(elemPath, value).(type) {
+		case string:
+			if node, err := ps.hydrateStructured(ctx, key, v, elemPath); err != nil {
+				return err
+			} else if node != nil {
+				if data[i], err = structuredValue(node); err != nil {
+					return err
+				}
+			} else if secret, err := ps.hydrateKeyValue(ctx, key, v); err != nil {
+				return errors.Wrapf(err, "failed to hydrate %q field", strings.Join(elemPath, "."))
+			} else if secret != nil {
+				sealed, err := ps.seal(elemPath, *secret)
+				if err != nil {
+					return err
+				}
+				data[i] = sealed
+			}
+
+		case nil:
+			if secret, err := ps.hydrateEmpty(ctx, key); err != nil {
+				return errors.Wrapf(err, "failed to hydrate %q field", strings.Join(elemPath, "."))
+			} else if secret != nil {
+				sealed, err := ps.seal(elemPath, *secret)
+				if err != nil {
+					return err
+				}
+				data[i] = sealed
+			}
+
+		case map[string]interface{}:
+			if err := ps.hydrateMapRecursively(ctx, v, elemPath); err != nil {
+				return err
+			}
+
+		case map[interface{}]interface{}:
+			vv := map[string]interface{}{}
+			for k, v := range v {
+				vv[k.(string)] = v
+			}
+			data[i] = vv
+
+			if err := ps.hydrateMapRecursively(ctx, vv, elemPath); err != nil {
+				return err
+			}
+
+		case []interface{}:
+			if err := ps.hydrateSliceRecursively(ctx, v, key, elemPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexPath returns a copy of the field path with the array index
+// appended to its last element, ie. ["spec", "env"] -> ["spec", "env[0]"].
+func indexPath(path []string, i int) []string {
+	indexed := make([]string, len(path), len(path)+1)
+	copy(indexed, path)
+	if len(indexed) == 0 {
+		return append(indexed, fmt.Sprintf("[%v]", i))
+	}
+	indexed[len(indexed)-1] += fmt.Sprintf("[%v]", i)
+	return indexed
+}
@@ -0,0 +1,102 @@
+package hydrate
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Retries of throttled API calls, on top of the AWS SDK's own retries.
+const (
+	maxThrottleRetries = 5
+	throttleBackoff    = 200 * time.Millisecond
+)
+
+// RateLimiter spaces out AWS API calls shared by all goroutines, and by
+// all hydrators it's set on, see SetRateLimiter.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *RateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewRateLimiter returns a limiter of AWS API calls per second, or nil
+// (no limit) if perSecond isn't positive.
+func NewRateLimiter(perSecond int) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// SetRateLimit limits the number of AWS SSM API calls per second across
+// all concurrent hydrations sharing the paramStore. Zero means no limit.
+func (ps *paramStore) SetRateLimit(perSecond int) {
+	ps.SetRateLimiter(NewRateLimiter(perSecond))
+}
+
+// SetRateLimiter shares the limiter with other hydrators, ie. with the
+// fresh ones of long-running servers replacing expired ones.
+func (ps *paramStore) SetRateLimiter(l *RateLimiter) {
+	ps.limiter = l
+	if p, ok := ps.provider.(*ssmProvider); ok {
+		p.limiter = l
+	}
+}
+
+// call calls fn, waiting for the rate limit first. Throttled calls are
+// retried with exponential backoff and jitter.
+func (ps *paramStore) call(ctx context.Context, fn func() error) error {
+	backoff := throttleBackoff
+	for attempt := 0; ; attempt++ {
+		if ps.limiter != nil {
+			if err := ps.limiter.wait(ctx); err != nil {
+				return err
+			}
+		}
+		err := fn()
+		if err == nil || attempt == maxThrottleRetries || !IsThrottled(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff/2 + time.Duration(rand.Int63n(int64(backoff))))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// IsThrottled reports whether the error is of an AWS API call that was
+// throttled, ie. still after the retries of a hydration.
+func IsThrottled(err error) bool {
+	switch apiErrorCode(err) {
+	case "ThrottlingException", "Throttling", "TooManyUpdates", "TooManyRequestsException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+func TestRateLimit(t *testing.T) {
+	tt := []struct {
+		perSecond int
+		calls     int
+		min       time.Duration
+	}{
+		{perSecond: 0, calls: 10},
+		{perSecond: 50, calls: 6, min: 100 * time.Millisecond},
+		{perSecond: 100, calls: 11, min: 100 * time.Millisecond},
+	}
+
+	for _, tc := range tt {
+		params := map[string]string{}
+		for i := 0; i < tc.calls; i++ {
+			params[fmt.Sprintf("/app/param_%v", i)] = "value"
+		}
+		ps := testStore(t, params)
+		ps.SetRateLimit(tc.perSecond)
+		if (ps.limiter == nil) != (tc.perSecond == 0) {
+			t.Errorf("%v/s: unexpected limiter %v", tc.perSecond, ps.limiter)
+		}
+
+		// Concurrent hydrations share the limit.
+		start := time.Now()
+		var wg sync.WaitGroup
+		for name := range params {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if _, err := ps.GetSecret(name); err != nil {
+					t.Error(err)
+				}
+			}(name)
+		}
+		wg.Wait()
+
+		if elapsed := time.Since(start); elapsed < tc.min {
+			t.Errorf("%v/s: expected %v calls to take at least %v, took %v", tc.perSecond, tc.calls, tc.min, elapsed)
+		}
+	}
+}
+
+func TestSetRateLimiter(t *testing.T) {
+	tt := []struct {
+		perSecond int
+		stores    int
+		min       time.Duration
+	}{
+		{perSecond: 0, stores: 3},
+		{perSecond: 50, stores: 6, min: 100 * time.Millisecond},
+	}
+
+	for _, tc := range tt {
+		limiter := NewRateLimiter(tc.perSecond)
+		if (limiter == nil) != (tc.perSecond == 0) {
+			t.Errorf("%v/s: unexpected limiter %v", tc.perSecond, limiter)
+		}
+
+		// Stores replacing each other, ie. of a server, share the limit.
+		start := time.Now()
+		for i := 0; i < tc.stores; i++ {
+			ps := testStore(t, map[string]string{"/app/db_pass": "hunter2"})
+			ps.SetRateLimiter(limiter)
+			if _, err := ps.GetSecret("/app/db_pass"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < tc.min {
+			t.Errorf("%v/s: expected %v stores to take at least %v, took %v", tc.perSecond, tc.stores, tc.min, elapsed)
+		}
+	}
+}
+
+func TestHydrateContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// More parameters than a batch, so that the second one waits.
+	params := map[string]string{}
+	var batchInput string
+	for i := 0; i <= maxBatchSize; i++ {
+		params[fmt.Sprintf("/app/param_%v", i)] = "value"
+		batchInput += fmt.Sprintf("param_%v: $$\n", i)
+	}
+	params["/app/db_pass"] = "hunter2"
+
+	tt := []struct {
+		name      string
+		ctx       context.Context
+		perSecond int
+		input     string
+		expected  string
+		err       error
+	}{
+		{name: "no references", ctx: canceled, input: "user: app\n", expected: "user: app\n"},
+		{name: "canceled", ctx: canceled, input: "db_pass: $$\n", err: context.Canceled},
+		{name: "rate limited", perSecond: 1, input: batchInput, err: context.DeadlineExceeded},
+	}
+
+	for _, tc := range tt {
+		ctx := tc.ctx
+		if ctx == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+		}
+		ps := testStore(t, params)
+		ps.SetRateLimit(tc.perSecond)
+
+		start := time.Now()
+		var b bytes.Buffer
+		err := ps.HydrateContext(ctx, &b, strings.NewReader(tc.input), "yaml", false)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%v: expected cancellation, took %v", tc.name, elapsed)
+		}
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%v: expected error %v, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.name, tc.expected, b.String())
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "rate exceeded"}
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "denied"}
+
+	tt := []struct {
+		name     string
+		errs     []error // Of the attempts, nil after.
+		canceled bool
+		attempts int
+		err      error
+	}{
+		{name: "ok", attempts: 1},
+		{name: "retried", errs: []error{throttled, errors.Wrap(throttled, "wrapped")}, attempts: 3},
+		{name: "not retried", errs: []error{denied}, attempts: 1, err: denied},
+		{name: "canceled", errs: []error{throttled, throttled}, canceled: true, attempts: 1, err: throttled},
+	}
+
+	for _, tc := range tt {
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.canceled {
+			cancel()
+		}
+		ps := &paramStore{}
+
+		attempts := 0
+		err := ps.call(ctx, func() error {
+			attempts++
+			if attempts <= len(tc.errs) {
+				return tc.errs[attempts-1]
+			}
+			return nil
+		})
+		cancel()
+		if errors.Cause(err) != tc.err {
+			t.Errorf("%v: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		if attempts != tc.attempts {
+			t.Errorf("%v: expected %v attempts, got %v", tc.name, tc.attempts, attempts)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package hydrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Redaction controls how secrets are written by previews of a hydration,
+// see SetRedaction.
+type Redaction int
+
+const (
+	RedactNone Redaction = iota // Write the secrets, the default.
+	RedactRef                   // Write "<redacted:/app/db_pass>", without fetching.
+	RedactHash                  // Write "<sha256:1a2b3c4d5e6f>" of the fetched secret.
+)
+
+// SetRedaction makes hydration write placeholders instead of the secrets,
+// ie. to review which fields a hydration substitutes in a PR or pipeline
+// log. Hashes show which secrets differ between runs, without revealing
+// them. Generated secrets are never stored by redacted hydrations.
+func (ps *paramStore) SetRedaction(r Redaction) {
+	ps.redaction = r
+}
+
+// redact returns the placeholder of the secret of the ref, ie. "/app/db_pass"
+// or "VAULT:secret/data/app#key", fetched by fetch if it's hashed.
+func (ps *paramStore) redact(ref string, fetch func() (string, error)) (string, error) {
+	if ps.redaction != RedactHash {
+		return "<redacted:" + ref + ">", nil
+	}
+	secret, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "<sha256:" + hex.EncodeToString(sum[:])[:12] + ">", nil
+}
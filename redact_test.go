@@ -0,0 +1,60 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSetRedaction(t *testing.T) {
+	tt := []struct {
+		name      string
+		redaction Redaction
+		input     string
+		expected  string
+		fetched   bool
+	}{
+		{
+			name:      "refs",
+			redaction: RedactRef,
+			input:     "pass: $$\nkey: $SECRET:/app/api_key\n",
+			expected:  "pass: <redacted:/app/pass>\nkey: <redacted:/app/api_key>\n",
+		},
+		{
+			name:      "hashes",
+			redaction: RedactHash,
+			input:     "pass: $$\n",
+			expected:  "pass: <sha256:f52fbd32b2b3>\n",
+			fetched:   true,
+		},
+		{
+			name:      "generated",
+			redaction: RedactRef,
+			input:     "token: $GENERATE:password(32)\n",
+			expected:  "token: <generated:/app/token>\n",
+		},
+		{name: "none", redaction: RedactNone, input: "pass: $$\n", expected: "pass: hunter2\n", fetched: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, svc := newFakeSSM(t, map[string]string{"/app/pass": "hunter2", "/app/api_key": "k3y"})
+			ps := ParamStore(svc, "/app")
+			ps.SetRedaction(tc.redaction)
+
+			var b bytes.Buffer
+			if err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b.String())
+			}
+			if fetched := f.called("GetParameter")+f.called("GetParameters") > 0; fetched != tc.fetched {
+				t.Errorf("expected secrets fetched %v, got %v", tc.fetched, fetched)
+			}
+			if f.called("PutParameter") > 0 {
+				t.Error("expected no parameters stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Refresh re-hydrates only the fields of the previously hydrated output that
+// reference a changed parameter, ie. one whose version differs from a lock
+// file, and writes the updated output. Other fields are kept as hydrated,
+// without fetching their parameters. Fields referencing only other backends,
+// ie. $VAULT:, are never refreshed. The template and the hydrated output must
+// be json, yaml or toml, of the same format. It returns the refreshed fields,
+// sorted.
+func (ps *paramStore) Refresh(ctx context.Context, w io.Writer, template, hydrated io.Reader, format string, changed func(parameter string) bool) ([]string, error) {
+	switch format {
+	case "json", "yml", "yaml", "toml":
+	default:
+		return nil, errors.Errorf("failed to refresh: unsupported file format %q, expected json, yaml or toml", format)
+	}
+
+	template, err := ps.expandIncludes(ctx, template, format)
+	if err != nil {
+		return nil, err
+	}
+	input, err := ioutil.ReadAll(template)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read template")
+	}
+	output, err := ioutil.ReadAll(hydrated)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read hydrated file")
+	}
+
+	refs, err := ps.FieldReferencesContext(ctx, bytes.NewReader(input), format, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to refresh")
+	}
+	r := &refresher{ps: ps, ctx: ctx, fields: map[string]bool{}}
+	var keys []string
+	for _, ref := range refs {
+		if ref.Field != "" && changed(ref.Parameter) {
+			r.fields[ref.Field] = true
+			keys = append(keys, ref.Parameter)
+		}
+	}
+	if len(keys) > 0 {
+		if err := ps.prefetchKeys(ctx, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	templateDocs, err := decodeDocuments(bytes.NewReader(input), format)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode template")
+	}
+	docs, err := decodeDocuments(bytes.NewReader(output), format)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode hydrated file")
+	}
+	if len(templateDocs) != len(docs) {
+		return nil, errors.Errorf("failed to refresh: template has %v documents, hydrated file has %v", len(templateDocs), len(docs))
+	}
+	for i := range docs {
+		if err := r.walk(templateDocs[i], docs[i], "", nil, func(interface{}) {}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.refreshed) == 0 {
+		_, err := w.Write(output)
+		return nil, err
+	}
+	if err := encodeRefreshed(w, output, docs, format); err != nil {
+		return nil, err
+	}
+	sort.Strings(r.refreshed)
+	return r.refreshed, nil
+}
+
+type refresher struct {
+	ps        *paramStore
+	ctx       context.Context
+	fields    map[string]bool // Fields to refresh.
+	refreshed []string
+}
+
+// walk walks the template and the hydrated data side by side, hydrating the
+// template values of the fields to refresh into the hydrated data via set.
+// Paths are built like hydrateMapRecursively does, so that they match the
+// fields of FieldReferences.
+func (r *refresher) walk(template, hydrated interface{}, key string, path []string, set func(interface{})) error {
+	switch t := template.(type) {
+	case map[string]interface{}:
+		h, ok := hydrated.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for k, elem := range t {
+			k := k
+			if _, ok := h[k]; !ok {
+				continue
+			}
+			if err := r.walk(elem, h[k], k, append(path, k), func(x interface{}) { h[k] = x }); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		h, ok := hydrated.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, elem := range t {
+			i := i
+			if i >= len(h) {
+				break
+			}
+			if err := r.walk(elem, h[i], key, indexPath(path, i), func(x interface{}) { h[i] = x }); err != nil {
+				return err
+			}
+		}
+
+	case []map[string]interface{}:
+		// TOML arrays of tables, ie. [[servers]].
+		h, ok := hydrated.([]map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for i, table := range t {
+			if i >= len(h) {
+				break
+			}
+			if err := r.walk(table, h[i], key, indexPath(path, i), func(interface{}) {}); err != nil {
+				return err
+			}
+		}
+
+	case string:
+		field := strings.Join(path, ".")
+		if !r.fields[field] {
+			return nil
+		}
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		value, err := r.hydrate(key, t, path)
+		if err != nil {
+			return err
+		}
+		set(value)
+		r.refreshed = append(r.refreshed, field)
+	}
+	return nil
+}
+
+func (r *refresher) hydrate(key, value string, path []string) (interface{}, error) {
+	if node, err := r.ps.hydrateStructured(r.ctx, key, value, path); err != nil {
+		return nil, err
+	} else if node != nil {
+		return structuredValue(node)
+	}
+	secret, err := r.ps.hydrateKeyValue(r.ctx, key, value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to hydrate %q field", strings.Join(path, "."))
+	}
+	if secret == nil {
+		return value, nil
+	}
+	return r.ps.seal(path, *secret)
+}
+
+// encodeRefreshed writes the hydrated output with the refreshed values of
+// the docs, keeping the formatting of the output where possible.
+func encodeRefreshed(w io.Writer, output []byte, docs []interface{}, format string) error {
+	switch format {
+	case "json":
+		data, _ := docs[0].(map[string]interface{})
+		b, err := updateJSON(output, data)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode JSON")
+		}
+		_, err = w.Write(b)
+		return err
+
+	case "yml", "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(output))
+		enc := yaml.NewEncoder(w)
+		for _, doc := range docs {
+			var node yaml.Node
+			if err := dec.Decode(&node); err != nil {
+				return errors.Wrap(err, "failed to decode YAML")
+			}
+			updateYAMLNode(&node, doc)
+			if err := enc.Encode(&node); err != nil {
+				return errors.Wrap(err, "failed to encode YAML")
+			}
+		}
+		return enc.Close()
+
+	default:
+		data, _ := docs[0].(map[string]interface{})
+		if b, ok := updateTOML(output, data); ok {
+			_, err := w.Write(b)
+			return err
+		}
+		if err := toml.NewEncoder(w).Encode(data); err != nil {
+			return errors.Wrap(err, "failed to encode TOML")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	params := map[string]string{
+		"/app/db_pass": "new-pass",
+		"/app/api_key": "new-key",
+	}
+	tt := []struct {
+		name     string
+		format   string
+		template string
+		hydrated string
+		changed  []string
+		expected string
+		fields   []string
+		err      string
+	}{
+		{
+			name:     "yaml",
+			format:   "yaml",
+			template: "db:\n  pass: $SECRET:/app/db_pass\napi: $SECRET:/app/api_key\n",
+			hydrated: "db:\n  pass: old-pass\napi: old-key # kept\n",
+			changed:  []string{"/app/db_pass"},
+			expected: "db:\n    pass: new-pass\napi: old-key # kept\n",
+			fields:   []string{"db.pass"},
+		},
+		{
+			name:     "json",
+			format:   "json",
+			template: `{"pass": "$SECRET:/app/db_pass", "key": "$SECRET:/app/api_key"}`,
+			hydrated: `{"pass": "old-pass", "key": "old-key"}`,
+			changed:  []string{"/app/db_pass", "/app/api_key"},
+			fields:   []string{"key", "pass"},
+		},
+		{
+			name:     "unchanged",
+			format:   "yaml",
+			template: "pass: $SECRET:/app/db_pass\n",
+			hydrated: "pass: old-pass\n",
+			expected: "pass: old-pass\n",
+		},
+		{
+			name:     "documents",
+			format:   "yaml",
+			template: "pass: $SECRET:/app/db_pass\n---\nkey: $SECRET:/app/api_key\n",
+			hydrated: "pass: old-pass\n",
+			changed:  []string{"/app/db_pass"},
+			err:      "template has 2 documents, hydrated file has 1",
+		},
+		{name: "format", format: "env", template: "PASS=$SECRET:/app/db_pass\n", hydrated: "PASS=old\n", err: `unsupported file format "env"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			fields, err := testStore(t, params).Refresh(context.Background(), &b, strings.NewReader(tc.template), strings.NewReader(tc.hydrated), tc.format, func(parameter string) bool {
+				for _, changed := range tc.changed {
+					if parameter == changed {
+						return true
+					}
+				}
+				return false
+			})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fields, tc.fields) {
+				t.Errorf("expected refreshed fields %q, got %q", tc.fields, fields)
+			}
+			if tc.expected != "" && b.String() != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, b.String())
+			}
+			if tc.format == "json" && (!strings.Contains(b.String(), "new-pass") || !strings.Contains(b.String(), "new-key")) {
+				t.Errorf("expected the refreshed values, got %s", b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package hydrate
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Refs lists the parameters used by a run, for infrastructure as code to
+// wire IAM policies or CloudWatch alarms to exactly those parameters, ie.
+// with Terraform:
+//
+//	locals {
+//	  refs = jsondecode(file("refs.json"))
+//	}
+//
+//	data "aws_iam_policy_document" "app" {
+//	  statement {
+//	    actions   = ["ssm:GetParameter", "ssm:GetParameters"]
+//	    resources = local.refs.arns
+//	  }
+//	}
+type Refs struct {
+	Parameters []ParameterRef `json:"parameters"`
+	ARNs       []string       `json:"arns"` // Deduplicated, ie. for IAM policy resources.
+}
+
+// ParameterRef is a parameter used by a run.
+type ParameterRef struct {
+	Name    string `json:"name"`
+	ARN     string `json:"arn"`
+	Version int64  `json:"version"`
+	Type    string `json:"type"` // ie. SecureString
+}
+
+// Write encodes the refs. Parameters are sorted by name and version, so
+// that regenerated files show up as minimal diffs.
+func (r *Refs) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return errors.Wrap(err, "failed to encode refs")
+	}
+	return nil
+}
+
+// Refs returns the ARNs, versions and types of all parameters fetched so
+// far. References pinned to versions or labels are listed by the version
+// fetched.
+func (p *ssmProvider) Refs() *Refs {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	refs := &Refs{Parameters: []ParameterRef{}, ARNs: []string{}}
+	seen := map[ParameterRef]bool{}
+	arns := map[string]bool{}
+	for key, metadata := range p.metadata {
+		name, _ := parameterSelector(key)
+		ref := ParameterRef{Name: name, ARN: metadata.ARN, Version: metadata.Version, Type: metadata.Type}
+		if seen[ref] {
+			continue // ie. both "/app/db_pass" and "/app/db_pass:3".
+		}
+		seen[ref] = true
+		refs.Parameters = append(refs.Parameters, ref)
+		if ref.ARN != "" && !arns[ref.ARN] {
+			arns[ref.ARN] = true
+			refs.ARNs = append(refs.ARNs, ref.ARN)
+		}
+	}
+
+	sort.Slice(refs.Parameters, func(i, j int) bool {
+		a, b := refs.Parameters[i], refs.Parameters[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	sort.Strings(refs.ARNs)
+	return refs
+}
@@ -0,0 +1,65 @@
+package hydrate
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRefs(t *testing.T) {
+	arn := "arn:aws:ssm:us-east-1:123456789012:parameter"
+	tt := []struct {
+		input    string
+		expected *Refs
+	}{
+		{input: "name: app\n", expected: &Refs{Parameters: []ParameterRef{}, ARNs: []string{}}},
+		{
+			input: "user: $$\ndb_pass: $$\n",
+			expected: &Refs{
+				Parameters: []ParameterRef{
+					{Name: "/app/db_pass", ARN: arn + "/app/db_pass", Version: 2, Type: "SecureString"},
+					{Name: "/app/user", ARN: arn + "/app/user", Version: 1, Type: "SecureString"},
+				},
+				ARNs: []string{arn + "/app/db_pass", arn + "/app/user"},
+			},
+		},
+		{
+			input: "a: $SECRET:/app/db_pass\nb: $SECRET:/app/db_pass:2\nc: $SECRET:/app/db_pass:1\n",
+			expected: &Refs{
+				Parameters: []ParameterRef{
+					{Name: "/app/db_pass", ARN: arn + "/app/db_pass", Version: 1, Type: "SecureString"},
+					{Name: "/app/db_pass", ARN: arn + "/app/db_pass", Version: 2, Type: "SecureString"},
+				},
+				ARNs: []string{arn + "/app/db_pass"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/user": "app"})
+		f.history = map[string][]string{"/app/db_pass": {"old", "hunter2"}}
+		provider := SSMProvider(svc)
+
+		var b bytes.Buffer
+		if err := New(provider, "/app").Hydrate(&b, strings.NewReader(tc.input), "yaml", false); err != nil {
+			t.Fatal(err)
+		}
+		if refs := provider.Refs(); !reflect.DeepEqual(refs, tc.expected) {
+			t.Errorf("%q: expected %+v, got %+v", tc.input, tc.expected, refs)
+		}
+	}
+}
+
+func TestRefsWrite(t *testing.T) {
+	refs := &Refs{Parameters: []ParameterRef{{Name: "/app/a", ARN: "arn:a", Version: 3, Type: "String"}}, ARNs: []string{"arn:a"}}
+
+	var b bytes.Buffer
+	if err := refs.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"parameters\": [\n    {\n      \"name\": \"/app/a\",\n      \"arn\": \"arn:a\",\n      \"version\": 3,\n      \"type\": \"String\"\n    }\n  ],\n  \"arns\": [\n    \"arn:a\"\n  ]\n}\n"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,153 @@
+package hydrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Change describes a field hydrated by Resolve.
+type Change struct {
+	Path string // ie. "spec.env[0].value"
+	Old  string // The reference, ie. "$SECRET:/app/db_password".
+	New  string // The secret.
+}
+
+// Resolve hydrates only the fields of the decoded JSON/YAML doc matching the
+// selectors, in place, and returns the changed fields sorted by path.
+// Selectors are dot-separated field paths, optionally written as JSONPath
+// ("$.spec.env[0].value"), where "*" matches any key and "[*]" any array
+// element. A selector matching a map or array selects all fields within it.
+func (ps *paramStore) Resolve(ctx context.Context, doc interface{}, selectors []string) ([]Change, error) {
+	parsed := make([][]string, len(selectors))
+	for i, selector := range selectors {
+		parsed[i] = parseSelector(selector)
+	}
+
+	r := &resolver{ps: ps, ctx: ctx, selectors: parsed}
+	if err := r.walk(doc, nil, "", func(interface{}) {}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(r.changes, func(i, j int) bool {
+		return r.changes[i].Path < r.changes[j].Path
+	})
+	return r.changes, nil
+}
+
+type resolver struct {
+	ps        *paramStore
+	ctx       context.Context
+	selectors [][]string
+	changes   []Change
+}
+
+func (r *resolver) walk(value interface{}, path []string, key string, set func(interface{})) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			k := k
+			if err := r.walk(elem, append(path, k), k, func(x interface{}) { v[k] = x }); err != nil {
+				return err
+			}
+		}
+
+	case map[interface{}]interface{}:
+		for k, elem := range v {
+			k := k
+			if err := r.walk(elem, append(path, fmt.Sprint(k)), fmt.Sprint(k), func(x interface{}) { v[k] = x }); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for i, elem := range v {
+			i := i
+			if err := r.walk(elem, append(path, fmt.Sprintf("[%v]", i)), key, func(x interface{}) { v[i] = x }); err != nil {
+				return err
+			}
+		}
+
+	case string:
+		if !r.selected(path) {
+			return nil
+		}
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		secret, err := r.ps.hydrateKeyValue(r.ctx, key, v)
+		if err != nil {
+			return errors.Wrapf(err, "failed to hydrate %q field", formatSelector(path))
+		}
+		if secret != nil {
+			set(*secret)
+			r.changes = append(r.changes, Change{Path: formatSelector(path), Old: v, New: *secret})
+		}
+	}
+	return nil
+}
+
+// selected reports whether any selector matches the path or its parent.
+func (r *resolver) selected(path []string) bool {
+	for _, selector := range r.selectors {
+		if len(selector) > len(path) {
+			continue
+		}
+		match := true
+		for i, segment := range selector {
+			if segment == path[i] || segment == "*" && !strings.HasPrefix(path[i], "[") || segment == "[*]" && strings.HasPrefix(path[i], "[") {
+				continue
+			}
+			match = false
+			break
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSelector splits "$.spec.env[0].value" into "spec", "env", "[0]", "value".
+func parseSelector(selector string) []string {
+	selector = strings.TrimPrefix(strings.TrimPrefix(selector, "$"), ".")
+
+	var segments []string
+	for _, part := range strings.Split(selector, ".") {
+		for part != "" {
+			i := strings.Index(part, "[")
+			switch {
+			case i < 0:
+				segments = append(segments, part)
+				part = ""
+			case i > 0:
+				segments = append(segments, part[:i])
+				part = part[i:]
+			default:
+				j := strings.Index(part, "]")
+				if j < 0 {
+					segments = append(segments, part)
+					part = ""
+					continue
+				}
+				segments = append(segments, part[:j+1])
+				part = part[j+1:]
+			}
+		}
+	}
+	return segments
+}
+
+func formatSelector(path []string) string {
+	var b strings.Builder
+	for i, segment := range path {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			b.WriteString(".")
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	const manifest = `{
+		"metadata": {"name": "$SECRET:/app/user", "annotations": {"a": "$SECRET:/app/user", "b": "plain"}},
+		"spec": {"env": [
+			{"name": "DB_PASS", "value": "$SECRET:/app/db_pass"},
+			{"name": "USER", "value": "$SECRET:/app/user"}
+		], "hosts": ["$$"]}
+	}`
+
+	tt := []struct {
+		selectors []string
+		expected  []Change
+		unchanged []string // Fields left as references.
+		err       string
+	}{
+		{
+			selectors: []string{"$.spec.env[*].value"},
+			expected: []Change{
+				{Path: "spec.env[0].value", Old: "$SECRET:/app/db_pass", New: "hunter2"},
+				{Path: "spec.env[1].value", Old: "$SECRET:/app/user", New: "app"},
+			},
+			unchanged: []string{"metadata.name", "metadata.annotations.a"},
+		},
+		{
+			selectors: []string{"metadata.annotations", "spec.env[1]"},
+			expected: []Change{
+				{Path: "metadata.annotations.a", Old: "$SECRET:/app/user", New: "app"},
+				{Path: "spec.env[1].value", Old: "$SECRET:/app/user", New: "app"},
+			},
+			unchanged: []string{"metadata.name", "spec.env[0].value"},
+		},
+		{
+			selectors: []string{"*.name", "spec.hosts"},
+			expected: []Change{
+				{Path: "metadata.name", Old: "$SECRET:/app/user", New: "app"},
+				{Path: "spec.hosts[0]", Old: "$$", New: "h1"},
+			},
+			unchanged: []string{"spec.env[0].value"},
+		},
+		{selectors: []string{"spec.nothing", "*.env.value"}},
+		{selectors: []string{"spec"}, err: `failed to hydrate "spec.env[0].value" field`},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/user": "app", "/app/hosts": "h1"})
+		if tc.err == "" {
+			ps = testStore(t, map[string]string{"/app/user": "app", "/app/hosts": "h1", "/app/db_pass": "hunter2"})
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(manifest), &doc); err != nil {
+			t.Fatal(err)
+		}
+		changes, err := ps.Resolve(context.Background(), doc, tc.selectors)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.selectors, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(changes, tc.expected) {
+			t.Errorf("%q: expected changes %+v, got %+v", tc.selectors, tc.expected, changes)
+		}
+
+		for _, change := range tc.expected {
+			if value := lookupField(doc, change.Path); value != change.New {
+				t.Errorf("%q: expected %v to be %q, got %q", tc.selectors, change.Path, change.New, value)
+			}
+		}
+		for _, path := range tc.unchanged {
+			if value := lookupField(doc, path); !strings.HasPrefix(value, "$") {
+				t.Errorf("%q: expected %v to be left unhydrated, got %q", tc.selectors, path, value)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	doc := map[string]interface{}{"a": "$SECRET:/app/user"}
+	if _, err := testStore(t, nil).Resolve(ctx, doc, []string{"a"}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// lookupField returns the string value of the parsed selector's field.
+func lookupField(doc interface{}, path string) string {
+	for _, segment := range parseSelector(path) {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			doc = v[segment]
+		case []interface{}:
+			var i int
+			json.Unmarshal([]byte(strings.Trim(segment, "[]")), &i)
+			doc = v[i]
+		}
+	}
+	s, _ := doc.(string)
+	return s
+}
+
+func TestParseSelector(t *testing.T) {
+	tt := []struct {
+		selector  string
+		expected  []string
+		formatted string
+	}{
+		{selector: "$.spec.env[0].value", expected: []string{"spec", "env", "[0]", "value"}, formatted: "spec.env[0].value"},
+		{selector: "spec.env[*]", expected: []string{"spec", "env", "[*]"}, formatted: "spec.env[*]"},
+		{selector: "a[0][1].b", expected: []string{"a", "[0]", "[1]", "b"}, formatted: "a[0][1].b"},
+		{selector: "a[0", expected: []string{"a", "[0"}, formatted: "a[0"},
+		{selector: "$", expected: nil, formatted: ""},
+	}
+	for _, tc := range tt {
+		segments := parseSelector(tc.selector)
+		if !reflect.DeepEqual(segments, tc.expected) {
+			t.Errorf("%v: expected %q, got %q", tc.selector, tc.expected, segments)
+		}
+		if s := formatSelector(segments); s != tc.formatted {
+			t.Errorf("%v: expected %q, got %q", tc.selector, tc.formatted, s)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package hydrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// updateJSON returns the JSON input with the string values that differ
+// in the hydrated data replaced, by strings or spliced documents, so that
+// the key order, formatting and numbers of the input are kept as they are.
+func updateJSON(input []byte, data interface{}) ([]byte, error) {
+	u := &jsonUpdater{input: input, dec: json.NewDecoder(bytes.NewReader(input))}
+	if err := u.value(data); err != nil {
+		return nil, err
+	}
+
+	end := int(u.dec.InputOffset())
+	out := append(u.out, input[u.last:end]...)
+	return append(out, '\n'), nil
+}
+
+type jsonUpdater struct {
+	input []byte
+	dec   *json.Decoder
+	out   []byte
+	last  int // Offset of the input copied into out.
+}
+
+func (u *jsonUpdater) value(data interface{}) error {
+	start := int(u.dec.InputOffset())
+	tok, err := u.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			m, _ := data.(map[string]interface{})
+			for u.dec.More() {
+				key, err := u.dec.Token()
+				if err != nil {
+					return err
+				}
+				k, _ := key.(string)
+				if err := u.value(m[k]); err != nil {
+					return err
+				}
+			}
+		case '[':
+			items, _ := data.([]interface{})
+			for i := 0; u.dec.More(); i++ {
+				var item interface{}
+				if i < len(items) {
+					item = items[i]
+				}
+				if err := u.value(item); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := u.dec.Token() // Closing delimiter.
+		return err
+
+	case string:
+		hydrated, ok := data.(string)
+		if ok && hydrated == v || data == nil {
+			return nil
+		}
+		// Other values are documents spliced by "$INCLUDE:" references, or
+		// structured values spliced by !list, !json or !yaml ones.
+		// The string token starts after any whitespace, ':' and ','.
+		return u.replace(start+bytes.IndexByte(u.input[start:], '"'), data)
+
+	default:
+		if _, ok := data.(string); ok {
+			// Hydrated null, see SetEmpty, or pinned number or boolean,
+			// see PinFields.
+			rest := u.input[start:]
+			return u.replace(start+len(rest)-len(bytes.TrimLeft(rest, " \t\r\n:,")), data)
+		}
+	}
+	return nil
+}
+
+// replace replaces the input from start up to the decoder's offset with
+// the value.
+func (u *jsonUpdater) replace(start int, data interface{}) error {
+	quoted, err := marshalJSON(data)
+	if err != nil {
+		return err
+	}
+	u.out = append(u.out, u.input[u.last:start]...)
+	u.out = append(u.out, quoted...)
+	u.last = int(u.dec.InputOffset())
+	return nil
+}
+
+// marshalJSON encodes the value without escaping <, > and &, which only
+// matters to JSON embedded in HTML.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+var (
+	tomlTableRe   = regexp.MustCompile(`^\s*(\[\[?)\s*([^\[\]#]+?)\s*\]\]?\s*(?:#.*)?$`)
+	tomlStringRe  = regexp.MustCompile(`^(\s*)([A-Za-z0-9_\-."' ]+?)(\s*=\s*)("(?:[^"\\]|\\.)*"|'[^']*')(.*)$`)
+	tomlInlineRe  = regexp.MustCompile(`^(\s*)([A-Za-z0-9_\-."' ]+?)(\s*=\s*)([\[{].*)$`)
+	tomlBareKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// updateTOML returns the TOML input with the single-line string values that
+// differ in the hydrated data replaced, so that the key order, formatting and
+// comments are kept as they are. Strings replaced by other values, ie. spliced
+// documents, and single-line arrays and inline tables with hydrated values are
+// written inline. It reports false if values within multi-line arrays were
+// hydrated and can't be replaced in place.
+func updateTOML(input []byte, data map[string]interface{}) ([]byte, bool) {
+	var (
+		out       bytes.Buffer
+		table     []tomlStep
+		arrays    = map[string]int{} // Number of [[array]] tables so far.
+		multiline bool
+	)
+	for _, line := range strings.SplitAfter(string(input), "\n") {
+		text := strings.TrimRight(line, "\r\n")
+		if strings.Contains(text, `"""`) || strings.Contains(text, `'''`) {
+			// Leave multi-line strings as they are.
+			if strings.Count(text, `"""`)%2 == 1 || strings.Count(text, `'''`)%2 == 1 {
+				multiline = !multiline
+			}
+			out.WriteString(line)
+			continue
+		}
+		if multiline {
+			out.WriteString(line)
+			continue
+		}
+
+		if m := tomlTableRe.FindStringSubmatch(text); m != nil {
+			table = nil
+			for _, key := range splitTOMLKey(m[2]) {
+				table = append(table, tomlStep{key: key, index: -1})
+			}
+			if m[1] == "[[" {
+				name := strings.Join(splitTOMLKey(m[2]), ".")
+				table[len(table)-1].index = arrays[name]
+				arrays[name]++
+			}
+			out.WriteString(line)
+			continue
+		}
+
+		m := tomlStringRe.FindStringSubmatch(text)
+		if m == nil {
+			m = tomlInlineRe.FindStringSubmatch(text)
+			if m != nil {
+				value, comment, ok := splitTOMLComment(m[4])
+				if !ok {
+					m = nil
+				} else {
+					m = []string{m[0], m[1], m[2], m[3], value, comment}
+				}
+			}
+		}
+		if m == nil {
+			out.WriteString(line)
+			continue
+		}
+		path := append([]tomlStep{}, table...)
+		for _, key := range splitTOMLKey(m[2]) {
+			path = append(path, tomlStep{key: key, index: -1})
+		}
+
+		var old map[string]interface{}
+		value := lookupTOML(data, path)
+		if _, err := toml.Decode("v = "+m[4], &old); err != nil || value == nil || reflect.DeepEqual(old["v"], value) {
+			out.WriteString(line)
+			continue
+		}
+		quoted, err := inlineTOML(value, m[4][0])
+		if err != nil {
+			return nil, false
+		}
+		out.WriteString(m[1] + m[2] + m[3] + quoted + m[5] + line[len(text):])
+	}
+
+	// Make sure all hydrated values were replaced, comparing them as
+	// encoded, ie. with int64 integers.
+	var b bytes.Buffer
+	var check, expected map[string]interface{}
+	if _, err := toml.Decode(out.String(), &check); err != nil {
+		return nil, false
+	}
+	if err := toml.NewEncoder(&b).Encode(data); err != nil {
+		return nil, false
+	}
+	if _, err := toml.Decode(b.String(), &expected); err != nil || !reflect.DeepEqual(check, expected) {
+		return nil, false
+	}
+	return out.Bytes(), true
+}
+
+// inlineTOML encodes the value as an inline TOML value, strings quoted like
+// quoteTOML.
+func inlineTOML(value interface{}, quote byte) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return quoteTOML(v, quote), nil
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			s, err := inlineTOML(v[key], '"')
+			if err != nil {
+				return "", err
+			}
+			if !tomlBareKeyRe.MatchString(key) {
+				key = quoteTOML(key, '"')
+			}
+			parts = append(parts, key+" = "+s)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, table := range v {
+			items[i] = table
+		}
+		return inlineTOML(items, quote)
+
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := inlineTOML(item, '"')
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+
+	case nil:
+		return "", errors.New("TOML has no null values")
+	}
+
+	// Numbers, booleans and dates.
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(map[string]interface{}{"v": value}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(b.String(), "v = ")), nil
+}
+
+// splitTOMLComment splits the single-line value of an array or inline table
+// from any whitespace and comment after it. It reports false if the value
+// doesn't end on the line.
+func splitTOMLComment(s string) (value, comment string, ok bool) {
+	var v map[string]interface{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '#' {
+			continue
+		}
+		value = strings.TrimRight(s[:i], " \t")
+		if _, err := toml.Decode("v = "+value, &v); err == nil {
+			return value, s[len(value):], true
+		}
+	}
+	value = strings.TrimRight(s, " \t")
+	if _, err := toml.Decode("v = "+value, &v); err != nil {
+		return "", "", false
+	}
+	return value, s[len(value):], true
+}
+
+type tomlStep struct {
+	key   string
+	index int // Index within an array of tables, or -1.
+}
+
+func lookupTOML(data interface{}, path []tomlStep) interface{} {
+	for _, step := range path {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		data = m[step.key]
+		if step.index >= 0 {
+			tables, ok := data.([]map[string]interface{})
+			if !ok || step.index >= len(tables) {
+				return nil
+			}
+			data = tables[step.index]
+		}
+	}
+	return data
+}
+
+// splitTOMLKey splits the dotted key, ie. `a."b.c".d`, into its parts.
+func splitTOMLKey(key string) []string {
+	var (
+		parts []string
+		part  strings.Builder
+		quote rune
+	)
+	for _, c := range key {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		case c != ' ' && c != '\t':
+			part.WriteRune(c)
+		}
+	}
+	return append(parts, strings.TrimSpace(part.String()))
+}
+
+// quoteTOML quotes the value as a TOML literal string, if it was one and
+// the value can be, or a basic string.
+func quoteTOML(value string, quote byte) string {
+	if quote == '\'' && !strings.ContainsAny(value, "'\r\n") {
+		return "'" + value + "'"
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range value {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, c)
+				continue
+			}
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package hydrate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUpdateJSON(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		data     interface{}
+		expected string
+	}{
+		{
+			name:     "keeps key order and formatting",
+			input:    "{\n  \"b\": \"$$\",\n  \"a\":   1.50\n}",
+			data:     map[string]interface{}{"a": json.Number("1.50"), "b": "secret"},
+			expected: "{\n  \"b\": \"secret\",\n  \"a\":   1.50\n}\n",
+		},
+		{
+			name:     "keeps big numbers",
+			input:    `{"id": 9007199254740993, "key": "$$"}`,
+			data:     map[string]interface{}{"id": json.Number("9007199254740993"), "key": "k3y"},
+			expected: `{"id": 9007199254740993, "key": "k3y"}` + "\n",
+		},
+		{
+			name:     "escapes strings",
+			input:    `{"key": "$$"}`,
+			data:     map[string]interface{}{"key": "\"quoted\"\n\\"},
+			expected: `{"key": "\"quoted\"\n\\"}` + "\n",
+		},
+		{
+			name:     "arrays",
+			input:    `{"hosts": ["$$", "kept", ["$$"]]}`,
+			data:     map[string]interface{}{"hosts": []interface{}{"a", "kept", []interface{}{"b"}}},
+			expected: `{"hosts": ["a", "kept", ["b"]]}` + "\n",
+		},
+		{
+			name:     "strings replaced by documents",
+			input:    `{"db": "$INCLUDE:db.yml", "n": null}`,
+			data:     map[string]interface{}{"db": map[string]interface{}{"host": "db", "port": json.Number("5432")}, "n": nil},
+			expected: `{"db": {"host":"db","port":5432}, "n": null}` + "\n",
+		},
+		{
+			name:     "unchanged",
+			input:    `[{"a": "x"}, true]`,
+			data:     []interface{}{map[string]interface{}{"a": "x"}, true},
+			expected: `[{"a": "x"}, true]` + "\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := updateJSON([]byte(tc.input), tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestUpdateTOML(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		data     map[string]interface{}
+		expected string
+		ok       bool
+	}{
+		{
+			name:     "keeps comments",
+			input:    "# Config.\nname = \"$$\" # The name.\nport = 8080\n",
+			data:     map[string]interface{}{"name": "app", "port": int64(8080)},
+			expected: "# Config.\nname = \"app\" # The name.\nport = 8080\n",
+			ok:       true,
+		},
+		{
+			name:     "tables",
+			input:    "[db]\npassword = '$$'\n\n[db.replica]\npassword = \"$$\"\n",
+			data:     map[string]interface{}{"db": map[string]interface{}{"password": "a'b", "replica": map[string]interface{}{"password": "c\"d"}}},
+			expected: "[db]\npassword = \"a'b\"\n\n[db.replica]\npassword = \"c\\\"d\"\n",
+			ok:       true,
+		},
+		{
+			name:     "arrays of tables",
+			input:    "[[users]]\npassword = \"$$\"\n[[users]]\npassword = \"kept\"\n",
+			data:     map[string]interface{}{"users": []map[string]interface{}{{"password": "a"}, {"password": "kept"}}},
+			expected: "[[users]]\npassword = \"a\"\n[[users]]\npassword = \"kept\"\n",
+			ok:       true,
+		},
+		{
+			name:     "single-line arrays",
+			input:    "hosts = [\"$$\", \"b\"] # Hosts.\n",
+			data:     map[string]interface{}{"hosts": []interface{}{"a", "b"}},
+			expected: "hosts = [\"a\", \"b\"] # Hosts.\n",
+			ok:       true,
+		},
+		{
+			name:     "strings replaced by documents",
+			input:    "db = \"$INCLUDE:db.yml\"\n",
+			data:     map[string]interface{}{"db": map[string]interface{}{"port": int64(5432), "host": "db"}},
+			expected: "db = { host = \"db\", port = 5432 }\n",
+			ok:       true,
+		},
+		{
+			name:  "multi-line arrays",
+			input: "hosts = [\n  \"$$\",\n]\n",
+			data:  map[string]interface{}{"hosts": []interface{}{"a"}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			output, ok := updateTOML([]byte(tc.input), tc.data)
+			if ok != tc.ok {
+				t.Fatalf("expected ok %v, got %v:\n%s", tc.ok, ok, output)
+			}
+			if ok && string(output) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/pkg/errors"
+)
+
+// SecretsManagerAPI is the part of the AWS Secrets Manager client used by
+// hydrate, implemented by *secretsmanager.Client.
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// secretsManagerProvider fetches secrets from AWS Secrets Manager.
+type secretsManagerProvider struct {
+	sm SecretsManagerAPI
+
+	mu     sync.Mutex
+	values map[string]string // Raw values of the fetched secrets.
+
+	logging
+}
+
+// SecretsManagerProvider returns a SecretProvider fetching secrets from
+// AWS Secrets Manager. Keys are secret names or ARNs, optionally followed
+// by "#<key>" to select a key of a JSON-valued secret, ie. "my-secret#db_password".
+func SecretsManagerProvider(svc SecretsManagerAPI) *secretsManagerProvider {
+	return &secretsManagerProvider{
+		sm:     svc,
+		values: map[string]string{},
+	}
+}
+
+// Name returns "secretsmanager", see NamedSecretProvider.
+func (p *secretsManagerProvider) Name() string {
+	return "secretsmanager"
+}
+
+func (p *secretsManagerProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	name, field := key, ""
+	if i := strings.LastIndex(key, "#"); i >= 0 {
+		name, field = key[:i], key[i+1:]
+	}
+
+	value, err := p.getSecretValue(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if field == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", errors.Wrapf(err, "%q secret is not a JSON object, can't select %q key", name, field)
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", errors.Wrapf(ErrNotFound, "%q secret has no %q key", name, field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (p *secretsManagerProvider) getSecretValue(ctx context.Context, name string) (string, error) {
+	p.mu.Lock()
+	value, ok := p.values[name]
+	p.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	p.log(LevelInfo, "fetching secret", "key", name, "from", "AWS Secrets Manager")
+
+	out, err := p.sm.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", errors.Wrapf(ErrNotFound, "secret %q doesn't exist in AWS Secrets Manager", name)
+		}
+		return "", errors.Wrapf(err, "failed to fetch %q secret", name)
+	}
+
+	value = aws.ToString(out.SecretString)
+	if out.SecretString == nil {
+		value = string(out.SecretBinary)
+	}
+
+	p.mu.Lock()
+	p.values[name] = value
+	p.mu.Unlock()
+
+	return value, nil
+}
+
+// Forget drops the cached values of the secrets.
+func (p *secretsManagerProvider) Forget(keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, key := range keys {
+		if i := strings.LastIndex(key, "#"); i >= 0 {
+			key = key[:i]
+		}
+		delete(p.values, key)
+	}
+}
@@ -0,0 +1,77 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSecretsManager(t *testing.T) {
+	secrets := map[string]string{
+		"app/db":     `{"user": "app", "password": "hunter2", "port": 5432, "opts": {"ssl": true}}`,
+		"app/token":  "t0ken",
+		"app/broken": "not json",
+	}
+
+	tt := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			input:    "user: $SECRETSMANAGER:app/db#user\npass: $SECRETSMANAGER:app/db#password\ntoken: $SECRETSMANAGER:app/token\n",
+			expected: "user: app\npass: hunter2\ntoken: t0ken\n",
+		},
+		{
+			input:    "port: $SECRETSMANAGER:app/db#port\nopts: $SECRETSMANAGER:app/db#opts\n",
+			expected: "port: \"5432\"\nopts: '{\"ssl\":true}'\n",
+		},
+		{input: "user: $SECRETSMANAGER:app/db#missing\n", err: `"app/db" secret has no "missing" key`},
+		{input: "user: $SECRETSMANAGER:app/missing\n", err: `secret "app/missing" doesn't exist in AWS Secrets Manager`},
+		{input: "user: $SECRETSMANAGER:app/broken#user\n", err: `"app/broken" secret is not a JSON object, can't select "user" key`},
+		{input: "user: \"$SECRETSMANAGER:\"\n", err: "empty $SECRETSMANAGER: reference"},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSecretsManager(t, secrets)
+		ps := testStore(t, nil)
+		ps.SetBackend("SECRETSMANAGER", SecretsManagerProvider(svc))
+
+		var b bytes.Buffer
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, b.String())
+		}
+
+		// Keys of the same secret share one fetch.
+		if n := f.called("secretsmanager.GetSecretValue"); n > 2 {
+			t.Errorf("%q: expected up to 2 GetSecretValue calls, got %v", tc.input, n)
+		}
+	}
+}
+
+func TestSecretsManagerBackend(t *testing.T) {
+	f, svc := newFakeSecretsManager(t, map[string]string{"/app/db_pass": "hunter2"})
+	provider := SecretsManagerProvider(svc)
+	ps := New(provider, "/app")
+
+	for i := 0; i < 2; i++ {
+		secret, err := ps.GetSecret("db_pass")
+		if err != nil || secret != "hunter2" {
+			t.Fatalf("expected hunter2, got %q, %v", secret, err)
+		}
+		ps.Forget("/app/db_pass")
+	}
+	if n := f.called("secretsmanager.GetSecretValue"); n != 2 {
+		t.Errorf("expected forgotten secrets to be fetched again, got %v calls", n)
+	}
+}
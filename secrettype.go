@@ -0,0 +1,118 @@
+package hydrate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxK8sSecretSize is the max size of the data of a Secret accepted by the
+// Kubernetes API server.
+const maxK8sSecretSize = 1 << 20
+
+// k8sSecretTypes are the keys required by the built-in Secret types, any
+// of which are required by the keys' entries. Other types, ie. Opaque or
+// custom ones, have no required keys.
+var k8sSecretTypes = map[string][][]string{
+	"kubernetes.io/service-account-token": nil,
+	"kubernetes.io/dockercfg":             {{".dockercfg"}},
+	"kubernetes.io/dockerconfigjson":      {{".dockerconfigjson"}},
+	"kubernetes.io/basic-auth":            {{"username", "password"}},
+	"kubernetes.io/ssh-auth":              {{"ssh-privatekey"}},
+	"kubernetes.io/tls":                   {{"tls.crt"}, {"tls.key"}},
+	"bootstrap.kubernetes.io/token":       {{"token-id"}, {"token-secret"}},
+}
+
+var (
+	bootstrapTokenIDRe     = regexp.MustCompile(`^[a-z0-9]{6}$`)
+	bootstrapTokenSecretRe = regexp.MustCompile(`^[a-z0-9]{16}$`)
+)
+
+// validateK8sSecret checks the hydrated Secret the way the API server
+// would, ie. that a kubernetes.io/tls Secret has both tls.crt and tls.key,
+// so that it fails before it's applied. Values are only checked if they
+// were fetched, not during dry runs, see check.
+func validateK8sSecret(secret map[string]interface{}, check bool) error {
+	secretType, _ := secret["type"].(string)
+
+	values := map[string][]byte{}
+	data, _ := secret["data"].(map[string]interface{})
+	for key, value := range data {
+		s, _ := value.(string)
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil && check {
+			return errors.Errorf("data.%v isn't base64-encoded", key)
+		}
+		values[key] = b
+	}
+	stringData, _ := secret["stringData"].(map[string]interface{})
+	for key, value := range stringData {
+		s, _ := value.(string)
+		values[key] = []byte(s) // Overrides data, like the API server.
+	}
+
+	size := 0
+	for key, value := range values {
+		if !k8sSecretKeyRe.MatchString(key) {
+			return errors.Errorf("%q: Secret keys may only contain a-z, A-Z, 0-9, -._", key)
+		}
+		size += len(value)
+	}
+	if check && size > maxK8sSecretSize {
+		return errors.Errorf("Secret data of %v bytes exceeds the 1MiB limit", size)
+	}
+
+	for _, keys := range k8sSecretTypes[secretType] {
+		if !hasAnyKey(values, keys) {
+			return errors.Errorf("%v Secret requires %v", secretType, strings.Join(quoteKeys(keys), " or "))
+		}
+	}
+
+	switch secretType {
+	case "kubernetes.io/service-account-token":
+		metadata, _ := secret["metadata"].(map[string]interface{})
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		if name, _ := annotations["kubernetes.io/service-account.name"].(string); name == "" {
+			return errors.Errorf("%v Secret requires the kubernetes.io/service-account.name annotation", secretType)
+		}
+
+	case "kubernetes.io/dockercfg", "kubernetes.io/dockerconfigjson":
+		key := "." + strings.TrimPrefix(secretType, "kubernetes.io/")
+		if check && !json.Valid(values[key]) {
+			return errors.Errorf("%v Secret's %q key isn't valid JSON", secretType, key)
+		}
+
+	case "bootstrap.kubernetes.io/token":
+		if !check {
+			break
+		}
+		id, token := string(values["token-id"]), string(values["token-secret"])
+		if !bootstrapTokenIDRe.MatchString(id) {
+			return errors.Errorf("%v Secret's \"token-id\" must be 6 characters of a-z, 0-9", secretType)
+		}
+		if !bootstrapTokenSecretRe.MatchString(token) {
+			return errors.Errorf("%v Secret's \"token-secret\" must be 16 characters of a-z, 0-9", secretType)
+		}
+	}
+	return nil
+}
+
+func hasAnyKey(values map[string][]byte, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteKeys(keys []string) []string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = `"` + key + `"`
+	}
+	return quoted
+}
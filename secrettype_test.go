@@ -0,0 +1,60 @@
+package hydrate
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestValidateK8sSecret(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	secret := func(secretType string, data, stringData map[string]interface{}) map[string]interface{} {
+		s := map[string]interface{}{"type": secretType}
+		if data != nil {
+			s["data"] = data
+		}
+		if stringData != nil {
+			s["stringData"] = stringData
+		}
+		return s
+	}
+	tt := []struct {
+		name   string
+		secret map[string]interface{}
+		check  bool
+		err    string
+	}{
+		{name: "opaque", secret: secret("Opaque", map[string]interface{}{"a": b64([]byte("x"))}, nil), check: true},
+		{name: "tls", secret: secret("kubernetes.io/tls", map[string]interface{}{"tls.crt": b64([]byte("crt"))}, map[string]interface{}{"tls.key": "key"}), check: true},
+		{name: "tls without key", secret: secret("kubernetes.io/tls", map[string]interface{}{"tls.crt": b64([]byte("crt"))}, nil), err: `kubernetes.io/tls Secret requires "tls.key"`},
+		{name: "basic auth", secret: secret("kubernetes.io/basic-auth", nil, map[string]interface{}{"password": "hunter2"}), check: true},
+		{name: "basic auth without keys", secret: secret("kubernetes.io/basic-auth", nil, map[string]interface{}{}), err: `requires "username" or "password"`},
+		{name: "not base64", secret: secret("Opaque", map[string]interface{}{"a": "not base64!"}, nil), check: true, err: "data.a isn't base64-encoded"},
+		{name: "not base64 in dry runs", secret: secret("Opaque", map[string]interface{}{"a": "$SECRET:/app/a"}, nil)},
+		{name: "invalid key", secret: secret("Opaque", nil, map[string]interface{}{"a b": "x"}), err: `"a b": Secret keys may only contain`},
+		{name: "too large", secret: secret("Opaque", nil, map[string]interface{}{"a": strings.Repeat("x", maxK8sSecretSize+1)}), check: true, err: "exceeds the 1MiB limit"},
+		{name: "dockerconfigjson", secret: secret("kubernetes.io/dockerconfigjson", nil, map[string]interface{}{".dockerconfigjson": "{not json"}), check: true, err: "isn't valid JSON"},
+		{name: "service account token", secret: secret("kubernetes.io/service-account-token", nil, nil), err: "requires the kubernetes.io/service-account.name annotation"},
+		{
+			name:   "bootstrap token",
+			secret: secret("bootstrap.kubernetes.io/token", nil, map[string]interface{}{"token-id": "abc123", "token-secret": "0123456789abcdef"}),
+			check:  true,
+		},
+		{
+			name:   "bootstrap token id",
+			secret: secret("bootstrap.kubernetes.io/token", nil, map[string]interface{}{"token-id": "ABC", "token-secret": "0123456789abcdef"}),
+			check:  true,
+			err:    `"token-id" must be 6 characters`,
+		},
+	}
+
+	for _, tc := range tt {
+		err := validateK8sSecret(tc.secret, tc.check)
+		if tc.err == "" && err != nil {
+			t.Errorf("%v: unexpected error %v", tc.name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%v: expected error %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package hydrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/pkg/errors"
+)
+
+// SSMAPI is the part of the AWS SSM client used by hydrate, implemented by
+// *ssm.Client, ie. to hydrate against a fake in tests without AWS.
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+	GetParameterHistory(ctx context.Context, params *ssm.GetParameterHistoryInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterHistoryOutput, error)
+	DescribeParameters(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error)
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+	GetServiceSetting(ctx context.Context, params *ssm.GetServiceSettingInput, optFns ...func(*ssm.Options)) (*ssm.GetServiceSettingOutput, error)
+}
+
+// ssmProvider fetches secrets from AWS SSM Parameter Store.
+type ssmProvider struct {
+	ssm SSMAPI
+
+	mu       sync.Mutex
+	metadata map[string]Metadata // Metadata of the fetched parameters.
+	frozen   *Lock               // If set, fetch exactly the locked versions.
+	kmsKeyID string              // KMS key of new parameters, aws/ssm if empty.
+
+	// limiter, if set, is the rate limit of the paramStore(s) using the
+	// provider, which its own API calls (ie. suggestions) honor too.
+	limiter *RateLimiter
+
+	logging
+}
+
+// SSMProvider returns a SecretProvider fetching decrypted parameters
+// from AWS SSM Parameter Store, ie. of ssm.NewFromConfig(cfg).
+func SSMProvider(svc SSMAPI) *ssmProvider {
+	return &ssmProvider{
+		ssm:      svc,
+		metadata: map[string]Metadata{},
+	}
+}
+
+// highThroughputSetting is the service setting raising the Parameter Store
+// API quota from 40 to 10,000 requests per second.
+const highThroughputSetting = "/ssm/parameter-store/high-throughput-enabled"
+
+// HighThroughput reports whether higher throughput is enabled for the
+// Parameter Store of the account and region.
+func (p *ssmProvider) HighThroughput(ctx context.Context) (bool, error) {
+	out, err := p.ssm.GetServiceSetting(ctx, &ssm.GetServiceSettingInput{
+		SettingId: aws.String(highThroughputSetting),
+	})
+	if err != nil {
+		return false, errors.Wrap(p.explainError(ctx, err, ""), "failed to get Parameter Store throughput setting")
+	}
+	return aws.ToString(out.ServiceSetting.SettingValue) == "true", nil
+}
+
+// ParamStore returns a hydrator fetching secrets from AWS SSM Parameter Store.
+func ParamStore(svc SSMAPI, basePath string) *paramStore {
+	return New(SSMProvider(svc), basePath)
+}
+
+// Name returns "ssm", see NamedSecretProvider.
+func (p *ssmProvider) Name() string {
+	return "ssm"
+}
+
+// parameterSelector splits the "/app/db_pass:3" (version) or "/app/db_pass#prod"
+// (label) parameter reference into the parameter name and the GetParameter
+// selector, ie. ":3" or ":prod".
+func parameterSelector(key string) (name, selector string) {
+	slash := strings.LastIndex(key, "/")
+	if i := strings.LastIndex(key, "#"); i > slash {
+		return key[:i], ":" + key[i+1:]
+	}
+	if i := strings.LastIndex(key, ":"); i > slash {
+		return key[:i], key[i:]
+	}
+	return key, ""
+}
+
+// referencesByName groups the references, pinned or not, by parameter name,
+// returning the names in the order of the references.
+func referencesByName(paths []string) (names []string, refs map[string][]string) {
+	refs = map[string][]string{}
+	for _, path := range paths {
+		name, _ := parameterSelector(path)
+		if len(refs[name]) == 0 {
+			names = append(names, name)
+		}
+		refs[name] = append(refs[name], path)
+	}
+	return names, refs
+}
+
+// parameterName returns the GetParameter name of the key, with the version
+// or label it's pinned to, if any.
+func (p *ssmProvider) parameterName(key string) (string, error) {
+	if name, selector := parameterSelector(key); selector != "" {
+		return name + selector, nil // Pinned by the reference, even if frozen.
+	}
+	if p.frozen == nil {
+		return key, nil
+	}
+	version, ok := p.frozen.Parameters[key]
+	if !ok {
+		return "", errors.Errorf("%q parameter is not in the lock file, re-run without --frozen to update it", key)
+	}
+	return fmt.Sprintf("%v:%v", key, version), nil
+}
+
+func (p *ssmProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	name, err := p.parameterName(key)
+	if err != nil {
+		return "", err
+	}
+
+	p.log(LevelInfo, "fetching secret", "key", name, "from", "AWS SSM Parameter Store")
+
+	param, err := p.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", errors.Wrapf(p.explainError(ctx, err, key), "failed to fetch %q parameter", name)
+	}
+
+	p.mu.Lock()
+	p.metadata[key] = parameterMetadata(*param.Parameter)
+	p.mu.Unlock()
+
+	return aws.ToString(param.Parameter.Value), nil
+}
+
+// GetSecrets fetches the parameters via GetParameters. Parameters missing
+// from the lock file in frozen mode are omitted as well.
+func (p *ssmProvider) GetSecrets(ctx context.Context, keys []string) (map[string]string, error) {
+	names := make([]string, 0, len(keys))
+	requested := make(map[string]string, len(keys)) // Keys by name.
+	for _, key := range keys {
+		name, err := p.parameterName(key)
+		if err != nil {
+			continue
+		}
+		p.log(LevelInfo, "fetching secret", "key", name, "from", "AWS SSM Parameter Store")
+		names = append(names, name)
+		requested[name] = key
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	out, err := p.ssm.GetParameters(ctx, &ssm.GetParametersInput{
+		Names:          names,
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch parameters")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	secrets := make(map[string]string, len(out.Parameters))
+	for _, param := range out.Parameters {
+		key, ok := requested[aws.ToString(param.Name)+aws.ToString(param.Selector)]
+		if !ok {
+			key = requested[aws.ToString(param.Name)]
+		}
+		secrets[key] = aws.ToString(param.Value)
+		p.metadata[key] = parameterMetadata(param)
+	}
+	return secrets, nil
+}
+
+// GetSecretsByPath fetches all parameters of the path's subtree via
+// GetParametersByPath.
+func (p *ssmProvider) GetSecretsByPath(ctx context.Context, path string) (map[string]string, error) {
+	p.log(LevelInfo, "fetching subtree", "path", path, "from", "AWS SSM Parameter Store")
+
+	secrets := map[string]string{}
+	pages := ssm.NewGetParametersByPathPaginator(p.ssm, &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+	for pages.HasMorePages() {
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(p.explainError(ctx, err, path), "failed to fetch %q parameters", path)
+		}
+
+		p.mu.Lock()
+		for _, param := range out.Parameters {
+			key := aws.ToString(param.Name)
+			secrets[key] = aws.ToString(param.Value)
+			p.metadata[key] = parameterMetadata(param)
+		}
+		p.mu.Unlock()
+	}
+	return secrets, nil
+}
+
+// SetKMSKeyID sets the KMS key used to encrypt parameters stored by
+// PutSecret. Defaults to the aws/ssm key.
+func (p *ssmProvider) SetKMSKeyID(kmsKeyID string) {
+	p.kmsKeyID = kmsKeyID
+}
+
+// PutSecret stores the secret as a SecureString parameter,
+// unless the parameter already exists.
+func (p *ssmProvider) PutSecret(ctx context.Context, key, value string) error {
+	p.log(LevelInfo, "storing secret", "key", key, "into", "AWS SSM Parameter Store")
+
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(key),
+		Value:     aws.String(value),
+		Type:      types.ParameterTypeSecureString,
+		Overwrite: aws.Bool(false),
+	}
+	if p.kmsKeyID != "" {
+		input.KeyId = aws.String(p.kmsKeyID)
+	}
+	out, err := p.ssm.PutParameter(ctx, input)
+	if err != nil {
+		return errors.Wrapf(p.explainError(ctx, err, key), "failed to store %q parameter", key)
+	}
+
+	p.mu.Lock()
+	p.metadata[key] = Metadata{Version: out.Version, LastModified: time.Now(), Type: string(types.ParameterTypeSecureString)}
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Metadata returns the metadata of the parameter, fetching it if needed.
+func (p *ssmProvider) Metadata(ctx context.Context, key string) (Metadata, error) {
+	p.mu.Lock()
+	metadata, ok := p.metadata[key]
+	p.mu.Unlock()
+	if ok {
+		return metadata, nil
+	}
+
+	if _, err := p.GetSecret(ctx, key); err != nil {
+		return Metadata{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.metadata[key], nil
+}
+
+func parameterMetadata(param types.Parameter) Metadata {
+	return Metadata{
+		Version:      param.Version,
+		LastModified: aws.ToTime(param.LastModifiedDate),
+		Type:         string(param.Type),
+		ARN:          aws.ToString(param.ARN),
+	}
+}
+
+// Forget drops the recorded metadata of the parameters.
+func (p *ssmProvider) Forget(keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, key := range keys {
+		delete(p.metadata, key)
+	}
+}
+
+// describeParameters passes the metadata of each of the named parameters
+// that exist to fn, without reading their values.
+func (p *ssmProvider) describeParameters(ctx context.Context, names []string, fn func(p types.ParameterMetadata)) error {
+	// DescribeParameters accepts up to 50 values per filter.
+	for len(names) > 0 {
+		chunk := names
+		if len(chunk) > 50 {
+			chunk = chunk[:50]
+		}
+		names = names[len(chunk):]
+
+		pages := ssm.NewDescribeParametersPaginator(p.ssm, &ssm.DescribeParametersInput{
+			ParameterFilters: []types.ParameterStringFilter{{
+				Key:    aws.String("Name"),
+				Option: aws.String("Equals"),
+				Values: chunk,
+			}},
+		})
+		for pages.HasMorePages() {
+			out, err := pages.NextPage(ctx)
+			if err != nil {
+				return errors.Wrap(p.explainError(ctx, err, ""), "failed to describe parameters")
+			}
+			for _, param := range out.Parameters {
+				fn(param)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package hydrate
+
+import "strings"
+
+// ProviderStats counts the secrets served by a provider, see Stats.
+type ProviderStats struct {
+	Fetched int // Fetched from the provider.
+	Cached  int // Served from the cache dir, see SetCache.
+	Failed  int // Failed to fetch, including secrets that don't exist.
+}
+
+// Stats returns the secrets served so far by the name of each provider,
+// ie. "ssm" or "vault", see NamedSecretProvider.
+func (ps *paramStore) Stats() map[string]ProviderStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	stats := make(map[string]ProviderStats, len(ps.stats))
+	for name, s := range ps.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// count updates the stats of the provider of the "<provider>:<key>" cache key.
+func (ps *paramStore) count(cacheKey string, update func(*ProviderStats)) {
+	name := cacheKey
+	if i := strings.Index(cacheKey, ":"); i >= 0 {
+		name = cacheKey[:i]
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.stats == nil {
+		ps.stats = map[string]*ProviderStats{}
+	}
+	if ps.stats[name] == nil {
+		ps.stats[name] = &ProviderStats{}
+	}
+	update(ps.stats[name])
+}
@@ -0,0 +1,29 @@
+package hydrate
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected map[string]ProviderStats
+	}{
+		{input: "name: app\n", expected: map[string]ProviderStats{}},
+		{input: "a: $SECRET:/app/pass\nb: $SECRET:/app/pass\n", expected: map[string]ProviderStats{"ssm": {Fetched: 1}}},
+		{input: "a: $SECRET:/app/pass\nb: $SECRET:/app/missing\n", expected: map[string]ProviderStats{"ssm": {Fetched: 1, Failed: 1}}},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/pass": "hunter2"})
+
+		var b bytes.Buffer
+		_ = ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if stats := ps.Stats(); !reflect.DeepEqual(stats, tc.expected) {
+			t.Errorf("%q: expected %+v, got %+v", tc.input, tc.expected, stats)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// modifierRe matches references whose fetched value is parsed into a list,
+// ie. "$SECRET:/app/allowed_hosts!list" of a StringList parameter, or an
+// object, ie. "$SECRET:/app/db!json". The modifier goes after any default.
+var modifierRe = regexp.MustCompile(`^(\$\$|\$[A-Z]+\??(?::.*)?)!(list|json|yaml)$`)
+
+// hydrateStructured hydrates the value, if it's a reference with a modifier,
+// into the node of the parsed secret. It returns nil for other values.
+// Encrypted fields, dry runs, redactions, empty secrets and references kept
+// as they are, see SetMissing, hydrate into string scalars.
+func (ps *paramStore) hydrateStructured(ctx context.Context, key, value string, path []string) (*yaml.Node, error) {
+	m := modifierRe.FindStringSubmatch(value)
+	if m == nil {
+		return nil, nil
+	}
+	ref, modifier := m[1], m[2]
+
+	secret, err := ps.hydrateKeyValue(ctx, key, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to hydrate %q field", strings.Join(path, "."))
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	if *secret == ref {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	}
+
+	sealed, err := ps.seal(path, *secret)
+	if err != nil {
+		return nil, err
+	}
+	if sealed != *secret || ps.refs != nil || ps.redaction != RedactNone || *secret == "" || strings.HasPrefix(*secret, missingPrefix) {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: sealed}, nil
+	}
+
+	node, err := parseStructured(*secret, modifier)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to hydrate %q field: %v", strings.Join(path, "."), ref)
+	}
+	return node, nil
+}
+
+// parseStructured parses the secret into a node. Values of !list are split
+// on commas, like StringList parameters are stored.
+func parseStructured(secret, modifier string) (*yaml.Node, error) {
+	switch modifier {
+	case "list":
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range strings.Split(secret, ",") {
+			item := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item}
+			quoteYAML11(item)
+			node.Content = append(node.Content, item)
+		}
+		return node, nil
+
+	case "json":
+		// Never include the secret in the error.
+		if !json.Valid([]byte(secret)) {
+			return nil, errors.New("!json value isn't valid JSON")
+		}
+	}
+
+	// JSON is parsed as YAML too, keeping the key order.
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(secret), &doc); err != nil {
+		return nil, errors.Errorf("!%v value isn't valid YAML", modifier)
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.Errorf("!%v value is empty", modifier)
+	}
+	node := doc.Content[0]
+	blockStyle(node, modifier == "json")
+	return node, nil
+}
+
+// blockStyle resets the flow style of JSON objects and arrays, and the
+// quotes of JSON strings, so that the spliced value is written like the
+// rest of the YAML document.
+func blockStyle(node *yaml.Node, json bool) {
+	node.Style &^= yaml.FlowStyle
+	if json {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		quoteYAML11(node)
+	}
+	for _, n := range node.Content {
+		blockStyle(n, json)
+	}
+}
+
+// structuredValue decodes the hydrated node for maps of decoded documents.
+func structuredValue(node *yaml.Node) (interface{}, error) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		return node.Value, nil
+	}
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "failed to decode structured value")
+	}
+	return v, nil
+}
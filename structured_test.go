@@ -0,0 +1,69 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHydrateStructured(t *testing.T) {
+	params := map[string]string{
+		"/app/hosts": "a.internal,b.internal,yes",
+		"/app/db":    `{"host": "db.internal", "port": 5432, "tls": "on"}`,
+		"/app/tags":  "- web\n- api\n",
+		"/app/bad":   "{not json",
+	}
+	tt := []struct {
+		format   string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			format:   "yaml",
+			input:    "hosts: $SECRET:/app/hosts!list\n",
+			expected: "hosts:\n    - a.internal\n    - b.internal\n    - \"yes\"\n",
+		},
+		{
+			format:   "yaml",
+			input:    "db: $SECRET:/app/db!json\n",
+			expected: "db:\n    host: db.internal\n    port: 5432\n    tls: \"on\"\n",
+		},
+		{
+			format:   "yaml",
+			input:    "tags: $SECRET:/app/tags!yaml\n",
+			expected: "tags:\n    - web\n    - api\n",
+		},
+		{
+			format:   "yaml",
+			input:    "tags: $SECRET:/app/missing|a,b!list\n",
+			expected: "tags:\n    - a\n    - b\n",
+		},
+		{
+			format:   "json",
+			input:    `{"hosts": "$SECRET:/app/hosts!list", "name": "app"}`,
+			expected: `{"hosts": ["a.internal","b.internal","yes"], "name": "app"}` + "\n",
+		},
+		{format: "yaml", input: "db: $SECRET:/app/bad!json\n", err: `failed to hydrate "db" field: $SECRET:/app/bad: !json value isn't valid JSON`},
+	}
+
+	for _, tc := range tt {
+		var b bytes.Buffer
+		err := testStore(t, params).Hydrate(&b, strings.NewReader(tc.input), tc.format, false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			if err != nil && strings.Contains(err.Error(), "not json") {
+				t.Errorf("%q: expected error without the secret, got %v", tc.input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package hydrate
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// hydrateTemplate renders Go text/template files ("tmpl" format), ie.
+//
+//	# db_password version {{ version "db_password" }}, modified {{ (lastModified "db_password").Format "2006-01-02" }}
+//	DB_PASSWORD={{ secret "db_password" }}
+//
+// The variables set by SetVars are available as the template data, ie. {{ .Tenant }}.
+// Secrets are sealed by EncryptFields under their keys, ie. "db_password".
+func (ps *paramStore) hydrateTemplate(ctx context.Context, w io.Writer, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read template")
+	}
+
+	tpl, err := template.New("").Option("missingkey=error").Funcs(template.FuncMap{
+		"secret": func(key string) (string, error) {
+			secret, err := ps.getSecret(ctx, key)
+			if err != nil {
+				return "", ps.suggest(ctx, err)
+			}
+			if ps.refs != nil {
+				// Template references aren't attributed to fields, see FieldReferences.
+				return secret, nil
+			}
+			return ps.seal([]string{key}, secret)
+		},
+		"version": func(key string) (int64, error) {
+			m, err := ps.metadata(ctx, key)
+			return m.Version, err
+		},
+		"lastModified": func(key string) (time.Time, error) {
+			m, err := ps.metadata(ctx, key)
+			return m.LastModified, err
+		},
+		"type": func(key string) (string, error) {
+			m, err := ps.metadata(ctx, key)
+			return m.Type, err
+		},
+		"arn": func(key string) (string, error) {
+			m, err := ps.metadata(ctx, key)
+			return m.ARN, err
+		},
+	}).Parse(string(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse template")
+	}
+
+	ps.mu.Lock()
+	vars := ps.vars
+	ps.mu.Unlock()
+
+	if err := tpl.Execute(w, vars); err != nil {
+		return errors.Wrap(err, "failed to hydrate template")
+	}
+	return nil
+}
+
+// metadata returns the metadata of the key parameter.
+func (ps *paramStore) metadata(ctx context.Context, key string) (Metadata, error) {
+	path, err := ps.paramPath(key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if ps.refs != nil {
+		ps.record(path)
+		return Metadata{}, nil
+	}
+
+	provider, ok := ps.provider.(MetadataProvider)
+	if !ok {
+		return Metadata{}, errors.Errorf("can't get metadata of %q, the secret provider doesn't expose it", path)
+	}
+	return provider.Metadata(ctx, path)
+}
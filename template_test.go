@@ -0,0 +1,72 @@
+package hydrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHydrateTemplate(t *testing.T) {
+	tt := []struct {
+		input    string
+		vars     map[string]interface{}
+		expected string
+		err      string
+	}{
+		{
+			input:    `DB_PASS={{ secret "db_pass" }}` + "\n",
+			expected: "DB_PASS=hunter2\n",
+		},
+		{
+			input:    `# db_pass v{{ version "db_pass" }}, {{ type "/app/db_pass" }}, modified {{ (lastModified "db_pass").UTC.Format "2006-01-02" }}` + "\n",
+			expected: "# db_pass v2, SecureString, modified 2023-11-14\n",
+		},
+		{
+			input:    `{{ arn "db_pass" }}`,
+			expected: "arn:aws:ssm:us-east-1:123456789012:parameter/app/db_pass",
+		},
+		{
+			input:    `{{ .Tenant }}={{ secret "user" }}`,
+			vars:     map[string]interface{}{"Tenant": "acme"},
+			expected: "acme=app",
+		},
+		{input: `{{ .Tenant }}`, err: `map has no entry for key "Tenant"`},
+		{input: `{{ secret "missing" }}`, err: `"/app/missing"`},
+		{input: `{{ version "missing" }}`, err: `"/app/missing"`},
+		{input: `{{ secret`, err: "failed to parse template"},
+	}
+
+	for _, tc := range tt {
+		f, svc := newFakeSSM(t, map[string]string{"/app/user": "app"})
+		f.history = map[string][]string{"/app/db_pass": {"old", "hunter2"}}
+		ps := ParamStore(svc, "/app")
+		if tc.vars != nil {
+			ps.SetVars(tc.vars)
+		} else {
+			ps.SetVars(map[string]interface{}{})
+		}
+
+		var b strings.Builder
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "tmpl", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.input, err)
+			continue
+		}
+		if b.String() != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.input, tc.expected, b.String())
+		}
+	}
+
+	// Providers without metadata can't render metadata functions.
+	ps := New(SecretProviderFunc(func(ctx context.Context, key string) (string, error) { return "s3cr3t", nil }), "/app")
+	var b strings.Builder
+	if err := ps.Hydrate(&b, strings.NewReader(`{{ version "db_pass" }}`), "tmpl", false); err == nil || !strings.Contains(err.Error(), `can't get metadata of "/app/db_pass", the secret provider doesn't expose it`) {
+		t.Errorf("expected metadata error, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package hydrate
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// SetVars sets the variables available in parameter paths, including the
+// base path, as Go text/template expressions, ie. "$SECRET:/app/{{.Tenant}}/db".
+// The cache is keyed by the expanded paths, so it's shared by all vars.
+func (ps *paramStore) SetVars(vars map[string]interface{}) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.vars = vars
+}
+
+func (ps *paramStore) expandPath(key string) (string, error) {
+	if !strings.Contains(key, "{{") {
+		return key, nil
+	}
+
+	tpl, err := template.New(key).Option("missingkey=error").Parse(key)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse %q parameter path", key)
+	}
+
+	ps.mu.Lock()
+	vars := ps.vars
+	ps.mu.Unlock()
+
+	var b strings.Builder
+	if err := tpl.Execute(&b, vars); err != nil {
+		return "", errors.Wrapf(err, "failed to expand %q parameter path", key)
+	}
+	return b.String(), nil
+}
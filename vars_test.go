@@ -0,0 +1,68 @@
+package hydrate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	vars := map[string]interface{}{"Env": "prod", "Tenant": "acme", "Region": map[string]interface{}{"Name": "us-east-1"}}
+	tt := []struct {
+		key      string
+		vars     map[string]interface{}
+		expected string
+		err      string
+	}{
+		{key: "/app/db_pass", expected: "/app/db_pass"},
+		{key: "/app/{{.Env}}/db_pass", vars: vars, expected: "/app/prod/db_pass"},
+		{key: "/{{.Tenant}}/{{.Env}}/{{.Region.Name}}", vars: vars, expected: "/acme/prod/us-east-1"},
+		{key: "/app/{{.Missing}}/db_pass", vars: vars, err: "failed to expand"},
+		{key: "/app/{{.Env}}/db_pass", err: "failed to expand"},
+		{key: "/app/{{.Env/db_pass", vars: vars, err: "failed to parse"},
+	}
+	for _, tc := range tt {
+		ps := testStore(t, nil)
+		ps.SetVars(tc.vars)
+		path, err := ps.expandPath(tc.key)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %q, %v", tc.key, tc.err, path, err)
+			}
+			continue
+		}
+		if err != nil || path != tc.expected {
+			t.Errorf("%q: expected %q, got %q, %v", tc.key, tc.expected, path, err)
+		}
+	}
+}
+
+func TestVarsCache(t *testing.T) {
+	f, svc := newFakeSSM(t, map[string]string{"/acme/db_pass": "acme-pass", "/globex/db_pass": "globex-pass"})
+	ps := ParamStore(svc, "/{{.Tenant}}")
+
+	tt := []struct {
+		tenant   string
+		key      string
+		expected string
+	}{
+		{tenant: "acme", key: "db_pass", expected: "acme-pass"},
+		{tenant: "globex", key: "db_pass", expected: "globex-pass"},
+		{tenant: "acme", key: "/{{.Tenant}}/db_pass", expected: "acme-pass"},
+		{tenant: "globex", key: "/acme/db_pass", expected: "acme-pass"},
+	}
+	for _, tc := range tt {
+		ps.SetVars(map[string]interface{}{"Tenant": tc.tenant})
+		secret, err := ps.GetSecret(tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != tc.expected {
+			t.Errorf("%v %q: expected %q, got %q", tc.tenant, tc.key, tc.expected, secret)
+		}
+	}
+
+	// The cache is keyed by the expanded paths.
+	if n := f.called("GetParameter"); n != 2 {
+		t.Errorf("expected 2 GetParameter calls, got %v", n)
+	}
+}
@@ -0,0 +1,255 @@
+package hydrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VaultConfig configures the HashiCorp Vault provider.
+type VaultConfig struct {
+	Address   string // ie. https://vault.example.com:8200
+	Namespace string // Vault Enterprise namespace, optional.
+
+	// Token authenticates the requests. If empty, a token is obtained
+	// by logging in with the AppRole RoleID and SecretID.
+	Token    string
+	RoleID   string
+	SecretID string
+
+	Client *http.Client // Defaults to http.DefaultClient.
+}
+
+// VaultConfigFromEnv returns the configuration of the $VAULT_ADDR,
+// $VAULT_NAMESPACE, $VAULT_TOKEN, $VAULT_ROLE_ID and $VAULT_SECRET_ID
+// environment variables.
+func VaultConfigFromEnv() VaultConfig {
+	return VaultConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		RoleID:    os.Getenv("VAULT_ROLE_ID"),
+		SecretID:  os.Getenv("VAULT_SECRET_ID"),
+	}
+}
+
+// vaultProvider fetches secrets from HashiCorp Vault KV secrets engines.
+type vaultProvider struct {
+	cfg VaultConfig
+
+	mu      sync.Mutex
+	token   string
+	values  map[string]map[string]interface{} // Data of the fetched paths.
+	expires map[string]time.Time              // Lease expiry of the fetched paths.
+
+	logging
+}
+
+// VaultProvider returns a SecretProvider fetching secrets from HashiCorp
+// Vault KV (v1 or v2) secrets engines. Keys are secret paths followed by
+// "#<key>", ie. "secret/data/app#db_password". Without a key, the whole
+// secret is returned as a JSON object.
+func VaultProvider(cfg VaultConfig) *vaultProvider {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &vaultProvider{
+		cfg:     cfg,
+		token:   cfg.Token,
+		values:  map[string]map[string]interface{}{},
+		expires: map[string]time.Time{},
+	}
+}
+
+// Name returns "vault", see NamedSecretProvider.
+func (p *vaultProvider) Name() string {
+	return "vault"
+}
+
+func (p *vaultProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	path, field := key, ""
+	if i := strings.LastIndex(key, "#"); i >= 0 {
+		path, field = key[:i], key[i+1:]
+	}
+	path = strings.Trim(path, "/")
+
+	data, err := p.read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	var v interface{} = data
+	if field != "" {
+		var ok bool
+		if v, ok = data[field]; !ok {
+			return "", errors.Wrapf(ErrNotFound, "Vault secret %q has no %q key", path, field)
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// read returns the data of the secret path. KV v2 responses are unwrapped
+// from their {"data": {...}, "metadata": {...}} envelope.
+func (p *vaultProvider) read(ctx context.Context, path string) (map[string]interface{}, error) {
+	p.mu.Lock()
+	data, ok := p.values[path]
+	p.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	p.log(LevelInfo, "fetching secret", "key", path, "from", "Vault")
+
+	var resp struct {
+		Data          map[string]interface{} `json:"data"`
+		LeaseDuration int64                  `json:"lease_duration"`
+	}
+	if err := p.do(ctx, "GET", path, nil, &resp); err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %q Vault secret", path)
+	}
+
+	data = resp.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	p.mu.Lock()
+	p.values[path] = data
+	if resp.LeaseDuration > 0 {
+		p.expires[path] = time.Now().Add(time.Duration(resp.LeaseDuration) * time.Second)
+	}
+	p.mu.Unlock()
+
+	return data, nil
+}
+
+// login obtains a token by the AppRole auth method.
+func (p *vaultProvider) login(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	token := p.token
+	p.mu.Unlock()
+	if token != "" {
+		return token, nil
+	}
+	if p.cfg.RoleID == "" {
+		return "", errors.New("Vault token is missing, set $VAULT_TOKEN or $VAULT_ROLE_ID and $VAULT_SECRET_ID")
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	body := map[string]string{"role_id": p.cfg.RoleID, "secret_id": p.cfg.SecretID}
+	if err := p.request(ctx, "POST", "auth/approle/login", "", body, &resp); err != nil {
+		return "", errors.Wrap(err, "failed to log in to Vault via AppRole")
+	}
+
+	p.mu.Lock()
+	p.token = resp.Auth.ClientToken
+	p.mu.Unlock()
+
+	return resp.Auth.ClientToken, nil
+}
+
+func (p *vaultProvider) do(ctx context.Context, method, path string, body, v interface{}) error {
+	token, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	return p.request(ctx, method, path, token, body, v)
+}
+
+func (p *vaultProvider) request(ctx context.Context, method, path, token string, body, v interface{}) error {
+	if p.cfg.Address == "" {
+		return errors.New("Vault address is missing, set $VAULT_ADDR")
+	}
+
+	var r bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&r).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(p.cfg.Address, "/")+"/v1/"+path, &r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errors.Wrapf(ErrNotFound, "%q doesn't exist in Vault", path)
+	case resp.StatusCode >= 300:
+		var verr struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(b, &verr)
+		if len(verr.Errors) > 0 {
+			return errors.Errorf("Vault: %v %v", resp.Status, strings.Join(verr.Errors, "; "))
+		}
+		return errors.Errorf("Vault: %v", resp.Status)
+	}
+
+	return errors.Wrap(json.Unmarshal(b, v), "failed to decode Vault response")
+}
+
+// Forget drops the cached data of the secrets.
+func (p *vaultProvider) Forget(keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, key := range keys {
+		if i := strings.LastIndex(key, "#"); i >= 0 {
+			key = key[:i]
+		}
+		delete(p.values, strings.Trim(key, "/"))
+		delete(p.expires, strings.Trim(key, "/"))
+	}
+}
+
+// Expiry returns when the lease of the key's secret expires, if it has one.
+func (p *vaultProvider) Expiry(key string) time.Time {
+	if i := strings.LastIndex(key, "#"); i >= 0 {
+		key = key[:i]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expires[strings.Trim(key, "/")]
+}
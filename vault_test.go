@@ -0,0 +1,141 @@
+package hydrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// newFakeVault serves the KV secrets by their paths (ie. "secret/data/app")
+// and the AppRole login of the "role" RoleID and "s3cr3t" SecretID.
+func newFakeVault(t *testing.T, secrets map[string]string) (*httptest.Server, *[]string) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		requests = append(requests, r.Method+" "+path)
+
+		if path == "auth/approle/login" {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "s3cr3t" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors": ["invalid role or secret ID"]}`))
+				return
+			}
+			w.Write([]byte(`{"auth": {"client_token": "approle-token"}}`))
+			return
+		}
+
+		if token := r.Header.Get("X-Vault-Token"); token != "token" && token != "approle-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		if ns := r.Header.Get("X-Vault-Namespace"); ns != "" && ns != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": []}`))
+			return
+		}
+		secret, ok := secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+			return
+		}
+		w.Write([]byte(secret))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv, _ := newFakeVault(t, map[string]string{
+		"secret/data/app": `{"data": {"data": {"db_password": "p4ss", "port": 5432}, "metadata": {"version": 3}}}`,
+		"kv/app":          `{"data": {"db_password": "v1"}}`,
+	})
+
+	tt := []struct {
+		cfg      VaultConfig
+		key      string
+		expected string
+		err      string
+		notFound bool
+	}{
+		{cfg: VaultConfig{Token: "token"}, key: "secret/data/app#db_password", expected: "p4ss"},
+		{cfg: VaultConfig{Token: "token"}, key: "/secret/data/app/#port", expected: "5432"},
+		{cfg: VaultConfig{Token: "token"}, key: "secret/data/app", expected: `{"db_password":"p4ss","port":5432}`},
+		{cfg: VaultConfig{Token: "token"}, key: "kv/app#db_password", expected: "v1"},
+		{cfg: VaultConfig{Token: "token", Namespace: "team"}, key: "kv/app#db_password", expected: "v1"},
+		{cfg: VaultConfig{RoleID: "role", SecretID: "s3cr3t"}, key: "kv/app#db_password", expected: "v1"},
+		{cfg: VaultConfig{Token: "token"}, key: "kv/app#missing", err: `Vault secret "kv/app" has no "missing" key`, notFound: true},
+		{cfg: VaultConfig{Token: "token"}, key: "kv/missing#key", err: `"kv/missing" doesn't exist in Vault`, notFound: true},
+		{cfg: VaultConfig{Token: "wrong"}, key: "kv/app#db_password", err: `failed to fetch "kv/app" Vault secret: Vault: 403 Forbidden permission denied`},
+		{cfg: VaultConfig{Token: "token", Namespace: "other"}, key: "kv/app#db_password", err: `Vault: 403 Forbidden`},
+		{cfg: VaultConfig{RoleID: "role", SecretID: "wrong"}, key: "kv/app#db_password", err: `failed to log in to Vault via AppRole: Vault: 400 Bad Request invalid role or secret ID`},
+		{cfg: VaultConfig{}, key: "kv/app#db_password", err: `Vault token is missing, set $VAULT_TOKEN or $VAULT_ROLE_ID and $VAULT_SECRET_ID`},
+	}
+
+	for _, tc := range tt {
+		tc.cfg.Address = srv.URL + "/"
+		secret, err := VaultProvider(tc.cfg).GetSecret(context.Background(), tc.key)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: expected error %q, got %v", tc.key, tc.err, err)
+			}
+			if errors.Is(err, ErrNotFound) != tc.notFound {
+				t.Errorf("%v: expected ErrNotFound to be %v, got %v", tc.key, tc.notFound, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.key, err)
+			continue
+		}
+		if secret != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.key, tc.expected, secret)
+		}
+	}
+
+	if _, err := VaultProvider(VaultConfig{Token: "token"}).GetSecret(context.Background(), "kv/app#db_password"); err == nil || !strings.Contains(err.Error(), "Vault address is missing, set $VAULT_ADDR") {
+		t.Errorf("expected the missing address error, got %v", err)
+	}
+}
+
+func TestVaultBackend(t *testing.T) {
+	srv, requests := newFakeVault(t, map[string]string{
+		"secret/data/app": `{"data": {"data": {"user": "admin", "password": "p4ss"}, "metadata": {}}}`,
+	})
+	vault := VaultProvider(VaultConfig{Address: srv.URL, RoleID: "role", SecretID: "s3cr3t"})
+
+	_, svc := newFakeSSM(t, map[string]string{})
+	ps := ParamStore(svc, "/app")
+	ps.SetBackend("VAULT", vault)
+
+	var b strings.Builder
+	input := "user: $VAULT:secret/data/app#user\npassword: $VAULT:secret/data/app#password\n"
+	if err := ps.Hydrate(&b, strings.NewReader(input), "yaml", false); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "user: admin\npassword: p4ss\n"; b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	// One login, and one read of the secret for both of its keys.
+	expected := []string{"POST auth/approle/login", "GET secret/data/app"}
+	if strings.Join(*requests, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected requests %q, got %q", expected, *requests)
+	}
+
+	vault.Forget("secret/data/app#user")
+	if _, err := vault.GetSecret(context.Background(), "secret/data/app#user"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(*requests); n != 3 {
+		t.Errorf("expected the forgotten secret to be fetched again, got requests %q", *requests)
+	}
+}
@@ -0,0 +1,226 @@
+package hydrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// hydrateYAMLNode hydrates the YAML node tree in place. Unlike decoding into
+// a map, this keeps anchors, aliases and merge keys intact: each anchored
+// node is hydrated exactly once, and the hydrated value is reflected wherever
+// the node's aliases (ie. `<<: *defaults`) expand.
+func (ps *paramStore) hydrateYAMLNode(ctx context.Context, node *yaml.Node, path []string, seen map[*yaml.Node]bool) error {
+	if seen[node] {
+		return nil
+	}
+	seen[node] = true
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := ps.hydrateYAMLNode(ctx, n, path, seen); err != nil {
+				return err
+			}
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				// Let the encoder resolve the tag implicitly, so that
+				// it writes `<<:` rather than `!!merge <<:`.
+				key.Tag = ""
+			}
+
+			switch value.Kind {
+			case yaml.ScalarNode:
+				if err := ps.hydrateYAMLScalar(ctx, value, key.Value, append(path, key.Value)); err != nil {
+					return err
+				}
+				if value.Kind != yaml.ScalarNode && key.LineComment == "" {
+					// Keep the comment on the key's line, above the spliced value.
+					key.LineComment, value.LineComment = value.LineComment, ""
+				}
+
+			case yaml.MappingNode:
+				// Recursively go deeper. This includes inline merge
+				// maps, ie. `<<: {key: $SECRET}`.
+				if err := ps.hydrateYAMLNode(ctx, value, append(path, key.Value), seen); err != nil {
+					return err
+				}
+
+			case yaml.SequenceNode:
+				if err := ps.hydrateYAMLSequence(ctx, value, key.Value, append(path, key.Value), seen); err != nil {
+					return err
+				}
+
+			case yaml.AliasNode:
+				// Aliases, including merge keys `<<: *anchor`, point to
+				// the anchored node, which is hydrated where it's defined.
+			}
+		}
+
+	case yaml.SequenceNode:
+		return ps.hydrateYAMLItems(ctx, node, "", path, seen)
+	}
+
+	return nil
+}
+
+// hydrateYAMLSequence hydrates the items of the sequence, whose string
+// items are hydrated as values of the sequence's key.
+func (ps *paramStore) hydrateYAMLSequence(ctx context.Context, node *yaml.Node, key string, path []string, seen map[*yaml.Node]bool) error {
+	if seen[node] {
+		return nil
+	}
+	seen[node] = true
+
+	return ps.hydrateYAMLItems(ctx, node, key, path, seen)
+}
+
+func (ps *paramStore) hydrateYAMLItems(ctx context.Context, node *yaml.Node, key string, path []string, seen map[*yaml.Node]bool) error {
+	for i, item := range node.Content {
+		itemPath := indexPath(path, i)
+
+		switch item.Kind {
+		case yaml.ScalarNode:
+			if err := ps.hydrateYAMLScalar(ctx, item, key, itemPath); err != nil {
+				return err
+			}
+
+		case yaml.MappingNode:
+			if err := ps.hydrateYAMLNode(ctx, item, itemPath, seen); err != nil {
+				return err
+			}
+
+		case yaml.SequenceNode:
+			if err := ps.hydrateYAMLSequence(ctx, item, key, itemPath, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ps *paramStore) hydrateYAMLScalar(ctx context.Context, node *yaml.Node, key string, path []string) error {
+	if ref, ok := ps.pinned(path); ok {
+		node.Tag, node.Value, node.Style = "!!str", ref, 0 // See PinFields.
+	}
+	if node.Tag == "!!null" {
+		// Null, ie. `key:` or `key: ~`, see SetEmpty.
+		if secret, err := ps.hydrateEmpty(ctx, key); err != nil {
+			return errors.Wrapf(err, "failed to hydrate %q field", strings.Join(path, "."))
+		} else if secret != nil {
+			sealed, err := ps.seal(path, *secret)
+			if err != nil {
+				return err
+			}
+			node.Tag, node.Value, node.Style = "!!str", sealed, 0
+			quoteYAML11(node)
+		}
+		return nil
+	}
+	if node.Tag != "!!str" {
+		return nil
+	}
+	if structured, err := ps.hydrateStructured(ctx, key, node.Value, path); err != nil {
+		return err
+	} else if structured != nil && structured.Kind == yaml.ScalarNode {
+		node.Value = structured.Value
+		quoteYAML11(node)
+		return nil
+	} else if structured != nil {
+		structured.Anchor = node.Anchor
+		structured.HeadComment, structured.LineComment, structured.FootComment = node.HeadComment, node.LineComment, node.FootComment
+		*node = *structured
+		return nil
+	}
+	if secret, err := ps.hydrateKeyValue(ctx, key, node.Value); err != nil {
+		return errors.Wrapf(err, "failed to hydrate %q field", strings.Join(path, "."))
+	} else if secret != nil {
+		sealed, err := ps.seal(path, *secret)
+		if err != nil {
+			return err
+		}
+		node.Value = sealed
+		quoteYAML11(node)
+	}
+	return nil
+}
+
+// yamlScalarTags are the tags of scalars decoded into other types than
+// strings, which are only decoded as strings once hydrated.
+var yamlScalarTags = map[string]bool{"!!null": true, "!!bool": true, "!!int": true, "!!float": true}
+
+// yaml11Re matches strings that YAML 1.2 reads as strings, but YAML 1.1
+// parsers (ie. Kubernetes' and PyYAML) read as booleans or sexagesimal
+// numbers, ie. `on`, `no` or `22:22`.
+var yaml11Re = regexp.MustCompile(`^(?:[yY]|[yY]es|YES|[nN]|[nN]o|NO|[oO]n|ON|[oO]ff|OFF|[-+]?[0-9][0-9_]*(?::[0-5]?[0-9])+(?:\.[0-9_]*)?)$`)
+
+// quoteYAML11 quotes the plain string scalar, if YAML 1.1 would read it as
+// another type. Others, ie. `0755` or `1.10`, are quoted by the encoder.
+func quoteYAML11(node *yaml.Node) {
+	if node.Style == 0 && yaml11Re.MatchString(node.Value) {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+}
+
+// updateYAMLNode sets the string scalars of the node tree to the values of
+// the data decoded from it, after the data was hydrated. The node keeps
+// the scalars as written, ie. `0755` or `1.10`, which re-encoding the
+// decoded data would change to `493` and `1.1`.
+func updateYAMLNode(node *yaml.Node, data interface{}) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			updateYAMLNode(n, data)
+		}
+
+	case yaml.MappingNode:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				key.Tag = "" // See hydrateYAMLNode.
+				continue
+			}
+			if v, ok := m[key.Value]; ok {
+				updateYAMLNode(value, v)
+			}
+		}
+
+	case yaml.SequenceNode:
+		items, _ := data.([]interface{})
+		for i, n := range node.Content {
+			if i < len(items) {
+				updateYAMLNode(n, items[i])
+			}
+		}
+
+	case yaml.ScalarNode:
+		switch v := data.(type) {
+		case string:
+			if node.Tag == "!!str" && node.Value != v {
+				node.Value = v
+				quoteYAML11(node)
+			} else if yamlScalarTags[node.Tag] {
+				// Hydrated null, see SetEmpty, or pinned, see PinFields.
+				node.Tag, node.Value, node.Style = "!!str", v, 0
+				quoteYAML11(node)
+			}
+		case map[string]interface{}, []interface{}:
+			// Spliced by a !list, !json or !yaml reference.
+			var structured yaml.Node
+			if node.Tag == "!!str" && structured.Encode(v) == nil {
+				*node = structured
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package hydrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHydrateYAMLNode(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			input: `defaults: &defaults
+    db_pass: $SECRET:/app/db_pass
+    port: 5432
+stage:
+    <<: *defaults
+    api_key: $$
+prod:
+    <<: *defaults
+`,
+			expected: `defaults: &defaults
+    db_pass: hunter2
+    port: 5432
+stage:
+    <<: *defaults
+    api_key: k3y
+prod:
+    <<: *defaults
+`,
+		},
+		{
+			input: `stage:
+    <<: {db_pass: $SECRET:/app/db_pass}
+    user: $SECRET:/app/user
+`,
+			expected: `stage:
+    <<: {db_pass: hunter2}
+    user: app
+`,
+		},
+		{
+			input: `pass: &pass $SECRET:/app/db_pass
+copy: *pass
+`,
+			expected: `pass: &pass hunter2
+copy: *pass
+`,
+		},
+		{
+			input:    "a: $$\n---\nb: $SECRET:/app/user\n",
+			expected: "a: hunter2\n---\nb: app\n",
+		},
+		{
+			input: "db:\n    missing: $SECRET:/app/missing\n",
+			err:   `failed to hydrate "db.missing" field`,
+		},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{"/app/db_pass": "hunter2", "/app/api_key": "k3y", "/app/user": "app", "/app/a": "hunter2"})
+
+		var b bytes.Buffer
+		err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", false)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, b.String())
+		}
+	}
+}
+
+func TestHydrateYAMLScalars(t *testing.T) {
+	tt := []struct {
+		input    string
+		k8s      bool
+		expected string
+	}{
+		{
+			input:    "mode: 0755\nversion: 1.10\nenabled: yes\npass: $SECRET:/app/db_pass\n",
+			expected: "mode: 0755\nversion: 1.10\nenabled: yes\npass: hunter2\n",
+		},
+		{
+			input:    "a: $SECRET:/app/on\nb: $SECRET:/app/no\nc: $SECRET:/app/time\nd: $SECRET:/app/octal\ne: $SECRET:/app/words\n",
+			expected: "a: \"on\"\nb: \"no\"\nc: \"22:22\"\nd: \"0755\"\ne: two words\n",
+		},
+		{
+			input:    "a: '$SECRET:/app/on'\n",
+			expected: "a: 'on'\n",
+		},
+		{
+			input:    "kind: ConfigMap\nmetadata:\n  name: app\ndata:\n  mode: \"0755\"\n  enabled: $SECRET:/app/on\n  pass: $SECRET:/app/db_pass\n",
+			k8s:      true,
+			expected: "kind: ConfigMap\nmetadata:\n    name: app\ndata:\n    mode: \"0755\"\n    enabled: \"on\"\n    pass: hunter2\n",
+		},
+		{
+			input:    "kind: Secret\nmetadata:\n  name: app\n  annotations:\n    replicas: 010\nstringData:\n  pass: $SECRET:/app/db_pass\n",
+			k8s:      true,
+			expected: "kind: Secret\nmetadata:\n    name: app\n    annotations:\n        replicas: 010\nstringData:\n    pass: hunter2\n",
+		},
+	}
+
+	for _, tc := range tt {
+		ps := testStore(t, map[string]string{
+			"/app/db_pass": "hunter2",
+			"/app/on":      "on",
+			"/app/no":      "no",
+			"/app/time":    "22:22",
+			"/app/octal":   "0755",
+			"/app/words":   "two words",
+		})
+
+		var b strings.Builder
+		if err := ps.Hydrate(&b, strings.NewReader(tc.input), "yaml", tc.k8s); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, b.String())
+		}
+	}
+}